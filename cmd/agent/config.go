@@ -11,20 +11,51 @@ import (
 	"github.com/caarlos0/env/v10"
 	"github.com/dlomanov/mon/internal/apps/agent"
 	"github.com/dlomanov/mon/internal/apps/agent/collector"
+	"github.com/dlomanov/mon/internal/apps/agent/relabel"
+	httpclient "github.com/dlomanov/mon/internal/apps/agent/reporter/clients/http"
+	"github.com/dlomanov/mon/internal/apps/agent/reporter/identity"
 	"gopkg.in/yaml.v2"
 )
 
-type rawConfig struct {
-	Addr           string `json:"address" env:"ADDRESS"`
-	GRPCAddr       string `json:"grpc_address" env:"GRPC_ADDRESS"`
-	PollInterval   uint64 `json:"poll_interval" env:"POLL_INTERVAL"`
-	ReportInterval uint64 `json:"report_interval" env:"REPORT_INTERVAL"`
-	Key            string `json:"key" env:"KEY"`
-	RateLimit      uint64 `json:"rate_limit" env:"RATE_LIMIT"`
-	LogLevel       string `json:"log_level" env:"LOG_LEVEL"`
-	PublicKeyPath  string `json:"crypto_key" env:"CRYPTO_KEY"`
-	ConfigPath     string `json:"config" env:"CONFIG"`
-}
+type (
+	rawConfig struct {
+		Addr           string                        `json:"address" env:"ADDRESS"`
+		GRPCAddr       string                        `json:"grpc_address" env:"GRPC_ADDRESS"`
+		PollInterval   uint64                        `json:"poll_interval" env:"POLL_INTERVAL"`
+		ReportInterval uint64                        `json:"report_interval" env:"REPORT_INTERVAL"`
+		Key            string                        `json:"key" env:"KEY"`
+		RateLimit      uint64                        `json:"rate_limit" env:"RATE_LIMIT"`
+		LogLevel       string                        `json:"log_level" env:"LOG_LEVEL"`
+		PublicKeyPath  string                        `json:"crypto_key" env:"CRYPTO_KEY"`
+		ConfigPath     string                        `json:"config" env:"CONFIG"`
+		CgroupRoot     string                        `json:"cgroup_root" env:"CGROUP_ROOT"`
+		Aggregate      bool                          `json:"aggregate" env:"AGGREGATE"`
+		Align          bool                          `json:"align" env:"ALIGN"`
+		StartJitter    uint64                        `json:"start_jitter" env:"START_JITTER"`
+		ReportJitter   uint64                        `json:"report_jitter" env:"REPORT_JITTER"`
+		Collectors     map[string]rawCollectorConfig `json:"collectors"`
+		Relabel        []rawRelabelRule              `json:"relabel"`
+		Compression    string                        `json:"compression" env:"COMPRESSION"`
+		CompressionLvl int                           `json:"compression_level" env:"COMPRESSION_LEVEL"`
+		CompressionMin int                           `json:"compression_min_size" env:"COMPRESSION_MIN_SIZE"`
+		SourceIP       string                        `json:"source_ip" env:"SOURCE_IP"`
+		SourceIface    string                        `json:"source_interface" env:"SOURCE_INTERFACE"`
+		AgentID        string                        `json:"agent_id" env:"AGENT_ID"`
+		Buckets        []float64                     `json:"histogram_buckets" env:"HISTOGRAM_BUCKETS"`
+		SummaryAcc     float64                       `json:"summary_accuracy" env:"SUMMARY_ACCURACY"`
+	}
+	rawCollectorConfig struct {
+		PollInterval   uint64 `json:"poll_interval"`
+		ReportInterval uint64 `json:"report_interval"`
+		Aggregate      *bool  `json:"aggregate"`
+	}
+	rawRelabelRule struct {
+		Action      string  `json:"action"`
+		Regex       string  `json:"regex"`
+		Replacement string  `json:"replacement"`
+		Factor      float64 `json:"factor"`
+	}
+)
 
 //go:embed config.json
 var configFS embed.FS
@@ -90,6 +121,18 @@ func (r *rawConfig) readFlags() {
 	flag.StringVar(&r.PublicKeyPath, "crypto-key", r.PublicKeyPath, "public key PEM path")
 	flag.StringVar(&r.ConfigPath, "config", r.ConfigPath, "config path")
 	flag.StringVar(&r.ConfigPath, "c", r.ConfigPath, "config path (shorthand)")
+	flag.StringVar(&r.CgroupRoot, "cgroup_root", r.CgroupRoot, "cgroup directory for container metrics, empty disables")
+	flag.BoolVar(&r.Aggregate, "aggregate", r.Aggregate, "report min/max/avg/count of gauges sampled between reports")
+	flag.BoolVar(&r.Align, "align", r.Align, "poll and report on wall-clock multiples of intervals")
+	flag.Uint64Var(&r.StartJitter, "start_jitter", r.StartJitter, "max random delay of the first poll in seconds")
+	flag.Uint64Var(&r.ReportJitter, "report_jitter", r.ReportJitter, "max random delay of reports in seconds")
+	flag.StringVar(&r.Compression, "compression", r.Compression, "request compression: gzip, zstd or snappy")
+	flag.IntVar(&r.CompressionLvl, "compression_level", r.CompressionLvl, "request compression level, 0 selects the default")
+	flag.IntVar(&r.CompressionMin, "compression_min_size", r.CompressionMin, "min request body size in bytes to compress")
+	flag.StringVar(&r.SourceIP, "source_ip", r.SourceIP, "reported source IP, detected from the server connection if empty")
+	flag.StringVar(&r.SourceIface, "source_interface", r.SourceIface, "network interface to take the reported source IP from")
+	flag.StringVar(&r.AgentID, "agent_id", r.AgentID, "reported agent ID")
+	flag.Float64Var(&r.SummaryAcc, "summary_accuracy", r.SummaryAcc, "relative accuracy of summary quantiles")
 	flag.Parse()
 }
 
@@ -110,16 +153,54 @@ func (r *rawConfig) print() error {
 }
 
 func (r *rawConfig) toConfig() agent.Config {
+	collectors := make(map[string]collector.Config, len(r.Collectors))
+	for name, c := range r.Collectors {
+		collectors[name] = collector.Config{
+			PollInterval:   time.Duration(c.PollInterval) * time.Second,
+			ReportInterval: time.Duration(c.ReportInterval) * time.Second,
+			Aggregate:      c.Aggregate,
+		}
+	}
+
+	rules := make([]relabel.Rule, 0, len(r.Relabel))
+	for _, v := range r.Relabel {
+		rules = append(rules, relabel.Rule{
+			Action:      relabel.Action(v.Action),
+			Regex:       v.Regex,
+			Replacement: v.Replacement,
+			Factor:      v.Factor,
+		})
+	}
+
 	return agent.Config{
 		CollectorConfig: collector.Config{
-			PollInterval:   time.Duration(r.PollInterval) * time.Second,
-			ReportInterval: time.Duration(r.ReportInterval) * time.Second,
+			PollInterval:    time.Duration(r.PollInterval) * time.Second,
+			ReportInterval:  time.Duration(r.ReportInterval) * time.Second,
+			CgroupRoot:      r.CgroupRoot,
+			Aggregate:       &r.Aggregate,
+			Align:           &r.Align,
+			StartJitter:     time.Duration(r.StartJitter) * time.Second,
+			ReportJitter:    time.Duration(r.ReportJitter) * time.Second,
+			Buckets:         r.Buckets,
+			SummaryAccuracy: r.SummaryAcc,
 		},
+		Collectors:    collectors,
+		Relabel:       rules,
 		Addr:          r.Addr,
 		GRPCAddr:      r.GRPCAddr,
 		HashKey:       r.Key,
 		RateLimit:     r.RateLimit,
 		PublicKeyPath: r.PublicKeyPath,
 		LogLevel:      r.LogLevel,
+		Compression: httpclient.Compression{
+			Algorithm: r.Compression,
+			Level:     r.CompressionLvl,
+			MinSize:   r.CompressionMin,
+		},
+		Identity: identity.Config{
+			IP:        r.SourceIP,
+			Interface: r.SourceIface,
+			AgentID:   r.AgentID,
+		},
 	}
 }
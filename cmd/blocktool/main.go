@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dlomanov/mon/internal/infra/storage/block"
+)
+
+const usage = `Usage: blocktool <command> <file> [args]
+
+Commands:
+  info <file>        print the header, series count, time range, sizes and compression ratio
+  ls <file>          print index entries
+  dump <file> <key>  print points of the series
+  verify <file>      verify checksums and decode every series
+`
+
+// main is the entry point of the block inspection tool.
+// It opens the block file given as the second argument and runs the command given as the first one.
+func main() {
+	flag.Usage = func() { _, _ = fmt.Fprint(flag.CommandLine.Output(), usage) }
+	flag.Parse()
+	if flag.NArg() < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(os.Stdout, flag.Arg(0), flag.Arg(1), flag.Args()[2:]); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "blocktool:", err)
+		os.Exit(1)
+	}
+}
+
+func run(out io.Writer, command, path string, args []string) error {
+	r, err := block.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = r.Close() }()
+
+	switch command {
+	case "info":
+		return info(out, r)
+	case "ls":
+		return ls(out, r)
+	case "dump":
+		if len(args) != 1 {
+			return errors.New("dump requires a series key")
+		}
+		return dump(out, r, args[0])
+	case "verify":
+		return verify(out, r)
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+func info(out io.Writer, r *block.Reader) error {
+	var points, chunks, payloads, raw int64
+	var minT, maxT int64 = math.MaxInt64, math.MinInt64
+	for _, e := range r.Index() {
+		points += int64(e.Points)
+		chunks += e.ChunkLen
+		payloads += e.PayloadLen
+		// uncompressed points are a timestamp and a value of every column
+		raw += int64(e.Points) * int64(8+8*e.Columns)
+		if e.Points > 0 {
+			minT, maxT = min(minT, e.MinT), max(maxT, e.MaxT)
+		}
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(w, "version:\t%d\n", r.Version())
+	_, _ = fmt.Fprintf(w, "series:\t%d\n", len(r.Index()))
+	_, _ = fmt.Fprintf(w, "points:\t%d\n", points)
+	if points > 0 {
+		_, _ = fmt.Fprintf(w, "time range:\t%s - %s\n", formatTime(minT), formatTime(maxT))
+	}
+	_, _ = fmt.Fprintf(w, "file size:\t%d\n", r.Size())
+	_, _ = fmt.Fprintf(w, "chunks size:\t%d\n", chunks)
+	_, _ = fmt.Fprintf(w, "payloads size:\t%d\n", payloads)
+	_, _ = fmt.Fprintf(w, "index and footer size:\t%d\n", r.Size()-chunks-payloads-int64(block.HeaderSize))
+	if chunks > 0 {
+		_, _ = fmt.Fprintf(w, "compression ratio:\t%.2f\n", float64(raw)/float64(chunks))
+	}
+	return w.Flush()
+}
+
+func ls(out io.Writer, r *block.Reader) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "KEY\tCOLUMNS\tPOINTS\tMIN TIME\tMAX TIME\tOFFSET\tCHUNK\tPAYLOAD\tCRC")
+	for _, e := range r.Index() {
+		_, _ = fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%d\t%d\t%d\t%08x\n",
+			e.Key, e.Columns, e.Points, formatTime(e.MinT), formatTime(e.MaxT),
+			e.Offset, e.ChunkLen, e.PayloadLen, e.CRC)
+	}
+	return w.Flush()
+}
+
+// dump prints points of the series, values are printed as floats and raw 64-bit patterns,
+// since the meaning of a column is defined by the writer.
+func dump(out io.Writer, r *block.Reader, key string) error {
+	e, ok := r.Lookup(key)
+	if !ok {
+		return fmt.Errorf("series %q not found", key)
+	}
+	s, err := r.Series(e)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, p := range s.Points {
+		_, _ = fmt.Fprint(w, formatTime(p.T))
+		for _, v := range p.V {
+			_, _ = fmt.Fprintf(w, "\t%g (%#x)", math.Float64frombits(v), v)
+		}
+		_, _ = fmt.Fprintln(w)
+	}
+	if len(s.Payload) > 0 {
+		_, _ = fmt.Fprintf(w, "payload:\t%s\n", s.Payload)
+	}
+	return w.Flush()
+}
+
+func verify(out io.Writer, r *block.Reader) error {
+	failed := 0
+	for _, e := range r.Index() {
+		if _, err := r.Series(e); err != nil {
+			_, _ = fmt.Fprintln(out, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d series are corrupted", failed, len(r.Index()))
+	}
+	_, _ = fmt.Fprintf(out, "ok: %d series\n", len(r.Index()))
+	return nil
+}
+
+func formatTime(ns int64) string {
+	return time.Unix(0, ns).UTC().Format(time.RFC3339Nano)
+}
@@ -12,21 +12,39 @@ import (
 	"github.com/caarlos0/env/v10"
 	"github.com/dlomanov/mon/internal/apps/server"
 	"github.com/dlomanov/mon/internal/apps/server/container"
+	"github.com/dlomanov/mon/internal/entities"
 	"gopkg.in/yaml.v2"
 )
 
 type rawConfig struct {
-	Addr            string `json:"address" env:"ADDRESS"`
-	GRPCAddr        string `json:"grpc_address" env:"GRPC_ADDRESS"`
-	LogLevel        string `json:"log_level" env:"LOG_LEVEL"`
-	StoreInterval   uint64 `json:"store_interval" env:"STORE_INTERVAL"`
-	FileStoragePath string `json:"file_storage_path" env:"FILE_STORAGE_PATH"`
-	Restore         bool   `json:"restore" env:"RESTORE"`
-	DatabaseDSN     string `json:"database_dsn" env:"DATABASE_DSN"`
-	Key             string `json:"key" env:"KEY"`
-	PrivateKeyPath  string `json:"crypto_key" env:"CRYPTO_KEY"`
-	ConfigPath      string `json:"config" env:"CONFIG"`
-	TrustedSubnet   string `json:"trusted_subnet" env:"TRUSTED_SUBNET"`
+	Addr                  string `json:"address" env:"ADDRESS"`
+	GRPCAddr              string `json:"grpc_address" env:"GRPC_ADDRESS"`
+	LogLevel              string `json:"log_level" env:"LOG_LEVEL"`
+	StoreInterval         uint64 `json:"store_interval" env:"STORE_INTERVAL"`
+	FileStoragePath       string `json:"file_storage_path" env:"FILE_STORAGE_PATH"`
+	Restore               bool   `json:"restore" env:"RESTORE"`
+	DatabaseDSN           string `json:"database_dsn" env:"DATABASE_DSN"`
+	SkipMigration         bool   `json:"skip_migration" env:"SKIP_MIGRATION"`
+	MaxOpenConns          uint64 `json:"database_max_open_conns" env:"DATABASE_MAX_OPEN_CONNS"`
+	MaxIdleConns          uint64 `json:"database_max_idle_conns" env:"DATABASE_MAX_IDLE_CONNS"`
+	ConnMaxLifetime       uint64 `json:"database_conn_max_lifetime" env:"DATABASE_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime       uint64 `json:"database_conn_max_idle_time" env:"DATABASE_CONN_MAX_IDLE_TIME"`
+	Key                   string `json:"key" env:"KEY"`
+	PrivateKeyPath        string `json:"crypto_key" env:"CRYPTO_KEY"`
+	AllowLegacyEncryption bool   `json:"allow_legacy_encryption" env:"ALLOW_LEGACY_ENCRYPTION"`
+	ConfigPath            string `json:"config" env:"CONFIG"`
+	TrustedSubnet         string `json:"trusted_subnet" env:"TRUSTED_SUBNET"`
+	AdminToken            string `json:"admin_token" env:"ADMIN_TOKEN" yaml:"-"`
+	TTL                   string `json:"ttl" env:"TTL"`
+	TTLGrace              uint64 `json:"ttl_grace" env:"TTL_GRACE"`
+	SweepInterval         uint64 `json:"sweep_interval" env:"SWEEP_INTERVAL"`
+	CounterOverflow       string `json:"counter_overflow" env:"COUNTER_OVERFLOW"`
+	HistorySize           uint64 `json:"history_size" env:"HISTORY_SIZE"`
+	Retention             string `json:"retention" env:"RETENTION"`
+	CompactInterval       uint64 `json:"compact_interval" env:"COMPACT_INTERVAL"`
+	BackupDir             string `json:"backup_dir" env:"BACKUP_DIR"`
+	BackupInterval        uint64 `json:"backup_interval" env:"BACKUP_INTERVAL"`
+	BackupKeep            uint64 `json:"backup_keep" env:"BACKUP_KEEP"`
 }
 
 //go:embed config.json
@@ -90,11 +108,28 @@ func (r *rawConfig) readFlags() {
 	flag.StringVar(&r.FileStoragePath, "f", r.FileStoragePath, "file storage path")
 	flag.BoolVar(&r.Restore, "r", r.Restore, "restore metrics from file at server start")
 	flag.StringVar(&r.DatabaseDSN, "d", r.DatabaseDSN, "database DSN")
+	flag.BoolVar(&r.SkipMigration, "skip_migration", r.SkipMigration, "check the database schema at server start instead of migrating it")
+	flag.Uint64Var(&r.MaxOpenConns, "database_max_open_conns", r.MaxOpenConns, "maximum number of open database connections, 0 is unlimited")
+	flag.Uint64Var(&r.MaxIdleConns, "database_max_idle_conns", r.MaxIdleConns, "maximum number of idle database connections, 0 keeps the driver default")
+	flag.Uint64Var(&r.ConnMaxLifetime, "database_conn_max_lifetime", r.ConnMaxLifetime, "maximum database connection lifetime in seconds, 0 is unlimited")
+	flag.Uint64Var(&r.ConnMaxIdleTime, "database_conn_max_idle_time", r.ConnMaxIdleTime, "maximum database connection idle time in seconds, 0 is unlimited")
 	flag.StringVar(&r.Key, "k", r.Key, "hashing key")
 	flag.StringVar(&r.PrivateKeyPath, "crypto-key", r.PrivateKeyPath, "private key PEM path")
+	flag.BoolVar(&r.AllowLegacyEncryption, "allow_legacy_encryption", r.AllowLegacyEncryption, "accept metrics encrypted in the unauthenticated legacy format")
 	flag.StringVar(&r.ConfigPath, "config", r.ConfigPath, "config path")
 	flag.StringVar(&r.ConfigPath, "c", r.ConfigPath, "config path (shorthand)")
 	flag.StringVar(&r.TrustedSubnet, "t", r.TrustedSubnet, "trusted subtnet (CIDR)")
+	flag.StringVar(&r.TTL, "ttl", r.TTL, "comma-separated metric TTLs as <type or name pattern>=<duration>, e.g. gauge=24h,host-*=1h")
+	flag.Uint64Var(&r.TTLGrace, "ttl_grace", r.TTLGrace, "seconds a stale metric is kept before eviction")
+	flag.Uint64Var(&r.SweepInterval, "sweep_interval", r.SweepInterval, "expired metrics eviction interval in seconds")
+	flag.StringVar(&r.CounterOverflow, "counter_overflow", r.CounterOverflow, "counter overflow policy: clamp or error")
+	flag.Uint64Var(&r.HistorySize, "history_size", r.HistorySize, "number of points kept per metric by in-memory history, 0 disables it")
+	flag.StringVar(&r.Retention, "retention", r.Retention, "comma-separated history tiers as <resolution or raw>=<retention>, e.g. raw=24h,1m=30d,1h=365d")
+	flag.Uint64Var(&r.CompactInterval, "compact_interval", r.CompactInterval, "history compaction interval in seconds")
+	flag.StringVar(&r.BackupDir, "backup_dir", r.BackupDir, "scheduled backups directory, scheduled backups are disabled if empty")
+	flag.Uint64Var(&r.BackupInterval, "backup_interval", r.BackupInterval, "scheduled backup interval in seconds")
+	flag.Uint64Var(&r.BackupKeep, "backup_keep", r.BackupKeep, "number of latest scheduled backups kept, 0 keeps all")
+	flag.StringVar(&r.AdminToken, "admin_token", r.AdminToken, "admin operations token, admin operations are disabled if empty")
 	flag.Parse()
 }
 
@@ -120,10 +155,44 @@ func (r *rawConfig) toConfig() server.Config {
 		FileStoragePath: r.FileStoragePath,
 		Restore:         r.Restore,
 		DatabaseDSN:     r.DatabaseDSN,
-		Key:             r.Key,
-		Addr:            r.Addr,
-		GRPCAddr:        r.GRPCAddr,
-		PrivateKeyPath:  r.PrivateKeyPath,
+		SkipMigration:   r.SkipMigration,
+		DatabasePool: container.DatabasePool{
+			MaxOpenConns:    int(r.MaxOpenConns),
+			MaxIdleConns:    int(r.MaxIdleConns),
+			ConnMaxLifetime: time.Duration(r.ConnMaxLifetime) * time.Second,
+			ConnMaxIdleTime: time.Duration(r.ConnMaxIdleTime) * time.Second,
+		},
+		Key:                   r.Key,
+		Addr:                  r.Addr,
+		GRPCAddr:              r.GRPCAddr,
+		PrivateKeyPath:        r.PrivateKeyPath,
+		AllowLegacyEncryption: r.AllowLegacyEncryption,
+		AdminToken:            r.AdminToken,
+		SweepInterval:         time.Duration(r.SweepInterval) * time.Second,
+		HistorySize:           int(r.HistorySize),
+		CompactInterval:       time.Duration(r.CompactInterval) * time.Second,
+		BackupDir:             r.BackupDir,
+		BackupInterval:        time.Duration(r.BackupInterval) * time.Second,
+		BackupKeep:            int(r.BackupKeep),
+	}
+
+	rules, err := entities.ParseTTLRules(r.TTL)
+	if err != nil {
+		panic(err)
+	}
+	cfg.Expiry = entities.Expiry{
+		Rules: rules,
+		Grace: time.Duration(r.TTLGrace) * time.Second,
+	}
+
+	cfg.Retention, err = entities.ParseRetention(r.Retention)
+	if err != nil {
+		panic(err)
+	}
+
+	cfg.CounterOverflow, err = entities.ParseOverflowPolicy(r.CounterOverflow)
+	if err != nil {
+		panic(err)
 	}
 
 	if r.TrustedSubnet != "" {
@@ -2,11 +2,13 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"github.com/dlomanov/mon/internal/infra/logging"
 	"log"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
 
 	"github.com/dlomanov/mon/internal/apps/server"
 )
@@ -25,6 +27,10 @@ var (
 // 4. Runs the server with the loaded configuration, handling incoming requests.
 // 5. If an error occurs during the server startup or while running, it logs the error and terminates the application.
 // 6. Gracefully shuts down the server upon receiving an interrupt signal (e.g., SIGINT or SIGTERM).
+//
+// Instead of serving, "backup <file>" writes the storage to a backup archive,
+// "restore <file>" replaces the storage contents with the archive ones
+// and "migrate [up | down [steps] | to <version> | version]" runs database schema migrations.
 func main() {
 	fmt.Printf("Build version: %s\n", buildVersion)
 	fmt.Printf("Build date: %s\n", buildDate)
@@ -32,14 +38,29 @@ func main() {
 
 	cfg := getConfig()
 
-	go func() { log.Println(http.ListenAndServe("localhost:6061", nil)) }()
-
 	logger, err := logging.WithLevel(cfg.LogLevel)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	err = server.Run(context.Background(), cfg, logger)
+	switch cmd := flag.Arg(0); cmd {
+	case "":
+		go func() { log.Println(http.ListenAndServe("localhost:6061", nil)) }()
+		err = server.Run(context.Background(), cfg, logger)
+	case "backup", "restore":
+		if flag.NArg() != 2 {
+			log.Fatalf("usage: %s [flags] %s <file>", os.Args[0], cmd)
+		}
+		if cmd == "backup" {
+			err = server.Backup(context.Background(), cfg, logger, flag.Arg(1))
+		} else {
+			err = server.Restore(context.Background(), cfg, logger, flag.Arg(1))
+		}
+	case "migrate":
+		err = server.Migrate(context.Background(), cfg, logger, flag.Args()[1:])
+	default:
+		log.Fatalf("unknown command %q, expected backup, restore or migrate", cmd)
+	}
 	if err != nil {
 		panic(err)
 	}
@@ -2,9 +2,12 @@ package agent
 
 import (
 	"context"
+	"github.com/dlomanov/mon/internal/apps/agent/relabel"
 	"github.com/dlomanov/mon/internal/apps/agent/reporter"
 	grpcclient "github.com/dlomanov/mon/internal/apps/agent/reporter/clients/grpc"
 	httpclient "github.com/dlomanov/mon/internal/apps/agent/reporter/clients/http"
+	"github.com/dlomanov/mon/internal/apps/agent/reporter/identity"
+	"github.com/dlomanov/mon/internal/entities"
 	"github.com/dlomanov/mon/internal/infra/logging"
 	"os"
 	"os/signal"
@@ -26,6 +29,12 @@ func Run(cfg Config) (err error) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	proc, err := relabel.New(logger, cfg.Relabel)
+	if err != nil {
+		logger.Error("failed to create relabel processor", zap.Error(err))
+		return err
+	}
+
 	rc, err := createReportClient(logger, cfg)
 	if err != nil {
 		logger.Error("failed to create report client", zap.Error(err))
@@ -34,8 +43,10 @@ func Run(cfg Config) (err error) {
 	r := reporter.NewReporter(logger, cfg.RateLimit, rc)
 	defer r.Close()
 
-	go jobs.CollectMetrics(ctx, cfg.CollectorConfig, logger, r.Enqueue)
-	go jobs.CollectAdvancedMetrics(ctx, cfg.CollectorConfig, logger, r.Enqueue)
+	report := func(metrics map[string]entities.Metric) { r.Enqueue(proc.Process(metrics)) }
+	go jobs.CollectMetrics(ctx, cfg.Collector(jobs.NameRuntime), logger, report)
+	go jobs.CollectAdvancedMetrics(ctx, cfg.Collector(jobs.NameSystem), logger, report)
+	go jobs.CollectContainerMetrics(ctx, cfg.Collector(jobs.NameContainer), logger, report)
 
 	<-catchTerminate(logger, func() { cancel() })
 	logger.Debug("agent stopped")
@@ -63,12 +74,24 @@ func catchTerminate(logger *zap.Logger, onTerminate func()) chan struct{} {
 }
 
 func createReportClient(logger *zap.Logger, cfg Config) (reporter.Client, error) {
+	idCfg := cfg.Identity
+	idCfg.ServerAddr = cfg.Addr
+	if cfg.GRPCAddr != "" {
+		idCfg.ServerAddr = cfg.GRPCAddr
+	}
+	id, err := identity.New(idCfg)
+	if err != nil {
+		return nil, err
+	}
+
 	if cfg.GRPCAddr != "" {
-		return grpcclient.New(logger, cfg.GRPCAddr)
+		return grpcclient.New(logger, cfg.GRPCAddr, id)
 	}
 	return httpclient.New(logger, httpclient.Config{
 		Addr:          cfg.Addr,
 		PublicKeyPath: cfg.PublicKeyPath,
 		HashKey:       cfg.HashKey,
+		Compression:   cfg.Compression,
+		Identity:      id,
 	}, nil)
 }
@@ -0,0 +1,389 @@
+// Package cgroup reads container resource usage from the cgroup filesystem.
+//
+// The reader expects root to be the cgroup directory of the container itself,
+// which is what a container sees at /sys/fs/cgroup with a private cgroup
+// namespace (cgroup v2) or with per-controller bind mounts (cgroup v1).
+// Both hierarchies are normalized to the same set of metric names.
+package cgroup
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultRoot is the usual cgroup mount point inside a container.
+const DefaultRoot = "/sys/fs/cgroup"
+
+// v1Unlimited is the smallest value cgroup v1 reports for an unset limit (page-aligned MaxInt64).
+const v1Unlimited = uint64(1) << 62
+
+var ErrNotDetected = errors.New("cgroup hierarchy not detected")
+
+// Version is a cgroup hierarchy version.
+type Version int
+
+const (
+	VersionUnknown Version = 0
+	V1             Version = 1
+	V2             Version = 2
+)
+
+type (
+	// Stats is a normalized snapshot of cgroup resource usage.
+	// Gauges hold instantaneous values, Counters hold cumulative values
+	// that only grow during the cgroup lifetime.
+	// Files missing from the hierarchy produce no entries.
+	Stats struct {
+		Gauges   map[string]float64
+		Counters map[string]uint64
+	}
+
+	// Reader reads Stats from a cgroup directory.
+	Reader struct {
+		root    string
+		version Version
+	}
+)
+
+// Detect returns the cgroup hierarchy version mounted at root.
+func Detect(root string) Version {
+	if exists(filepath.Join(root, "cgroup.controllers")) {
+		return V2
+	}
+	if exists(filepath.Join(root, "memory")) || exists(filepath.Join(root, "cpuacct")) || exists(filepath.Join(root, "cpu,cpuacct")) {
+		return V1
+	}
+	return VersionUnknown
+}
+
+// NewReader creates a Reader for the cgroup directory at root.
+// Returns ErrNotDetected if root holds neither a v1 nor a v2 hierarchy.
+func NewReader(root string) (*Reader, error) {
+	v := Detect(root)
+	if v == VersionUnknown {
+		return nil, fmt.Errorf("%w: %s", ErrNotDetected, root)
+	}
+	return &Reader{root: root, version: v}, nil
+}
+
+// Version returns the detected hierarchy version.
+func (r *Reader) Version() Version {
+	return r.version
+}
+
+// Read collects the current resource usage.
+func (r *Reader) Read() (Stats, error) {
+	s := Stats{
+		Gauges:   make(map[string]float64),
+		Counters: make(map[string]uint64),
+	}
+
+	var err error
+	switch r.version {
+	case V2:
+		err = r.readV2(s)
+	case V1:
+		err = r.readV1(s)
+	default:
+		err = ErrNotDetected
+	}
+
+	return s, err
+}
+
+func (r *Reader) readV2(s Stats) error {
+	if v, ok, err := readUint(filepath.Join(r.root, "memory.current")); err != nil {
+		return err
+	} else if ok {
+		s.Gauges["CgroupMemoryCurrent"] = float64(v)
+	}
+	if v, ok, err := readUint(filepath.Join(r.root, "memory.max")); err != nil {
+		return err
+	} else if ok {
+		s.Gauges["CgroupMemoryMax"] = float64(v)
+	}
+
+	ms, err := readKeyValues(filepath.Join(r.root, "memory.stat"))
+	if err != nil {
+		return err
+	}
+	setMemoryStat(s, ms, "")
+
+	cs, err := readKeyValues(filepath.Join(r.root, "cpu.stat"))
+	if err != nil {
+		return err
+	}
+	setCounter(s, "CgroupCPUUsageUsec", cs, "usage_usec", 1)
+	setCounter(s, "CgroupCPUUserUsec", cs, "user_usec", 1)
+	setCounter(s, "CgroupCPUSystemUsec", cs, "system_usec", 1)
+	setCounter(s, "CgroupCPUPeriods", cs, "nr_periods", 1)
+	setCounter(s, "CgroupCPUThrottledPeriods", cs, "nr_throttled", 1)
+	setCounter(s, "CgroupCPUThrottledUsec", cs, "throttled_usec", 1)
+
+	if err := r.readIOStatV2(s); err != nil {
+		return err
+	}
+
+	if v, ok, err := readUint(filepath.Join(r.root, "pids.current")); err != nil {
+		return err
+	} else if ok {
+		s.Gauges["CgroupPidsCurrent"] = float64(v)
+	}
+	if v, ok, err := readUint(filepath.Join(r.root, "pids.max")); err != nil {
+		return err
+	} else if ok {
+		s.Gauges["CgroupPidsMax"] = float64(v)
+	}
+
+	return nil
+}
+
+func (r *Reader) readIOStatV2(s Stats) error {
+	lines, err := readLines(filepath.Join(r.root, "io.stat"))
+	if err != nil || lines == nil {
+		return err
+	}
+
+	names := map[string]string{
+		"rbytes": "CgroupIOReadBytes",
+		"wbytes": "CgroupIOWriteBytes",
+		"rios":   "CgroupIOReadOps",
+		"wios":   "CgroupIOWriteOps",
+	}
+	for _, name := range names {
+		s.Counters[name] = 0
+	}
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		for _, f := range fields[1:] { // skip device "major:minor"
+			k, v, ok := strings.Cut(f, "=")
+			name, known := names[k]
+			if !ok || !known {
+				continue
+			}
+			n, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return fmt.Errorf("io.stat: %w", err)
+			}
+			s.Counters[name] += n
+		}
+	}
+
+	return nil
+}
+
+func (r *Reader) readV1(s Stats) error {
+	memory := filepath.Join(r.root, "memory")
+	if v, ok, err := readUint(filepath.Join(memory, "memory.usage_in_bytes")); err != nil {
+		return err
+	} else if ok {
+		s.Gauges["CgroupMemoryCurrent"] = float64(v)
+	}
+	if v, ok, err := readUint(filepath.Join(memory, "memory.limit_in_bytes")); err != nil {
+		return err
+	} else if ok {
+		if v >= v1Unlimited {
+			v = 0
+		}
+		s.Gauges["CgroupMemoryMax"] = float64(v)
+	}
+
+	ms, err := readKeyValues(filepath.Join(memory, "memory.stat"))
+	if err != nil {
+		return err
+	}
+	setMemoryStat(s, ms, "total_")
+
+	cpu := r.controller("cpu,cpuacct", "cpu")
+	cs, err := readKeyValues(filepath.Join(cpu, "cpu.stat"))
+	if err != nil {
+		return err
+	}
+	setCounter(s, "CgroupCPUPeriods", cs, "nr_periods", 1)
+	setCounter(s, "CgroupCPUThrottledPeriods", cs, "nr_throttled", 1)
+	setCounter(s, "CgroupCPUThrottledUsec", cs, "throttled_time", 1000)
+
+	cpuacct := r.controller("cpu,cpuacct", "cpuacct")
+	if v, ok, err := readUint(filepath.Join(cpuacct, "cpuacct.usage")); err != nil {
+		return err
+	} else if ok {
+		s.Counters["CgroupCPUUsageUsec"] = v / 1000
+	}
+
+	blkio := filepath.Join(r.root, "blkio")
+	if err := readBlkio(s, filepath.Join(blkio, "blkio.throttle.io_service_bytes"), "CgroupIOReadBytes", "CgroupIOWriteBytes"); err != nil {
+		return err
+	}
+	if err := readBlkio(s, filepath.Join(blkio, "blkio.throttle.io_serviced"), "CgroupIOReadOps", "CgroupIOWriteOps"); err != nil {
+		return err
+	}
+
+	pids := filepath.Join(r.root, "pids")
+	if v, ok, err := readUint(filepath.Join(pids, "pids.current")); err != nil {
+		return err
+	} else if ok {
+		s.Gauges["CgroupPidsCurrent"] = float64(v)
+	}
+	if v, ok, err := readUint(filepath.Join(pids, "pids.max")); err != nil {
+		return err
+	} else if ok {
+		s.Gauges["CgroupPidsMax"] = float64(v)
+	}
+
+	return nil
+}
+
+// controller returns the directory of a v1 controller,
+// preferring the co-mounted directory when it exists.
+func (r *Reader) controller(combined, single string) string {
+	if p := filepath.Join(r.root, combined); exists(p) {
+		return p
+	}
+	return filepath.Join(r.root, single)
+}
+
+func readBlkio(s Stats, path, readName, writeName string) error {
+	lines, err := readLines(path)
+	if err != nil || lines == nil {
+		return err
+	}
+
+	s.Counters[readName] = 0
+	s.Counters[writeName] = 0
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 3 { // skip the grand "Total N" line
+			continue
+		}
+		n, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		switch fields[1] {
+		case "Read":
+			s.Counters[readName] += n
+		case "Write":
+			s.Counters[writeName] += n
+		}
+	}
+
+	return nil
+}
+
+// setMemoryStat maps memory.stat keys to metrics. Cgroup v1 prefixes hierarchical totals with "total_".
+func setMemoryStat(s Stats, ms map[string]uint64, prefix string) {
+	if ms == nil {
+		return
+	}
+
+	anon, file := "anon", "file"
+	if prefix != "" {
+		anon, file = "rss", "cache"
+	}
+	setGauge(s, "CgroupMemoryAnon", ms, prefix+anon)
+	setGauge(s, "CgroupMemoryFile", ms, prefix+file)
+	setGauge(s, "CgroupMemoryShmem", ms, prefix+"shmem")
+	setGauge(s, "CgroupMemoryInactiveFile", ms, prefix+"inactive_file")
+	setCounter(s, "CgroupMemoryPageFaults", ms, prefix+"pgfault", 1)
+	setCounter(s, "CgroupMemoryMajorPageFaults", ms, prefix+"pgmajfault", 1)
+
+	// working set as computed by kubelet: usage without reclaimable page cache
+	usage, ok := s.Gauges["CgroupMemoryCurrent"]
+	inactive, iok := ms[prefix+"inactive_file"]
+	if ok && iok {
+		ws := usage - float64(inactive)
+		if ws < 0 {
+			ws = 0
+		}
+		s.Gauges["CgroupMemoryWorkingSet"] = ws
+	}
+}
+
+func setGauge(s Stats, name string, values map[string]uint64, key string) {
+	if v, ok := values[key]; ok {
+		s.Gauges[name] = float64(v)
+	}
+}
+
+func setCounter(s Stats, name string, values map[string]uint64, key string, div uint64) {
+	if v, ok := values[key]; ok {
+		s.Counters[name] = v / div
+	}
+}
+
+// readUint reads a single-value file. The value "max" is reported as 0 (unlimited).
+func readUint(path string) (value uint64, ok bool, err error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	str := strings.TrimSpace(string(content))
+	if str == "max" {
+		return 0, true, nil
+	}
+	value, err = strconv.ParseUint(str, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+
+	return value, true, nil
+}
+
+// readKeyValues reads a flat keyed file such as memory.stat or cpu.stat.
+// Returns nil map if the file doesn't exist.
+func readKeyValues(path string) (map[string]uint64, error) {
+	lines, err := readLines(path)
+	if err != nil || lines == nil {
+		return nil, err
+	}
+
+	result := make(map[string]uint64, len(lines))
+	for _, line := range lines {
+		k, v, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(v), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		result[k] = n
+	}
+
+	return result, nil
+}
+
+func readLines(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func(file *os.File) { _ = file.Close() }(file)
+
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, scanner.Err()
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,98 @@
+package cgroup_test
+
+import (
+	"testing"
+
+	"github.com/dlomanov/mon/internal/apps/agent/collector/cgroup"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReader(t *testing.T) {
+	tests := []struct {
+		name         string
+		root         string
+		version      cgroup.Version
+		wantGauges   map[string]float64
+		wantCounters map[string]uint64
+	}{
+		{
+			name:    "cgroup v2",
+			root:    "testdata/v2",
+			version: cgroup.V2,
+			wantGauges: map[string]float64{
+				"CgroupMemoryCurrent":      104857600,
+				"CgroupMemoryMax":          268435456,
+				"CgroupMemoryAnon":         52428800,
+				"CgroupMemoryFile":         41943040,
+				"CgroupMemoryShmem":        1048576,
+				"CgroupMemoryInactiveFile": 20971520,
+				"CgroupMemoryWorkingSet":   83886080,
+				"CgroupPidsCurrent":        12,
+				"CgroupPidsMax":            0,
+			},
+			wantCounters: map[string]uint64{
+				"CgroupMemoryPageFaults":      120034,
+				"CgroupMemoryMajorPageFaults": 17,
+				"CgroupCPUUsageUsec":          8830000,
+				"CgroupCPUUserUsec":           6120000,
+				"CgroupCPUSystemUsec":         2710000,
+				"CgroupCPUPeriods":            1200,
+				"CgroupCPUThrottledPeriods":   35,
+				"CgroupCPUThrottledUsec":      412000,
+				"CgroupIOReadBytes":           1572864,
+				"CgroupIOWriteBytes":          2097152,
+				"CgroupIOReadOps":             150,
+				"CgroupIOWriteOps":            200,
+			},
+		},
+		{
+			name:    "cgroup v1",
+			root:    "testdata/v1",
+			version: cgroup.V1,
+			wantGauges: map[string]float64{
+				"CgroupMemoryCurrent":      104857600,
+				"CgroupMemoryMax":          0,
+				"CgroupMemoryAnon":         52428800,
+				"CgroupMemoryFile":         41943040,
+				"CgroupMemoryShmem":        1048576,
+				"CgroupMemoryInactiveFile": 20971520,
+				"CgroupMemoryWorkingSet":   83886080,
+				"CgroupPidsCurrent":        12,
+				"CgroupPidsMax":            512,
+			},
+			wantCounters: map[string]uint64{
+				"CgroupMemoryPageFaults":      120034,
+				"CgroupMemoryMajorPageFaults": 17,
+				"CgroupCPUUsageUsec":          8830000,
+				"CgroupCPUPeriods":            1200,
+				"CgroupCPUThrottledPeriods":   35,
+				"CgroupCPUThrottledUsec":      412000,
+				"CgroupIOReadBytes":           1572864,
+				"CgroupIOWriteBytes":          2097152,
+				"CgroupIOReadOps":             150,
+				"CgroupIOWriteOps":            200,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.version, cgroup.Detect(tt.root))
+
+			r, err := cgroup.NewReader(tt.root)
+			require.NoError(t, err)
+			require.Equal(t, tt.version, r.Version())
+
+			s, err := r.Read()
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantGauges, s.Gauges)
+			assert.Equal(t, tt.wantCounters, s.Counters)
+		})
+	}
+}
+
+func TestNewReader_NotDetected(t *testing.T) {
+	_, err := cgroup.NewReader(t.TempDir())
+	require.ErrorIs(t, err, cgroup.ErrNotDetected)
+}
@@ -1,41 +1,188 @@
 package collector
 
 import (
+	"math"
+	"time"
+
 	"github.com/dlomanov/mon/internal/entities"
 	"go.uber.org/zap"
 )
 
-type Collector struct {
-	Metrics map[string]entities.Metric
-	logger  *zap.Logger
-}
+// Suffixes of gauges derived from a report window in aggregation mode.
+const (
+	SuffixMin   = "_min"
+	SuffixMax   = "_max"
+	SuffixAvg   = "_avg"
+	SuffixCount = "_count"
+)
+
+type (
+	Collector struct {
+		Metrics    map[string]entities.Metric
+		increments map[string]int64
+		logger     *zap.Logger
+		aggregate  bool
+		windows    map[string]*window
+		buckets    []float64
+		histograms map[string]*entities.Histogram
+		accuracy   float64
+		summaries  map[string]*entities.Summary
+	}
 
-func NewCollector(logger *zap.Logger) Collector {
+	// window accumulates gauge samples between two reports.
+	window struct {
+		min   float64
+		max   float64
+		sum   float64
+		count int64
+	}
+)
+
+func NewCollector(logger *zap.Logger, cfg Config) Collector {
+	buckets := cfg.Buckets
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	accuracy := cfg.SummaryAccuracy
+	if accuracy == 0 {
+		accuracy = entities.DefaultSummaryAccuracy
+	}
 	return Collector{
-		Metrics: make(map[string]entities.Metric),
-		logger:  logger,
+		Metrics:    make(map[string]entities.Metric),
+		increments: make(map[string]int64),
+		logger:     logger,
+		aggregate:  cfg.Aggregated(),
+		windows:    make(map[string]*window),
+		buckets:    buckets,
+		histograms: make(map[string]*entities.Histogram),
+		accuracy:   accuracy,
+		summaries:  make(map[string]*entities.Summary),
 	}
 }
 
 func (c *Collector) UpdateGauge(name string, value float64) {
 	key := entities.MetricsKey{Name: name, Type: entities.MetricGauge}
-	v := entities.Metric{MetricsKey: key, Value: &value}
+	v := entities.Metric{MetricsKey: key, Value: &value, Timestamp: time.Now()}
 	c.Metrics[key.String()] = v
+
+	if c.aggregate {
+		c.observe(name, value)
+	}
 }
 
 func (c *Collector) UpdateCounter(name string, value int64) {
 	key := entities.MetricsKey{Name: name, Type: entities.MetricCounter}
 	keyString := key.String()
-	v := entities.Metric{MetricsKey: key, Delta: &value}
+	v := entities.Metric{MetricsKey: key, Delta: &value, Timestamp: time.Now()}
 
 	old, ok := c.Metrics[keyString]
 	if ok {
-		*v.Delta += *old.Delta
+		*v.Delta, _ = entities.AddDelta(*old.Delta, value)
 	}
 
 	c.Metrics[keyString] = v
 }
 
+// IncrementCounter adds the increase to the named counter.
+// Unlike UpdateCounter, the counter holds increases since the previous snapshot only,
+// so each increase is reported once.
+func (c *Collector) IncrementCounter(name string, delta int64) {
+	c.increments[name], _ = entities.AddDelta(c.increments[name], delta)
+}
+
+// ObserveHistogram adds a value to the named histogram.
+// Histograms hold observations since the previous snapshot,
+// the server merges reported histograms bucket-wise.
+func (c *Collector) ObserveHistogram(name string, value float64) {
+	h, ok := c.histograms[name]
+	if !ok {
+		var err error
+		if h, err = entities.NewHistogram(c.buckets); err != nil {
+			c.logger.Error("invalid histogram buckets", zap.String("name", name), zap.Error(err))
+			return
+		}
+		c.histograms[name] = h
+	}
+	h.Observe(value)
+}
+
+// ObserveSummary adds a value to the named summary.
+// Summaries hold observations since the previous snapshot,
+// the server merges reported summaries into a fleet-wide sketch.
+func (c *Collector) ObserveSummary(name string, value float64) {
+	s, ok := c.summaries[name]
+	if !ok {
+		var err error
+		if s, err = entities.NewSummary(c.accuracy); err != nil {
+			c.logger.Error("invalid summary accuracy", zap.String("name", name), zap.Error(err))
+			return
+		}
+		c.summaries[name] = s
+	}
+	s.Observe(value)
+}
+
+// Snapshot returns a copy of the collected metrics ready to be reported.
+// It contains counter increases, histograms and summaries observed since the previous snapshot.
+// In aggregation mode it also contains min, max, avg and count gauges
+// of every gauge observed since the previous snapshot; the report window is reset.
+// Metrics derived from observations are timestamped with the snapshot time.
+func (c *Collector) Snapshot() map[string]entities.Metric {
+	now := time.Now()
+	result := make(map[string]entities.Metric, len(c.Metrics)+len(c.increments)+len(c.histograms)+len(c.summaries)+4*len(c.windows))
+	for k, v := range c.Metrics {
+		result[k] = v
+	}
+
+	for name, delta := range c.increments {
+		delta := delta
+		key := entities.MetricsKey{Name: name, Type: entities.MetricCounter}
+		result[key.String()] = entities.Metric{MetricsKey: key, Delta: &delta, Timestamp: now}
+	}
+	c.increments = make(map[string]int64, len(c.increments))
+
+	for name, h := range c.histograms {
+		key := entities.MetricsKey{Name: name, Type: entities.MetricHistogram}
+		result[key.String()] = entities.Metric{MetricsKey: key, Histogram: h, Timestamp: now}
+	}
+	c.histograms = make(map[string]*entities.Histogram, len(c.histograms))
+
+	for name, s := range c.summaries {
+		key := entities.MetricsKey{Name: name, Type: entities.MetricSummary}
+		result[key.String()] = entities.Metric{MetricsKey: key, Summary: s, Timestamp: now}
+	}
+	c.summaries = make(map[string]*entities.Summary, len(c.summaries))
+
+	for name, w := range c.windows {
+		avg := w.sum / float64(w.count)
+		count := float64(w.count)
+		for suffix, value := range map[string]*float64{
+			SuffixMin:   &w.min,
+			SuffixMax:   &w.max,
+			SuffixAvg:   &avg,
+			SuffixCount: &count,
+		} {
+			key := entities.MetricsKey{Name: name + suffix, Type: entities.MetricGauge}
+			result[key.String()] = entities.Metric{MetricsKey: key, Value: value, Timestamp: now}
+		}
+	}
+	c.windows = make(map[string]*window, len(c.windows))
+
+	return result
+}
+
 func (c *Collector) LogUpdated() {
 	c.logger.Info("Metrics updated\n", zap.Int("updated_metric_count", len(c.Metrics)))
 }
+
+func (c *Collector) observe(name string, value float64) {
+	w, ok := c.windows[name]
+	if !ok {
+		w = &window{min: math.Inf(1), max: math.Inf(-1)}
+		c.windows[name] = w
+	}
+	w.min = math.Min(w.min, value)
+	w.max = math.Max(w.max, value)
+	w.sum += value
+	w.count++
+}
@@ -2,6 +2,7 @@ package collector
 
 import (
 	"testing"
+	"time"
 
 	"github.com/dlomanov/mon/internal/entities"
 	"github.com/stretchr/testify/assert"
@@ -41,6 +42,7 @@ func TestCollector_UpdateGauge(t *testing.T) {
 			res, ok := storage[key.String()]
 			require.True(t, ok)
 			assert.Equal(t, tt.want, *res.Value)
+			assert.False(t, res.Timestamp.IsZero(), "gauge should be timestamped at collection")
 		})
 	}
 }
@@ -80,3 +82,95 @@ func TestCollector_UpdateCounter(t *testing.T) {
 		})
 	}
 }
+
+func TestCollector_Snapshot(t *testing.T) {
+	aggregate := true
+	c := NewCollector(zap.NewNop(), Config{Aggregate: &aggregate})
+	for _, v := range []float64{3, 1, 5, 3} {
+		c.UpdateGauge("test-key", v)
+	}
+
+	want := map[string]float64{
+		"test-key":               3,
+		"test-key" + SuffixMin:   1,
+		"test-key" + SuffixMax:   5,
+		"test-key" + SuffixAvg:   3,
+		"test-key" + SuffixCount: 4,
+	}
+	res := c.Snapshot()
+	require.Len(t, res, len(want))
+	for name, v := range want {
+		key := entities.MetricsKey{Name: name, Type: entities.MetricGauge}
+		m, ok := res[key.String()]
+		require.True(t, ok, name)
+		assert.Equal(t, v, *m.Value, name)
+	}
+
+	// window is reset after snapshot, last values are kept
+	res = c.Snapshot()
+	require.Len(t, res, 1)
+}
+
+func TestCollector_IncrementCounter(t *testing.T) {
+	c := NewCollector(zap.NewNop(), Config{})
+	c.IncrementCounter("bytes", 3)
+	c.IncrementCounter("bytes", 4)
+
+	key := entities.MetricsKey{Name: "bytes", Type: entities.MetricCounter}
+	snapshot := c.Snapshot()
+	require.Contains(t, snapshot, key.String())
+	assert.Equal(t, int64(7), *snapshot[key.String()].Delta)
+
+	c.IncrementCounter("bytes", 2)
+	snapshot = c.Snapshot()
+	require.Contains(t, snapshot, key.String())
+	assert.Equal(t, int64(2), *snapshot[key.String()].Delta, "increases are reset by snapshot")
+	assert.NotContains(t, c.Snapshot(), key.String())
+}
+
+func TestCollector_ObserveHistogram(t *testing.T) {
+	c := NewCollector(zap.NewNop(), Config{Buckets: []float64{1, 10}})
+	c.ObserveHistogram("latency", 0.5)
+	c.ObserveHistogram("latency", 5)
+
+	key := entities.MetricsKey{Name: "latency", Type: entities.MetricHistogram}
+	snapshot := c.Snapshot()
+	require.Contains(t, snapshot, key.String())
+	assert.Equal(t, []uint64{1, 1, 0}, snapshot[key.String()].Histogram.Counts)
+
+	assert.NotContains(t, c.Snapshot(), key.String(), "histograms are reset by snapshot")
+}
+
+func TestCollector_ObserveSummary(t *testing.T) {
+	c := NewCollector(zap.NewNop(), Config{SummaryAccuracy: 0.02})
+	c.ObserveSummary("latency", 0.5)
+	c.ObserveSummary("latency", 5)
+
+	key := entities.MetricsKey{Name: "latency", Type: entities.MetricSummary}
+	snapshot := c.Snapshot()
+	require.Contains(t, snapshot, key.String())
+	s := snapshot[key.String()].Summary
+	assert.Equal(t, uint64(2), s.Count)
+	assert.Equal(t, 0.02, s.Alpha)
+
+	assert.NotContains(t, c.Snapshot(), key.String(), "summaries are reset by snapshot")
+}
+
+func TestConfig_Merge(t *testing.T) {
+	enabled, disabled := true, false
+	global := Config{PollInterval: time.Second, ReportInterval: 10 * time.Second, Aggregate: &enabled, Align: &enabled}
+
+	merged := global.Merge(Config{ReportInterval: time.Minute})
+	assert.Equal(t, time.Second, merged.PollInterval)
+	assert.Equal(t, time.Minute, merged.ReportInterval)
+	assert.True(t, merged.Aggregated(), "unset override keeps the global value")
+	assert.True(t, merged.Aligned(), "unset override keeps the global value")
+
+	merged = global.Merge(Config{Aggregate: &disabled, Align: &disabled})
+	assert.False(t, merged.Aggregated(), "override disables aggregation")
+	assert.False(t, merged.Aligned(), "override disables alignment")
+
+	merged = Config{}.Merge(Config{Aggregate: &enabled})
+	assert.True(t, merged.Aggregated())
+	assert.False(t, merged.Aligned())
+}
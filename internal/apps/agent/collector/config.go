@@ -2,7 +2,69 @@ package collector
 
 import "time"
 
+// DefaultBuckets are histogram bucket upper bounds in seconds used if Config.Buckets is empty.
+var DefaultBuckets = []float64{0.00001, 0.00005, 0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1}
+
 type Config struct {
 	PollInterval   time.Duration
 	ReportInterval time.Duration
+	CgroupRoot     string
+	// Aggregate enables reporting of min, max, avg and count
+	// of every gauge sampled during the report interval, disabled if nil.
+	Aggregate *bool
+	// Align schedules polls and reports on wall-clock multiples of their intervals, disabled if nil.
+	Align *bool
+	// StartJitter delays the first poll by a random duration up to the value.
+	// With Align polls are delayed from the aligned times by the same duration.
+	StartJitter time.Duration
+	// ReportJitter delays every report by a random duration up to the value.
+	ReportJitter time.Duration
+	// Buckets are histogram bucket upper bounds, DefaultBuckets if empty.
+	Buckets []float64
+	// SummaryAccuracy is the relative accuracy of summary quantiles,
+	// entities.DefaultSummaryAccuracy if zero.
+	SummaryAccuracy float64
+}
+
+// Aggregated reports whether Aggregate is enabled.
+func (c Config) Aggregated() bool {
+	return c.Aggregate != nil && *c.Aggregate
+}
+
+// Aligned reports whether Align is enabled.
+func (c Config) Aligned() bool {
+	return c.Align != nil && *c.Align
+}
+
+// Merge returns a copy of c with non-zero fields of override applied,
+// so Aggregate and Align are overridden by a false value as well.
+func (c Config) Merge(override Config) Config {
+	if override.PollInterval != 0 {
+		c.PollInterval = override.PollInterval
+	}
+	if override.ReportInterval != 0 {
+		c.ReportInterval = override.ReportInterval
+	}
+	if override.CgroupRoot != "" {
+		c.CgroupRoot = override.CgroupRoot
+	}
+	if override.StartJitter != 0 {
+		c.StartJitter = override.StartJitter
+	}
+	if override.ReportJitter != 0 {
+		c.ReportJitter = override.ReportJitter
+	}
+	if len(override.Buckets) != 0 {
+		c.Buckets = override.Buckets
+	}
+	if override.SummaryAccuracy != 0 {
+		c.SummaryAccuracy = override.SummaryAccuracy
+	}
+	if override.Aggregate != nil {
+		c.Aggregate = override.Aggregate
+	}
+	if override.Align != nil {
+		c.Align = override.Align
+	}
+	return c
 }
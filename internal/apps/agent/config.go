@@ -2,14 +2,30 @@ package agent
 
 import (
 	"github.com/dlomanov/mon/internal/apps/agent/collector"
+	"github.com/dlomanov/mon/internal/apps/agent/relabel"
+	httpclient "github.com/dlomanov/mon/internal/apps/agent/reporter/clients/http"
+	"github.com/dlomanov/mon/internal/apps/agent/reporter/identity"
 )
 
 type Config struct {
 	CollectorConfig collector.Config
-	LogLevel        string
-	Addr            string
-	GRPCAddr        string
-	HashKey         string
-	RateLimit       uint64
-	PublicKeyPath   string
+	// Collectors overrides CollectorConfig per job name (see jobs.Name* constants).
+	Collectors map[string]collector.Config
+	// Relabel rules are applied to collected metrics before reporting.
+	Relabel       []relabel.Rule
+	LogLevel      string
+	Addr          string
+	GRPCAddr      string
+	HashKey       string
+	RateLimit     uint64
+	PublicKeyPath string
+	// Compression configures HTTP request body compression.
+	Compression httpclient.Compression
+	// Identity configures the reported source identity, ServerAddr is set from Addr or GRPCAddr.
+	Identity identity.Config
+}
+
+// Collector returns the configuration of the named collector job.
+func (c Config) Collector(name string) collector.Config {
+	return c.CollectorConfig.Merge(c.Collectors[name])
 }
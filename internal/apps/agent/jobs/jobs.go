@@ -2,19 +2,29 @@ package jobs
 
 import (
 	"context"
-	"log"
-	"math"
 	"math/rand"
 	"runtime"
 	"time"
 
 	"github.com/dlomanov/mon/internal/apps/agent/collector"
+	"github.com/dlomanov/mon/internal/apps/agent/collector/cgroup"
 	"github.com/dlomanov/mon/internal/entities"
 	"github.com/shirou/gopsutil/v3/mem"
 	"go.uber.org/zap"
 )
 
-type Report func(map[string]entities.Metric)
+// Job names used to look up per-collector configuration.
+const (
+	NameRuntime   = "runtime"
+	NameSystem    = "system"
+	NameContainer = "container"
+)
+
+type (
+	Report func(map[string]entities.Metric)
+
+	poll func(ctx context.Context, c *collector.Collector) error
+)
 
 func CollectMetrics(
 	ctx context.Context,
@@ -22,16 +32,23 @@ func CollectMetrics(
 	logger *zap.Logger,
 	report Report,
 ) {
-	c := collector.NewCollector(logger)
-	reportTime := time.Now().Add(cfg.ReportInterval)
-
-	ticker := time.NewTicker(cfg.PollInterval)
-	defer ticker.Stop()
-
-	for i := 0; i < math.MaxInt64 && ctx.Err() == nil; i++ {
+	var lastNumGC uint32
+	run(ctx, NameRuntime, cfg, logger, report, func(_ context.Context, c *collector.Collector) error {
 		ms := runtime.MemStats{}
 		runtime.ReadMemStats(&ms)
 
+		// PauseNs is a circular buffer of recent pauses, older ones are lost.
+		from := lastNumGC
+		if ms.NumGC-from > uint32(len(ms.PauseNs)) {
+			from = ms.NumGC - uint32(len(ms.PauseNs))
+		}
+		for i := from; i < ms.NumGC; i++ {
+			pause := float64(ms.PauseNs[i%uint32(len(ms.PauseNs))]) / float64(time.Second)
+			c.ObserveHistogram("GCPause", pause)
+			c.ObserveSummary("GCPause", pause)
+		}
+		lastNumGC = ms.NumGC
+
 		c.UpdateGauge("Alloc", float64(ms.Alloc))
 		c.UpdateGauge("BuckHashSys", float64(ms.BuckHashSys))
 		c.UpdateGauge("Frees", float64(ms.Frees))
@@ -61,59 +78,98 @@ func CollectMetrics(
 		c.UpdateGauge("TotalAlloc", float64(ms.TotalAlloc))
 		c.UpdateGauge("RandomValue", rand.Float64())
 		c.UpdateCounter("PollCount", 1)
-		c.LogUpdated()
+		return nil
+	})
+}
 
-		if reportTime.Compare(time.Now()) <= 0 {
-			reportTime = time.Now().Add(cfg.ReportInterval)
-			report(c.Metrics)
+func CollectAdvancedMetrics(
+	ctx context.Context,
+	cfg collector.Config,
+	logger *zap.Logger,
+	report Report,
+) {
+	run(ctx, NameSystem, cfg, logger, report, func(ctx context.Context, c *collector.Collector) error {
+		v, err := mem.VirtualMemoryWithContext(ctx)
+		if err != nil {
+			return err
 		}
+		c.UpdateGauge("TotalMemory", float64(v.Total))
+		c.UpdateGauge("FreeMemory", float64(v.Free))
+		c.UpdateGauge("CPUutilization1", v.UsedPercent)
+		return nil
+	})
+}
 
-		select {
-		case <-ctx.Done():
-			continue
-		case <-ticker.C:
-			continue
-		}
+// CollectContainerMetrics reports resource usage of the cgroup the agent runs in.
+// Cumulative cgroup counters are reported as increases since the previous report,
+// the first poll of a counter only sets its baseline, so usage before the agent started isn't reported.
+// The job exits immediately if no cgroup hierarchy is found at cfg.CgroupRoot.
+func CollectContainerMetrics(
+	ctx context.Context,
+	cfg collector.Config,
+	logger *zap.Logger,
+	report Report,
+) {
+	if cfg.CgroupRoot == "" {
+		logger.Debug("container metrics disabled")
+		return
 	}
+	r, err := cgroup.NewReader(cfg.CgroupRoot)
+	if err != nil {
+		logger.Info("container metrics unavailable", zap.Error(err))
+		return
+	}
+	logger.Debug("container metrics enabled", zap.Int("cgroup_version", int(r.Version())))
 
-	logger.Debug("collect cancelled: %s\n", zap.Error(ctx.Err()))
+	prev := make(map[string]uint64)
+	run(ctx, NameContainer, cfg, logger, report, func(_ context.Context, c *collector.Collector) error {
+		s, err := r.Read()
+		if err != nil {
+			return err
+		}
+		for name, v := range s.Gauges {
+			c.UpdateGauge(name, v)
+		}
+		for name, v := range s.Counters {
+			last, ok := prev[name]
+			prev[name] = v
+			if !ok {
+				continue
+			}
+			delta := v - last
+			if v < last { // cgroup recreated
+				delta = v
+			}
+			c.IncrementCounter(name, int64(delta))
+		}
+		return nil
+	})
 }
 
-func CollectAdvancedMetrics(
+// run polls metrics and reports them according to the job schedule until ctx is done.
+func run(
 	ctx context.Context,
+	name string,
 	cfg collector.Config,
 	logger *zap.Logger,
 	report Report,
+	poll poll,
 ) {
-	c := collector.NewCollector(logger)
-	reportTime := time.Now().Add(cfg.ReportInterval)
-
-	ticker := time.NewTicker(cfg.PollInterval)
-	defer ticker.Stop()
+	logger = logger.With(zap.String("collector", name))
+	c := collector.NewCollector(logger, cfg)
+	s := newSchedule(cfg, time.Now())
 
-	for ctx.Err() == nil {
-		v, err := mem.VirtualMemoryWithContext(ctx)
-		if err != nil {
-			log.Printf("error occured while collecting advanced metrics: %s\n", v)
+	for s.waitPoll(ctx) {
+		if err := poll(ctx, &c); err != nil {
+			logger.Error("error occurred while collecting metrics", zap.Error(err))
 		} else {
-			c.UpdateGauge("TotalMemory", float64(v.Total))
-			c.UpdateGauge("FreeMemory", float64(v.Free))
-			c.UpdateGauge("CPUutilization1", v.UsedPercent)
 			c.LogUpdated()
 		}
 
-		if reportTime.Compare(time.Now()) <= 0 {
-			reportTime = time.Now().Add(cfg.ReportInterval)
-			report(c.Metrics)
-		}
-
-		select {
-		case <-ctx.Done():
-			continue
-		case <-ticker.C:
-			continue
+		if s.reportDue(time.Now()) {
+			report(c.Snapshot())
 		}
 	}
 
-	logger.Debug("collect cancelled: %s\n", zap.Error(ctx.Err()))
+	logger.Debug("collect cancelled", zap.Error(ctx.Err()))
 }
@@ -2,6 +2,9 @@ package jobs_test
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -10,6 +13,7 @@ import (
 	"github.com/dlomanov/mon/internal/apps/agent/jobs"
 	"github.com/dlomanov/mon/internal/entities"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 )
 
@@ -46,3 +50,53 @@ func TestCollectMetrics(t *testing.T) {
 
 	assert.NoError(t, timeoutCtx.Err())
 }
+
+func TestCollectContainerMetrics(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	root := t.TempDir()
+	entries, err := os.ReadDir("../collector/cgroup/testdata/v2")
+	require.NoError(t, err)
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join("../collector/cgroup/testdata/v2", e.Name()))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(root, e.Name()), data, 0o644))
+	}
+	setUsage := func(usec int) {
+		stat := fmt.Sprintf("usage_usec %d\nuser_usec 6120000\nsystem_usec 2710000\n", usec)
+		require.NoError(t, os.WriteFile(filepath.Join(root, "cpu.stat"), []byte(stat), 0o644))
+	}
+
+	// the CPU usage grows by 1000 before the second poll and by 500 before the third one
+	var reported []map[string]entities.Metric
+	usage := []int{8831000, 8831500}
+	jobs.CollectContainerMetrics(
+		ctx,
+		collector.Config{
+			PollInterval:   10 * time.Millisecond,
+			ReportInterval: 0,
+			CgroupRoot:     root,
+		},
+		zap.NewNop(),
+		func(metrics map[string]entities.Metric) {
+			reported = append(reported, metrics)
+			if len(reported) > len(usage) {
+				cancel()
+				return
+			}
+			setUsage(usage[len(reported)-1])
+		})
+
+	require.Len(t, reported, 3)
+	gauge := entities.MetricsKey{Name: "CgroupMemoryCurrent", Type: entities.MetricGauge}
+	require.Contains(t, reported[0], gauge.String())
+	assert.Equal(t, float64(104857600), *reported[0][gauge.String()].Value)
+
+	cpu := entities.MetricsKey{Name: "CgroupCPUUsageUsec", Type: entities.MetricCounter}
+	assert.NotContains(t, reported[0], cpu.String(), "the first poll is the baseline")
+	require.Contains(t, reported[1], cpu.String())
+	assert.Equal(t, int64(1000), *reported[1][cpu.String()].Delta)
+	require.Contains(t, reported[2], cpu.String())
+	assert.Equal(t, int64(500), *reported[2][cpu.String()].Delta)
+}
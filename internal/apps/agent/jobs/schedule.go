@@ -0,0 +1,93 @@
+package jobs
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/dlomanov/mon/internal/apps/agent/collector"
+)
+
+// schedule computes poll and report times of a single job.
+//
+// With cfg.Align polls happen on wall-clock multiples of cfg.PollInterval and
+// reports on multiples of cfg.ReportInterval, so agents restarted together
+// don't drift apart. Otherwise intervals are counted from the job start.
+// Polls are delayed by a random cfg.StartJitter offset, aligned polls are delayed
+// from the aligned times, and reports are additionally delayed by a random
+// cfg.ReportJitter fraction to spread the load on the server.
+type schedule struct {
+	cfg        collector.Config
+	offset     time.Duration
+	nextPoll   time.Time
+	nextReport time.Time
+}
+
+func newSchedule(cfg collector.Config, now time.Time) *schedule {
+	s := &schedule{cfg: cfg, offset: jitter(cfg.StartJitter)}
+	s.nextPoll = now.Add(s.offset)
+	if cfg.Aligned() {
+		s.nextPoll = align(now, cfg.PollInterval).Add(s.offset)
+	}
+	s.nextReport = s.reportAfter(s.nextPoll)
+	return s
+}
+
+// waitPoll blocks until the next poll time.
+// Returns false if ctx is done before.
+func (s *schedule) waitPoll(ctx context.Context) bool {
+	timer := time.NewTimer(time.Until(s.nextPoll))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+	}
+
+	s.nextPoll = s.nextPoll.Add(s.cfg.PollInterval)
+	if now := time.Now(); s.nextPoll.Before(now) { // skip polls missed by a slow collector
+		s.nextPoll = now
+		if s.cfg.Aligned() {
+			s.nextPoll = align(now.Add(-s.offset), s.cfg.PollInterval).Add(s.offset)
+		}
+	}
+	return true
+}
+
+// reportDue reports whether metrics should be reported at now,
+// and if so schedules the next report.
+func (s *schedule) reportDue(now time.Time) bool {
+	if now.Before(s.nextReport) {
+		return false
+	}
+	s.nextReport = s.reportAfter(now)
+	return true
+}
+
+func (s *schedule) reportAfter(t time.Time) time.Time {
+	next := t.Add(s.cfg.ReportInterval)
+	if s.cfg.Aligned() {
+		next = align(t.Add(time.Nanosecond), s.cfg.ReportInterval)
+	}
+	return next.Add(jitter(s.cfg.ReportJitter))
+}
+
+// align returns the first multiple of interval not before t.
+func align(t time.Time, interval time.Duration) time.Time {
+	if interval <= 0 {
+		return t
+	}
+	aligned := t.Truncate(interval)
+	if aligned.Before(t) {
+		aligned = aligned.Add(interval)
+	}
+	return aligned
+}
+
+func jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
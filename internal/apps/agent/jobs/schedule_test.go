@@ -0,0 +1,86 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dlomanov/mon/internal/apps/agent/collector"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedule(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 0, 3, 0, time.UTC)
+	aligned := true
+	tests := []struct {
+		name           string
+		cfg            collector.Config
+		wantPoll       time.Time
+		wantReport     time.Time
+		wantReportLate time.Duration // upper bound of report jitter
+	}{
+		{
+			name:       "relative to start",
+			cfg:        collector.Config{PollInterval: 2 * time.Second, ReportInterval: 10 * time.Second},
+			wantPoll:   now,
+			wantReport: now.Add(10 * time.Second),
+		},
+		{
+			name:       "aligned",
+			cfg:        collector.Config{PollInterval: 2 * time.Second, ReportInterval: 10 * time.Second, Align: &aligned},
+			wantPoll:   now.Add(1 * time.Second),
+			wantReport: now.Add(7 * time.Second),
+		},
+		{
+			name: "aligned with report jitter",
+			cfg: collector.Config{
+				PollInterval:   time.Minute,
+				ReportInterval: time.Minute,
+				Align:          &aligned,
+				ReportJitter:   5 * time.Second,
+			},
+			wantPoll:       now.Add(57 * time.Second),
+			wantReport:     now.Add(117 * time.Second),
+			wantReportLate: 5 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSchedule(tt.cfg, now)
+
+			assert.Equal(t, tt.wantPoll, s.nextPoll)
+			assert.False(t, s.nextReport.Before(tt.wantReport))
+			assert.False(t, s.nextReport.After(tt.wantReport.Add(tt.wantReportLate)))
+			assert.False(t, s.reportDue(tt.wantPoll))
+			assert.True(t, s.reportDue(tt.wantReport.Add(tt.wantReportLate)))
+		})
+	}
+}
+
+func TestSchedule_AlignedStartJitter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 0, 3, 0, time.UTC)
+	aligned := true
+	cfg := collector.Config{
+		PollInterval:   time.Minute,
+		ReportInterval: time.Minute,
+		Align:          &aligned,
+		StartJitter:    30 * time.Second,
+	}
+	first := now.Add(57 * time.Second)
+
+	polls := make(map[time.Time]bool)
+	for i := 0; i < 50; i++ {
+		s := newSchedule(cfg, now)
+		assert.False(t, s.nextPoll.Before(first))
+		assert.True(t, s.nextPoll.Before(first.Add(cfg.StartJitter)))
+		polls[s.nextPoll] = true
+	}
+	assert.Greater(t, len(polls), 1, "start jitter is kept")
+}
+
+func TestAlign(t *testing.T) {
+	base := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	assert.Equal(t, base, align(base, time.Minute))
+	assert.Equal(t, base.Add(time.Minute), align(base.Add(time.Second), time.Minute))
+	assert.Equal(t, base.Add(time.Second), align(base.Add(time.Second), 0))
+}
@@ -0,0 +1,166 @@
+// Package relabel filters and transforms collected metrics before they are reported.
+//
+// Rules are applied in order to every metric, similar to Prometheus relabeling.
+// Regular expressions are anchored and matched against the metric name.
+package relabel
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/dlomanov/mon/internal/entities"
+	"go.uber.org/zap"
+)
+
+// Action is a relabeling rule action.
+type Action string
+
+const (
+	// ActionDrop drops metrics whose name matches Regex.
+	ActionDrop Action = "drop"
+	// ActionKeep drops metrics whose name doesn't match Regex.
+	ActionKeep Action = "keep"
+	// ActionRename replaces the matched name with Replacement, which may refer to capture groups ($1).
+	ActionRename Action = "rename"
+	// ActionPrefix prepends Replacement to matched names.
+	ActionPrefix Action = "prefix"
+	// ActionScale multiplies values of matched gauges by Factor.
+	ActionScale Action = "scale"
+	// ActionDelta converts matched monotonic gauges into counters holding the increase
+	// since the previous report. The first report of a gauge only records the baseline.
+	ActionDelta Action = "delta"
+)
+
+type (
+	// Rule is a single relabeling rule.
+	Rule struct {
+		Action      Action
+		Regex       string // defaults to ".*"
+		Replacement string
+		Factor      float64
+	}
+
+	// Processor applies relabeling rules. It is safe for concurrent use.
+	Processor struct {
+		logger     *zap.Logger
+		rules      []rule
+		mu         sync.Mutex
+		last       map[string]float64  // reported baselines of gauges converted by ActionDelta
+		collisions map[string]struct{} // names produced by rules from several metrics, logged once
+	}
+
+	rule struct {
+		Rule
+		re *regexp.Regexp
+	}
+)
+
+// New compiles rules into a Processor.
+func New(logger *zap.Logger, rules []Rule) (*Processor, error) {
+	compiled := make([]rule, 0, len(rules))
+	for i, r := range rules {
+		if r.Regex == "" {
+			r.Regex = ".*"
+		}
+		re, err := regexp.Compile("^(?:" + r.Regex + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("relabel rule %d: %w", i, err)
+		}
+		switch r.Action {
+		case ActionDrop, ActionKeep, ActionRename, ActionPrefix, ActionDelta:
+		case ActionScale:
+			if r.Factor == 0 {
+				return nil, fmt.Errorf("relabel rule %d: scale factor is required", i)
+			}
+		default:
+			return nil, fmt.Errorf("relabel rule %d: unknown action %q", i, r.Action)
+		}
+		compiled = append(compiled, rule{Rule: r, re: re})
+	}
+
+	return &Processor{
+		logger:     logger,
+		rules:      compiled,
+		last:       make(map[string]float64),
+		collisions: make(map[string]struct{}),
+	}, nil
+}
+
+// Process returns metrics transformed by the rules. The input map is not modified.
+// If rules produce the same metric from several ones, only one of them is kept and the collision is logged.
+func (p *Processor) Process(metrics map[string]entities.Metric) map[string]entities.Metric {
+	if len(p.rules) == 0 {
+		return metrics
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result := make(map[string]entities.Metric, len(metrics))
+	for _, m := range metrics {
+		source := m.String()
+		m, ok := p.apply(m)
+		if !ok {
+			continue
+		}
+		key := m.String()
+		if _, ok := result[key]; ok {
+			if _, logged := p.collisions[key]; !logged {
+				p.collisions[key] = struct{}{}
+				p.logger.Warn("relabel rules produce the same metric from several ones, one of them is dropped",
+					zap.String("metric", key), zap.String("source", source))
+			}
+		}
+		result[key] = m
+	}
+	return result
+}
+
+func (p *Processor) apply(m entities.Metric) (entities.Metric, bool) {
+	for _, r := range p.rules {
+		matched := r.re.MatchString(m.Name)
+		switch {
+		case r.Action == ActionDrop && matched:
+			return m, false
+		case r.Action == ActionKeep && !matched:
+			return m, false
+		case !matched:
+			continue
+		}
+
+		switch r.Action {
+		case ActionRename:
+			m.Name = r.re.ReplaceAllString(m.Name, r.Replacement)
+		case ActionPrefix:
+			m.Name = r.Replacement + m.Name
+		case ActionScale:
+			if m.Type == entities.MetricGauge {
+				v := *m.Value * r.Factor
+				m.Value = &v
+			}
+		case ActionDelta:
+			if m.Type != entities.MetricGauge {
+				continue
+			}
+			key := m.String()
+			cur := *m.Value
+			last, seen := p.last[key]
+			if !seen {
+				p.last[key] = cur
+				return m, false
+			}
+			if cur < last { // reset
+				last = 0
+			}
+			// the fraction of the increase is reported once it adds up to a whole
+			delta := int64(cur - last)
+			p.last[key] = last + float64(delta)
+			m.Type = entities.MetricCounter
+			m.Value = nil
+			m.Delta = &delta
+		}
+	}
+
+	return m, true
+}
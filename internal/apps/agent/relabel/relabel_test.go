@@ -0,0 +1,150 @@
+package relabel_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dlomanov/mon/internal/apps/agent/relabel"
+	"github.com/dlomanov/mon/internal/entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestProcessor(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []relabel.Rule
+		in    []entities.Metric
+		want  []entities.Metric
+	}{
+		{
+			name:  "drop",
+			rules: []relabel.Rule{{Action: relabel.ActionDrop, Regex: "Lookups|BuckHashSys"}},
+			in:    []entities.Metric{gauge("Lookups", 1), gauge("BuckHashSys", 2), gauge("HeapAlloc", 3)},
+			want:  []entities.Metric{gauge("HeapAlloc", 3)},
+		},
+		{
+			name:  "keep",
+			rules: []relabel.Rule{{Action: relabel.ActionKeep, Regex: "Heap.*"}},
+			in:    []entities.Metric{gauge("Lookups", 1), gauge("HeapAlloc", 3)},
+			want:  []entities.Metric{gauge("HeapAlloc", 3)},
+		},
+		{
+			name: "rename and prefix",
+			rules: []relabel.Rule{
+				{Action: relabel.ActionRename, Regex: "(.*)Sys", Replacement: "${1}System"},
+				{Action: relabel.ActionPrefix, Replacement: "go."},
+			},
+			in:   []entities.Metric{gauge("HeapSys", 1), counter("PollCount", 2)},
+			want: []entities.Metric{gauge("go.HeapSystem", 1), counter("go.PollCount", 2)},
+		},
+		{
+			name:  "scale",
+			rules: []relabel.Rule{{Action: relabel.ActionScale, Regex: "Heap.*", Factor: 1.0 / (1 << 20)}},
+			in:    []entities.Metric{gauge("HeapAlloc", 3<<20), counter("HeapCount", 2)},
+			want:  []entities.Metric{gauge("HeapAlloc", 3), counter("HeapCount", 2)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := relabel.New(zap.NewNop(), tt.rules)
+			require.NoError(t, err)
+
+			assert.Equal(t, toMap(tt.want), p.Process(toMap(tt.in)))
+		})
+	}
+}
+
+func TestProcessor_Delta(t *testing.T) {
+	p, err := relabel.New(zap.NewNop(), []relabel.Rule{{Action: relabel.ActionDelta, Regex: "NumGC"}})
+	require.NoError(t, err)
+
+	assert.Empty(t, p.Process(toMap([]entities.Metric{gauge("NumGC", 10)})))
+	assert.Equal(t,
+		toMap([]entities.Metric{counter("NumGC", 5)}),
+		p.Process(toMap([]entities.Metric{gauge("NumGC", 15)})))
+	assert.Equal(t,
+		toMap([]entities.Metric{counter("NumGC", 3)}),
+		p.Process(toMap([]entities.Metric{gauge("NumGC", 3)})), "reset")
+}
+
+func TestProcessor_DeltaFraction(t *testing.T) {
+	p, err := relabel.New(zap.NewNop(), []relabel.Rule{{Action: relabel.ActionDelta, Regex: "Uptime"}})
+	require.NoError(t, err)
+
+	assert.Empty(t, p.Process(toMap([]entities.Metric{gauge("Uptime", 10)})))
+	for _, v := range []float64{10.4, 10.8} {
+		assert.Equal(t,
+			toMap([]entities.Metric{counter("Uptime", 0)}),
+			p.Process(toMap([]entities.Metric{gauge("Uptime", v)})))
+	}
+	assert.Equal(t,
+		toMap([]entities.Metric{counter("Uptime", 1)}),
+		p.Process(toMap([]entities.Metric{gauge("Uptime", 11.2)})), "increments add up past 1")
+	assert.Equal(t,
+		toMap([]entities.Metric{counter("Uptime", 2)}),
+		p.Process(toMap([]entities.Metric{gauge("Uptime", 13.1)})), "the remainder is kept")
+	assert.Equal(t,
+		toMap([]entities.Metric{counter("Uptime", 2)}),
+		p.Process(toMap([]entities.Metric{gauge("Uptime", 2.5)})), "reset")
+	assert.Equal(t,
+		toMap([]entities.Metric{counter("Uptime", 1)}),
+		p.Process(toMap([]entities.Metric{gauge("Uptime", 3)})), "the remainder is kept after reset")
+}
+
+func TestProcessor_DeltaTimestamp(t *testing.T) {
+	p, err := relabel.New(zap.NewNop(), []relabel.Rule{{Action: relabel.ActionDelta, Regex: "NumGC"}})
+	require.NoError(t, err)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sample := func(v float64, sec int) map[string]entities.Metric {
+		m := gauge("NumGC", v)
+		m.Timestamp = start.Add(time.Duration(sec) * time.Second)
+		return toMap([]entities.Metric{m})
+	}
+	p.Process(sample(10, 0))
+	want := counter("NumGC", 5)
+	want.Timestamp = start.Add(10 * time.Second)
+	assert.Equal(t, toMap([]entities.Metric{want}), p.Process(sample(15, 10)))
+}
+
+func TestProcessor_Collision(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	p, err := relabel.New(zap.New(core), []relabel.Rule{
+		{Action: relabel.ActionRename, Regex: "HeapSys|StackSys", Replacement: "Sys"},
+	})
+	require.NoError(t, err)
+
+	in := toMap([]entities.Metric{gauge("HeapSys", 1), gauge("StackSys", 2)})
+	assert.Len(t, p.Process(in), 1)
+	p.Process(in)
+	assert.Equal(t, 1, logs.Len(), "a collision is logged once")
+}
+
+func TestNew_Invalid(t *testing.T) {
+	_, err := relabel.New(zap.NewNop(), []relabel.Rule{{Action: "unknown"}})
+	require.Error(t, err)
+	_, err = relabel.New(zap.NewNop(), []relabel.Rule{{Action: relabel.ActionDrop, Regex: "("}})
+	require.Error(t, err)
+	_, err = relabel.New(zap.NewNop(), []relabel.Rule{{Action: relabel.ActionScale}})
+	require.Error(t, err)
+}
+
+func gauge(name string, value float64) entities.Metric {
+	return entities.Metric{MetricsKey: entities.MetricsKey{Name: name, Type: entities.MetricGauge}, Value: &value}
+}
+
+func counter(name string, delta int64) entities.Metric {
+	return entities.Metric{MetricsKey: entities.MetricsKey{Name: name, Type: entities.MetricCounter}, Delta: &delta}
+}
+
+func toMap(metrics []entities.Metric) map[string]entities.Metric {
+	result := make(map[string]entities.Metric, len(metrics))
+	for _, m := range metrics {
+		result[m.String()] = m
+	}
+	return result
+}
@@ -3,7 +3,7 @@ package grpc
 import (
 	"context"
 	"github.com/dlomanov/mon/internal/apps/agent/reporter"
-	"github.com/dlomanov/mon/internal/apps/agent/reporter/utils"
+	"github.com/dlomanov/mon/internal/apps/agent/reporter/identity"
 	pb "github.com/dlomanov/mon/internal/apps/shared/proto"
 	"github.com/dlomanov/mon/internal/entities"
 	"go.uber.org/zap"
@@ -16,15 +16,17 @@ var _ reporter.Client = (*Client)(nil)
 
 type (
 	Client struct {
-		logger *zap.Logger
-		conn   *grpc.ClientConn
-		client pb.MetricServiceClient
+		logger   *zap.Logger
+		conn     *grpc.ClientConn
+		client   pb.MetricServiceClient
+		identity *identity.Identity
 	}
 )
 
 func New(
 	logger *zap.Logger,
 	grpcAddr string,
+	id *identity.Identity,
 ) (*Client, error) {
 	conn, err := grpc.Dial(grpcAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
@@ -33,18 +35,22 @@ func New(
 	client := pb.NewMetricServiceClient(conn)
 
 	return &Client{
-		logger: logger,
-		conn:   conn,
-		client: client,
+		logger:   logger,
+		conn:     conn,
+		client:   client,
+		identity: id,
 	}, nil
 }
 
 func (r *Client) Report(ctx context.Context, metrics map[string]entities.Metric) {
-	ip, err := utils.GetOutboundIP()
-	if err != nil {
-		r.logger.Error("get outbound ip failed", zap.Error(err))
-	} else {
-		ctx = metadata.AppendToOutgoingContext(ctx, "X-Real-IP", ip.String())
+	if r.identity != nil {
+		headers, err := r.identity.Headers()
+		if err != nil {
+			r.logger.Error("get source ip failed", zap.Error(err))
+		}
+		for k, v := range headers {
+			ctx = metadata.AppendToOutgoingContext(ctx, k, v)
+		}
 	}
 
 	if _, err := r.client.Update(ctx, &pb.UpdateRequest{Metrics: r.toModels(metrics)}); err != nil {
@@ -63,6 +69,12 @@ func (r *Client) toModels(metrics map[string]entities.Metric) []*pb.Metric {
 			return pb.MetricType_COUNTER
 		case entities.MetricGauge:
 			return pb.MetricType_GAUGE
+		case entities.MetricHistogram:
+			return pb.MetricType_HISTOGRAM
+		case entities.MetricSummary:
+			return pb.MetricType_SUMMARY
+		case entities.MetricSet:
+			return pb.MetricType_SET
 		default:
 			return pb.MetricType_UNKNOWN
 		}
@@ -70,12 +82,43 @@ func (r *Client) toModels(metrics map[string]entities.Metric) []*pb.Metric {
 
 	ms := make([]*pb.Metric, 0, len(metrics))
 	for _, v := range metrics {
-		ms = append(ms, &pb.Metric{
+		m := &pb.Metric{
 			Name:  v.Name,
 			Type:  mapType(v.Type),
 			Value: v.Value,
 			Delta: v.Delta,
-		})
+			Total: v.Total,
+		}
+		if v.Histogram != nil {
+			m.Histogram = &pb.Histogram{
+				Bounds: v.Histogram.Bounds,
+				Counts: v.Histogram.Counts,
+				Sum:    v.Histogram.Sum,
+				Count:  v.Histogram.Count,
+			}
+		}
+		if v.Summary != nil {
+			m.Summary = &pb.Summary{
+				Alpha:    v.Summary.Alpha,
+				Positive: v.Summary.Positive,
+				Negative: v.Summary.Negative,
+				Zero:     v.Summary.Zero,
+				Count:    v.Summary.Count,
+				Sum:      v.Summary.Sum,
+				Min:      v.Summary.Min,
+				Max:      v.Summary.Max,
+			}
+		}
+		if v.Set != nil {
+			m.Set = &pb.Set{
+				Precision: uint32(v.Set.Precision),
+				Registers: v.Set.Registers,
+			}
+		}
+		if !v.Timestamp.IsZero() {
+			m.Timestamp = v.Timestamp.UnixNano()
+		}
+		ms = append(ms, m)
 	}
 	return ms
 }
@@ -2,19 +2,23 @@ package http
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/dlomanov/mon/internal/apps/agent/reporter"
-	"github.com/dlomanov/mon/internal/apps/agent/reporter/utils"
+	"github.com/dlomanov/mon/internal/apps/agent/reporter/identity"
 	"github.com/dlomanov/mon/internal/apps/shared/apimodels"
 	"github.com/dlomanov/mon/internal/entities"
+	"github.com/dlomanov/mon/internal/infra/services/compress"
 	"github.com/dlomanov/mon/internal/infra/services/encrypt"
 	"github.com/dlomanov/mon/internal/infra/services/hashing"
 	"github.com/go-resty/resty/v2"
 	"go.uber.org/zap"
+	"net/http"
 	"os"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -22,15 +26,32 @@ var _ reporter.Client = (*Client)(nil)
 
 type (
 	Client struct {
-		client  *resty.Client
-		logger  *zap.Logger
-		enc     *encrypt.Encryptor
-		hashKey string
+		client      *resty.Client
+		logger      *zap.Logger
+		enc         *encrypt.Encryptor
+		hashKey     string
+		compression Compression
+		identity    *identity.Identity
+		// negotiated is set once the server advertised support of the configured compression.
+		negotiated atomic.Bool
+		// downgraded is set once the server rejected the configured compression, gzip is used from then on.
+		downgraded atomic.Bool
 	}
 	Config struct {
 		Addr          string
 		PublicKeyPath string
 		HashKey       string
+		Compression   Compression
+		Identity      *identity.Identity // optional
+	}
+	// Compression configures request body compression.
+	// Until the server advertises the configured algorithm in the Accept-Encoding
+	// response header, requests are compressed with gzip, which every server supports.
+	// If the server rejects the algorithm anyway, the request is resent with gzip, which is kept from then on.
+	Compression struct {
+		Algorithm string // compress.Gzip (default), compress.Zstd or compress.Snappy
+		Level     int    // compress.DefaultLevel selects the algorithm default
+		MinSize   int    // bodies smaller than MinSize bytes are sent uncompressed
 	}
 )
 
@@ -47,14 +68,22 @@ func New(
 	if err != nil {
 		return nil, err
 	}
+	if config.Compression.Algorithm == "" {
+		config.Compression.Algorithm = compress.Gzip
+	}
+	if !compress.Supported(config.Compression.Algorithm) {
+		return nil, fmt.Errorf("%w: %s", compress.ErrUnsupported, config.Compression.Algorithm)
+	}
 	return &Client{
 		logger: logger,
 		client: createClient(client, config.Addr).
 			SetRetryWaitTime(1 * time.Second).
 			SetRetryMaxWaitTime(5 * time.Second).
 			SetRetryCount(3),
-		enc:     enc,
-		hashKey: config.HashKey,
+		enc:         enc,
+		hashKey:     config.HashKey,
+		compression: config.Compression,
+		identity:    config.Identity,
 	}, nil
 }
 
@@ -91,40 +120,103 @@ func (r *Client) Report(ctx context.Context, metrics map[string]entities.Metric)
 		headers["Encryption"] = ""
 	}
 
-	compressedJSON, err := compress(encJSON)
+	headers["Accept-Encoding"] = "gzip"
+
+	if r.identity != nil {
+		idHeaders, err := r.identity.Headers()
+		if err != nil {
+			r.logger.Error("get source ip failed", zap.Error(err))
+		}
+		for k, v := range idHeaders {
+			headers[k] = v
+		}
+	}
+
+	algo := r.algorithm(len(encJSON))
+	resp, err := r.post(ctx, headers, algo, encJSON)
 	if err != nil {
-		r.logger.Error("compression failed", zap.Error(err))
+		r.logger.Error("reporting metrics failed", zap.Error(err))
 		return
 	}
-	headers["Content-Encoding"] = "gzip"
-	headers["Accept-Encoding"] = "gzip"
+	if algo != "" && algo != compress.Gzip && rejectsEncoding(resp) {
+		// the server doesn't support the algorithm despite advertising it, e.g. it's replaced or behind a proxy
+		r.logger.Warn("compression rejected, falling back to gzip",
+			zap.String("algorithm", algo), zap.Int("status", resp.StatusCode()))
+		r.downgraded.Store(true)
+		if resp, err = r.post(ctx, headers, compress.Gzip, encJSON); err != nil {
+			r.logger.Error("reporting metrics failed", zap.Error(err))
+			return
+		}
+	}
+	r.negotiate(resp)
+
+	r.logger.Debug("metrics reported")
+}
 
-	ip, err := utils.GetOutboundIP()
+// post sends the body compressed with algo, uncompressed if algo is empty.
+func (r *Client) post(ctx context.Context, headers map[string]string, algo string, body []byte) (*resty.Response, error) {
+	compressed, err := r.compress(algo, body)
 	if err != nil {
-		r.logger.Error("get outbound ip failed", zap.Error(err))
-	} else {
-		headers["X-Real-IP"] = ip.String()
+		return nil, fmt.Errorf("compression failed: %w", err)
 	}
-
-	_, err = r.client.
+	req := r.client.
 		R().
 		SetContext(ctx).
 		SetHeaders(headers).
-		SetBody(compressedJSON).
-		Post("/updates/")
-	if err != nil {
-		r.logger.Error("reporting metrics failed", zap.Error(err))
-		return
+		SetBody(compressed)
+	if algo != "" {
+		req.SetHeader("Content-Encoding", algo)
 	}
+	return req.Post("/updates/")
+}
 
-	r.logger.Debug("metrics reported")
+// rejectsEncoding reports whether the server rejected the request because of its content coding.
+func rejectsEncoding(resp *resty.Response) bool {
+	return resp.StatusCode() == http.StatusNotAcceptable || resp.StatusCode() == http.StatusUnsupportedMediaType
+}
+
+// algorithm returns the compression algorithm for a body of the given size,
+// or an empty string if the body should be sent uncompressed.
+func (r *Client) algorithm(size int) string {
+	switch {
+	case size < r.compression.MinSize:
+		return ""
+	case r.negotiated.Load() && !r.downgraded.Load():
+		return r.compression.Algorithm
+	default:
+		return compress.Gzip
+	}
+}
+
+// negotiate updates the compression algorithm from the server response (RFC 7694).
+func (r *Client) negotiate(resp *resty.Response) {
+	if r.compression.Algorithm == compress.Gzip || r.downgraded.Load() {
+		return
+	}
+	switch {
+	case rejectsEncoding(resp):
+		r.negotiated.Store(false)
+	case resp.Header().Get("Accept-Encoding") != "":
+		accepted := compress.ParseList(resp.Header().Get("Accept-Encoding"))
+		ok := slices.Contains(accepted, r.compression.Algorithm)
+		if r.negotiated.Swap(ok) != ok {
+			r.logger.Debug("compression negotiated", zap.Bool("accepted", ok), zap.String("algorithm", r.compression.Algorithm))
+		}
+	}
 }
 
-func compress(dataJSON []byte) ([]byte, error) {
+func (r *Client) compress(algo string, dataJSON []byte) ([]byte, error) {
+	if algo == "" {
+		return dataJSON, nil
+	}
+
 	buf := bytes.Buffer{}
-	cw := gzip.NewWriter(&buf)
+	cw, err := compress.NewWriter(algo, &buf, r.compression.Level)
+	if err != nil {
+		return nil, err
+	}
 
-	_, err := cw.Write(dataJSON)
+	_, err = cw.Write(dataJSON)
 	if err != nil {
 		return nil, err
 	}
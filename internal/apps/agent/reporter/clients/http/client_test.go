@@ -0,0 +1,167 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/dlomanov/mon/internal/entities"
+	"github.com/dlomanov/mon/internal/infra/services/compress"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// testServer records content codings of reported bodies and replies with the status and accepted codings.
+// Bodies of rejected codings are replied with 406 Not Acceptable.
+type testServer struct {
+	mu        sync.Mutex
+	encodings []string
+	status    int
+	accepted  string
+	rejected  map[string]bool
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if encoding := r.Header.Get("Content-Encoding"); s.rejected[encoding] {
+		s.encodings = append(s.encodings, encoding)
+		w.Header().Set("Accept-Encoding", s.accepted)
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+
+	body := r.Body
+	if encoding := r.Header.Get("Content-Encoding"); encoding != "" {
+		reader, err := compress.NewReader(encoding, r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer func(reader io.Closer) { _ = reader.Close() }(reader)
+		body = reader
+	}
+	if _, err := io.ReadAll(body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.encodings = append(s.encodings, r.Header.Get("Content-Encoding"))
+
+	if s.accepted != "" {
+		w.Header().Set("Accept-Encoding", s.accepted)
+	}
+	w.WriteHeader(s.status)
+}
+
+func (s *testServer) reject(encoding string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rejected = map[string]bool{encoding: true}
+}
+
+func (s *testServer) reported() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.encodings
+}
+
+func TestClient_Compression(t *testing.T) {
+	value := 1.5
+	metrics := map[string]entities.Metric{
+		"gauge_cpu": {MetricsKey: entities.MetricsKey{Name: "cpu", Type: entities.MetricGauge}, Value: &value},
+	}
+	tests := []struct {
+		name        string
+		compression Compression
+		accepted    string
+		want        []string
+	}{
+		{
+			name:        "gzip by default",
+			compression: Compression{},
+			accepted:    "zstd, snappy, gzip",
+			want:        []string{compress.Gzip, compress.Gzip},
+		},
+		{
+			name:        "zstd once advertised",
+			compression: Compression{Algorithm: compress.Zstd},
+			accepted:    "zstd, snappy, gzip",
+			want:        []string{compress.Gzip, compress.Zstd, compress.Zstd},
+		},
+		{
+			name:        "snappy once advertised",
+			compression: Compression{Algorithm: compress.Snappy},
+			accepted:    "snappy, gzip",
+			want:        []string{compress.Gzip, compress.Snappy},
+		},
+		{
+			name:        "gzip if not advertised",
+			compression: Compression{Algorithm: compress.Zstd},
+			accepted:    "gzip",
+			want:        []string{compress.Gzip, compress.Gzip},
+		},
+		{
+			name:        "gzip if server doesn't advertise",
+			compression: Compression{Algorithm: compress.Zstd},
+			want:        []string{compress.Gzip, compress.Gzip},
+		},
+		{
+			name:        "small bodies uncompressed",
+			compression: Compression{Algorithm: compress.Zstd, MinSize: 1 << 20},
+			accepted:    "zstd, snappy, gzip",
+			want:        []string{"", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &testServer{status: http.StatusOK, accepted: tt.accepted}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			c, err := New(zaptest.NewLogger(t), Config{Addr: ts.URL, Compression: tt.compression}, nil)
+			require.NoError(t, err)
+			for range tt.want {
+				c.Report(context.Background(), metrics)
+			}
+			assert.Equal(t, tt.want, s.reported())
+		})
+	}
+}
+
+func TestClient_CompressionFallback(t *testing.T) {
+	value := 1.5
+	metrics := map[string]entities.Metric{
+		"gauge_cpu": {MetricsKey: entities.MetricsKey{Name: "cpu", Type: entities.MetricGauge}, Value: &value},
+	}
+	s := &testServer{status: http.StatusOK, accepted: "zstd, gzip"}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	c, err := New(zaptest.NewLogger(t), Config{Addr: ts.URL, Compression: Compression{Algorithm: compress.Zstd}}, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	c.Report(ctx, metrics)
+	c.Report(ctx, metrics)
+	// the server still advertises zstd, but a proxy in front of it rejects zstd bodies
+	s.reject(compress.Zstd)
+	c.Report(ctx, metrics)
+	c.Report(ctx, metrics)
+	c.Report(ctx, metrics)
+
+	// the rejected body is resent with gzip, which is kept despite zstd being advertised
+	assert.Equal(t,
+		[]string{compress.Gzip, compress.Zstd, compress.Zstd, compress.Gzip, compress.Gzip, compress.Gzip},
+		s.reported())
+}
+
+func TestNew_UnsupportedCompression(t *testing.T) {
+	_, err := New(zaptest.NewLogger(t), Config{Compression: Compression{Algorithm: "br"}}, nil)
+	assert.ErrorIs(t, err, compress.ErrUnsupported)
+}
@@ -0,0 +1,203 @@
+// Package identity resolves the source identity the agent reports to the server
+// in the X-Real-IP and X-Agent-ID headers.
+//
+// The source IP is resolved in order of precedence from:
+//   - an explicit IP address;
+//   - the first address of a named network interface;
+//   - the local address of a connection to the server.
+//
+// The resolved IP is cached and resolved again only when host interface addresses change.
+package identity
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	HeaderIP      = "X-Real-IP"
+	HeaderAgentID = "X-Agent-ID"
+
+	// DefaultRefreshInterval is the default interval of interface addresses checks.
+	DefaultRefreshInterval = 30 * time.Second
+)
+
+var ErrNoAddress = errors.New("identity: no address found")
+
+type (
+	Config struct {
+		IP              string        // explicit source IP
+		Interface       string        // network interface name to take the source IP from
+		ServerAddr      string        // server address, the local address of a connection to it is used by default
+		AgentID         string        // optional agent identifier, the server attributes logged requests to it
+		RefreshInterval time.Duration // interval of interface addresses checks, DefaultRefreshInterval if zero
+	}
+
+	// Identity is the agent source identity. It is safe for concurrent use.
+	Identity struct {
+		cfg Config
+
+		mu          sync.Mutex
+		ip          net.IP
+		fingerprint string
+		checkedAt   time.Time
+
+		// overridden in tests
+		now            func() time.Time
+		interfaceAddrs func() ([]net.Addr, error)
+	}
+)
+
+// New creates Identity. It fails if the explicit IP is invalid;
+// other resolution errors are reported by IP.
+func New(cfg Config) (*Identity, error) {
+	if cfg.IP != "" && net.ParseIP(cfg.IP) == nil {
+		return nil, fmt.Errorf("identity: invalid IP %q", cfg.IP)
+	}
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = DefaultRefreshInterval
+	}
+	cfg.ServerAddr = hostPort(cfg.ServerAddr)
+	return &Identity{
+		cfg:            cfg,
+		now:            time.Now,
+		interfaceAddrs: net.InterfaceAddrs,
+	}, nil
+}
+
+// AgentID returns the configured agent identifier, possibly empty.
+func (i *Identity) AgentID() string {
+	return i.cfg.AgentID
+}
+
+// IP returns the source IP.
+func (i *Identity) IP() (net.IP, error) {
+	if i.cfg.IP != "" {
+		return net.ParseIP(i.cfg.IP), nil
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	now := i.now()
+	if i.ip != nil && now.Sub(i.checkedAt) < i.cfg.RefreshInterval {
+		return i.ip, nil
+	}
+	i.checkedAt = now
+
+	fingerprint, err := i.addrsFingerprint()
+	if err == nil && i.ip != nil && fingerprint == i.fingerprint {
+		return i.ip, nil
+	}
+
+	ip, err := i.resolve()
+	if err != nil {
+		return nil, err
+	}
+	i.ip, i.fingerprint = ip, fingerprint
+	return ip, nil
+}
+
+// Headers returns identity headers to attach to a request.
+// The IP header is omitted if the source IP can't be resolved.
+func (i *Identity) Headers() (map[string]string, error) {
+	headers := make(map[string]string, 2)
+	if i.cfg.AgentID != "" {
+		headers[HeaderAgentID] = i.cfg.AgentID
+	}
+	ip, err := i.IP()
+	if err != nil {
+		return headers, err
+	}
+	headers[HeaderIP] = ip.String()
+	return headers, nil
+}
+
+func (i *Identity) resolve() (net.IP, error) {
+	if i.cfg.Interface != "" {
+		return interfaceIP(i.cfg.Interface)
+	}
+	return connectionIP(i.cfg.ServerAddr)
+}
+
+func (i *Identity) addrsFingerprint() (string, error) {
+	addrs, err := i.interfaceAddrs()
+	if err != nil {
+		return "", err
+	}
+	values := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		values = append(values, a.String())
+	}
+	slices.Sort(values)
+	return strings.Join(values, ","), nil
+}
+
+// interfaceIP returns the first IPv4 address of the interface, or the first IPv6 address if there is none.
+func interfaceIP(name string) (net.IP, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	var result net.IP
+	for _, a := range addrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ipNet.IP.To4() != nil {
+			return ipNet.IP, nil
+		}
+		if result == nil {
+			result = ipNet.IP
+		}
+	}
+	if result == nil {
+		return nil, fmt.Errorf("%w: interface %s", ErrNoAddress, name)
+	}
+	return result, nil
+}
+
+// connectionIP returns the local address used to reach addr.
+// Dialing UDP doesn't send any packets, it only selects the route.
+func connectionIP(addr string) (net.IP, error) {
+	if addr == "" {
+		return nil, fmt.Errorf("%w: server address is empty", ErrNoAddress)
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer func(conn net.Conn) { _ = conn.Close() }(conn)
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
+
+// hostPort strips the scheme and path from a server address.
+func hostPort(addr string) string {
+	if !strings.Contains(addr, "://") {
+		return addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return addr
+	}
+	if u.Port() != "" {
+		return u.Host
+	}
+	switch u.Scheme {
+	case "https":
+		return net.JoinHostPort(u.Hostname(), "443")
+	default:
+		return net.JoinHostPort(u.Hostname(), "80")
+	}
+}
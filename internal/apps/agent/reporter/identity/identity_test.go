@@ -0,0 +1,104 @@
+package identity
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentity_IP(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "explicit",
+			cfg:  Config{IP: "10.1.2.3", Interface: "lo", ServerAddr: "127.0.0.1:8080"},
+			want: "10.1.2.3",
+		},
+		{
+			name: "interface",
+			cfg:  Config{Interface: "lo", ServerAddr: "192.0.2.1:8080"},
+			want: "127.0.0.1",
+		},
+		{
+			name: "connection",
+			cfg:  Config{ServerAddr: "http://127.0.0.1:8080"},
+			want: "127.0.0.1",
+		},
+		{
+			name:    "unknown interface",
+			cfg:     Config{Interface: "mon-unknown0"},
+			wantErr: true,
+		},
+		{
+			name:    "no server address",
+			cfg:     Config{},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := New(tt.cfg)
+			require.NoError(t, err)
+
+			ip, err := id.IP()
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, ip.String())
+		})
+	}
+}
+
+func TestIdentity_Refresh(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	calls := 0
+	addrs := []net.Addr{&net.IPNet{IP: net.IPv4(10, 0, 0, 1), Mask: net.CIDRMask(8, 32)}}
+
+	id, err := New(Config{ServerAddr: "127.0.0.1:8080", RefreshInterval: time.Minute})
+	require.NoError(t, err)
+	id.now = func() time.Time { return now }
+	id.interfaceAddrs = func() ([]net.Addr, error) {
+		calls++
+		return addrs, nil
+	}
+
+	_, err = id.IP()
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+	fingerprint := id.fingerprint
+
+	_, err = id.IP()
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls, "cached within refresh interval")
+
+	now = now.Add(time.Minute)
+	addrs = append(addrs, &net.IPNet{IP: net.IPv4(10, 0, 0, 2), Mask: net.CIDRMask(8, 32)})
+	_, err = id.IP()
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.NotEqual(t, fingerprint, id.fingerprint, "resolved again on interface change")
+}
+
+func TestNew_InvalidIP(t *testing.T) {
+	_, err := New(Config{IP: "10.0.0"})
+	require.Error(t, err)
+}
+
+func TestIdentity_Headers(t *testing.T) {
+	id, err := New(Config{IP: "10.1.2.3", AgentID: "agent-1"})
+	require.NoError(t, err)
+
+	headers, err := id.Headers()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{HeaderIP: "10.1.2.3", HeaderAgentID: "agent-1"}, headers)
+}
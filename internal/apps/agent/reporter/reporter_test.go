@@ -3,7 +3,6 @@ package reporter_test
 import (
 	"github.com/dlomanov/mon/internal/apps/agent/reporter"
 	httpclient "github.com/dlomanov/mon/internal/apps/agent/reporter/clients/http"
-	"github.com/dlomanov/mon/internal/apps/agent/reporter/utils"
 	"github.com/dlomanov/mon/internal/entities"
 	"github.com/go-resty/resty/v2"
 	"github.com/jarcoal/httpmock"
@@ -55,9 +54,3 @@ func TestReporter(t *testing.T) {
 	info := httpmock.GetCallCountInfo()
 	assert.Equal(t, 1, info["POST "+url])
 }
-
-func TestGetOutboundIP(t *testing.T) {
-	localAddr, err := utils.GetOutboundIP()
-	require.NoError(t, err)
-	t.Log("IP:", localAddr)
-}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/dlomanov/mon/internal/apps/server/container"
+	"github.com/dlomanov/mon/internal/infra/services/backup"
+	"go.uber.org/zap"
+)
+
+// Backup - writes a consistent snapshot of the configured storage to the archive file.
+func Backup(ctx context.Context, cfg Config, logger *zap.Logger, path string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	c, err := container.NewContainer(ctx, logger, cfg.Config)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	b, err := c.BackupUseCase.Backup(ctx)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err = backup.Write(f, b); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write backup archive: %w", err)
+	}
+
+	logger.Info("metrics backed up",
+		zap.String("path", path),
+		zap.Int("metrics", len(b.Metrics)),
+		zap.Int("metadata", len(b.Metadata)))
+	return nil
+}
+
+// Restore - replaces metrics and metadata of the configured storage with the ones of the archive file.
+func Restore(ctx context.Context, cfg Config, logger *zap.Logger, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	b, err := backup.Read(f)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	c, err := container.NewContainer(ctx, logger, cfg.Config)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err = c.BackupUseCase.Restore(ctx, b); err != nil {
+		return err
+	}
+
+	logger.Info("metrics restored",
+		zap.String("path", path),
+		zap.Time("created_at", b.CreatedAt),
+		zap.Int("metrics", len(b.Metrics)),
+		zap.Int("metadata", len(b.Metadata)))
+	return nil
+}
@@ -3,19 +3,42 @@ package container
 import (
 	"net"
 	"time"
+
+	"github.com/dlomanov/mon/internal/entities"
 )
 
 // Config holds the configuration for the server application.
 // It includes settings for logging, storage, database connection, and other application parameters.
 type Config struct {
-	LogLevel        string        // LogLevel specifies the logging level (e.g., "debug", "info", "warn", "error").
-	StoreInterval   time.Duration // StoreInterval defines the interval at which metrics are stored.
-	FileStoragePath string        // FileStoragePath is the path to the directory where metrics are stored in file storage.
-	Restore         bool          // Restore indicates whether to restore metrics from storage on startup.
-	DatabaseDSN     string        // DatabaseDSN is the data source name for connecting to the database.
-	Key             string        // Key is the secret key used for hashing.
-	Addr            string        // Server host and port.
-	GRPCAddr        string        // GRPCServer host and port.
-	PrivateKeyPath  string        // Path to private PEM key for decrypting incoming metrics.
-	TrustedSubnet   *net.IPNet    // Trusted subnet (CIDR)
+	LogLevel              string                  // LogLevel specifies the logging level (e.g., "debug", "info", "warn", "error").
+	StoreInterval         time.Duration           // StoreInterval defines the interval at which metrics are stored.
+	FileStoragePath       string                  // FileStoragePath is the path to the directory where metrics are stored in file storage.
+	Restore               bool                    // Restore indicates whether to restore metrics from storage on startup.
+	DatabaseDSN           string                  // DatabaseDSN is the data source name for connecting to the database.
+	SkipMigration         bool                    // SkipMigration disables database migrations on startup, the schema is checked instead.
+	DatabasePool          DatabasePool            // DatabasePool limits the database connection pool.
+	Key                   string                  // Key is the secret key used for hashing.
+	Addr                  string                  // Server host and port.
+	GRPCAddr              string                  // GRPCServer host and port.
+	PrivateKeyPath        string                  // Path to private PEM key for decrypting incoming metrics.
+	AllowLegacyEncryption bool                    // AllowLegacyEncryption accepts metrics encrypted in the unauthenticated legacy format.
+	TrustedSubnet         *net.IPNet              // Trusted subnet (CIDR)
+	AdminToken            string                  // AdminToken authorizes admin operations, they are disabled if empty.
+	Expiry                entities.Expiry         // Expiry sets TTLs after which metrics become stale and are evicted.
+	SweepInterval         time.Duration           // SweepInterval defines the interval at which expired metrics are evicted.
+	CounterOverflow       entities.OverflowPolicy // CounterOverflow defines what happens when a counter exceeds the int64 range.
+	HistorySize           int                     // HistorySize is the number of points kept per metric by in-memory history.
+	Retention             entities.Retention      // Retention defines history rollup tiers and how long their points are kept.
+	CompactInterval       time.Duration           // CompactInterval defines the interval at which history is rolled up and truncated.
+	BackupDir             string                  // BackupDir is the directory of scheduled backups, they are disabled if empty.
+	BackupInterval        time.Duration           // BackupInterval defines the interval at which scheduled backups are made.
+	BackupKeep            int                     // BackupKeep is the number of latest scheduled backups kept, zero keeps all.
+}
+
+// DatabasePool holds the database connection pool limits, zero values keep the database/sql defaults.
+type DatabasePool struct {
+	MaxOpenConns    int           // MaxOpenConns is the maximum number of open connections.
+	MaxIdleConns    int           // MaxIdleConns is the maximum number of idle connections.
+	ConnMaxLifetime time.Duration // ConnMaxLifetime is the maximum time a connection may be reused.
+	ConnMaxIdleTime time.Duration // ConnMaxIdleTime is the maximum time a connection may be idle.
 }
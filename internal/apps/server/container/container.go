@@ -3,7 +3,9 @@ package container
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/dlomanov/mon/internal/apps/server/usecases"
+	"github.com/dlomanov/mon/internal/infra/services/backup"
 	"github.com/dlomanov/mon/internal/infra/services/encrypt"
 	storage2 "github.com/dlomanov/mon/internal/infra/storage"
 	"io"
@@ -19,12 +21,16 @@ type (
 	// It serves as a central place for managing dependencies and
 	// configuration across the application.
 	Container struct {
-		Config        Config
-		DB            *sqlx.DB
-		Logger        *zap.Logger
-		Dec           *encrypt.Decryptor
-		MetricUseCase *usecases.MetricUseCase
-		storage       usecases.Storage
+		Config          Config
+		DB              *sqlx.DB
+		Logger          *zap.Logger
+		Dec             *encrypt.Decryptor
+		MetricUseCase   *usecases.MetricUseCase
+		MetadataUseCase *usecases.MetadataUseCase
+		HistoryUseCase  *usecases.HistoryUseCase
+		BackupUseCase   *usecases.BackupUseCase
+		storage         usecases.Storage
+		history         usecases.HistoryStorage
 	}
 )
 
@@ -45,20 +51,61 @@ func NewContainer(
 		return nil, err
 	}
 
-	dec, err := createDecryptor(cfg.PrivateKeyPath)
+	dec, err := createDecryptor(cfg.PrivateKeyPath, cfg.AllowLegacyEncryption)
 	if err != nil {
 		return nil, err
 	}
 
-	metricUC := usecases.NewMetricUseCase(s)
+	meta, err := createMetaStorage(logger, s, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := createHistoryStorage(ctx, logger, s, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	backupStorage, err := createBackupStorage(s, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	metricUC := usecases.NewMetricUseCase(logger, s, meta, history, usecases.MetricConfig{
+		Expiry:   cfg.Expiry,
+		Overflow: cfg.CounterOverflow,
+	})
+	go func() {
+		err := metricUC.SweepLoop(ctx, logger, cfg.SweepInterval)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			logger.Error("failed sweep loop", zap.Error(err))
+		}
+	}()
+	metadataUC := usecases.NewMetadataUseCase(meta)
+	historyUC := usecases.NewHistoryUseCase(history, cfg.Retention)
+	go func() {
+		err := historyUC.CompactLoop(ctx, logger, cfg.CompactInterval)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			logger.Error("failed compact loop", zap.Error(err))
+		}
+	}()
+
+	backupUC := usecases.NewBackupUseCase(backupStorage)
+	if err = startBackupLoop(ctx, logger, backupUC, cfg); err != nil {
+		return nil, err
+	}
 
 	return &Container{
-		Config:        cfg,
-		Logger:        logger,
-		DB:            db,
-		Dec:           dec,
-		MetricUseCase: metricUC,
-		storage:       s,
+		Config:          cfg,
+		Logger:          logger,
+		DB:              db,
+		Dec:             dec,
+		MetricUseCase:   metricUC,
+		MetadataUseCase: metadataUC,
+		HistoryUseCase:  historyUC,
+		BackupUseCase:   backupUC,
+		storage:         s,
+		history:         history,
 	}, nil
 }
 
@@ -71,6 +118,12 @@ func (c *Container) Close() {
 			c.Logger.Error("failed to close storage", zap.Error(err))
 		}
 	}
+	// the storage closed above may keep history itself
+	if closer, ok := c.history.(io.Closer); ok && any(c.history) != any(c.storage) {
+		if err := closer.Close(); err != nil {
+			c.Logger.Error("failed to close history storage", zap.Error(err))
+		}
+	}
 	if c.DB != nil {
 		if err := c.DB.Close(); err != nil {
 			c.Logger.Error("failed to close DB", zap.Error(err))
@@ -82,7 +135,25 @@ func createDB(ctx context.Context, cfg Config) (*sqlx.DB, error) {
 	if cfg.DatabaseDSN == "" {
 		return nil, nil
 	}
-	return sqlx.ConnectContext(ctx, "pgx", cfg.DatabaseDSN)
+	db, err := sqlx.ConnectContext(ctx, "pgx", cfg.DatabaseDSN)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := cfg.DatabasePool
+	if pool.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(pool.MaxOpenConns)
+	}
+	if pool.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(pool.MaxIdleConns)
+	}
+	if pool.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	}
+	if pool.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+	}
+	return db, nil
 }
 
 func createStorage(
@@ -93,7 +164,11 @@ func createStorage(
 ) (usecases.Storage, error) {
 	switch {
 	case db != nil:
-		return storage2.NewPGStorage(ctx, logger, db)
+		var opts []storage2.PGOption
+		if cfg.SkipMigration {
+			opts = append(opts, storage2.SkipMigration())
+		}
+		return storage2.NewPGStorage(ctx, logger, db, opts...)
 	case cfg.FileStoragePath != "":
 		return createFileStorage(ctx, logger, cfg)
 	default:
@@ -101,6 +176,95 @@ func createStorage(
 	}
 }
 
+// createMetaStorage returns the metric storage itself if it supports metadata,
+// otherwise metadata is kept next to the storage file or in memory.
+func createMetaStorage(
+	logger *zap.Logger,
+	s usecases.Storage,
+	cfg Config,
+) (usecases.MetaStorage, error) {
+	if meta, ok := s.(usecases.MetaStorage); ok {
+		return meta, nil
+	}
+	path := ""
+	if cfg.FileStoragePath != "" {
+		path = cfg.FileStoragePath + ".meta"
+	}
+	return storage2.NewMetaStorage(logger, path)
+}
+
+// createHistoryStorage returns the metric storage itself if it supports history,
+// otherwise the latest points are kept in memory and dumped next to the storage file.
+func createHistoryStorage(
+	ctx context.Context,
+	logger *zap.Logger,
+	s usecases.Storage,
+	cfg Config,
+) (usecases.HistoryStorage, error) {
+	if history, ok := s.(usecases.HistoryStorage); ok {
+		return history, nil
+	}
+	path := ""
+	if cfg.FileStoragePath != "" {
+		path = cfg.FileStoragePath + ".history"
+	}
+	history, err := storage2.NewMemHistory(logger, cfg.HistorySize, path)
+	if err != nil {
+		return nil, err
+	}
+
+	// history is too large to be dumped on every update, so it's dumped at least as often as it's compacted
+	interval := cfg.StoreInterval
+	if interval <= 0 || cfg.CompactInterval > 0 && cfg.CompactInterval < interval {
+		interval = cfg.CompactInterval
+	}
+	if interval <= 0 {
+		interval = usecases.DefaultCompactInterval
+	}
+	go func() {
+		err := history.DumpLoop(ctx, interval)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			logger.Error("failed history dump loop", zap.Error(err))
+		}
+	}()
+	return history, nil
+}
+
+// createBackupStorage returns the metric storage itself if it backs up metadata as well,
+// otherwise metrics and metadata storages are backed up one after another.
+func createBackupStorage(s usecases.Storage, meta usecases.MetaStorage) (usecases.BackupStorage, error) {
+	if backup, ok := s.(usecases.BackupStorage); ok {
+		return backup, nil
+	}
+	metrics, ok := s.(storage2.MetricsReplacer)
+	if !ok {
+		return nil, fmt.Errorf("storage %T doesn't support backups", s)
+	}
+	metaStorage, ok := meta.(*storage2.MetaStorage)
+	if !ok {
+		return nil, fmt.Errorf("metadata storage %T doesn't support backups", meta)
+	}
+	return storage2.NewSplitBackup(metrics, metaStorage), nil
+}
+
+// startBackupLoop starts scheduled backups to the backup directory if it's set.
+func startBackupLoop(ctx context.Context, logger *zap.Logger, uc *usecases.BackupUseCase, cfg Config) error {
+	if cfg.BackupDir == "" || cfg.BackupInterval <= 0 {
+		return nil
+	}
+	dir, err := backup.NewDir(cfg.BackupDir, cfg.BackupKeep)
+	if err != nil {
+		return err
+	}
+	go func() {
+		err := uc.BackupLoop(ctx, logger, cfg.BackupInterval, dir.Save)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			logger.Error("failed backup loop", zap.Error(err))
+		}
+	}()
+	return nil
+}
+
 func createFileStorage(
 	ctx context.Context,
 	logger *zap.Logger,
@@ -127,7 +291,7 @@ func createFileStorage(
 	return fs, nil
 }
 
-func createDecryptor(keyPath string) (*encrypt.Decryptor, error) {
+func createDecryptor(keyPath string, allowLegacy bool) (*encrypt.Decryptor, error) {
 	if keyPath == "" {
 		return nil, nil
 	}
@@ -135,5 +299,5 @@ func createDecryptor(keyPath string) (*encrypt.Decryptor, error) {
 	if err != nil {
 		return nil, err
 	}
-	return encrypt.NewDecryptor(privateKey)
+	return encrypt.NewDecryptor(privateKey, allowLegacy)
 }
@@ -0,0 +1,57 @@
+package interceptor
+
+import (
+	"context"
+	"crypto/subtle"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Admin authorizes admin calls with the admin token
+// passed in the "authorization" metadata as "Bearer <token>".
+// Admin calls are the ones of the named services and the listed full methods.
+// If the token isn't configured, admin calls are denied. Other calls pass through.
+func Admin(logger *zap.Logger, token string, serviceNames []string, methods ...string) grpc.UnaryServerInterceptor {
+	isAdmin := func(fullMethod string) bool {
+		for _, name := range serviceNames {
+			if strings.HasPrefix(fullMethod, "/"+name+"/") {
+				return true
+			}
+		}
+		return slices.Contains(methods, fullMethod)
+	}
+	return func(
+		ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		if !isAdmin(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		if token == "" {
+			logger.Debug("admin: operations are disabled")
+			return nil, status.Error(codes.PermissionDenied, "admin operations are disabled")
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get("authorization")
+		if len(values) == 0 {
+			logger.Debug("admin: missing token")
+			return nil, status.Error(codes.Unauthenticated, "missing admin token")
+		}
+		got, ok := strings.CutPrefix(values[0], "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			logger.Debug("admin: invalid token")
+			return nil, status.Error(codes.Unauthenticated, "invalid admin token")
+		}
+
+		return handler(ctx, req)
+	}
+}
@@ -13,23 +13,38 @@ import (
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
 func UseServices(s *grpcserver.Server, c *container.Container) {
 	pb.RegisterMetricServiceServer(s.Server, services.NewMetricService(c.Logger, c.MetricUseCase))
+	pb.RegisterMetadataServiceServer(s.Server, services.NewMetadataService(c.Logger, c.MetadataUseCase))
+	pb.RegisterAdminServiceServer(s.Server, services.NewAdminService(c.Logger, c.MetricUseCase))
 }
 
 func GetServerOptions(c *container.Container) grpcserver.Option {
 	return grpcserver.ServerOptions(grpc.ChainUnaryInterceptor(
 		interceptor.TrustedSubnet(c.Logger, c.Config.TrustedSubnet),
-		logging.UnaryServerInterceptor(interceptorLogger(c.Logger.Sugar())),
+		interceptor.Admin(c.Logger, c.Config.AdminToken,
+			[]string{pb.AdminService_ServiceDesc.ServiceName},
+			pb.MetadataService_Register_FullMethodName),
+		logging.UnaryServerInterceptor(interceptorLogger(c.Logger.Sugar()), logging.WithFieldsFromContext(agentFields)),
 		recovery.UnaryServerInterceptor(recovery.WithRecoveryHandler(func(p any) (err error) {
 			c.Logger.Error("cached panic", zap.Any("panic", p))
 			return status.Error(codes.Internal, "internal server error")
 		}))))
 }
 
+// agentFields attributes calls to the agent identified by the "x-agent-id" metadata.
+func agentFields(ctx context.Context) logging.Fields {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("x-agent-id"); len(values) != 0 && values[0] != "" {
+		return logging.Fields{"agent_id", values[0]}
+	}
+	return nil
+}
+
 func interceptorLogger(sugar *zap.SugaredLogger) logging.Logger {
 	return logging.LoggerFunc(func(_ context.Context, lvl logging.Level, msg string, fields ...any) {
 		switch lvl {
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/dlomanov/mon/internal/apps/server/usecases"
+	pb "github.com/dlomanov/mon/internal/apps/shared/proto"
+	"github.com/dlomanov/mon/internal/entities"
+	"github.com/dlomanov/mon/internal/entities/apperrors"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ pb.AdminServiceServer = (*AdminService)(nil)
+
+// AdminService removes and resets metrics, calls are authorized by interceptor.Admin.
+type AdminService struct {
+	pb.UnimplementedAdminServiceServer
+	logger   *zap.Logger
+	metricUC *usecases.MetricUseCase
+}
+
+func NewAdminService(
+	logger *zap.Logger,
+	metricUC *usecases.MetricUseCase,
+) *AdminService {
+	return &AdminService{
+		logger:   logger,
+		metricUC: metricUC,
+	}
+}
+
+func (a *AdminService) Delete(ctx context.Context, request *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	emptyResp := &pb.DeleteResponse{}
+
+	keys := make([]entities.MetricsKey, 0, len(request.GetKeys()))
+	for _, k := range request.GetKeys() {
+		typ := entities.MetricType(strings.ToLower(k.GetType().String()))
+		if !typ.IsValid() || entities.ValidateMetricName(k.GetName()) != nil {
+			return emptyResp, status.Error(codes.InvalidArgument, "invalid metric key")
+		}
+		keys = append(keys, entities.MetricsKey{Name: k.GetName(), Type: typ})
+	}
+	if len(keys) == 0 {
+		a.logger.Debug("no keys provided")
+		return emptyResp, status.Error(codes.InvalidArgument, "no keys provided")
+	}
+
+	deleted, err := a.metricUC.Delete(ctx, keys...)
+	if err != nil {
+		a.logger.Debug("failed delete metrics", zap.Error(err))
+		return emptyResp, internalStatus(err)
+	}
+	return &pb.DeleteResponse{Deleted: int64(deleted)}, nil
+}
+
+func (a *AdminService) DeleteByPattern(
+	ctx context.Context,
+	request *pb.DeleteByPatternRequest,
+) (*pb.DeleteResponse, error) {
+	deleted, err := a.metricUC.DeleteByPattern(ctx, entities.NamePattern(request.GetPattern()))
+	if err != nil {
+		a.logger.Debug("failed delete metrics by pattern", zap.Error(err))
+		var errInvalid *apperrors.AppErrorInvalid
+		if errors.As(err, &errInvalid) {
+			return &pb.DeleteResponse{}, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return &pb.DeleteResponse{}, internalStatus(err)
+	}
+	return &pb.DeleteResponse{Deleted: int64(deleted)}, nil
+}
+
+func (a *AdminService) ResetCounter(
+	ctx context.Context,
+	request *pb.ResetCounterRequest,
+) (*pb.ResetCounterResponse, error) {
+	emptyResp := &pb.ResetCounterResponse{}
+
+	err := a.metricUC.ResetCounter(ctx, request.GetName())
+	if err != nil {
+		a.logger.Debug("failed reset counter", zap.Error(err))
+		var errNotFound *apperrors.AppErrorNotFound
+		if errors.As(err, &errNotFound) {
+			return emptyResp, status.Error(codes.NotFound, err.Error())
+		}
+		return emptyResp, internalStatus(err)
+	}
+	return emptyResp, nil
+}
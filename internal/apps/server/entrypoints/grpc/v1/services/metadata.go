@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/dlomanov/mon/internal/apps/server/usecases"
+	pb "github.com/dlomanov/mon/internal/apps/shared/proto"
+	"github.com/dlomanov/mon/internal/entities"
+	"github.com/dlomanov/mon/internal/entities/apperrors"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ pb.MetadataServiceServer = (*MetadataService)(nil)
+
+type MetadataService struct {
+	pb.UnimplementedMetadataServiceServer
+	logger     *zap.Logger
+	metadataUC *usecases.MetadataUseCase
+}
+
+func NewMetadataService(
+	logger *zap.Logger,
+	metadataUC *usecases.MetadataUseCase,
+) *MetadataService {
+	return &MetadataService{
+		logger:     logger,
+		metadataUC: metadataUC,
+	}
+}
+
+// Register declares metadata of a metric name, calls are authorized by interceptor.Admin.
+func (m *MetadataService) Register(
+	ctx context.Context,
+	request *pb.RegisterMetadataRequest,
+) (*pb.RegisterMetadataResponse, error) {
+	emptyResp := &pb.RegisterMetadataResponse{}
+
+	meta := request.GetMetadata()
+	if meta == nil {
+		m.logger.Debug("no metadata provided")
+		return emptyResp, status.Error(codes.InvalidArgument, "no metadata provided")
+	}
+
+	if _, err := m.metadataUC.Register(ctx, toMetadataEntity(meta)); err != nil {
+		m.logger.Debug("failed register metadata", zap.Error(err))
+		var errInvalid *apperrors.AppErrorInvalid
+		if errors.As(err, &errInvalid) {
+			return emptyResp, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return emptyResp, internalStatus(err)
+	}
+
+	return emptyResp, nil
+}
+
+// Get returns metadata of the requested names, names without metadata are skipped.
+// If no names are requested, all metadata is returned.
+func (m *MetadataService) Get(ctx context.Context, request *pb.GetMetadataRequest) (*pb.GetMetadataResponse, error) {
+	var (
+		metas []entities.Metadata
+		err   error
+	)
+	if names := request.GetNames(); len(names) == 0 {
+		metas, err = m.metadataUC.GetAll(ctx)
+	} else {
+		metas, err = m.metadataUC.GetMany(ctx, names...)
+	}
+	if err != nil {
+		m.logger.Debug("failed get metadata", zap.Error(err))
+		return &pb.GetMetadataResponse{}, internalStatus(err)
+	}
+
+	result := make([]*pb.Metadata, 0, len(metas))
+	for _, v := range metas {
+		result = append(result, toMetadataProto(v))
+	}
+	return &pb.GetMetadataResponse{Metadata: result}, nil
+}
+
+func toMetadataEntity(meta *pb.Metadata) entities.Metadata {
+	typ := entities.MetricUnknown
+	if meta.GetType() != pb.MetricType_UNKNOWN {
+		typ = entities.MetricType(strings.ToLower(meta.GetType().String()))
+	}
+	return entities.Metadata{
+		Name:        meta.GetName(),
+		Type:        typ,
+		Unit:        meta.GetUnit(),
+		Description: meta.GetDescription(),
+		Owner:       meta.GetOwner(),
+	}
+}
+
+func toMetadataProto(meta entities.Metadata) *pb.Metadata {
+	return &pb.Metadata{
+		Name:        meta.Name,
+		Type:        pb.MetricType(pb.MetricType_value[strings.ToUpper(string(meta.Type))]),
+		Unit:        meta.Unit,
+		Description: meta.Description,
+		Owner:       meta.Owner,
+	}
+}
@@ -2,12 +2,15 @@ package services
 
 import (
 	"context"
+	"errors"
 	"github.com/dlomanov/mon/internal/apps/server/usecases"
 	pb "github.com/dlomanov/mon/internal/apps/shared/proto"
 	"github.com/dlomanov/mon/internal/entities"
+	"github.com/dlomanov/mon/internal/entities/apperrors"
 	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"time"
 )
 
 var _ pb.MetricServiceServer = (*MetricService)(nil)
@@ -44,7 +47,11 @@ func (m *MetricService) Update(ctx context.Context, request *pb.UpdateRequest) (
 
 	if _, err := m.metricUC.Update(ctx, ms...); err != nil {
 		m.logger.Debug("failed update metrics", zap.Error(err))
-		return emptyResp, status.Error(codes.Internal, err.Error())
+		var errInvalid *apperrors.AppErrorInvalid
+		if errors.As(err, &errInvalid) {
+			return emptyResp, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return emptyResp, internalStatus(err)
 	}
 
 	return emptyResp, nil
@@ -58,6 +65,12 @@ func (m *MetricService) toEntities(metrics []*pb.Metric) ([]entities.Metric, err
 				return entities.MetricCounter, nil
 			case pb.MetricType_GAUGE:
 				return entities.MetricGauge, nil
+			case pb.MetricType_HISTOGRAM:
+				return entities.MetricHistogram, nil
+			case pb.MetricType_SUMMARY:
+				return entities.MetricSummary, nil
+			case pb.MetricType_SET:
+				return entities.MetricSet, nil
 			default:
 				return entities.MetricUnknown, status.Error(codes.InvalidArgument, "unknown metric type")
 			}
@@ -68,15 +81,57 @@ func (m *MetricService) toEntities(metrics []*pb.Metric) ([]entities.Metric, err
 			switch {
 			case err != nil:
 				return entity, err
-			case typ == entities.MetricCounter && (m.Delta == nil || m.Value != nil):
+			case entities.ValidateMetricName(m.Name) != nil:
+				return entity, status.Error(codes.InvalidArgument, "invalid metric name")
+			case typ == entities.MetricCounter && ((m.Delta == nil) == (m.Total == nil) || m.Value != nil):
+				return entity, status.Error(codes.InvalidArgument, "invalid metric type")
+			case typ != entities.MetricCounter && m.Total != nil:
 				return entity, status.Error(codes.InvalidArgument, "invalid metric type")
 			case typ == entities.MetricGauge && (m.Delta != nil || m.Value == nil):
 				return entity, status.Error(codes.InvalidArgument, "invalid metric type")
+			case typ == entities.MetricHistogram && (m.Delta != nil || m.Value != nil || m.Histogram == nil):
+				return entity, status.Error(codes.InvalidArgument, "invalid metric type")
+			case typ == entities.MetricSummary && (m.Delta != nil || m.Value != nil || m.Summary == nil):
+				return entity, status.Error(codes.InvalidArgument, "invalid metric type")
+			case typ == entities.MetricSet && (m.Delta != nil || m.Value != nil || m.Set == nil):
+				return entity, status.Error(codes.InvalidArgument, "invalid metric type")
+			case typ == entities.MetricSet && m.Set.GetPrecision() > uint32(entities.MaxSetPrecision):
+				return entity, status.Error(codes.InvalidArgument, "invalid set precision")
 			default:
 				entity.Name = m.Name
 				entity.Type = typ
 				entity.Delta = m.Delta
+				entity.Total = m.Total
 				entity.Value = m.Value
+				if ts := m.GetTimestamp(); ts != 0 {
+					entity.Timestamp = time.Unix(0, ts)
+				}
+				if h := m.GetHistogram(); h != nil {
+					entity.Histogram = &entities.Histogram{
+						Bounds: h.GetBounds(),
+						Counts: h.GetCounts(),
+						Sum:    h.GetSum(),
+						Count:  h.GetCount(),
+					}
+				}
+				if s := m.GetSummary(); s != nil {
+					entity.Summary = &entities.Summary{
+						Alpha:    s.GetAlpha(),
+						Positive: s.GetPositive(),
+						Negative: s.GetNegative(),
+						Zero:     s.GetZero(),
+						Count:    s.GetCount(),
+						Sum:      s.GetSum(),
+						Min:      s.GetMin(),
+						Max:      s.GetMax(),
+					}
+				}
+				if s := m.GetSet(); s != nil {
+					entity.Set = &entities.Set{
+						Precision: uint8(s.GetPrecision()),
+						Registers: s.GetRegisters(),
+					}
+				}
 				return entity, nil
 			}
 		}
@@ -92,3 +147,13 @@ func (m *MetricService) toEntities(metrics []*pb.Metric) ([]entities.Metric, err
 	}
 	return result, nil
 }
+
+// internalStatus converts a failure of the server into a gRPC status,
+// transient failures are reported as unavailable, so clients retry them.
+func internalStatus(err error) error {
+	var errTransient *apperrors.AppErrorTransient
+	if errors.As(err, &errTransient) {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
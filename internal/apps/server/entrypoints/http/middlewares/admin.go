@@ -0,0 +1,35 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// HeaderAuthorization carries the admin token as "Bearer <token>".
+const HeaderAuthorization = "Authorization"
+
+// Admin allows requests authorized with the admin token.
+// If the token isn't configured, admin requests are forbidden.
+func Admin(logger *zap.Logger, token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token == "" {
+				logger.Debug("admin operations are disabled")
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			got, ok := strings.CutPrefix(r.Header.Get(HeaderAuthorization), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				logger.Debug("invalid admin token")
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -3,20 +3,27 @@ package middlewares
 import (
 	"net/http"
 	"strings"
-)
 
-const compAlgo = "gzip"
+	"github.com/dlomanov/mon/internal/infra/services/compress"
+)
 
 var allowedTypes = map[string]struct{}{
 	"application/json": {},
 	"text/html":        {},
 }
 
-// Compressor is a middleware that compresses HTTP responses using gzip if the client
-// supports it. It checks the "Accept-Encoding" header of the request to determine if
-// the client can accept gzip-encoded responses. If so, it wraps the response writer
-// with a gzip writer. It also handles decompression of the request body if it's
-// gzip-encoded, by replacing the request body with a decompressed reader.
+// acceptedEncodings advertises request content codings supported by the server (RFC 7694).
+var acceptedEncodings = strings.Join(compress.Algorithms, ", ")
+
+// Compressor is a middleware that compresses HTTP responses using zstd, snappy or gzip
+// if the client supports it. It checks the "Accept-Encoding" header of the request
+// and picks the most preferred coding supported by both sides. If there is one, it wraps
+// the response writer with a compressing writer. It also handles decompression of the
+// request body if it's encoded with one of the supported codings, by replacing the
+// request body with a decompressed reader.
+//
+// Every response carries an "Accept-Encoding" header listing codings accepted in
+// request bodies, so clients can negotiate request compression.
 //
 // The middleware supports only "application/json" and "text/html" content types for
 // compression. It returns a new HTTP handler that wraps the provided handler with
@@ -24,19 +31,19 @@ var allowedTypes = map[string]struct{}{
 func Compressor(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ow := w
+		w.Header().Set("Accept-Encoding", acceptedEncodings)
 
-		acceptEncoding := r.Header.Get("Accept-Encoding")
-		if strings.Contains(acceptEncoding, compAlgo) {
-			cw := newCompressWriter(w, allowedTypes)
+		if algo := compress.Negotiate(r.Header.Get("Accept-Encoding")); algo != "" {
+			cw := newCompressWriter(w, allowedTypes, algo)
 			defer func(cw *compressWriter) { _ = cw.Close() }(cw)
 			ow = cw
 		}
 
-		contentEncoding := r.Header.Get("Content-Encoding")
-		if strings.Contains(contentEncoding, compAlgo) {
-			cr, err := newCompressReader(r.Body)
+		contentEncoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+		if compress.Supported(contentEncoding) {
+			cr, err := newCompressReader(r.Body, contentEncoding)
 			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
+				w.WriteHeader(http.StatusBadRequest)
 				return
 			}
 			defer func(cr *compressReader) { _ = cr.Close() }(cr)
@@ -1,12 +1,13 @@
 package middlewares
 
 import (
-	"compress/gzip"
 	"io"
+
+	"github.com/dlomanov/mon/internal/infra/services/compress"
 )
 
-func newCompressReader(r io.ReadCloser) (*compressReader, error) {
-	d, err := gzip.NewReader(r)
+func newCompressReader(r io.ReadCloser, algo string) (*compressReader, error) {
+	d, err := compress.NewReader(algo, r)
 	return &compressReader{
 		reader:       r,
 		decompressor: d,
@@ -0,0 +1,130 @@
+package middlewares
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dlomanov/mon/internal/infra/services/compress"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressor(t *testing.T) {
+	const body = `{"id":"cpu","type":"gauge","value":1.5}`
+	tests := []struct {
+		name            string
+		contentEncoding string
+		acceptEncoding  string
+		writeHeader     bool
+		wantCode        int
+		wantEncoding    string
+	}{
+		{name: "plain", wantCode: http.StatusOK},
+		{name: "gzip request", contentEncoding: compress.Gzip, wantCode: http.StatusOK},
+		{name: "zstd request", contentEncoding: compress.Zstd, wantCode: http.StatusOK},
+		{name: "snappy request", contentEncoding: compress.Snappy, wantCode: http.StatusOK},
+		{name: "unsupported request", contentEncoding: "br", wantCode: http.StatusNotAcceptable},
+		{name: "gzip response", acceptEncoding: "gzip", wantCode: http.StatusOK, wantEncoding: compress.Gzip},
+		{name: "preferred response", acceptEncoding: "gzip, snappy, zstd", wantCode: http.StatusOK, wantEncoding: compress.Zstd},
+		{name: "excluded response", acceptEncoding: "zstd;q=0, snappy", wantCode: http.StatusOK, wantEncoding: compress.Snappy},
+		{name: "unsupported response", acceptEncoding: "br", wantCode: http.StatusOK},
+		{
+			name:            "zstd request and response after status",
+			contentEncoding: compress.Zstd,
+			acceptEncoding:  "zstd",
+			writeHeader:     true,
+			wantCode:        http.StatusOK,
+			wantEncoding:    compress.Zstd,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(Compressor(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, err := io.ReadAll(r.Body)
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				if tt.writeHeader {
+					w.WriteHeader(http.StatusOK)
+				}
+				_, _ = w.Write(data)
+			})))
+			defer ts.Close()
+
+			reqBody := []byte(body)
+			if tt.contentEncoding != "" && compress.Supported(tt.contentEncoding) {
+				reqBody = encode(t, tt.contentEncoding, reqBody)
+			}
+			req, err := http.NewRequest(http.MethodPost, ts.URL, bytes.NewReader(reqBody))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			if tt.contentEncoding != "" {
+				req.Header.Set("Content-Encoding", tt.contentEncoding)
+			}
+			// an explicit header disables transparent decompression by the client
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			if tt.acceptEncoding == "" {
+				req.Header.Set("Accept-Encoding", "identity")
+			}
+
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			defer func(body io.Closer) { _ = body.Close() }(resp.Body)
+
+			require.Equal(t, tt.wantCode, resp.StatusCode)
+			assert.Equal(t, "zstd, snappy, gzip", resp.Header.Get("Accept-Encoding"))
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			assert.Equal(t, tt.wantEncoding, resp.Header.Get("Content-Encoding"))
+			respBody, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			if tt.wantEncoding != "" {
+				respBody = decode(t, tt.wantEncoding, respBody)
+			}
+			assert.Equal(t, body, string(respBody))
+		})
+	}
+}
+
+func TestCompressor_InvalidBody(t *testing.T) {
+	ts := httptest.NewServer(Compressor(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL, bytes.NewReader([]byte("not gzip")))
+	require.NoError(t, err)
+	req.Header.Set("Content-Encoding", compress.Gzip)
+	resp, err := ts.Client().Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func encode(t *testing.T, algo string, data []byte) []byte {
+	t.Helper()
+	buf := bytes.Buffer{}
+	w, err := compress.NewWriter(algo, &buf, compress.DefaultLevel)
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func decode(t *testing.T, algo string, data []byte) []byte {
+	t.Helper()
+	r, err := compress.NewReader(algo, bytes.NewReader(data))
+	require.NoError(t, err)
+	defer func(r io.Closer) { _ = r.Close() }(r)
+	result, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return result
+}
@@ -1,16 +1,17 @@
 package middlewares
 
 import (
-	"compress/gzip"
 	"io"
 	"net/http"
 	"strings"
+
+	"github.com/dlomanov/mon/internal/infra/services/compress"
 )
 
-func newCompressWriter(w http.ResponseWriter, allowedTypes map[string]struct{}) *compressWriter {
+func newCompressWriter(w http.ResponseWriter, allowedTypes map[string]struct{}, algo string) *compressWriter {
 	return &compressWriter{
 		w:            w,
-		cw:           gzip.NewWriter(w),
+		algo:         algo,
 		contentTypes: allowedTypes,
 		wroteHeader:  false,
 		compressable: false,
@@ -20,6 +21,7 @@ func newCompressWriter(w http.ResponseWriter, allowedTypes map[string]struct{})
 type compressWriter struct {
 	w            http.ResponseWriter
 	cw           io.WriteCloser
+	algo         string
 	contentTypes map[string]struct{}
 	wroteHeader  bool
 	compressable bool
@@ -30,6 +32,8 @@ func (c *compressWriter) Header() http.Header {
 }
 
 func (c *compressWriter) WriteHeader(statusCode int) {
+	// Content-Encoding must be set before the headers are sent
+	c.writeHeader()
 	c.w.WriteHeader(statusCode)
 }
 
@@ -52,12 +56,17 @@ func (c *compressWriter) writeHeader() {
 	}
 	c.wroteHeader = true
 
-	c.compressable = c.isCompressable()
-	if !c.compressable {
+	if !c.isCompressable() {
+		return
+	}
+	cw, err := compress.NewWriter(c.algo, c.w, compress.DefaultLevel)
+	if err != nil {
 		return
 	}
+	c.cw = cw
+	c.compressable = true
 
-	c.w.Header().Set("Content-Encoding", compAlgo)
+	c.w.Header().Set("Content-Encoding", c.algo)
 }
 
 func (c *compressWriter) isCompressable() bool {
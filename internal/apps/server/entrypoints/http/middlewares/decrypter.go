@@ -4,12 +4,19 @@ import (
 	"bytes"
 	"github.com/dlomanov/mon/internal/infra/services/encrypt"
 	"io"
+	"net"
 	"net/http"
+	"sync"
 
 	"go.uber.org/zap"
 )
 
+// Decrypter is a middleware that decrypts request bodies of requests marked with the
+// "Encryption" header. The versioned envelope is accepted, the legacy format if the decryptor allows it.
+// The first legacy body of every peer is logged, so senders left to migrate can be found.
+// Bodies that can't be decrypted are rejected with 400 Bad Request.
 func Decrypter(logger *zap.Logger, dec *encrypt.Decryptor) func(http.Handler) http.Handler {
+	var legacyPeers sync.Map
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			_, ok := r.Header["Encryption"]
@@ -29,15 +36,35 @@ func Decrypter(logger *zap.Logger, dec *encrypt.Decryptor) func(http.Handler) ht
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
-			body, err := dec.Decrypt(encBody)
+			body, legacy, err := dec.Decrypt(encBody)
 			if err != nil {
-				logger.Error("failed to decrypt body", zap.Error(err))
-				w.WriteHeader(http.StatusInternalServerError)
+				logger.Debug("failed to decrypt body", zap.Error(err))
+				w.WriteHeader(http.StatusBadRequest)
 				return
 			}
+			if legacy {
+				peer := peerAddr(r)
+				if _, seen := legacyPeers.LoadOrStore(peer, struct{}{}); !seen {
+					logger.Warn("legacy encryption is used", zap.String("peer", peer))
+				}
+			}
 			r.Body = io.NopCloser(bytes.NewReader(body))
 
 			next.ServeHTTP(w, r)
 		})
 	}
 }
+
+// peerAddr returns the agent ID or the source IP reported by the client, or the remote address of the connection.
+func peerAddr(r *http.Request) string {
+	if agentID := r.Header.Get(HeaderAgentID); agentID != "" {
+		return agentID
+	}
+	if ip := r.Header.Get("X-Real-IP"); ip != "" {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
@@ -16,8 +16,14 @@ import (
 // captures the response status code and size. This allows the middleware to log these
 // details after the handler has processed the request.
 //
+// Requests of agents reporting their identity are logged with the agent ID
+// from the X-Agent-ID header, so reports can be attributed to agents.
+//
 // The Logger middleware is useful for monitoring and debugging web server requests,
 // providing insights into request handling performance and potential issues.
+// HeaderAgentID carries the optional identifier of the reporting agent.
+const HeaderAgentID = "X-Agent-ID"
+
 func Logger(logger *zap.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -32,13 +38,17 @@ func Logger(logger *zap.Logger) func(http.Handler) http.Handler {
 			start := time.Now()
 			next.ServeHTTP(wrapper, r)
 
-			logger.Info("incoming HTTP request",
+			fields := []zap.Field{
 				zap.String("URI", r.URL.Path),
 				zap.String("method", r.Method),
 				zap.Duration("elapsed_time", time.Since(start)),
 				zap.Int("response_status_code", wrapper.data.responseStatus),
 				zap.Int("response_size", wrapper.data.responseSize),
-			)
+			}
+			if agentID := r.Header.Get(HeaderAgentID); agentID != "" {
+				fields = append(fields, zap.String("agent_id", agentID))
+			}
+			logger.Info("incoming HTTP request", fields...)
 		})
 	}
 }
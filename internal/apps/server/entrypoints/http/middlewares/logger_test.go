@@ -0,0 +1,29 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLogger_AgentID(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	h := Logger(zap.New(core))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+	req.Header.Set(HeaderAgentID, "agent-1")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/updates/", nil))
+
+	entries := logs.All()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "agent-1", entries[0].ContextMap()["agent_id"])
+	assert.NotContains(t, entries[1].ContextMap(), "agent_id")
+}
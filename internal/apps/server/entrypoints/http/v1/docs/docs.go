@@ -15,6 +15,303 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/api/v1/backup": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Downloads a consistent snapshot of metrics and metadata as a portable archive. Requires the admin token.\nThe archive is restored into a server with any storage.",
+                "produces": [
+                    "application/gzip"
+                ],
+                "summary": "Backup metrics",
+                "operationId": "backup",
+                "responses": {
+                    "200": {
+                        "description": "Backup archive",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid admin token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Admin operations are disabled",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to backup metrics",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/range": {
+            "get": {
+                "description": "Retrieves values of a gauge or counter over a time range, counter values are cumulative.\nWith a step the series is downsampled to the latest value of every step, stamped with the step end.\nRanges starting before the raw retention are read from the finest rollup tier that retains the start,\nrollup values are selected by agg, the last value of counters and the average of gauges by default.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Query metric history",
+                "operationId": "query_range",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Name of the metric",
+                        "name": "name",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Type of the metric (gauge, counter)",
+                        "name": "type",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Range start, RFC 3339 or unix seconds, defaults to an hour before the end",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Range end, RFC 3339 or unix seconds, defaults to now",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Downsampling step, duration (e.g. 1m) or seconds",
+                        "name": "step",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Rollup aggregation (min, max, avg, last, sum)",
+                        "name": "agg",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/apimodels.Series"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid range query",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to get metric history",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/restore": {
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Replaces all metrics and metadata with the ones of a backup archive. Requires the admin token.",
+                "consumes": [
+                    "application/gzip"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Restore metrics",
+                "operationId": "restore",
+                "parameters": [
+                    {
+                        "description": "Backup archive",
+                        "name": "archive",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Restored backup",
+                        "schema": {
+                            "$ref": "#/definitions/apimodels.BackupInfo"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid backup archive",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid admin token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Admin operations are disabled",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "413": {
+                        "description": "Backup archive is too large",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to restore metrics",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/meta/": {
+            "get": {
+                "description": "Retrieves all registered metadata ordered by metric name.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "List metric metadata",
+                "operationId": "list_metadata",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/apimodels.Metadata"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Failed to get metadata",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Creates or replaces unit, description, owner and declared type of a metric name.\nUpdates of the metric with another type are rejected once a type is declared. Requires the admin token.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Register metric metadata",
+                "operationId": "register_metadata",
+                "parameters": [
+                    {
+                        "description": "Metadata to register",
+                        "name": "metadata",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/apimodels.Metadata"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Registered metadata",
+                        "schema": {
+                            "$ref": "#/definitions/apimodels.Metadata"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid metadata",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid admin token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Admin operations are disabled",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/meta/{name}": {
+            "get": {
+                "description": "Retrieves metadata registered for a metric name.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get metric metadata",
+                "operationId": "get_metadata",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Name of the metric",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/apimodels.Metadata"
+                        }
+                    },
+                    "404": {
+                        "description": "Metadata not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
         "/ping": {
             "get": {
                 "description": "Checks the connectivity to the database by pinging it.",
@@ -38,7 +335,7 @@ const docTemplate = `{
         },
         "/report": {
             "get": {
-                "description": "Retrieves all metrics and generates a report in HTML format.",
+                "description": "Retrieves all metrics and generates a report in HTML format.\nValues are followed by units of the registered metadata, stale metrics are marked.",
                 "produces": [
                     "text/html"
                 ],
@@ -60,6 +357,53 @@ const docTemplate = `{
                 }
             }
         },
+        "/reset/counter/{name}": {
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Sets the counter value to zero. Requires the admin token.",
+                "summary": "Reset counter",
+                "operationId": "reset_counter",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Name of the counter",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Counter reset",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid admin token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Admin operations are disabled",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Counter not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
         "/update/": {
             "post": {
                 "description": "Updates a metric using a JSON request body.",
@@ -94,6 +438,12 @@ const docTemplate = `{
                         "schema": {
                             "type": "string"
                         }
+                    },
+                    "503": {
+                        "description": "Storage is temporarily unavailable, see Retry-After",
+                        "schema": {
+                            "type": "string"
+                        }
                     }
                 }
             }
@@ -138,6 +488,12 @@ const docTemplate = `{
                         "schema": {
                             "type": "string"
                         }
+                    },
+                    "503": {
+                        "description": "Storage is temporarily unavailable, see Retry-After",
+                        "schema": {
+                            "type": "string"
+                        }
                     }
                 }
             }
@@ -179,6 +535,12 @@ const docTemplate = `{
                         "schema": {
                             "type": "string"
                         }
+                    },
+                    "503": {
+                        "description": "Storage is temporarily unavailable, see Retry-After",
+                        "schema": {
+                            "type": "string"
+                        }
                     }
                 }
             }
@@ -225,11 +587,59 @@ const docTemplate = `{
                         }
                     }
                 }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Deletes metrics of any type with names matching the pattern. Requires the admin token.\nIn the pattern '*' matches any sequence of characters and '?' matches a single character.",
+                "produces": [
+                    "text/plain"
+                ],
+                "summary": "Delete metrics by pattern",
+                "operationId": "delete_metrics_by_pattern",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Name pattern",
+                        "name": "pattern",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Number of deleted metrics",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid pattern",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid admin token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Admin operations are disabled",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
             }
         },
         "/value/{type}/{name}": {
             "get": {
-                "description": "Retrieves a metric by its name and type using URL parameters.",
+                "description": "Retrieves a metric by its name and type using URL parameters.\nFor summary metrics, q selects quantiles to estimate, values are returned separated by spaces.",
                 "produces": [
                     "text/plain"
                 ],
@@ -249,6 +659,16 @@ const docTemplate = `{
                         "name": "name",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "number"
+                        },
+                        "collectionFormat": "csv",
+                        "description": "Summary quantiles in [0, 1], repeated or comma-separated",
+                        "name": "q",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -258,6 +678,64 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "400": {
+                        "description": "Invalid quantile",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Metric not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Deletes a metric by its type and name. Requires the admin token.",
+                "summary": "Delete metric",
+                "operationId": "delete_metric",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Type of the metric",
+                        "name": "type",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Name of the metric",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Metric deleted",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid admin token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Admin operations are disabled",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "404": {
                         "description": "Metric not found",
                         "schema": {
@@ -269,6 +747,79 @@ const docTemplate = `{
         }
     },
     "definitions": {
+        "apimodels.BackupInfo": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "description": "CreatedAt is the time the backup was made.",
+                    "type": "string"
+                },
+                "metadata": {
+                    "description": "Metadata is the number of metadata in the backup.",
+                    "type": "integer"
+                },
+                "metrics": {
+                    "description": "Metrics is the number of metrics in the backup.",
+                    "type": "integer"
+                },
+                "version": {
+                    "description": "Version is the backup format version.",
+                    "type": "integer"
+                }
+            }
+        },
+        "apimodels.Histogram": {
+            "type": "object",
+            "properties": {
+                "bounds": {
+                    "description": "Bounds are strictly increasing bucket upper bounds.",
+                    "type": "array",
+                    "items": {
+                        "type": "number"
+                    }
+                },
+                "count": {
+                    "description": "Count is the number of observations.",
+                    "type": "integer"
+                },
+                "counts": {
+                    "description": "Counts are non-cumulative bucket counts.",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "sum": {
+                    "description": "Sum is the sum of observed values.",
+                    "type": "number"
+                }
+            }
+        },
+        "apimodels.Metadata": {
+            "type": "object",
+            "properties": {
+                "description": {
+                    "description": "Description explains what the metric measures.",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "Name is the metric name the metadata belongs to.",
+                    "type": "string"
+                },
+                "owner": {
+                    "description": "Owner is the team owning the metric.",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "Type is the declared metric type, empty allows any type.",
+                    "type": "string"
+                },
+                "unit": {
+                    "description": "Unit is the unit of metric values (e.g., \"bytes\", \"seconds\").",
+                    "type": "string"
+                }
+            }
+        },
         "apimodels.Metric": {
             "type": "object",
             "properties": {
@@ -276,12 +827,52 @@ const docTemplate = `{
                     "description": "Delta is the change in value for a counter metric.",
                     "type": "integer"
                 },
+                "histogram": {
+                    "description": "Histogram holds observations for a histogram metric.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/apimodels.Histogram"
+                        }
+                    ]
+                },
                 "id": {
                     "description": "Name is the unique name of the metric.",
                     "type": "string"
                 },
+                "set": {
+                    "description": "Set holds a distinct-count sketch for a set metric.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/apimodels.Set"
+                        }
+                    ]
+                },
+                "stale": {
+                    "description": "Stale is returned on reads if the metric wasn't updated within its TTL.",
+                    "type": "boolean"
+                },
+                "summary": {
+                    "description": "Summary holds a quantile sketch for a summary metric.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/apimodels.Summary"
+                        }
+                    ]
+                },
+                "timestamp": {
+                    "description": "Timestamp is the time the sample was taken, older gauge samples don't overwrite newer ones.",
+                    "type": "string"
+                },
+                "total": {
+                    "description": "Total is the cumulative value of a counter metric, sent instead of Delta.\nThe server derives the delta from the previous total, a lower total is taken as a counter reset.",
+                    "type": "integer"
+                },
                 "type": {
-                    "description": "Type is the type of the metric (e.g., \"counter\", \"gauge\").",
+                    "description": "Type is the type of the metric (e.g., \"counter\", \"gauge\", \"histogram\", \"summary\", \"set\").",
+                    "type": "string"
+                },
+                "updated_at": {
+                    "description": "UpdatedAt is the timestamp of the latest stored sample, returned on reads.",
                     "type": "string"
                 },
                 "value": {
@@ -298,10 +889,114 @@ const docTemplate = `{
                     "type": "string"
                 },
                 "type": {
-                    "description": "Type is the type of the metric (e.g., \"counter\", \"gauge\").",
+                    "description": "Type is the type of the metric (e.g., \"counter\", \"gauge\", \"histogram\", \"summary\", \"set\").",
+                    "type": "string"
+                }
+            }
+        },
+        "apimodels.Point": {
+            "type": "object",
+            "properties": {
+                "timestamp": {
+                    "description": "Timestamp is the sample time, or the step end for downsampled series.",
+                    "type": "string"
+                },
+                "value": {
+                    "description": "Value is the metric value.",
+                    "type": "number"
+                }
+            }
+        },
+        "apimodels.Series": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "description": "Name is the unique name of the metric.",
+                    "type": "string"
+                },
+                "points": {
+                    "description": "Points are metric values ordered by time.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/apimodels.Point"
+                    }
+                },
+                "resolution": {
+                    "description": "Resolution is the rollup resolution in seconds the points are read from, omitted for raw points.",
+                    "type": "integer"
+                },
+                "type": {
+                    "description": "Type is the type of the metric (e.g., \"counter\", \"gauge\", \"histogram\", \"summary\", \"set\").",
                     "type": "string"
                 }
             }
+        },
+        "apimodels.Set": {
+            "type": "object",
+            "properties": {
+                "precision": {
+                    "description": "Precision is the log2 of the number of registers.",
+                    "type": "integer"
+                },
+                "registers": {
+                    "description": "Registers are base64 encoded register values.",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                }
+            }
+        },
+        "apimodels.Summary": {
+            "type": "object",
+            "properties": {
+                "alpha": {
+                    "description": "Alpha is the relative accuracy of quantiles.",
+                    "type": "number"
+                },
+                "count": {
+                    "description": "Count is the number of observations.",
+                    "type": "integer"
+                },
+                "max": {
+                    "description": "Max is the maximal observed value.",
+                    "type": "number"
+                },
+                "min": {
+                    "description": "Min is the minimal observed value.",
+                    "type": "number"
+                },
+                "negative": {
+                    "description": "Negative are bins of negative values.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                },
+                "positive": {
+                    "description": "Positive are bins of positive values.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                },
+                "sum": {
+                    "description": "Sum is the sum of observed values.",
+                    "type": "number"
+                },
+                "zero": {
+                    "description": "Zero is the number of values close to zero.",
+                    "type": "integer"
+                }
+            }
+        }
+    },
+    "securityDefinitions": {
+        "AdminToken": {
+            "description": "Admin token as \"Bearer \u003ctoken\u003e\".",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
         }
     }
 }`
@@ -0,0 +1,112 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/dlomanov/mon/internal/apps/server/container"
+	"github.com/dlomanov/mon/internal/apps/server/entrypoints/http/middlewares"
+	"github.com/dlomanov/mon/internal/apps/server/usecases"
+	"github.com/dlomanov/mon/internal/apps/shared/apimodels"
+	"github.com/dlomanov/mon/internal/infra/services/backup"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+type backupEndpoint struct {
+	logger        *zap.Logger
+	backupUseCase *usecases.BackupUseCase
+}
+
+func UseBackup(r chi.Router, c *container.Container) {
+	e := &backupEndpoint{
+		logger:        c.Logger,
+		backupUseCase: c.BackupUseCase,
+	}
+	r.Group(func(r chi.Router) {
+		r.Use(middlewares.Admin(c.Logger, c.Config.AdminToken))
+		r.Get("/api/v1/backup", e.backup())
+		r.Post("/api/v1/restore", e.restore())
+	})
+}
+
+// @Summary		Backup metrics
+// @Description	Downloads a consistent snapshot of metrics and metadata as a portable archive. Requires the admin token.
+// @Description	The archive is restored into a server with any storage.
+// @ID				backup
+//
+// @Security		AdminToken
+// @Produce		application/gzip
+//
+// @Success		200	{file}		binary	"Backup archive"
+// @Failure		401	{object}	string	"Invalid admin token"
+// @Failure		403	{object}	string	"Admin operations are disabled"
+// @Failure		500	{object}	string	"Failed to backup metrics"
+//
+// @Router			/api/v1/backup [get]
+func (e *backupEndpoint) backup() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		b, err := e.backupUseCase.Backup(r.Context())
+		if err != nil {
+			e.logger.Error("backup failed", zap.Error(err))
+			writeStatus(w, err)
+			return
+		}
+
+		w.Header().Set(HeaderContentType, "application/gzip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+backup.FileName(b.CreatedAt)+`"`)
+		if err = backup.Write(w, b); err != nil {
+			e.logger.Error("error occurred during response writing", zap.Error(err))
+		}
+	}
+}
+
+// @Summary		Restore metrics
+// @Description	Replaces all metrics and metadata with the ones of a backup archive. Requires the admin token.
+// @ID				restore
+//
+// @Security		AdminToken
+// @Accept			application/gzip
+// @Produce		json
+//
+// @Param			archive	body		string					true	"Backup archive"
+//
+// @Success		200		{object}	apimodels.BackupInfo	"Restored backup"
+// @Failure		400		{object}	string					"Invalid backup archive"
+// @Failure		401		{object}	string					"Invalid admin token"
+// @Failure		403		{object}	string					"Admin operations are disabled"
+// @Failure		413		{object}	string					"Backup archive is too large"
+// @Failure		500		{object}	string					"Failed to restore metrics"
+//
+// @Router			/api/v1/restore [post]
+func (e *backupEndpoint) restore() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		b, err := backup.Read(http.MaxBytesReader(w, r.Body, backup.MaxArchiveSize))
+		var errTooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &errTooLarge):
+			e.logger.Debug("backup archive is too large", zap.Error(err))
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		case err != nil:
+			e.logger.Debug("cannot read backup archive", zap.Error(err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if err = e.backupUseCase.Restore(r.Context(), b); err != nil {
+			e.logger.Error("restore failed", zap.Error(err))
+			writeStatus(w, err)
+			return
+		}
+		e.logger.Info("metrics restored",
+			zap.Int("metrics", len(b.Metrics)),
+			zap.Int("metadata", len(b.Metadata)))
+
+		w.Header().Set(HeaderContentType, "application/json")
+		if err = json.NewEncoder(w).Encode(apimodels.MapToModelBackupInfo(b)); err != nil {
+			e.logger.Error("error occurred during response writing", zap.Error(err))
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"github.com/dlomanov/mon/internal/entities/apperrors"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 
@@ -26,9 +27,9 @@ var (
 // MetricFromRouteParams binds metric data from URL parameters to a Metric model.
 // It parses the metric type and value from the URL and returns a Metric model.
 func MetricFromRouteParams(r *http.Request) (model apimodels.Metric, err error) {
-	model.Name = chi.URLParam(r, "name")
-	model.Type = chi.URLParam(r, "type")
-	valueString := chi.URLParam(r, "value")
+	model.Name = URLParam(r, "name")
+	model.Type = URLParam(r, "type")
+	valueString := URLParam(r, "value")
 
 	metricType, ok := entities.ParseMetricType(model.Type)
 	if !ok {
@@ -50,6 +51,15 @@ func MetricFromRouteParams(r *http.Request) (model apimodels.Metric, err error)
 			return model, errors.Join(ErrInvalidMetricValue, err)
 		}
 		model.Delta = &delta
+	case metricType == entities.MetricSet:
+		var entity entities.Metric
+		entity, err = entities.NewMetric(entities.MetricsKey{Name: model.Name, Type: metricType}, valueString)
+		if err != nil {
+			return model, errors.Join(ErrInvalidMetricValue, err)
+		}
+		model.Set = apimodels.MapToModel(entity).Set
+	case metricType == entities.MetricHistogram, metricType == entities.MetricSummary:
+		return model, fmt.Errorf("%w: %s can only be updated with JSON", ErrInvalidMetricValue, metricType)
 	default:
 		return model, fmt.Errorf("%w: %s", ErrUnsupportedMetricType, model.Type)
 	}
@@ -84,3 +94,17 @@ func MetricsFromJSON(r *http.Request) (models []apimodels.Metric, err error) {
 
 	return models, err
 }
+
+// URLParam returns the URL parameter with percent-encoding removed,
+// so names containing escaped slashes are routed and bound as is.
+func URLParam(r *http.Request, key string) string {
+	value := chi.URLParam(r, key)
+	if r.URL.RawPath == "" {
+		return value // the router matched the already unescaped path
+	}
+	unescaped, err := url.PathUnescape(value)
+	if err != nil {
+		return value
+	}
+	return unescaped
+}
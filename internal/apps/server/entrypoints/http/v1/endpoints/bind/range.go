@@ -0,0 +1,72 @@
+package bind
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dlomanov/mon/internal/apps/shared/apimodels"
+	"github.com/dlomanov/mon/internal/entities"
+	"github.com/dlomanov/mon/internal/entities/apperrors"
+)
+
+var ErrInvalidRangeRequest = apperrors.NewInvalid("invalid range request")
+
+// RangeQueryFromParams binds a range query from query parameters name, type, from, to, step and agg.
+// Times are RFC 3339 or unix seconds, the step is a duration (e.g. "1m") or seconds.
+// Missing times are left zero to be defaulted by the use case.
+func RangeQueryFromParams(r *http.Request) (query entities.RangeQuery, err error) {
+	params := r.URL.Query()
+	key, err := apimodels.MapToEntityKey(apimodels.MetricKey{Name: params.Get("name"), Type: params.Get("type")})
+	if err != nil {
+		return query, fmt.Errorf("%w: %w", ErrInvalidRangeRequest, err)
+	}
+	query.MetricsKey = key
+
+	if query.From, err = parseTime(params.Get("from")); err != nil {
+		return query, fmt.Errorf("%w: from: %w", ErrInvalidRangeRequest, err)
+	}
+	if query.To, err = parseTime(params.Get("to")); err != nil {
+		return query, fmt.Errorf("%w: to: %w", ErrInvalidRangeRequest, err)
+	}
+	if query.Step, err = parseStep(params.Get("step")); err != nil {
+		return query, fmt.Errorf("%w: step: %w", ErrInvalidRangeRequest, err)
+	}
+	agg, ok := entities.ParseAggregation(params.Get("agg"))
+	if !ok {
+		return query, fmt.Errorf("%w: unknown aggregation: %s", ErrInvalidRangeRequest, params.Get("agg"))
+	}
+	query.Aggregation = agg
+	return query, nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return time.Time{}, fmt.Errorf("expected RFC 3339 or unix seconds: %s", value)
+	}
+	whole, frac := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(frac*float64(time.Second))), nil
+}
+
+func parseStep(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return d, nil
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(seconds) || seconds > math.MaxInt64/float64(time.Second) {
+		return 0, fmt.Errorf("expected duration or seconds: %s", value)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
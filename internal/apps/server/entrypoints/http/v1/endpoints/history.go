@@ -0,0 +1,69 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dlomanov/mon/internal/apps/server/container"
+	"github.com/dlomanov/mon/internal/apps/server/entrypoints/http/v1/endpoints/bind"
+	"github.com/dlomanov/mon/internal/apps/server/usecases"
+	"github.com/dlomanov/mon/internal/apps/shared/apimodels"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+type historyEndpoint struct {
+	logger         *zap.Logger
+	historyUseCase *usecases.HistoryUseCase
+}
+
+func UseHistory(r chi.Router, c *container.Container) {
+	e := &historyEndpoint{
+		logger:         c.Logger,
+		historyUseCase: c.HistoryUseCase,
+	}
+	r.Get("/api/v1/range", e.queryRange())
+}
+
+// @Summary		Query metric history
+// @Description	Retrieves values of a gauge or counter over a time range, counter values are cumulative.
+// @Description	With a step the series is downsampled to the latest value of every step, stamped with the step end.
+// @Description	Ranges starting before the raw retention are read from the finest rollup tier that retains the start,
+// @Description	rollup values are selected by agg, the last value of counters and the average of gauges by default.
+// @ID				query_range
+//
+// @Produce		json
+// @Param			name	query		string	true	"Name of the metric"
+// @Param			type	query		string	true	"Type of the metric (gauge, counter)"
+// @Param			from	query		string	false	"Range start, RFC 3339 or unix seconds, defaults to an hour before the end"
+// @Param			to		query		string	false	"Range end, RFC 3339 or unix seconds, defaults to now"
+// @Param			step	query		string	false	"Downsampling step, duration (e.g. 1m) or seconds"
+// @Param			agg		query		string	false	"Rollup aggregation (min, max, avg, last, sum)"
+//
+// @Success		200		{object}	apimodels.Series
+// @Failure		400		{object}	string	"Invalid range query"
+// @Failure		500		{object}	string	"Failed to get metric history"
+//
+// @Router			/api/v1/range [get]
+func (e *historyEndpoint) queryRange() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query, err := bind.RangeQueryFromParams(r)
+		if err != nil {
+			e.logger.Debug("invalid range query", zap.Error(err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		series, err := e.historyUseCase.Range(r.Context(), query)
+		if err != nil {
+			e.logger.Error("range query failed", zap.Error(err))
+			writeStatus(w, err)
+			return
+		}
+
+		w.Header().Set(HeaderContentType, "application/json")
+		if err = json.NewEncoder(w).Encode(apimodels.MapToModelSeries(series)); err != nil {
+			e.logger.Error("error occurred during response writing", zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/dlomanov/mon/internal/apps/server/container"
+	"github.com/dlomanov/mon/internal/apps/server/entrypoints/http/middlewares"
+	"github.com/dlomanov/mon/internal/apps/server/entrypoints/http/v1/endpoints/bind"
+	"github.com/dlomanov/mon/internal/apps/server/usecases"
+	"github.com/dlomanov/mon/internal/apps/shared/apimodels"
+	"github.com/dlomanov/mon/internal/entities/apperrors"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+type metadataEndpoint struct {
+	logger          *zap.Logger
+	metadataUseCase *usecases.MetadataUseCase
+}
+
+func UseMetadata(r chi.Router, c *container.Container) {
+	e := &metadataEndpoint{
+		logger:          c.Logger,
+		metadataUseCase: c.MetadataUseCase,
+	}
+	r.Get("/meta/", e.list())
+	r.Get("/meta/{name}", e.get())
+	// a declared type rejects updates of other types, so only admins declare metadata
+	r.With(middlewares.Admin(c.Logger, c.Config.AdminToken)).Post("/meta/", e.register())
+}
+
+// @Summary		Register metric metadata
+// @Description	Creates or replaces unit, description, owner and declared type of a metric name.
+// @Description	Updates of the metric with another type are rejected once a type is declared. Requires the admin token.
+// @ID				register_metadata
+//
+// @Security		AdminToken
+// @Accept			json
+// @Produce		json
+//
+// @Param			metadata	body		apimodels.Metadata	true	"Metadata to register"
+//
+// @Success		200			{object}	apimodels.Metadata	"Registered metadata"
+// @Failure		400			{object}	string				"Invalid metadata"
+// @Failure		401			{object}	string				"Invalid admin token"
+// @Failure		403			{object}	string				"Admin operations are disabled"
+// @Failure		415			{object}	string				"Unsupported Media Type"
+//
+// @Router			/meta/ [post]
+func (e *metadataEndpoint) register() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h := r.Header.Get(HeaderContentType); !strings.HasPrefix(h, "application/json") {
+			e.logger.Debug("invalid content-type", zap.String(HeaderContentType, h))
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		var model apimodels.Metadata
+		if err := json.NewDecoder(r.Body).Decode(&model); err != nil {
+			e.logger.Debug("cannot decode request JSON body", zap.Error(err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		meta, err := e.metadataUseCase.Register(r.Context(), apimodels.MapToEntityMetadata(model))
+		if err != nil {
+			e.logger.Error("error occurred during metadata registration", zap.Error(err))
+			writeStatus(w, err)
+			return
+		}
+		e.writeJSON(w, apimodels.MapToModelMetadata(meta))
+	}
+}
+
+// @Summary		Get metric metadata
+// @Description	Retrieves metadata registered for a metric name.
+// @ID				get_metadata
+//
+// @Produce		json
+// @Param			name	path		string				true	"Name of the metric"
+//
+// @Success		200		{object}	apimodels.Metadata
+// @Failure		404		{object}	string	"Metadata not found"
+//
+// @Router			/meta/{name} [get]
+func (e *metadataEndpoint) get() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		meta, err := e.metadataUseCase.Get(r.Context(), bind.URLParam(r, "name"))
+		var errNotFound *apperrors.AppErrorNotFound
+		switch {
+		case errors.As(err, &errNotFound):
+			http.NotFound(w, r)
+		case err != nil:
+			writeStatus(w, err)
+			e.logger.Error("get metadata failed", zap.Error(err))
+		default:
+			e.writeJSON(w, apimodels.MapToModelMetadata(meta))
+		}
+	}
+}
+
+// @Summary		List metric metadata
+// @Description	Retrieves all registered metadata ordered by metric name.
+// @ID				list_metadata
+//
+// @Produce		json
+//
+// @Success		200	{object}	[]apimodels.Metadata
+// @Failure		500	{object}	string	"Failed to get metadata"
+//
+// @Router			/meta/ [get]
+func (e *metadataEndpoint) list() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		metas, err := e.metadataUseCase.GetAll(r.Context())
+		if err != nil {
+			writeStatus(w, err)
+			e.logger.Error("get metadata failed", zap.Error(err))
+			return
+		}
+
+		models := make([]apimodels.Metadata, 0, len(metas))
+		for _, v := range metas {
+			models = append(models, apimodels.MapToModelMetadata(v))
+		}
+		e.writeJSON(w, models)
+	}
+}
+
+func (e *metadataEndpoint) writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set(HeaderContentType, "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		e.logger.Error("error occurred during response writing", zap.Error(err))
+	}
+}
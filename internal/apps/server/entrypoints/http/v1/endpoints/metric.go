@@ -5,32 +5,41 @@ import (
 	"errors"
 	"fmt"
 	"github.com/dlomanov/mon/internal/apps/server/container"
+	"github.com/dlomanov/mon/internal/apps/server/entrypoints/http/middlewares"
 	"github.com/dlomanov/mon/internal/apps/server/entrypoints/http/v1/endpoints/bind"
 	"github.com/dlomanov/mon/internal/apps/server/usecases"
 	"github.com/dlomanov/mon/internal/apps/shared/apimodels"
+	"github.com/dlomanov/mon/internal/entities"
 	"github.com/dlomanov/mon/internal/entities/apperrors"
 	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 	"html/template"
+	"math"
 	"net/http"
 	"slices"
+	"strconv"
 	"strings"
 )
 
 // HeaderContentType is the HTTP header key for specifying the content type of the response.
 const HeaderContentType = "Content-Type"
 
+// HeaderRetryAfter is the HTTP header key for the number of seconds after which a failed request may be retried.
+const HeaderRetryAfter = "Retry-After"
+
 var reportTemplate = template.Must(template.New("report").Parse(`{{range $val := .}}<p>{{$val}}</p>{{end}}`))
 
 type metricEndpoint struct {
-	logger        *zap.Logger
-	metricUseCase *usecases.MetricUseCase
+	logger          *zap.Logger
+	metricUseCase   *usecases.MetricUseCase
+	metadataUseCase *usecases.MetadataUseCase
 }
 
 func UseMetrics(r chi.Router, c *container.Container) {
 	e := &metricEndpoint{
-		logger:        c.Logger,
-		metricUseCase: c.MetricUseCase,
+		logger:          c.Logger,
+		metricUseCase:   c.MetricUseCase,
+		metadataUseCase: c.MetadataUseCase,
 	}
 	r.Get("/value/{type}/{name}", e.getByParams())
 	r.Post("/value/", e.getByJSON())
@@ -38,25 +47,34 @@ func UseMetrics(r chi.Router, c *container.Container) {
 	r.Post("/update/{type}/{name}/{value}", e.updateByParams())
 	r.Post("/update/", e.updateByJSON())
 	r.Post("/updates/", e.updatesByJSON())
+	r.Group(func(r chi.Router) {
+		r.Use(middlewares.Admin(c.Logger, c.Config.AdminToken))
+		r.Delete("/value/{type}/{name}", e.deleteByParams())
+		r.Delete("/value/", e.deleteByPattern())
+		r.Post("/reset/counter/{name}", e.resetCounter())
+	})
 }
 
 // getByParams
 // @Summary		Get metric by parameters
 // @Description	Retrieves a metric by its name and type using URL parameters.
+// @Description	For summary metrics, q selects quantiles to estimate, values are returned separated by spaces.
 // @ID				get_metric_by_params
 //
 // @Produce		plain
-// @Param			type	path		string	true	"Type of the metric"
-// @Param			name	path		string	true	"Name of the metric"
+// @Param			type	path		string		true	"Type of the metric"
+// @Param			name	path		string		true	"Name of the metric"
+// @Param			q		query		[]number	false	"Summary quantiles in [0, 1], repeated or comma-separated"
 //
-// @Success		200		{object}	string	"Metric value"
-// @Failure		404		{object}	string	"Metric not found"
+// @Success		200		{object}	string		"Metric value"
+// @Failure		400		{object}	string		"Invalid quantile"
+// @Failure		404		{object}	string		"Metric not found"
 // @Router			/value/{type}/{name} [get]
 func (e *metricEndpoint) getByParams() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		key := apimodels.MetricKey{
-			Name: chi.URLParam(r, "name"),
-			Type: chi.URLParam(r, "type"),
+			Name: bind.URLParam(r, "name"),
+			Type: bind.URLParam(r, "type"),
 		}
 
 		entityKey, err := apimodels.MapToEntityKey(key)
@@ -65,6 +83,10 @@ func (e *metricEndpoint) getByParams() http.HandlerFunc {
 			http.NotFound(w, r)
 			return
 		}
+		if entityKey.Type == entities.MetricSummary && r.URL.Query().Has("q") {
+			e.writeQuantiles(w, r, entityKey.Name)
+			return
+		}
 
 		entity, err := e.metricUseCase.Get(r.Context(), entityKey)
 		var errNotFound *apperrors.AppErrorNotFound
@@ -72,7 +94,7 @@ func (e *metricEndpoint) getByParams() http.HandlerFunc {
 		case errors.As(err, &errNotFound):
 			http.NotFound(w, r)
 		case err != nil:
-			w.WriteHeader(http.StatusInternalServerError)
+			writeStatus(w, err)
 			e.logger.Error("get entity failed", zap.Error(err))
 		default:
 			if _, err = w.Write([]byte(entity.StringValue())); err != nil {
@@ -82,6 +104,33 @@ func (e *metricEndpoint) getByParams() http.HandlerFunc {
 	}
 }
 
+func (e *metricEndpoint) writeQuantiles(w http.ResponseWriter, r *http.Request, name string) {
+	qs, err := parseQuantiles(r.URL.Query()["q"])
+	if err != nil {
+		e.logger.Debug("invalid quantiles", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	values, err := e.metricUseCase.Quantiles(r.Context(), name, qs...)
+	var errNotFound *apperrors.AppErrorNotFound
+	switch {
+	case errors.As(err, &errNotFound):
+		http.NotFound(w, r)
+	case err != nil:
+		e.logger.Debug("get quantiles failed", zap.Error(err))
+		writeStatus(w, err)
+	default:
+		formatted := make([]string, 0, len(values))
+		for _, v := range values {
+			formatted = append(formatted, strconv.FormatFloat(v, 'f', -1, 64))
+		}
+		if _, err = w.Write([]byte(strings.Join(formatted, " "))); err != nil {
+			e.logger.Error("error occurred during response writing", zap.Error(err))
+		}
+	}
+}
+
 // @Summary		Get metric by JSON
 // @Description	Retrieves a metric by its name and type using a JSON request body.
 // @ID				get_metric_by_json
@@ -124,10 +173,10 @@ func (e *metricEndpoint) getByJSON() http.HandlerFunc {
 		case errors.As(err, &errNotFound):
 			http.NotFound(w, r)
 		case err != nil:
-			w.WriteHeader(http.StatusInternalServerError)
+			writeStatus(w, err)
 			e.logger.Error("get entity failed", zap.Error(err))
 		default:
-			metrics := apimodels.MapToModel(entity)
+			metrics := apimodels.MapToStoredModel(entity)
 			w.Header().Set("Content-Type", "application/json")
 			if err = json.NewEncoder(w).Encode(metrics); err != nil {
 				e.logger.Error("error occurred during response writing", zap.Error(err))
@@ -138,6 +187,7 @@ func (e *metricEndpoint) getByJSON() http.HandlerFunc {
 
 // @Summary		Generate a report
 // @Description	Retrieves all metrics and generates a report in HTML format.
+// @Description	Values are followed by units of the registered metadata, stale metrics are marked.
 // @ID				generate_report
 //
 // @Produce		html
@@ -150,15 +200,32 @@ func (e *metricEndpoint) report() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		values, err := e.metricUseCase.GetAll(r.Context())
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			writeStatus(w, err)
 			e.logger.Error("get entities failed", zap.Error(err))
 			return
 		}
 
+		metas, err := e.metadataUseCase.GetAll(r.Context())
+		if err != nil {
+			writeStatus(w, err)
+			e.logger.Error("get metadata failed", zap.Error(err))
+			return
+		}
+		units := make(map[string]string, len(metas))
+		for _, v := range metas {
+			units[v.Name] = v.Unit
+		}
+
 		result := make([]string, 0, len(values))
 		for _, v := range values {
-			str := fmt.Sprintf("%s: %s\n", v.String(), v.StringValue())
-			result = append(result, str)
+			str := fmt.Sprintf("%s: %s", v.String(), v.StringValue())
+			if unit := units[v.Name]; unit != "" {
+				str += " " + unit
+			}
+			if v.Stale {
+				str += " (stale)"
+			}
+			result = append(result, str+"\n")
 		}
 		slices.Sort(result)
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -180,6 +247,7 @@ func (e *metricEndpoint) report() http.HandlerFunc {
 //
 // @Success		200		{object}	string	"Metric updated successfully"
 // @Failure		400		{object}	string	"Invalid metric parameters"
+// @Failure		503		{object}	string	"Storage is temporarily unavailable, see Retry-After"
 //
 // @Router			/update/{type}/{name}/{value} [post]
 func (e *metricEndpoint) updateByParams() http.HandlerFunc {
@@ -187,20 +255,20 @@ func (e *metricEndpoint) updateByParams() http.HandlerFunc {
 		metric, err := bind.MetricFromRouteParams(r)
 		if err != nil {
 			e.logger.Error("error occurred during model binding", zap.Error(err))
-			w.WriteHeader(statusCode(err))
+			writeStatus(w, err)
 			return
 		}
 		entity, err := apimodels.MapToEntity(metric)
 		if err != nil {
 			e.logger.Error("error occurred during model mapping", zap.Error(err))
-			w.WriteHeader(statusCode(err))
+			writeStatus(w, err)
 			return
 		}
 
 		_, err = e.metricUseCase.Update(r.Context(), entity)
 		if err != nil {
 			e.logger.Error("error occurred during metric update", zap.Error(err))
-			w.WriteHeader(statusCode(err))
+			writeStatus(w, err)
 			return
 		}
 		w.WriteHeader(http.StatusOK)
@@ -218,6 +286,7 @@ func (e *metricEndpoint) updateByParams() http.HandlerFunc {
 //
 // @Success		200		{object}	string				"Metrics updated successfully"
 // @Failure		400		{object}	string				"Invalid metrics JSON"
+// @Failure		503		{object}	string				"Storage is temporarily unavailable, see Retry-After"
 //
 // @Router			/updates/ [post]
 func (e *metricEndpoint) updatesByJSON() http.HandlerFunc {
@@ -225,21 +294,21 @@ func (e *metricEndpoint) updatesByJSON() http.HandlerFunc {
 		metrics, err := bind.MetricsFromJSON(r)
 		if err != nil {
 			e.logger.Error("error occurred during model binding", zap.Error(err))
-			w.WriteHeader(statusCode(err))
+			writeStatus(w, err)
 			return
 		}
 
 		values, err := apimodels.MapToEntities(metrics)
 		if err != nil {
 			e.logger.Error("error occurred during model mapping", zap.Error(err))
-			w.WriteHeader(statusCode(err))
+			writeStatus(w, err)
 			return
 		}
 
 		_, err = e.metricUseCase.Update(r.Context(), values...)
 		if err != nil {
 			e.logger.Error("error occurred during metric update", zap.Error(err))
-			w.WriteHeader(statusCode(err))
+			writeStatus(w, err)
 			return
 		}
 
@@ -258,6 +327,7 @@ func (e *metricEndpoint) updatesByJSON() http.HandlerFunc {
 //
 // @Success		200		{object}	apimodels.Metric	"Updated metric"
 // @Failure		400		{object}	string				"Invalid metric JSON"
+// @Failure		503		{object}	string				"Storage is temporarily unavailable, see Retry-After"
 //
 // @Router			/update/ [post]
 func (e *metricEndpoint) updateByJSON() http.HandlerFunc {
@@ -265,24 +335,24 @@ func (e *metricEndpoint) updateByJSON() http.HandlerFunc {
 		metric, err := bind.MetricFromJSON(r)
 		if err != nil {
 			e.logger.Error("error occurred during model binding", zap.Error(err))
-			w.WriteHeader(statusCode(err))
+			writeStatus(w, err)
 			return
 		}
 		entity, err := apimodels.MapToEntity(metric)
 		if err != nil {
 			e.logger.Error("error occurred during model mapping", zap.Error(err))
-			w.WriteHeader(statusCode(err))
+			writeStatus(w, err)
 			return
 		}
 
 		processed, err := e.metricUseCase.Update(r.Context(), entity)
 		if err != nil {
 			e.logger.Error("error occurred during metric update", zap.Error(err))
-			w.WriteHeader(statusCode(err))
+			writeStatus(w, err)
 			return
 		}
 		w.Header().Set(HeaderContentType, "application/json")
-		err = json.NewEncoder(w).Encode(apimodels.MapToModel(processed[0]))
+		err = json.NewEncoder(w).Encode(apimodels.MapToStoredModel(processed[0]))
 		if err != nil {
 			e.logger.Error("error occurred during response writing", zap.Error(err))
 			w.WriteHeader(http.StatusInternalServerError)
@@ -291,8 +361,124 @@ func (e *metricEndpoint) updateByJSON() http.HandlerFunc {
 	}
 }
 
+// @Summary		Delete metric
+// @Description	Deletes a metric by its type and name. Requires the admin token.
+// @ID				delete_metric
+//
+// @Security		AdminToken
+// @Param			type	path		string	true	"Type of the metric"
+// @Param			name	path		string	true	"Name of the metric"
+//
+// @Success		200		{object}	string	"Metric deleted"
+// @Failure		401		{object}	string	"Invalid admin token"
+// @Failure		403		{object}	string	"Admin operations are disabled"
+// @Failure		404		{object}	string	"Metric not found"
+//
+// @Router			/value/{type}/{name} [delete]
+func (e *metricEndpoint) deleteByParams() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, err := apimodels.MapToEntityKey(apimodels.MetricKey{
+			Name: bind.URLParam(r, "name"),
+			Type: bind.URLParam(r, "type"),
+		})
+		if err != nil {
+			e.logger.Debug("invalid metric key", zap.Error(err))
+			http.NotFound(w, r)
+			return
+		}
+
+		deleted, err := e.metricUseCase.Delete(r.Context(), key)
+		switch {
+		case err != nil:
+			writeStatus(w, err)
+			e.logger.Error("delete metric failed", zap.Error(err))
+		case deleted == 0:
+			http.NotFound(w, r)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}
+}
+
+// @Summary		Delete metrics by pattern
+// @Description	Deletes metrics of any type with names matching the pattern. Requires the admin token.
+// @Description	In the pattern '*' matches any sequence of characters and '?' matches a single character.
+// @ID				delete_metrics_by_pattern
+//
+// @Security		AdminToken
+// @Produce		plain
+// @Param			pattern	query		string	true	"Name pattern"
+//
+// @Success		200		{object}	string	"Number of deleted metrics"
+// @Failure		400		{object}	string	"Invalid pattern"
+// @Failure		401		{object}	string	"Invalid admin token"
+// @Failure		403		{object}	string	"Admin operations are disabled"
+//
+// @Router			/value/ [delete]
+func (e *metricEndpoint) deleteByPattern() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pattern := entities.NamePattern(r.URL.Query().Get("pattern"))
+		deleted, err := e.metricUseCase.DeleteByPattern(r.Context(), pattern)
+		if err != nil {
+			e.logger.Error("delete metrics by pattern failed", zap.Error(err))
+			writeStatus(w, err)
+			return
+		}
+
+		w.Header().Set(HeaderContentType, "text/plain; charset=utf-8")
+		if _, err = w.Write([]byte(strconv.Itoa(deleted))); err != nil {
+			e.logger.Error("error occurred during response writing", zap.Error(err))
+		}
+	}
+}
+
+// @Summary		Reset counter
+// @Description	Sets the counter value to zero. Requires the admin token.
+// @ID				reset_counter
+//
+// @Security		AdminToken
+// @Param			name	path		string	true	"Name of the counter"
+//
+// @Success		200		{object}	string	"Counter reset"
+// @Failure		401		{object}	string	"Invalid admin token"
+// @Failure		403		{object}	string	"Admin operations are disabled"
+// @Failure		404		{object}	string	"Counter not found"
+//
+// @Router			/reset/counter/{name} [post]
+func (e *metricEndpoint) resetCounter() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := e.metricUseCase.ResetCounter(r.Context(), bind.URLParam(r, "name"))
+		var errNotFound *apperrors.AppErrorNotFound
+		switch {
+		case errors.As(err, &errNotFound):
+			http.NotFound(w, r)
+		case err != nil:
+			writeStatus(w, err)
+			e.logger.Error("reset counter failed", zap.Error(err))
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}
+}
+
+// writeStatus writes the status code of the error, transient errors also get the Retry-After header.
+func writeStatus(w http.ResponseWriter, err error) {
+	var errTransient *apperrors.AppErrorTransient
+	if errors.As(err, &errTransient) {
+		seconds := int(math.Ceil(errTransient.RetryAfter.Seconds()))
+		w.Header().Set(HeaderRetryAfter, strconv.Itoa(max(seconds, 1)))
+	}
+	w.WriteHeader(statusCode(err))
+}
+
 func statusCode(err error) int {
+	var (
+		errInvalid   *apperrors.AppErrorInvalid
+		errTransient *apperrors.AppErrorTransient
+	)
 	switch {
+	case errors.As(err, &errTransient):
+		return http.StatusServiceUnavailable
 	case errors.Is(err, bind.ErrUnsupportedContentType):
 		return http.StatusUnsupportedMediaType
 	case errors.Is(err, bind.ErrInvalidMetricRequest):
@@ -305,7 +491,26 @@ func statusCode(err error) int {
 		return http.StatusBadRequest
 	case errors.Is(err, apimodels.ErrUnsupportedMetricType):
 		return http.StatusInternalServerError
+	case errors.As(err, &errInvalid):
+		return http.StatusBadRequest
 	default:
 		return http.StatusInternalServerError
 	}
 }
+
+func parseQuantiles(values []string) ([]float64, error) {
+	result := make([]float64, 0, len(values))
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			q, err := strconv.ParseFloat(item, 64)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, q)
+		}
+	}
+	return result, nil
+}
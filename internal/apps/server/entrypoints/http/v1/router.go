@@ -14,6 +14,11 @@ import (
 //
 //	@title		mon API
 //	@version	1.0
+//
+//	@securityDefinitions.apikey	AdminToken
+//	@in							header
+//	@name						Authorization
+//	@description				Admin token as "Bearer <token>".
 func UseEndpoints(r chi.Router, c *container.Container) {
 	logger := c.Logger
 	r.Use(middleware.Recoverer)
@@ -24,5 +29,8 @@ func UseEndpoints(r chi.Router, c *container.Container) {
 	r.Use(middlewares.Hash(c))
 	endpoints.UseSwagger(r, c)
 	endpoints.UseMetrics(r, c)
+	endpoints.UseMetadata(r, c)
+	endpoints.UseHistory(r, c)
+	endpoints.UseBackup(r, c)
 	r.Get("/ping", endpoints.PingDB(c))
 }
@@ -2,17 +2,25 @@ package v1
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"github.com/dlomanov/mon/internal/apps/server/usecases"
 	"github.com/dlomanov/mon/internal/infra/services/hashing"
 	"github.com/go-chi/chi/v5"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/dlomanov/mon/internal/apps/server/container"
+	"github.com/dlomanov/mon/internal/apps/server/entrypoints/http/middlewares"
 	"github.com/dlomanov/mon/internal/apps/server/mocks"
+	"github.com/dlomanov/mon/internal/entities"
+	"github.com/dlomanov/mon/internal/entities/apperrors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
@@ -212,10 +220,12 @@ func TestServer(t *testing.T) {
 	}
 
 	stg := mocks.NewStorage()
+	meta := mocks.NewMetaStorage()
 	r := chi.NewRouter()
 	UseEndpoints(r, &container.Container{
-		MetricUseCase: usecases.NewMetricUseCase(stg),
-		Logger:        zap.NewNop(),
+		MetricUseCase:   usecases.NewMetricUseCase(zap.NewNop(), stg, meta, mocks.NewHistoryStorage(), usecases.MetricConfig{}),
+		MetadataUseCase: usecases.NewMetadataUseCase(meta),
+		Logger:          zap.NewNop(),
 	})
 	ts := httptest.NewServer(r)
 	defer ts.Close()
@@ -266,13 +276,15 @@ func TestServer_UpdatesByJSON(t *testing.T) {
 
 	hashKey := "test_key"
 	stg := mocks.NewStorage()
+	meta := mocks.NewMetaStorage()
 	r := chi.NewRouter()
 	UseEndpoints(r, &container.Container{
 		Config: container.Config{
 			Key: hashKey,
 		},
-		MetricUseCase: usecases.NewMetricUseCase(stg),
-		Logger:        zap.NewNop(),
+		MetricUseCase:   usecases.NewMetricUseCase(zap.NewNop(), stg, meta, mocks.NewHistoryStorage(), usecases.MetricConfig{}),
+		MetadataUseCase: usecases.NewMetadataUseCase(meta),
+		Logger:          zap.NewNop(),
 	})
 	ts := httptest.NewServer(r)
 	defer ts.Close()
@@ -289,11 +301,1107 @@ func TestServer_UpdatesByJSON(t *testing.T) {
 	}
 }
 
+func TestServer_Histogram(t *testing.T) {
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "set histogram",
+			args: args{
+				method:      http.MethodPost,
+				path:        "/update/",
+				contentType: "application/json",
+				body:        `{"id":"latency","type":"histogram","histogram":{"bounds":[0.1,1],"counts":[1,2,0],"sum":1.5,"count":3}}`,
+			},
+			want: want{
+				code:        http.StatusOK,
+				contentType: "application/json",
+				body:        `{"id":"latency","type":"histogram","histogram":{"bounds":[0.1,1],"counts":[1,2,0],"sum":1.5,"count":3}}`,
+			},
+		},
+		{
+			name: "merge histogram",
+			args: args{
+				method:      http.MethodPost,
+				path:        "/update/",
+				contentType: "application/json",
+				body:        `{"id":"latency","type":"histogram","histogram":{"bounds":[0.1,1],"counts":[0,1,1],"sum":2.5,"count":2}}`,
+			},
+			want: want{
+				code:        http.StatusOK,
+				contentType: "application/json",
+				body:        `{"id":"latency","type":"histogram","histogram":{"bounds":[0.1,1],"counts":[1,3,1],"sum":4,"count":5}}`,
+			},
+		},
+		{
+			name: "get histogram",
+			args: args{
+				method: http.MethodGet,
+				path:   "/value/histogram/latency",
+			},
+			want: want{
+				code:        http.StatusOK,
+				contentType: "text/plain; charset=utf-8",
+				body:        `count=5 sum=4 le(0.1)=1 le(1)=4 le(+Inf)=5`,
+			},
+		},
+		{
+			name: "bounds mismatch",
+			args: args{
+				method:      http.MethodPost,
+				path:        "/update/",
+				contentType: "application/json",
+				body:        `{"id":"latency","type":"histogram","histogram":{"bounds":[0.5],"counts":[1,0],"sum":0.2,"count":1}}`,
+			},
+			want: want{
+				code: http.StatusBadRequest,
+			},
+		},
+		{
+			name: "invalid counts",
+			args: args{
+				method:      http.MethodPost,
+				path:        "/update/",
+				contentType: "application/json",
+				body:        `{"id":"latency","type":"histogram","histogram":{"bounds":[0.1,1],"counts":[1],"sum":0.2,"count":1}}`,
+			},
+			want: want{
+				code: http.StatusBadRequest,
+			},
+		},
+	}
+
+	stg := mocks.NewStorage()
+	meta := mocks.NewMetaStorage()
+	r := chi.NewRouter()
+	UseEndpoints(r, &container.Container{
+		MetricUseCase:   usecases.NewMetricUseCase(zap.NewNop(), stg, meta, mocks.NewHistoryStorage(), usecases.MetricConfig{}),
+		MetadataUseCase: usecases.NewMetadataUseCase(meta),
+		Logger:          zap.NewNop(),
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := testRequest(t, ts, tt.args, "")
+			_ = resp.Body.Close()
+
+			assert.Equal(t, tt.want.code, resp.StatusCode, "Unexpected status code")
+			assert.Equal(t, tt.want.body, strings.TrimSuffix(body, "\n"))
+			assert.Equal(t, tt.want.contentType, resp.Header.Get("Content-Type"))
+		})
+	}
+}
+
+func TestServer_Summary(t *testing.T) {
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "set summary",
+			args: args{
+				method:      http.MethodPost,
+				path:        "/updates/",
+				contentType: "application/json",
+				body:        `[{"id":"latency","type":"summary","summary":{"alpha":0.01,"positive":{"0":1},"count":1,"sum":1,"min":1,"max":1}}]`,
+			},
+			want: want{
+				code: http.StatusOK,
+			},
+		},
+		{
+			name: "merge summary",
+			args: args{
+				method:      http.MethodPost,
+				path:        "/updates/",
+				contentType: "application/json",
+				body:        `[{"id":"latency","type":"summary","summary":{"alpha":0.01,"positive":{"231":1},"count":1,"sum":100,"min":100,"max":100}}]`,
+			},
+			want: want{
+				code: http.StatusOK,
+			},
+		},
+		{
+			name: "accuracy mismatch",
+			args: args{
+				method:      http.MethodPost,
+				path:        "/updates/",
+				contentType: "application/json",
+				body:        `[{"id":"latency","type":"summary","summary":{"alpha":0.05,"positive":{"1":1},"count":1,"sum":1,"min":1,"max":1}}]`,
+			},
+			want: want{
+				code: http.StatusBadRequest,
+			},
+		},
+		{
+			name: "get quantiles",
+			args: args{
+				method: http.MethodGet,
+				path:   "/value/summary/latency?q=0,1",
+			},
+			want: want{
+				code:        http.StatusOK,
+				contentType: "text/plain; charset=utf-8",
+				body:        "1 100",
+			},
+		},
+		{
+			name: "invalid quantile",
+			args: args{
+				method: http.MethodGet,
+				path:   "/value/summary/latency?q=2",
+			},
+			want: want{
+				code: http.StatusBadRequest,
+			},
+		},
+		{
+			name: "unknown summary",
+			args: args{
+				method: http.MethodGet,
+				path:   "/value/summary/unknown?q=0.5",
+			},
+			want: want{
+				code:        http.StatusNotFound,
+				contentType: "text/plain; charset=utf-8",
+				body:        "404 page not found",
+			},
+		},
+	}
+
+	stg := mocks.NewStorage()
+	meta := mocks.NewMetaStorage()
+	r := chi.NewRouter()
+	UseEndpoints(r, &container.Container{
+		MetricUseCase:   usecases.NewMetricUseCase(zap.NewNop(), stg, meta, mocks.NewHistoryStorage(), usecases.MetricConfig{}),
+		MetadataUseCase: usecases.NewMetadataUseCase(meta),
+		Logger:          zap.NewNop(),
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := testRequest(t, ts, tt.args, "")
+			_ = resp.Body.Close()
+
+			assert.Equal(t, tt.want.code, resp.StatusCode, "Unexpected status code")
+			assert.Equal(t, tt.want.body, strings.TrimSuffix(body, "\n"))
+			assert.Equal(t, tt.want.contentType, resp.Header.Get("Content-Type"))
+		})
+	}
+}
+
+func TestServer_Set(t *testing.T) {
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "add member",
+			args: args{method: http.MethodPost, path: "/update/set/users/alice"},
+			want: want{code: http.StatusOK},
+		},
+		{
+			name: "add another member",
+			args: args{method: http.MethodPost, path: "/update/set/users/bob"},
+			want: want{code: http.StatusOK},
+		},
+		{
+			name: "add existing member",
+			args: args{method: http.MethodPost, path: "/update/set/users/alice"},
+			want: want{code: http.StatusOK},
+		},
+		{
+			name: "invalid sketch",
+			args: args{
+				method:      http.MethodPost,
+				path:        "/update/",
+				contentType: "application/json",
+				body:        `{"id":"users","type":"set","set":{"precision":4,"registers":"AAAA"}}`,
+			},
+			want: want{code: http.StatusBadRequest},
+		},
+		{
+			name: "get cardinality",
+			args: args{method: http.MethodGet, path: "/value/set/users"},
+			want: want{
+				code:        http.StatusOK,
+				contentType: "text/plain; charset=utf-8",
+				body:        "2",
+			},
+		},
+	}
+
+	stg := mocks.NewStorage()
+	meta := mocks.NewMetaStorage()
+	r := chi.NewRouter()
+	UseEndpoints(r, &container.Container{
+		MetricUseCase:   usecases.NewMetricUseCase(zap.NewNop(), stg, meta, mocks.NewHistoryStorage(), usecases.MetricConfig{}),
+		MetadataUseCase: usecases.NewMetadataUseCase(meta),
+		Logger:          zap.NewNop(),
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := testRequest(t, ts, tt.args, "")
+			_ = resp.Body.Close()
+
+			assert.Equal(t, tt.want.code, resp.StatusCode, "Unexpected status code")
+			assert.Equal(t, tt.want.body, strings.TrimSuffix(body, "\n"))
+			assert.Equal(t, tt.want.contentType, resp.Header.Get("Content-Type"))
+		})
+	}
+}
+
+func TestServer_Timestamps(t *testing.T) {
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "set gauge",
+			args: args{
+				method:      http.MethodPost,
+				path:        "/update/",
+				contentType: "application/json",
+				body:        `{"id":"key","type":"gauge","value":2,"timestamp":"2024-01-01T00:00:02Z"}`,
+			},
+			want: want{
+				code:        http.StatusOK,
+				contentType: "application/json",
+				body:        `{"id":"key","type":"gauge","value":2,"updated_at":"2024-01-01T00:00:02Z"}`,
+			},
+		},
+		{
+			name: "ignore stale gauge",
+			args: args{
+				method:      http.MethodPost,
+				path:        "/update/",
+				contentType: "application/json",
+				body:        `{"id":"key","type":"gauge","value":1,"timestamp":"2024-01-01T00:00:01Z"}`,
+			},
+			want: want{
+				code:        http.StatusOK,
+				contentType: "application/json",
+				body:        `{"id":"key","type":"gauge","value":2,"updated_at":"2024-01-01T00:00:02Z"}`,
+			},
+		},
+		{
+			name: "ignore stale gauge in batch",
+			args: args{
+				method:      http.MethodPost,
+				path:        "/updates/",
+				contentType: "application/json",
+				body: `[{"id":"key","type":"gauge","value":3,"timestamp":"2024-01-01T00:00:03Z"},` +
+					`{"id":"key","type":"gauge","value":1,"timestamp":"2024-01-01T00:00:01Z"}]`,
+			},
+			want: want{code: http.StatusOK},
+		},
+		{
+			name: "get gauge",
+			args: args{
+				method:      http.MethodPost,
+				path:        "/value/",
+				contentType: "application/json",
+				body:        `{"id":"key","type":"gauge"}`,
+			},
+			want: want{
+				code:        http.StatusOK,
+				contentType: "application/json",
+				body:        `{"id":"key","type":"gauge","value":3,"updated_at":"2024-01-01T00:00:03Z"}`,
+			},
+		},
+		{
+			name: "set counter",
+			args: args{
+				method:      http.MethodPost,
+				path:        "/update/",
+				contentType: "application/json",
+				body:        `{"id":"key","type":"counter","delta":2,"timestamp":"2024-01-01T00:00:02Z"}`,
+			},
+			want: want{
+				code:        http.StatusOK,
+				contentType: "application/json",
+				body:        `{"id":"key","type":"counter","delta":2,"updated_at":"2024-01-01T00:00:02Z"}`,
+			},
+		},
+		{
+			name: "late counter delta is still counted",
+			args: args{
+				method:      http.MethodPost,
+				path:        "/update/",
+				contentType: "application/json",
+				body:        `{"id":"key","type":"counter","delta":1,"timestamp":"2024-01-01T00:00:01Z"}`,
+			},
+			want: want{
+				code:        http.StatusOK,
+				contentType: "application/json",
+				body:        `{"id":"key","type":"counter","delta":3,"updated_at":"2024-01-01T00:00:02Z"}`,
+			},
+		},
+	}
+
+	stg := mocks.NewStorage()
+	meta := mocks.NewMetaStorage()
+	r := chi.NewRouter()
+	UseEndpoints(r, &container.Container{
+		MetricUseCase:   usecases.NewMetricUseCase(zap.NewNop(), stg, meta, mocks.NewHistoryStorage(), usecases.MetricConfig{}),
+		MetadataUseCase: usecases.NewMetadataUseCase(meta),
+		Logger:          zap.NewNop(),
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := testRequest(t, ts, tt.args, "")
+			_ = resp.Body.Close()
+
+			assert.Equal(t, tt.want.code, resp.StatusCode, "Unexpected status code")
+			assert.Equal(t, tt.want.body, strings.TrimSuffix(body, "\n"))
+			assert.Equal(t, tt.want.contentType, resp.Header.Get("Content-Type"))
+		})
+	}
+}
+
+func TestServer_Counters(t *testing.T) {
+	const maxInt64 = "9223372036854775807"
+	update := func(body string) args {
+		return args{method: http.MethodPost, path: "/update/", contentType: "application/json", body: body}
+	}
+	ok := func(body string) want {
+		return want{code: http.StatusOK, contentType: "application/json", body: body}
+	}
+	tests := []struct {
+		name   string
+		policy entities.OverflowPolicy
+		args   args
+		want   want
+	}{
+		{
+			name: "set counter close to max",
+			args: update(`{"id":"bytes","type":"counter","delta":9223372036854775800}`),
+			want: ok(`{"id":"bytes","type":"counter","delta":9223372036854775800}`),
+		},
+		{
+			name: "overflow is clamped",
+			args: update(`{"id":"bytes","type":"counter","delta":100}`),
+			want: ok(`{"id":"bytes","type":"counter","delta":` + maxInt64 + `}`),
+		},
+		{
+			name:   "overflow is rejected",
+			policy: entities.OverflowError,
+			args:   update(`{"id":"bytes","type":"counter","delta":1}`),
+			want:   want{code: http.StatusBadRequest},
+		},
+		{
+			name: "first total",
+			args: update(`{"id":"rx","type":"counter","total":100}`),
+			want: ok(`{"id":"rx","type":"counter","delta":100,"total":100}`),
+		},
+		{
+			name: "next total adds the increase",
+			args: update(`{"id":"rx","type":"counter","total":150}`),
+			want: ok(`{"id":"rx","type":"counter","delta":150,"total":150}`),
+		},
+		{
+			name: "lower total is a reset",
+			args: update(`{"id":"rx","type":"counter","total":20}`),
+			want: ok(`{"id":"rx","type":"counter","delta":170,"total":20}`),
+		},
+		{
+			name: "delta keeps the total",
+			args: update(`{"id":"rx","type":"counter","delta":5}`),
+			want: ok(`{"id":"rx","type":"counter","delta":175,"total":20}`),
+		},
+		{
+			name:   "batch with overflow is rejected",
+			policy: entities.OverflowError,
+			args: args{
+				method:      http.MethodPost,
+				path:        "/updates/",
+				contentType: "application/json",
+				body:        `[{"id":"rx","type":"counter","delta":1},{"id":"bytes","type":"counter","delta":1}]`,
+			},
+			want: want{code: http.StatusBadRequest},
+		},
+		{
+			name: "rejected batch changes nothing",
+			args: update(`{"id":"rx","type":"counter","delta":0}`),
+			want: ok(`{"id":"rx","type":"counter","delta":175,"total":20}`),
+		},
+		{
+			name: "total of a delta counter is a baseline",
+			args: update(`{"id":"bytes","type":"counter","total":10}`),
+			want: ok(`{"id":"bytes","type":"counter","delta":` + maxInt64 + `,"total":10}`),
+		},
+		{
+			name: "delta and total",
+			args: update(`{"id":"rx","type":"counter","delta":1,"total":1}`),
+			want: want{code: http.StatusBadRequest},
+		},
+		{
+			name: "gauge total",
+			args: update(`{"id":"rx","type":"gauge","value":1,"total":1}`),
+			want: want{code: http.StatusBadRequest},
+		},
+	}
+
+	stg := mocks.NewStorage()
+	meta := mocks.NewMetaStorage()
+	newServer := func(policy entities.OverflowPolicy) *httptest.Server {
+		r := chi.NewRouter()
+		UseEndpoints(r, &container.Container{
+			MetricUseCase:   usecases.NewMetricUseCase(zap.NewNop(), stg, meta, mocks.NewHistoryStorage(), usecases.MetricConfig{Overflow: policy}),
+			MetadataUseCase: usecases.NewMetadataUseCase(meta),
+			Logger:          zap.NewNop(),
+		})
+		return httptest.NewServer(r)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newServer(tt.policy)
+			defer ts.Close()
+
+			resp, body := testRequest(t, ts, tt.args, "")
+			_ = resp.Body.Close()
+
+			assert.Equal(t, tt.want.code, resp.StatusCode, "Unexpected status code")
+			if tt.want.body != "" {
+				assert.Equal(t, tt.want.body, strings.TrimSuffix(body, "\n"))
+				assert.Equal(t, tt.want.contentType, resp.Header.Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestServer_History(t *testing.T) {
+	update := func(body string) args {
+		return args{method: http.MethodPost, path: "/update/", contentType: "application/json", body: body}
+	}
+	query := func(params string) args {
+		return args{method: http.MethodGet, path: "/api/v1/range?" + params}
+	}
+	ok := func(body string) want {
+		return want{code: http.StatusOK, contentType: "application/json", body: body}
+	}
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "set gauge",
+			args: update(`{"id":"HeapInuse","type":"gauge","value":1,"timestamp":"2024-01-01T00:00:10Z"}`),
+			want: ok(`{"id":"HeapInuse","type":"gauge","value":1,"updated_at":"2024-01-01T00:00:10Z"}`),
+		},
+		{
+			name: "set gauge again",
+			args: update(`{"id":"HeapInuse","type":"gauge","value":2,"timestamp":"2024-01-01T00:00:20Z"}`),
+			want: ok(`{"id":"HeapInuse","type":"gauge","value":2,"updated_at":"2024-01-01T00:00:20Z"}`),
+		},
+		{
+			name: "set gauge in the next minute",
+			args: update(`{"id":"HeapInuse","type":"gauge","value":3,"timestamp":"2024-01-01T00:01:05Z"}`),
+			want: ok(`{"id":"HeapInuse","type":"gauge","value":3,"updated_at":"2024-01-01T00:01:05Z"}`),
+		},
+		{
+			name: "add counter",
+			args: update(`{"id":"requests","type":"counter","delta":1,"timestamp":"2024-01-01T00:00:10Z"}`),
+			want: ok(`{"id":"requests","type":"counter","delta":1,"updated_at":"2024-01-01T00:00:10Z"}`),
+		},
+		{
+			name: "add counter again",
+			args: update(`{"id":"requests","type":"counter","delta":2,"timestamp":"2024-01-01T00:00:20Z"}`),
+			want: ok(`{"id":"requests","type":"counter","delta":3,"updated_at":"2024-01-01T00:00:20Z"}`),
+		},
+		{
+			name: "gauge range",
+			args: query("name=HeapInuse&type=gauge&from=2024-01-01T00:00:00Z&to=2024-01-01T00:02:00Z"),
+			want: ok(`{"id":"HeapInuse","type":"gauge","points":[` +
+				`{"timestamp":"2024-01-01T00:00:10Z","value":1},` +
+				`{"timestamp":"2024-01-01T00:00:20Z","value":2},` +
+				`{"timestamp":"2024-01-01T00:01:05Z","value":3}]}`),
+		},
+		{
+			name: "gauge range in unix seconds",
+			args: query("name=HeapInuse&type=gauge&from=1704067215&to=1704067225"),
+			want: ok(`{"id":"HeapInuse","type":"gauge","points":[{"timestamp":"2024-01-01T00:00:20Z","value":2}]}`),
+		},
+		{
+			name: "downsampled gauge range",
+			args: query("name=HeapInuse&type=gauge&from=2024-01-01T00:01:00Z&to=2024-01-01T00:02:00Z&step=1m"),
+			want: ok(`{"id":"HeapInuse","type":"gauge","points":[` +
+				`{"timestamp":"2024-01-01T00:01:00Z","value":2},` +
+				`{"timestamp":"2024-01-01T00:02:00Z","value":3}]}`),
+		},
+		{
+			name: "counter range",
+			args: query("name=requests&type=counter&from=2024-01-01T00:00:00Z&to=2024-01-01T00:02:00Z"),
+			want: ok(`{"id":"requests","type":"counter","points":[` +
+				`{"timestamp":"2024-01-01T00:00:10Z","value":1},` +
+				`{"timestamp":"2024-01-01T00:00:20Z","value":3}]}`),
+		},
+		{
+			name: "unknown metric range",
+			args: query("name=unknown&type=gauge&from=2024-01-01T00:00:00Z&to=2024-01-01T00:02:00Z"),
+			want: ok(`{"id":"unknown","type":"gauge","points":[]}`),
+		},
+		{
+			name: "missing name",
+			args: query("type=gauge"),
+			want: want{code: http.StatusBadRequest},
+		},
+		{
+			name: "histogram range",
+			args: query("name=latency&type=histogram"),
+			want: want{code: http.StatusBadRequest},
+		},
+		{
+			name: "inverted range",
+			args: query("name=HeapInuse&type=gauge&from=2024-01-01T00:02:00Z&to=2024-01-01T00:00:00Z"),
+			want: want{code: http.StatusBadRequest},
+		},
+		{
+			name: "too many steps",
+			args: query("name=HeapInuse&type=gauge&from=2024-01-01T00:00:00Z&to=2024-01-02T00:00:00Z&step=1s"),
+			want: want{code: http.StatusBadRequest},
+		},
+		{
+			name: "invalid step",
+			args: query("name=HeapInuse&type=gauge&step=often"),
+			want: want{code: http.StatusBadRequest},
+		},
+	}
+
+	stg := mocks.NewStorage()
+	meta := mocks.NewMetaStorage()
+	history := mocks.NewHistoryStorage()
+	r := chi.NewRouter()
+	UseEndpoints(r, &container.Container{
+		MetricUseCase:   usecases.NewMetricUseCase(zap.NewNop(), stg, meta, history, usecases.MetricConfig{}),
+		MetadataUseCase: usecases.NewMetadataUseCase(meta),
+		HistoryUseCase:  usecases.NewHistoryUseCase(history, entities.Retention{}),
+		Logger:          zap.NewNop(),
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := testRequest(t, ts, tt.args, "")
+			_ = resp.Body.Close()
+
+			assert.Equal(t, tt.want.code, resp.StatusCode, "Unexpected status code")
+			if tt.want.body != "" {
+				assert.Equal(t, tt.want.body, strings.TrimSuffix(body, "\n"))
+				assert.Equal(t, tt.want.contentType, resp.Header.Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestServer_HistoryRetention(t *testing.T) {
+	stg := mocks.NewStorage()
+	meta := mocks.NewMetaStorage()
+	history := mocks.NewHistoryStorage()
+	retention, err := entities.ParseRetention("raw=1h,1m=30d")
+	require.NoError(t, err)
+	historyUC := usecases.NewHistoryUseCase(history, retention)
+	r := chi.NewRouter()
+	UseEndpoints(r, &container.Container{
+		MetricUseCase:   usecases.NewMetricUseCase(zap.NewNop(), stg, meta, history, usecases.MetricConfig{}),
+		MetadataUseCase: usecases.NewMetadataUseCase(meta),
+		HistoryUseCase:  historyUC,
+		Logger:          zap.NewNop(),
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	base := time.Now().UTC().Add(-30 * time.Minute).Truncate(time.Minute)
+	stamp := func(d time.Duration) string {
+		return base.Add(d).Format(time.RFC3339Nano)
+	}
+	for i, v := range []string{"1", "3"} {
+		resp, _ := testRequest(t, ts, args{
+			method:      http.MethodPost,
+			path:        "/update/",
+			contentType: "application/json",
+			body:        `{"id":"HeapInuse","type":"gauge","value":` + v + `,"timestamp":"` + stamp(time.Duration(i+1)*10*time.Second) + `"}`,
+		}, "")
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	_, err = historyUC.Compact(context.Background())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		params string
+		want   want
+	}{
+		{
+			name:   "recent range is raw",
+			params: "from=" + url.QueryEscape(stamp(0)),
+			want: want{code: http.StatusOK, contentType: "application/json", body: `{"id":"HeapInuse","type":"gauge","points":[` +
+				`{"timestamp":"` + stamp(10*time.Second) + `","value":1},` +
+				`{"timestamp":"` + stamp(20*time.Second) + `","value":3}]}`},
+		},
+		{
+			name:   "old range is rolled up",
+			params: "from=" + url.QueryEscape(stamp(-2*time.Hour)),
+			want: want{code: http.StatusOK, contentType: "application/json", body: `{"id":"HeapInuse","type":"gauge","resolution":60,"points":[` +
+				`{"timestamp":"` + stamp(0) + `","value":2}]}`},
+		},
+		{
+			name:   "rollup aggregation",
+			params: "agg=max&from=" + url.QueryEscape(stamp(-2*time.Hour)),
+			want: want{code: http.StatusOK, contentType: "application/json", body: `{"id":"HeapInuse","type":"gauge","resolution":60,"points":[` +
+				`{"timestamp":"` + stamp(0) + `","value":3}]}`},
+		},
+		{
+			name:   "unknown aggregation",
+			params: "agg=median",
+			want:   want{code: http.StatusBadRequest},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := testRequest(t, ts, args{method: http.MethodGet, path: "/api/v1/range?name=HeapInuse&type=gauge&" + tt.params}, "")
+			_ = resp.Body.Close()
+
+			assert.Equal(t, tt.want.code, resp.StatusCode, "Unexpected status code")
+			if tt.want.body != "" {
+				assert.Equal(t, tt.want.body, strings.TrimSuffix(body, "\n"))
+				assert.Equal(t, tt.want.contentType, resp.Header.Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestServer_Admin(t *testing.T) {
+	const token = "secret"
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "set gauge",
+			args: args{method: http.MethodPost, path: "/update/gauge/host-1.cpu/1"},
+			want: want{code: http.StatusOK},
+		},
+		{
+			name: "set another gauge",
+			args: args{method: http.MethodPost, path: "/update/gauge/host-1.mem/1"},
+			want: want{code: http.StatusOK},
+		},
+		{
+			name: "set counter",
+			args: args{method: http.MethodPost, path: "/update/counter/requests/5"},
+			want: want{code: http.StatusOK},
+		},
+		{
+			name: "delete without token",
+			args: args{method: http.MethodDelete, path: "/value/gauge/host-1.cpu"},
+			want: want{code: http.StatusUnauthorized},
+		},
+		{
+			name: "delete with invalid token",
+			args: args{method: http.MethodDelete, path: "/value/gauge/host-1.cpu", adminToken: "wrong"},
+			want: want{code: http.StatusUnauthorized},
+		},
+		{
+			name: "delete",
+			args: args{method: http.MethodDelete, path: "/value/gauge/host-1.cpu", adminToken: token},
+			want: want{code: http.StatusOK},
+		},
+		{
+			name: "get deleted",
+			args: args{method: http.MethodGet, path: "/value/gauge/host-1.cpu"},
+			want: want{code: http.StatusNotFound, contentType: "text/plain; charset=utf-8", body: "404 page not found"},
+		},
+		{
+			name: "delete missing",
+			args: args{method: http.MethodDelete, path: "/value/gauge/host-1.cpu", adminToken: token},
+			want: want{code: http.StatusNotFound, contentType: "text/plain; charset=utf-8", body: "404 page not found"},
+		},
+		{
+			name: "delete by empty pattern",
+			args: args{method: http.MethodDelete, path: "/value/", adminToken: token},
+			want: want{code: http.StatusBadRequest},
+		},
+		{
+			name: "delete by pattern",
+			args: args{method: http.MethodDelete, path: "/value/?pattern=host-1.*", adminToken: token},
+			want: want{code: http.StatusOK, contentType: "text/plain; charset=utf-8", body: "1"},
+		},
+		{
+			name: "reset counter",
+			args: args{method: http.MethodPost, path: "/reset/counter/requests", adminToken: token},
+			want: want{code: http.StatusOK},
+		},
+		{
+			name: "reset missing counter",
+			args: args{method: http.MethodPost, path: "/reset/counter/unknown", adminToken: token},
+			want: want{code: http.StatusNotFound, contentType: "text/plain; charset=utf-8", body: "404 page not found"},
+		},
+		{
+			name: "get report",
+			args: args{method: http.MethodGet, path: "/"},
+			want: want{code: http.StatusOK, body: "<p>counter_requests: 0\n</p>", contentType: "text/html; charset=utf-8"},
+		},
+	}
+
+	stg := mocks.NewStorage()
+	meta := mocks.NewMetaStorage()
+	r := chi.NewRouter()
+	UseEndpoints(r, &container.Container{
+		Config:          container.Config{AdminToken: token},
+		MetricUseCase:   usecases.NewMetricUseCase(zap.NewNop(), stg, meta, mocks.NewHistoryStorage(), usecases.MetricConfig{}),
+		MetadataUseCase: usecases.NewMetadataUseCase(meta),
+		Logger:          zap.NewNop(),
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := testRequest(t, ts, tt.args, "")
+			_ = resp.Body.Close()
+
+			assert.Equal(t, tt.want.code, resp.StatusCode, "Unexpected status code")
+			assert.Equal(t, tt.want.body, strings.TrimSuffix(body, "\n"))
+			assert.Equal(t, tt.want.contentType, resp.Header.Get("Content-Type"))
+		})
+	}
+}
+
+func TestServer_AdminDisabled(t *testing.T) {
+	stg := mocks.NewStorage()
+	meta := mocks.NewMetaStorage()
+	r := chi.NewRouter()
+	UseEndpoints(r, &container.Container{
+		MetricUseCase:   usecases.NewMetricUseCase(zap.NewNop(), stg, meta, mocks.NewHistoryStorage(), usecases.MetricConfig{}),
+		MetadataUseCase: usecases.NewMetadataUseCase(meta),
+		Logger:          zap.NewNop(),
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	resp, _ := testRequest(t, ts, args{method: http.MethodDelete, path: "/value/?pattern=*", adminToken: "any"}, "")
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestServer_Expiry(t *testing.T) {
+	stg := mocks.NewStorage()
+	meta := mocks.NewMetaStorage()
+	metricUC := usecases.NewMetricUseCase(zap.NewNop(), stg, meta, mocks.NewHistoryStorage(), usecases.MetricConfig{
+		Expiry: entities.Expiry{
+			Rules: []entities.TTLRule{{Type: entities.MetricGauge, TTL: time.Nanosecond}},
+		},
+	})
+	r := chi.NewRouter()
+	UseEndpoints(r, &container.Container{
+		MetricUseCase:   metricUC,
+		MetadataUseCase: usecases.NewMetadataUseCase(meta),
+		Logger:          zap.NewNop(),
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "set gauge",
+			args: args{method: http.MethodPost, path: "/update/gauge/FreeMemory/10"},
+			want: want{code: http.StatusOK},
+		},
+		{
+			name: "set counter",
+			args: args{method: http.MethodPost, path: "/update/counter/PollCount/1"},
+			want: want{code: http.StatusOK},
+		},
+		{
+			name: "get stale gauge",
+			args: args{
+				method:      http.MethodPost,
+				path:        "/value/",
+				contentType: "application/json",
+				body:        `{"id":"FreeMemory","type":"gauge"}`,
+			},
+			want: want{
+				code:        http.StatusOK,
+				contentType: "application/json",
+				body:        `{"id":"FreeMemory","type":"gauge","value":10,"stale":true}`,
+			},
+		},
+		{
+			name: "get report",
+			args: args{method: http.MethodGet, path: "/"},
+			want: want{
+				code:        http.StatusOK,
+				contentType: "text/html; charset=utf-8",
+				body:        "<p>counter_PollCount: 1\n</p><p>gauge_FreeMemory: 10 (stale)\n</p>",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := testRequest(t, ts, tt.args, "")
+			_ = resp.Body.Close()
+
+			assert.Equal(t, tt.want.code, resp.StatusCode, "Unexpected status code")
+			assert.Equal(t, tt.want.body, strings.TrimSuffix(body, "\n"))
+			assert.Equal(t, tt.want.contentType, resp.Header.Get("Content-Type"))
+		})
+	}
+
+	evicted, err := metricUC.Sweep(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, evicted)
+	resp, body := testRequest(t, ts, args{method: http.MethodGet, path: "/"}, "")
+	_ = resp.Body.Close()
+	assert.Equal(t, "<p>counter_PollCount: 1\n</p>", body)
+}
+
+func TestServer_Names(t *testing.T) {
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "name with underscores",
+			args: args{method: http.MethodPost, path: "/update/gauge/heap_alloc/1"},
+			want: want{code: http.StatusOK},
+		},
+		{
+			name: "name prefix",
+			args: args{method: http.MethodPost, path: "/update/gauge/heap/2"},
+			want: want{code: http.StatusOK},
+		},
+		{
+			name: "name with escaped slashes",
+			args: args{method: http.MethodPost, path: "/update/gauge/disk%2Fsda1%2Fused/3"},
+			want: want{code: http.StatusOK},
+		},
+		{
+			name: "unicode name",
+			args: args{method: http.MethodPost, path: "/update/counter/" + url.PathEscape("память.занято") + "/4"},
+			want: want{code: http.StatusOK},
+		},
+		{
+			name: "name with space",
+			args: args{method: http.MethodPost, path: "/update/gauge/heap%20alloc/1"},
+			want: want{code: http.StatusBadRequest},
+		},
+		{
+			name: "too long name",
+			args: args{
+				method:      http.MethodPost,
+				path:        "/update/",
+				contentType: "application/json",
+				body:        `{"id":"` + strings.Repeat("a", entities.MaxMetricNameLength+1) + `","type":"gauge","value":1}`,
+			},
+			want: want{code: http.StatusBadRequest},
+		},
+		{
+			name: "get name with escaped slashes",
+			args: args{method: http.MethodGet, path: "/value/gauge/disk%2Fsda1%2Fused"},
+			want: want{code: http.StatusOK, contentType: "text/plain; charset=utf-8", body: "3"},
+		},
+		{
+			name: "get name with underscores by JSON",
+			args: args{
+				method:      http.MethodPost,
+				path:        "/value/",
+				contentType: "application/json",
+				body:        `{"id":"heap_alloc","type":"gauge"}`,
+			},
+			want: want{code: http.StatusOK, contentType: "application/json", body: `{"id":"heap_alloc","type":"gauge","value":1}`},
+		},
+		{
+			name: "get report",
+			args: args{method: http.MethodGet, path: "/"},
+			want: want{
+				code:        http.StatusOK,
+				contentType: "text/html; charset=utf-8",
+				body: "<p>counter_память.занято: 4\n</p><p>gauge_disk/sda1/used: 3\n</p>" +
+					"<p>gauge_heap: 2\n</p><p>gauge_heap_alloc: 1\n</p>",
+			},
+		},
+	}
+
+	stg := mocks.NewStorage()
+	meta := mocks.NewMetaStorage()
+	r := chi.NewRouter()
+	UseEndpoints(r, &container.Container{
+		MetricUseCase:   usecases.NewMetricUseCase(zap.NewNop(), stg, meta, mocks.NewHistoryStorage(), usecases.MetricConfig{}),
+		MetadataUseCase: usecases.NewMetadataUseCase(meta),
+		Logger:          zap.NewNop(),
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := testRequest(t, ts, tt.args, "")
+			_ = resp.Body.Close()
+
+			assert.Equal(t, tt.want.code, resp.StatusCode, "Unexpected status code")
+			assert.Equal(t, tt.want.body, strings.TrimSuffix(body, "\n"))
+			assert.Equal(t, tt.want.contentType, resp.Header.Get("Content-Type"))
+		})
+	}
+}
+
+func TestServer_Metadata(t *testing.T) {
+	const token = "secret"
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "register without token",
+			args: args{
+				method:      http.MethodPost,
+				path:        "/meta/",
+				contentType: "application/json",
+				body:        `{"id":"Alloc","type":"counter"}`,
+			},
+			want: want{code: http.StatusUnauthorized},
+		},
+		{
+			name: "register metadata",
+			args: args{
+				method:      http.MethodPost,
+				path:        "/meta/",
+				contentType: "application/json",
+				body:        `{"id":"Alloc","type":"gauge","unit":"bytes","owner":"runtime"}`,
+				adminToken:  token,
+			},
+			want: want{
+				code:        http.StatusOK,
+				contentType: "application/json",
+				body:        `{"id":"Alloc","type":"gauge","unit":"bytes","owner":"runtime"}`,
+			},
+		},
+		{
+			name: "register invalid type",
+			args: args{
+				method:      http.MethodPost,
+				path:        "/meta/",
+				contentType: "application/json",
+				body:        `{"id":"Alloc","type":"meter"}`,
+				adminToken:  token,
+			},
+			want: want{code: http.StatusBadRequest},
+		},
+		{
+			name: "get metadata",
+			args: args{method: http.MethodGet, path: "/meta/Alloc"},
+			want: want{
+				code:        http.StatusOK,
+				contentType: "application/json",
+				body:        `{"id":"Alloc","type":"gauge","unit":"bytes","owner":"runtime"}`,
+			},
+		},
+		{
+			name: "get unknown metadata",
+			args: args{method: http.MethodGet, path: "/meta/Unknown"},
+			want: want{
+				code:        http.StatusNotFound,
+				contentType: "text/plain; charset=utf-8",
+				body:        "404 page not found",
+			},
+		},
+		{
+			name: "update declared type",
+			args: args{method: http.MethodPost, path: "/update/gauge/Alloc/10"},
+			want: want{code: http.StatusOK},
+		},
+		{
+			name: "update conflicting type",
+			args: args{method: http.MethodPost, path: "/update/counter/Alloc/10"},
+			want: want{code: http.StatusBadRequest},
+		},
+		{
+			name: "update conflicting type in batch",
+			args: args{
+				method:      http.MethodPost,
+				path:        "/updates/",
+				contentType: "application/json",
+				body:        `[{"id":"Other","type":"gauge","value":1},{"id":"Alloc","type":"counter","delta":1}]`,
+			},
+			want: want{code: http.StatusBadRequest},
+		},
+		{
+			name: "list metadata",
+			args: args{method: http.MethodGet, path: "/meta/"},
+			want: want{
+				code:        http.StatusOK,
+				contentType: "application/json",
+				body:        `[{"id":"Alloc","type":"gauge","unit":"bytes","owner":"runtime"}]`,
+			},
+		},
+		{
+			name: "report with units",
+			args: args{method: http.MethodGet, path: "/"},
+			want: want{
+				code:        http.StatusOK,
+				contentType: "text/html; charset=utf-8",
+				body:        "<p>gauge_Alloc: 10 bytes\n</p>",
+			},
+		},
+	}
+
+	stg := mocks.NewStorage()
+	meta := mocks.NewMetaStorage()
+	r := chi.NewRouter()
+	UseEndpoints(r, &container.Container{
+		Config:          container.Config{AdminToken: token},
+		MetricUseCase:   usecases.NewMetricUseCase(zap.NewNop(), stg, meta, mocks.NewHistoryStorage(), usecases.MetricConfig{}),
+		MetadataUseCase: usecases.NewMetadataUseCase(meta),
+		Logger:          zap.NewNop(),
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := testRequest(t, ts, tt.args, "")
+			_ = resp.Body.Close()
+
+			assert.Equal(t, tt.want.code, resp.StatusCode, "Unexpected status code")
+			assert.Equal(t, tt.want.body, strings.TrimSuffix(body, "\n"))
+			assert.Equal(t, tt.want.contentType, resp.Header.Get("Content-Type"))
+		})
+	}
+}
+
 type args struct {
 	method      string
 	path        string
 	contentType string
 	body        string
+	adminToken  string
 }
 
 type want struct {
@@ -316,6 +1424,9 @@ func testRequest(
 	if args.contentType != "" {
 		req.Header.Set("Content-Type", args.contentType)
 	}
+	if args.adminToken != "" {
+		req.Header.Set(middlewares.HeaderAuthorization, "Bearer "+args.adminToken)
+	}
 	if hashKey != "" && args.body != "" {
 		hash := hashing.ComputeBase64URLHash(hashKey, []byte(args.body))
 		req.Header.Set(hashing.HeaderHash, hash)
@@ -331,3 +1442,189 @@ func testRequest(
 
 	return resp, string(respBody)
 }
+
+func TestServer_Backup(t *testing.T) {
+	const token = "secret"
+	stg := mocks.NewStorage()
+	meta := mocks.NewMetaStorage()
+	r := chi.NewRouter()
+	UseEndpoints(r, &container.Container{
+		Config:          container.Config{AdminToken: token},
+		MetricUseCase:   usecases.NewMetricUseCase(zap.NewNop(), stg, meta, mocks.NewHistoryStorage(), usecases.MetricConfig{}),
+		MetadataUseCase: usecases.NewMetadataUseCase(meta),
+		BackupUseCase:   usecases.NewBackupUseCase(mocks.NewBackupStorage(stg, meta)),
+		Logger:          zap.NewNop(),
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	requests := []args{
+		{method: http.MethodPost, path: "/update/gauge/cpu/1.5"},
+		{method: http.MethodPost, path: "/update/counter/requests/5"},
+		{method: http.MethodPost, path: "/meta/", contentType: "application/json", body: `{"id":"cpu","unit":"percent"}`, adminToken: token},
+	}
+	for _, a := range requests {
+		resp, _ := testRequest(t, ts, a, "")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	resp, _ := testRequest(t, ts, args{method: http.MethodGet, path: "/api/v1/backup"}, "")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "backup without token")
+
+	resp, archive := testRequest(t, ts, args{method: http.MethodGet, path: "/api/v1/backup", adminToken: token}, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/gzip", resp.Header.Get("Content-Type"))
+	assert.Contains(t, resp.Header.Get("Content-Disposition"), "mon-backup-")
+
+	requests = []args{
+		{method: http.MethodPost, path: "/update/counter/requests/10"},
+		{method: http.MethodPost, path: "/update/gauge/mem/2"},
+		{method: http.MethodDelete, path: "/value/gauge/cpu", adminToken: token},
+	}
+	for _, a := range requests {
+		resp, _ = testRequest(t, ts, a, "")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	restore := args{method: http.MethodPost, path: "/api/v1/restore", contentType: "application/gzip", body: archive}
+	resp, _ = testRequest(t, ts, restore, "")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "restore without token")
+
+	invalid := restore
+	invalid.body = "not an archive"
+	invalid.adminToken = token
+	resp, _ = testRequest(t, ts, invalid, "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "restore invalid archive")
+
+	restore.adminToken = token
+	resp, body := testRequest(t, ts, restore, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Contains(t, body, `"metrics":2,"metadata":1`)
+
+	resp, body = testRequest(t, ts, args{method: http.MethodGet, path: "/"}, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "<p>counter_requests: 5\n</p><p>gauge_cpu: 1.5 percent\n</p>", body)
+
+	resp, body = testRequest(t, ts, args{method: http.MethodGet, path: "/meta/cpu"}, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `{"id":"cpu","unit":"percent"}`, strings.TrimSuffix(body, "\n"))
+}
+
+// unavailableStorage fails as a storage with a lost database connection.
+type unavailableStorage struct {
+	*mocks.MockStorage
+	err error
+}
+
+func (s unavailableStorage) Get(context.Context, entities.MetricsKey) (entities.Metric, bool, error) {
+	return entities.Metric{}, false, s.err
+}
+
+func (s unavailableStorage) Update(
+	context.Context,
+	entities.OverflowPolicy,
+	...entities.Metric,
+) ([]entities.Metric, error) {
+	return nil, s.err
+}
+
+func TestServer_Unavailable(t *testing.T) {
+	tests := []struct {
+		name string
+		args args
+	}{
+		{
+			name: "update by URL",
+			args: args{method: http.MethodPost, path: "/update/gauge/cpu/1.5"},
+		},
+		{
+			name: "update by JSON",
+			args: args{method: http.MethodPost, path: "/update/", contentType: "application/json", body: `{"id":"cpu","type":"gauge","value":1.5}`},
+		},
+		{
+			name: "batch update",
+			args: args{method: http.MethodPost, path: "/updates/", contentType: "application/json", body: `[{"id":"cpu","type":"gauge","value":1.5}]`},
+		},
+		{
+			name: "value by JSON",
+			args: args{method: http.MethodPost, path: "/value/", contentType: "application/json", body: `{"id":"cpu","type":"gauge"}`},
+		},
+	}
+
+	stg := unavailableStorage{
+		MockStorage: mocks.NewStorage(),
+		err: fmt.Errorf("%w: %w",
+			apperrors.NewTransient("database is temporarily unavailable", 1500*time.Millisecond),
+			errors.New("connection refused")),
+	}
+	meta := mocks.NewMetaStorage()
+	r := chi.NewRouter()
+	UseEndpoints(r, &container.Container{
+		MetricUseCase:   usecases.NewMetricUseCase(zap.NewNop(), stg, meta, mocks.NewHistoryStorage(), usecases.MetricConfig{}),
+		MetadataUseCase: usecases.NewMetadataUseCase(meta),
+		Logger:          zap.NewNop(),
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, _ := testRequest(t, ts, tt.args, "")
+			_ = resp.Body.Close()
+
+			assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode, "Unexpected status code")
+			assert.Equal(t, "2", resp.Header.Get("Retry-After"))
+		})
+	}
+}
+
+// failingHistory fails to append points, the metrics are stored anyway.
+type failingHistory struct {
+	*mocks.MockHistoryStorage
+}
+
+func (failingHistory) Append(context.Context, ...entities.Sample) error {
+	return errors.New("history is unavailable")
+}
+
+func TestServer_HistoryFailure(t *testing.T) {
+	stg := mocks.NewStorage()
+	meta := mocks.NewMetaStorage()
+	r := chi.NewRouter()
+	UseEndpoints(r, &container.Container{
+		MetricUseCase: usecases.NewMetricUseCase(
+			zap.NewNop(), stg, meta, failingHistory{mocks.NewHistoryStorage()}, usecases.MetricConfig{}),
+		MetadataUseCase: usecases.NewMetadataUseCase(meta),
+		Logger:          zap.NewNop(),
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	update := args{
+		method:      http.MethodPost,
+		path:        "/updates/",
+		contentType: "application/json",
+		body:        `[{"id":"requests","type":"counter","delta":5},{"id":"cpu","type":"gauge","value":1.5}]`,
+	}
+	value := args{
+		method:      http.MethodPost,
+		path:        "/value/",
+		contentType: "application/json",
+		body:        `{"id":"requests","type":"counter"}`,
+	}
+
+	// the stored batch is acknowledged, so the client has no reason to retry it
+	resp, _ := testRequest(t, ts, update, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, body := testRequest(t, ts, value, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `{"id":"requests","type":"counter","delta":5}`, strings.TrimSuffix(body, "\n"))
+
+	// the next batch is counted once as well
+	resp, _ = testRequest(t, ts, update, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, body = testRequest(t, ts, value, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `{"id":"requests","type":"counter","delta":10}`, strings.TrimSuffix(body, "\n"))
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/dlomanov/mon/internal/infra/storage"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// Migrate - runs database schema migrations without starting the server.
+// The arguments are one of:
+//
+//	up            applies all pending migrations (default)
+//	down [steps]  reverts the latest applied migrations, one by default
+//	to <version>  migrates up or down to the version, 0 reverts all migrations
+//	version       prints the applied and the latest schema versions
+func Migrate(ctx context.Context, cfg Config, logger *zap.Logger, args []string) error {
+	if cfg.DatabaseDSN == "" {
+		return errors.New("database DSN is required for migrations")
+	}
+	db, err := sqlx.ConnectContext(ctx, "pgx", cfg.DatabaseDSN)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			logger.Error("failed to close DB", zap.Error(err))
+		}
+	}()
+	migrator, err := storage.NewPGMigrator(logger, db)
+	if err != nil {
+		return err
+	}
+
+	cmd := "up"
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+	switch {
+	case cmd == "up" && len(args) == 0:
+		err = migrator.Up(ctx)
+	case cmd == "down" && len(args) <= 1:
+		steps := 1
+		if len(args) == 1 {
+			if steps, err = strconv.Atoi(args[0]); err != nil || steps <= 0 {
+				return fmt.Errorf("invalid number of steps %q", args[0])
+			}
+		}
+		err = migrator.Down(ctx, steps)
+	case cmd == "to" && len(args) == 1:
+		version, perr := strconv.ParseInt(args[0], 10, 64)
+		if perr != nil || version < 0 {
+			return fmt.Errorf("invalid version %q", args[0])
+		}
+		err = migrator.To(ctx, version)
+	case cmd == "version" && len(args) == 0:
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down [steps], to <version> or version", cmd)
+	}
+	if err != nil {
+		return err
+	}
+
+	current, latest, err := migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+	logger.Info("database schema version", zap.Int64("current", current), zap.Int64("latest", latest))
+	return nil
+}
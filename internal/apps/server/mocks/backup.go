@@ -0,0 +1,48 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/dlomanov/mon/internal/entities"
+)
+
+func NewBackupStorage(storage *MockStorage, meta *MockMetaStorage) *MockBackupStorage {
+	return &MockBackupStorage{
+		storage: storage,
+		meta:    meta,
+	}
+}
+
+type MockBackupStorage struct {
+	storage *MockStorage
+	meta    *MockMetaStorage
+}
+
+func (s *MockBackupStorage) Backup(ctx context.Context) (entities.Backup, error) {
+	metrics, err := s.storage.All(ctx)
+	if err != nil {
+		return entities.Backup{}, err
+	}
+	metadata, err := s.meta.AllMeta(ctx)
+	if err != nil {
+		return entities.Backup{}, err
+	}
+	return entities.Backup{Metrics: metrics, Metadata: metadata}, nil
+}
+
+func (s *MockBackupStorage) Restore(_ context.Context, backup entities.Backup) error {
+	s.storage.mu.Lock()
+	s.storage.internal = make(map[entities.MetricsKey]entities.Metric, len(backup.Metrics))
+	for _, v := range backup.Metrics {
+		s.storage.internal[v.MetricsKey] = v
+	}
+	s.storage.mu.Unlock()
+
+	s.meta.mu.Lock()
+	s.meta.internal = make(map[string]entities.Metadata, len(backup.Metadata))
+	for _, v := range backup.Metadata {
+		s.meta.internal[v.Name] = v
+	}
+	s.meta.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,140 @@
+package mocks
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dlomanov/mon/internal/entities"
+)
+
+func NewHistoryStorage() *MockHistoryStorage {
+	return &MockHistoryStorage{
+		internal: make(map[time.Duration]map[entities.MetricsKey]map[time.Time]entities.Rollup),
+		mu:       sync.RWMutex{},
+	}
+}
+
+// MockHistoryStorage keeps raw points as rollups of a single point with zero resolution.
+type MockHistoryStorage struct {
+	internal map[time.Duration]map[entities.MetricsKey]map[time.Time]entities.Rollup
+	mu       sync.RWMutex
+}
+
+func (s *MockHistoryStorage) Append(_ context.Context, samples ...entities.Sample) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, v := range samples {
+		s.set(0, entities.NewRollup(v.MetricsKey, entities.Point{Time: v.Time.UTC(), Value: v.Value}))
+	}
+	return nil
+}
+
+func (s *MockHistoryStorage) Range(
+	_ context.Context,
+	key entities.MetricsKey,
+	from time.Time,
+	to time.Time,
+) ([]entities.Point, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]entities.Point, 0)
+	for _, v := range s.between(0, key, from, to) {
+		result = append(result, entities.Point{Time: v.Time, Value: v.Last})
+	}
+	return result, nil
+}
+
+func (s *MockHistoryStorage) Rollup(
+	_ context.Context,
+	source time.Duration,
+	resolution time.Duration,
+	from time.Time,
+	to time.Time,
+) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	built := make(map[entities.MetricsKey]map[time.Time]entities.Rollup)
+	for key := range s.internal[source] {
+		for _, v := range s.between(source, key, from, to) {
+			if !v.Time.Before(to) {
+				continue
+			}
+			bucket := entities.Bucket(v.Time, resolution)
+			if built[key] == nil {
+				built[key] = make(map[time.Time]entities.Rollup)
+			}
+			r := built[key][bucket]
+			r.Merge(v)
+			r.Time = bucket
+			built[key][bucket] = r
+		}
+	}
+	count := 0
+	for _, rollups := range built {
+		for _, r := range rollups {
+			s.set(resolution, r)
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *MockHistoryStorage) RangeRollups(
+	_ context.Context,
+	key entities.MetricsKey,
+	resolution time.Duration,
+	from time.Time,
+	to time.Time,
+) ([]entities.Rollup, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.between(resolution, key, from, to), nil
+}
+
+func (s *MockHistoryStorage) Truncate(_ context.Context, resolution time.Duration, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for _, series := range s.internal[resolution] {
+		for t := range series {
+			if t.Before(before) {
+				delete(series, t)
+				deleted++
+			}
+		}
+	}
+	return deleted, nil
+}
+
+func (s *MockHistoryStorage) set(resolution time.Duration, r entities.Rollup) {
+	if s.internal[resolution] == nil {
+		s.internal[resolution] = make(map[entities.MetricsKey]map[time.Time]entities.Rollup)
+	}
+	if s.internal[resolution][r.MetricsKey] == nil {
+		s.internal[resolution][r.MetricsKey] = make(map[time.Time]entities.Rollup)
+	}
+	s.internal[resolution][r.MetricsKey][r.Time] = r
+}
+
+func (s *MockHistoryStorage) between(
+	resolution time.Duration,
+	key entities.MetricsKey,
+	from time.Time,
+	to time.Time,
+) []entities.Rollup {
+	result := make([]entities.Rollup, 0)
+	for t, v := range s.internal[resolution][key] {
+		if !t.Before(from) && !t.After(to) {
+			result = append(result, v)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Time.Before(result[j].Time) })
+	return result
+}
@@ -0,0 +1,54 @@
+package mocks
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/dlomanov/mon/internal/entities"
+)
+
+func NewMetaStorage() *MockMetaStorage {
+	return &MockMetaStorage{
+		internal: make(map[string]entities.Metadata),
+		mu:       sync.RWMutex{},
+	}
+}
+
+type MockMetaStorage struct {
+	internal map[string]entities.Metadata
+	mu       sync.RWMutex
+}
+
+func (s *MockMetaStorage) SetMeta(_ context.Context, meta entities.Metadata) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.internal[meta.Name] = meta
+	return nil
+}
+
+func (s *MockMetaStorage) GetMeta(_ context.Context, names ...string) ([]entities.Metadata, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]entities.Metadata, 0, len(names))
+	for _, name := range names {
+		if meta, ok := s.internal[name]; ok {
+			result = append(result, meta)
+		}
+	}
+	return result, nil
+}
+
+func (s *MockMetaStorage) AllMeta(_ context.Context) ([]entities.Metadata, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]entities.Metadata, 0, len(s.internal))
+	for _, v := range s.internal {
+		result = append(result, v)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
@@ -9,13 +9,13 @@ import (
 
 func NewStorage() *MockStorage {
 	return &MockStorage{
-		internal: make(map[string]entities.Metric),
+		internal: make(map[entities.MetricsKey]entities.Metric),
 		mu:       sync.RWMutex{},
 	}
 }
 
 type MockStorage struct {
-	internal map[string]entities.Metric
+	internal map[entities.MetricsKey]entities.Metric
 	mu       sync.RWMutex
 }
 
@@ -24,7 +24,7 @@ func (s *MockStorage) Set(_ context.Context, metrics ...entities.Metric) error {
 	defer s.mu.Unlock()
 
 	for _, v := range metrics {
-		s.internal[v.String()] = v
+		s.internal[v.MetricsKey] = v
 	}
 	return nil
 }
@@ -36,10 +36,38 @@ func (s *MockStorage) Get(
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	metric, ok = s.internal[key.String()]
+	metric, ok = s.internal[key]
 	return metric, ok, nil
 }
 
+func (s *MockStorage) Update(
+	_ context.Context,
+	overflow entities.OverflowPolicy,
+	updates ...entities.Metric,
+) ([]entities.Metric, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]entities.Metric, 0, len(updates))
+	updated := make(map[entities.MetricsKey]entities.Metric, len(updates))
+	for _, u := range updates {
+		stored, ok := updated[u.MetricsKey]
+		if !ok {
+			stored, ok = s.internal[u.MetricsKey]
+		}
+		m, err := entities.ApplyUpdate(stored, ok, u, overflow)
+		if err != nil {
+			return nil, err
+		}
+		updated[u.MetricsKey] = m
+		result = append(result, m)
+	}
+	for k, v := range updated {
+		s.internal[k] = v
+	}
+	return result, nil
+}
+
 func (s *MockStorage) All(_ context.Context) ([]entities.Metric, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -51,3 +79,60 @@ func (s *MockStorage) All(_ context.Context) ([]entities.Metric, error) {
 
 	return result, nil
 }
+
+func (s *MockStorage) Delete(_ context.Context, keys ...entities.MetricsKey) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for _, k := range keys {
+		if _, ok := s.internal[k]; ok {
+			delete(s.internal, k)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *MockStorage) DeleteByPattern(_ context.Context, pattern entities.NamePattern) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for k := range s.internal {
+		if pattern.Match(k.Name) {
+			delete(s.internal, k)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *MockStorage) Evict(_ context.Context, metrics ...entities.Metric) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	evicted := 0
+	for _, m := range metrics {
+		if v, ok := s.internal[m.MetricsKey]; ok && !v.ReceivedAt.After(m.ReceivedAt) {
+			delete(s.internal, m.MetricsKey)
+			evicted++
+		}
+	}
+	return evicted, nil
+}
+
+func (s *MockStorage) ResetCounter(_ context.Context, name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := entities.MetricsKey{Name: name, Type: entities.MetricCounter}
+	v, ok := s.internal[key]
+	if !ok {
+		return false, nil
+	}
+	zero := int64(0)
+	v.Delta = &zero
+	s.internal[key] = v
+	return true, nil
+}
@@ -0,0 +1,90 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dlomanov/mon/internal/entities"
+	"github.com/dlomanov/mon/internal/entities/apperrors"
+	"go.uber.org/zap"
+)
+
+type (
+	BackupUseCase struct {
+		storage BackupStorage
+		now     func() time.Time
+	}
+
+	BackupStorage interface {
+		// Backup returns metrics and metadata as of a single point in time,
+		// concurrent writes are blocked or isolated while reading.
+		Backup(ctx context.Context) (entities.Backup, error)
+		// Restore replaces all metrics and metadata with the backup ones.
+		Restore(ctx context.Context, backup entities.Backup) error
+	}
+)
+
+func NewBackupUseCase(storage BackupStorage) *BackupUseCase {
+	return &BackupUseCase{
+		storage: storage,
+		now:     time.Now,
+	}
+}
+
+// Backup takes a consistent snapshot of metrics and metadata.
+func (uc *BackupUseCase) Backup(ctx context.Context) (entities.Backup, error) {
+	backup, err := uc.storage.Backup(ctx)
+	if err != nil {
+		return entities.Backup{}, fmt.Errorf("%w: %w", apperrors.NewInternal("failed to backup metrics"), err)
+	}
+	backup.Version = entities.BackupVersion
+	backup.CreatedAt = uc.now().UTC()
+	return backup, nil
+}
+
+// Restore replaces metrics and metadata with the backup ones.
+func (uc *BackupUseCase) Restore(ctx context.Context, backup entities.Backup) error {
+	if err := backup.Validate(); err != nil {
+		return fmt.Errorf("%w: %w", apperrors.NewInvalid("invalid backup"), err)
+	}
+	if err := uc.storage.Restore(ctx, backup); err != nil {
+		return fmt.Errorf("%w: %w", apperrors.NewInternal("failed to restore metrics"), err)
+	}
+	return nil
+}
+
+// BackupLoop takes a backup every interval and passes it to save until the context is canceled.
+// Returns the context error, backup errors don't stop the loop.
+func (uc *BackupUseCase) BackupLoop(
+	ctx context.Context,
+	logger *zap.Logger,
+	interval time.Duration,
+	save func(ctx context.Context, backup entities.Backup) error,
+) error {
+	if interval <= 0 {
+		return errors.New("backup interval should be positive")
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Debug("backup loop cancelled", zap.Error(ctx.Err()))
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+
+		backup, err := uc.Backup(ctx)
+		if err == nil {
+			err = save(ctx, backup)
+		}
+		if err != nil {
+			logger.Error("failed to backup metrics", zap.Error(err))
+			continue
+		}
+		logger.Info("metrics backed up",
+			zap.Int("metrics", len(backup.Metrics)),
+			zap.Int("metadata", len(backup.Metadata)))
+	}
+}
@@ -0,0 +1,185 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dlomanov/mon/internal/entities"
+	"github.com/dlomanov/mon/internal/entities/apperrors"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultRangeDuration is the range of a query without a start.
+	DefaultRangeDuration = time.Hour
+	// DefaultCompactInterval is the default interval of history compaction.
+	DefaultCompactInterval = time.Minute
+)
+
+type (
+	HistoryUseCase struct {
+		storage   HistoryStorage
+		retention entities.Retention
+		now       func() time.Time
+
+		mu        sync.Mutex
+		compacted map[time.Duration]time.Time // end of the latest rolled up bucket by resolution
+	}
+
+	HistoryStorage interface {
+		// Append adds samples to the metric series, a sample replaces the one with the same key and time.
+		Append(ctx context.Context, samples ...entities.Sample) error
+		// Range returns points of the metric between from and to inclusively ordered by time.
+		Range(ctx context.Context, key entities.MetricsKey, from, to time.Time) ([]entities.Point, error)
+		// Rollup aggregates points of the source resolution within [from, to) into rollups of the resolution,
+		// replacing existing rollups of the same buckets. Zero source resolution means raw points.
+		// Returns the number of built rollups.
+		Rollup(ctx context.Context, source, resolution time.Duration, from, to time.Time) (int, error)
+		// RangeRollups returns rollups of the metric starting between from and to inclusively ordered by time.
+		RangeRollups(ctx context.Context, key entities.MetricsKey, resolution time.Duration, from, to time.Time) ([]entities.Rollup, error)
+		// Truncate deletes points of the resolution before the time, zero resolution means raw points.
+		// Returns the number of deleted points.
+		Truncate(ctx context.Context, resolution time.Duration, before time.Time) (int, error)
+	}
+)
+
+func NewHistoryUseCase(storage HistoryStorage, retention entities.Retention) *HistoryUseCase {
+	return &HistoryUseCase{
+		storage:   storage,
+		retention: retention,
+		now:       time.Now,
+		compacted: make(map[time.Duration]time.Time),
+	}
+}
+
+// Range returns the metric series within the query range.
+// A zero end defaults to now and a zero start to DefaultRangeDuration before the end.
+// The series is read from the finest retention tier that still keeps points since the start.
+// Rollups are built by compaction, so the latest incomplete buckets of a rollup tier are missing.
+func (uc *HistoryUseCase) Range(ctx context.Context, query entities.RangeQuery) (entities.Series, error) {
+	now := uc.now()
+	if query.To.IsZero() {
+		query.To = now
+	}
+	if query.From.IsZero() {
+		query.From = query.To.Add(-DefaultRangeDuration)
+	}
+	if err := query.Validate(); err != nil {
+		return entities.Series{}, fmt.Errorf("%w: %w", apperrors.NewInvalid("invalid range query"), err)
+	}
+
+	tier := uc.retention.TierFor(query.From, now)
+	// the first step also covers points within the step before the start
+	from := query.From.Add(-query.Step)
+	var points []entities.Point
+	var err error
+	if tier.Resolution == 0 {
+		points, err = uc.storage.Range(ctx, query.MetricsKey, from, query.To)
+	} else {
+		points, err = uc.rangeRollups(ctx, query, tier.Resolution, entities.Bucket(from, tier.Resolution))
+	}
+	if err != nil {
+		return entities.Series{}, fmt.Errorf("%w: %w", apperrors.NewInternal("failed to get metric history"), err)
+	}
+	return entities.Series{
+		MetricsKey: query.MetricsKey,
+		Resolution: tier.Resolution,
+		Points:     query.Downsample(points),
+	}, nil
+}
+
+func (uc *HistoryUseCase) rangeRollups(
+	ctx context.Context,
+	query entities.RangeQuery,
+	resolution time.Duration,
+	from time.Time,
+) ([]entities.Point, error) {
+	rollups, err := uc.storage.RangeRollups(ctx, query.MetricsKey, resolution, from, query.To)
+	if err != nil {
+		return nil, err
+	}
+	agg := query.Aggregation
+	if agg == "" {
+		agg = entities.DefaultAggregation(query.Type)
+	}
+	points := make([]entities.Point, 0, len(rollups))
+	for _, r := range rollups {
+		points = append(points, entities.Point{Time: r.Time, Value: r.Value(agg)})
+	}
+	return points, nil
+}
+
+// Compact builds rollups of complete buckets of every tier from the finer tier,
+// then deletes points retained longer than their tier retention.
+// Samples arriving after their bucket is rolled up are kept only in the raw tier.
+// Returns the number of deleted points.
+func (uc *HistoryUseCase) Compact(ctx context.Context) (int, error) {
+	if !uc.retention.Enabled() {
+		return 0, nil
+	}
+
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	now := uc.now()
+	source := uc.retention[0]
+	for _, tier := range uc.retention.Rollups() {
+		to := entities.Bucket(now, tier.Resolution)
+		from, ok := uc.compacted[tier.Resolution]
+		if !ok && source.Retention != 0 {
+			// the oldest bucket may be partially deleted from the source, so its rollup is kept as is
+			from = entities.Bucket(now.Add(-source.Retention), tier.Resolution).Add(tier.Resolution)
+		}
+		if from.Before(to) {
+			if _, err := uc.storage.Rollup(ctx, source.Resolution, tier.Resolution, from, to); err != nil {
+				return 0, fmt.Errorf("%w: %w", apperrors.NewInternal("failed to roll up metric history"), err)
+			}
+			uc.compacted[tier.Resolution] = to
+		}
+		source = tier
+	}
+
+	deleted := 0
+	for _, tier := range uc.retention {
+		if tier.Retention == 0 {
+			continue
+		}
+		n, err := uc.storage.Truncate(ctx, tier.Resolution, now.Add(-tier.Retention))
+		if err != nil {
+			return deleted, fmt.Errorf("%w: %w", apperrors.NewInternal("failed to truncate metric history"), err)
+		}
+		deleted += n
+	}
+	return deleted, nil
+}
+
+// CompactLoop compacts history every interval until the context is canceled.
+// Returns the context error, compaction errors don't stop the loop.
+func (uc *HistoryUseCase) CompactLoop(ctx context.Context, logger *zap.Logger, interval time.Duration) error {
+	if !uc.retention.Enabled() {
+		return nil
+	}
+	if interval <= 0 {
+		interval = DefaultCompactInterval
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Debug("compact loop cancelled", zap.Error(ctx.Err()))
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+
+		deleted, err := uc.Compact(ctx)
+		if err != nil {
+			logger.Error("failed to compact history", zap.Error(err))
+			continue
+		}
+		if deleted > 0 {
+			logger.Debug("expired history deleted", zap.Int("count", deleted))
+		}
+	}
+}
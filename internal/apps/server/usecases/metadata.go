@@ -0,0 +1,67 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"github.com/dlomanov/mon/internal/entities"
+	"github.com/dlomanov/mon/internal/entities/apperrors"
+)
+
+type (
+	MetadataUseCase struct {
+		storage MetaStorage
+	}
+
+	MetaStorage interface {
+		SetMeta(ctx context.Context, meta entities.Metadata) error
+		// GetMeta returns metadata of the names that are registered.
+		GetMeta(ctx context.Context, names ...string) ([]entities.Metadata, error)
+		AllMeta(ctx context.Context) ([]entities.Metadata, error)
+	}
+)
+
+func NewMetadataUseCase(storage MetaStorage) *MetadataUseCase {
+	return &MetadataUseCase{
+		storage: storage,
+	}
+}
+
+// Register creates or replaces metadata of a metric name.
+func (uc *MetadataUseCase) Register(ctx context.Context, meta entities.Metadata) (entities.Metadata, error) {
+	if err := meta.Validate(); err != nil {
+		return meta, fmt.Errorf("%w: %w", apperrors.NewInvalid("invalid metadata"), err)
+	}
+	if err := uc.storage.SetMeta(ctx, meta); err != nil {
+		return meta, fmt.Errorf("%w: %w", apperrors.NewInternal("failed to register metadata"), err)
+	}
+	return meta, nil
+}
+
+func (uc *MetadataUseCase) Get(ctx context.Context, name string) (entities.Metadata, error) {
+	metas, err := uc.storage.GetMeta(ctx, name)
+	switch {
+	case err != nil:
+		return entities.Metadata{}, fmt.Errorf("%w: %w", apperrors.NewInternal("failed to get metadata"), err)
+	case len(metas) == 0:
+		return entities.Metadata{}, apperrors.NewNotFound("metadata not found")
+	default:
+		return metas[0], nil
+	}
+}
+
+// GetMany returns metadata of the registered names, names without metadata are skipped.
+func (uc *MetadataUseCase) GetMany(ctx context.Context, names ...string) ([]entities.Metadata, error) {
+	metas, err := uc.storage.GetMeta(ctx, names...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apperrors.NewInternal("failed to get metadata"), err)
+	}
+	return metas, nil
+}
+
+func (uc *MetadataUseCase) GetAll(ctx context.Context) ([]entities.Metadata, error) {
+	metas, err := uc.storage.AllMeta(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apperrors.NewInternal("failed to get metadata"), err)
+	}
+	return metas, nil
+}
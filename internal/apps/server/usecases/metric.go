@@ -2,26 +2,68 @@ package usecases
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/dlomanov/mon/internal/entities"
 	"github.com/dlomanov/mon/internal/entities/apperrors"
+	"go.uber.org/zap"
+	"time"
 )
 
 type (
 	MetricUseCase struct {
+		logger  *zap.Logger
 		storage Storage
+		meta    MetaStorage
+		history HistoryStorage
+		cfg     MetricConfig
+		now     func() time.Time
+	}
+
+	// MetricConfig holds metric processing settings.
+	MetricConfig struct {
+		Expiry   entities.Expiry         // Expiry sets TTLs after which metrics become stale and are evicted.
+		Overflow entities.OverflowPolicy // Overflow defines what happens when a counter exceeds the int64 range.
 	}
 
 	Storage interface {
 		Set(ctx context.Context, metrics ...entities.Metric) error
+		// Update applies the updates to the stored metrics and returns the resulting metrics,
+		// see entities.ApplyUpdate. Updates are applied atomically: either all of them are stored or none,
+		// and concurrent updates of the same metric aren't lost.
+		Update(ctx context.Context, overflow entities.OverflowPolicy, updates ...entities.Metric) ([]entities.Metric, error)
 		Get(ctx context.Context, key entities.MetricsKey) (metric entities.Metric, ok bool, err error)
 		All(ctx context.Context) (result []entities.Metric, err error)
+		// Delete removes metrics by keys and returns the number of removed metrics.
+		Delete(ctx context.Context, keys ...entities.MetricsKey) (deleted int, err error)
+		// DeleteByPattern removes metrics of any type with names matching the pattern
+		// and returns the number of removed metrics.
+		DeleteByPattern(ctx context.Context, pattern entities.NamePattern) (deleted int, err error)
+		// ResetCounter sets the counter value to zero, ok is false if the counter doesn't exist.
+		ResetCounter(ctx context.Context, name string) (ok bool, err error)
+		// Evict removes the metrics unless they were received again after their ReceivedAt
+		// and returns the number of removed metrics.
+		Evict(ctx context.Context, metrics ...entities.Metric) (evicted int, err error)
 	}
 )
 
-func NewMetricUseCase(storage Storage) *MetricUseCase {
+// DefaultSweepInterval is used by SweepLoop if the interval isn't set.
+const DefaultSweepInterval = time.Minute
+
+func NewMetricUseCase(
+	logger *zap.Logger,
+	storage Storage,
+	meta MetaStorage,
+	history HistoryStorage,
+	cfg MetricConfig,
+) *MetricUseCase {
 	return &MetricUseCase{
+		logger:  logger,
 		storage: storage,
+		meta:    meta,
+		history: history,
+		cfg:     cfg,
+		now:     time.Now,
 	}
 }
 
@@ -33,6 +75,7 @@ func (uc *MetricUseCase) Get(ctx context.Context, key entities.MetricsKey) (enti
 	case !ok:
 		return entities.Metric{}, apperrors.NewNotFound("metric not found")
 	default:
+		m.Stale = uc.cfg.Expiry.IsStale(m, uc.now())
 		return m, nil
 	}
 }
@@ -43,39 +86,198 @@ func (uc *MetricUseCase) GetAll(ctx context.Context) ([]entities.Metric, error)
 	case err != nil:
 		return nil, fmt.Errorf("%w: %w", apperrors.NewInternal("failed to get metric"), err)
 	default:
+		now := uc.now()
+		for i := range m {
+			m[i].Stale = uc.cfg.Expiry.IsStale(m[i], now)
+		}
 		return m, nil
 	}
 }
 
+// Quantiles returns estimated values of the summary metric at quantiles qs, each in [0, 1].
+func (uc *MetricUseCase) Quantiles(ctx context.Context, name string, qs ...float64) ([]float64, error) {
+	for _, q := range qs {
+		if q < 0 || q > 1 {
+			return nil, apperrors.NewInvalid(fmt.Sprintf("quantile %v is not in [0, 1]", q))
+		}
+	}
+	m, err := uc.Get(ctx, entities.MetricsKey{Name: name, Type: entities.MetricSummary})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]float64, 0, len(qs))
+	for _, q := range qs {
+		result = append(result, m.Summary.Quantile(q))
+	}
+	return result, nil
+}
+
 func (uc *MetricUseCase) Update(
 	ctx context.Context,
 	metrics ...entities.Metric,
 ) ([]entities.Metric, error) {
-	result := make([]entities.Metric, 0, len(metrics))
+	if err := uc.checkDeclaredTypes(ctx, metrics); err != nil {
+		return nil, err
+	}
+
+	now := uc.now()
+	updates := make([]entities.Metric, 0, len(metrics))
 	for _, metric := range metrics {
-		m, err := uc.update(ctx, metric)
-		if err != nil {
-			return nil, err
+		switch metric.Type {
+		case entities.MetricGauge, entities.MetricCounter:
+		case entities.MetricHistogram, entities.MetricSummary, entities.MetricSet:
+			if err := entities.ValidateMergeable(metric); err != nil {
+				return nil, fmt.Errorf("%w: %w", apperrors.NewInvalid("invalid metric"), err)
+			}
+		default:
+			return nil, apperrors.ErrUnsupportedMetricType
 		}
-		result = append(result, m)
+		metric.ReceivedAt = now
+		updates = append(updates, metric)
+	}
+
+	// the whole batch is stored or rejected, so a failed request is safe to retry
+	result, err := uc.storage.Update(ctx, uc.cfg.Overflow, updates...)
+	switch {
+	case errors.Is(err, entities.ErrCounterOverflow):
+		return nil, fmt.Errorf("%w: %w", apperrors.NewInvalid("failed to update counter"), err)
+	case errors.Is(err, entities.ErrMergeConflict):
+		return nil, fmt.Errorf("%w: %w", apperrors.NewInvalid("failed to merge metric"), err)
+	case err != nil:
+		return nil, fmt.Errorf("%w: %w", apperrors.NewInternal("failed to update metric"), err)
+	}
+
+	samples := make([]entities.Sample, 0, len(result))
+	for _, m := range result {
+		if sample, ok := entities.NewSample(m); ok {
+			samples = append(samples, sample)
+		}
+	}
+	if len(samples) == 0 {
+		return result, nil
+	}
+	// the batch is already stored, failing the request would make the client retry it and apply counters twice
+	if err = uc.history.Append(ctx, samples...); err != nil {
+		uc.logger.Error("failed to append metric history", zap.Error(err))
 	}
 	return result, nil
 }
 
-func (uc *MetricUseCase) update(ctx context.Context, metric entities.Metric) (entities.Metric, error) {
-	switch metric.MetricsKey.Type {
-	case entities.MetricGauge:
-		return metric, uc.storage.Set(ctx, metric)
-	case entities.MetricCounter:
-		old, ok, err := uc.storage.Get(ctx, metric.MetricsKey)
+// Delete removes metrics by keys and returns the number of removed metrics.
+func (uc *MetricUseCase) Delete(ctx context.Context, keys ...entities.MetricsKey) (int, error) {
+	deleted, err := uc.storage.Delete(ctx, keys...)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", apperrors.NewInternal("failed to delete metrics"), err)
+	}
+	return deleted, nil
+}
+
+// DeleteByPattern removes metrics of any type with names matching the pattern
+// and returns the number of removed metrics.
+func (uc *MetricUseCase) DeleteByPattern(ctx context.Context, pattern entities.NamePattern) (int, error) {
+	if err := pattern.Validate(); err != nil {
+		return 0, fmt.Errorf("%w: %w", apperrors.NewInvalid("invalid pattern"), err)
+	}
+	deleted, err := uc.storage.DeleteByPattern(ctx, pattern)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", apperrors.NewInternal("failed to delete metrics"), err)
+	}
+	return deleted, nil
+}
+
+// ResetCounter sets the counter value to zero, returns AppErrorNotFound if the counter doesn't exist.
+func (uc *MetricUseCase) ResetCounter(ctx context.Context, name string) error {
+	ok, err := uc.storage.ResetCounter(ctx, name)
+	switch {
+	case err != nil:
+		return fmt.Errorf("%w: %w", apperrors.NewInternal("failed to reset counter"), err)
+	case !ok:
+		return apperrors.NewNotFound("counter not found")
+	default:
+		return nil
+	}
+}
+
+// Sweep evicts metrics that are stale for longer than the grace period
+// and returns the number of evicted metrics.
+func (uc *MetricUseCase) Sweep(ctx context.Context) (int, error) {
+	if !uc.cfg.Expiry.Enabled() {
+		return 0, nil
+	}
+
+	all, err := uc.storage.All(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", apperrors.NewInternal("failed to get metrics"), err)
+	}
+	now := uc.now()
+	expired := make([]entities.Metric, 0)
+	for _, m := range all {
+		if uc.cfg.Expiry.IsExpired(m, now) {
+			expired = append(expired, m)
+		}
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	evicted, err := uc.storage.Evict(ctx, expired...)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", apperrors.NewInternal("failed to evict metrics"), err)
+	}
+	return evicted, nil
+}
+
+// SweepLoop evicts expired metrics every interval until the context is canceled.
+// Returns the context error, sweep errors don't stop the loop.
+func (uc *MetricUseCase) SweepLoop(ctx context.Context, logger *zap.Logger, interval time.Duration) error {
+	if !uc.cfg.Expiry.Enabled() {
+		return nil
+	}
+	if interval <= 0 {
+		interval = DefaultSweepInterval
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Debug("sweep loop cancelled", zap.Error(ctx.Err()))
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+
+		evicted, err := uc.Sweep(ctx)
 		if err != nil {
-			return metric, fmt.Errorf("%w: %w", apperrors.NewInternal("failed to update metric"), err)
+			logger.Error("failed to sweep metrics", zap.Error(err))
+			continue
 		}
-		if ok {
-			*metric.Delta += *old.Delta
+		if evicted > 0 {
+			logger.Info("expired metrics evicted", zap.Int("count", evicted))
+		}
+	}
+}
+
+// checkDeclaredTypes rejects metrics whose type conflicts with the type declared in metadata.
+func (uc *MetricUseCase) checkDeclaredTypes(ctx context.Context, metrics []entities.Metric) error {
+	names := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		names = append(names, m.Name)
+	}
+	metas, err := uc.meta.GetMeta(ctx, names...)
+	if err != nil {
+		return fmt.Errorf("%w: %w", apperrors.NewInternal("failed to get metadata"), err)
+	}
+	if len(metas) == 0 {
+		return nil
+	}
+
+	declared := make(map[string]entities.Metadata, len(metas))
+	for _, meta := range metas {
+		declared[meta.Name] = meta
+	}
+	for _, m := range metrics {
+		if meta, ok := declared[m.Name]; ok && !meta.Allows(m.Type) {
+			return apperrors.NewInvalid(fmt.Sprintf("metric %s is declared as %s, got %s", m.Name, meta.Type, m.Type))
 		}
-		return metric, uc.storage.Set(ctx, metric)
-	default:
-		return metric, apperrors.ErrUnsupportedMetricType
 	}
+	return nil
 }
@@ -0,0 +1,24 @@
+package apimodels
+
+import (
+	"time"
+
+	"github.com/dlomanov/mon/internal/entities"
+)
+
+// BackupInfo summarizes a backup archive.
+type BackupInfo struct {
+	Version   int       `json:"version"`    // Version is the backup format version.
+	CreatedAt time.Time `json:"created_at"` // CreatedAt is the time the backup was made.
+	Metrics   int       `json:"metrics"`    // Metrics is the number of metrics in the backup.
+	Metadata  int       `json:"metadata"`   // Metadata is the number of metadata in the backup.
+}
+
+func MapToModelBackupInfo(entity entities.Backup) BackupInfo {
+	return BackupInfo{
+		Version:   entity.Version,
+		CreatedAt: entity.CreatedAt,
+		Metrics:   len(entity.Metrics),
+		Metadata:  len(entity.Metadata),
+	}
+}
@@ -0,0 +1,34 @@
+package apimodels
+
+import (
+	"time"
+
+	"github.com/dlomanov/mon/internal/entities"
+)
+
+// Series is a metric time series ordered by time.
+type Series struct {
+	MetricKey
+	// Resolution is the rollup resolution in seconds the points are read from, omitted for raw points.
+	Resolution int64   `json:"resolution,omitempty"`
+	Points     []Point `json:"points"` // Points are metric values ordered by time.
+}
+
+// Point is a metric value at a moment of time.
+// Counter values are cumulative.
+type Point struct {
+	Timestamp time.Time `json:"timestamp"` // Timestamp is the sample time, or the step end for downsampled series.
+	Value     float64   `json:"value"`     // Value is the metric value.
+}
+
+func MapToModelSeries(entity entities.Series) Series {
+	points := make([]Point, 0, len(entity.Points))
+	for _, p := range entity.Points {
+		points = append(points, Point{Timestamp: p.Time, Value: p.Value})
+	}
+	return Series{
+		MetricKey:  MapToModelKey(entity.MetricsKey),
+		Resolution: int64(entity.Resolution / time.Second),
+		Points:     points,
+	}
+}
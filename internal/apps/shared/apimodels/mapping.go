@@ -11,6 +11,7 @@ var (
 	ErrInvalidMetricType     = apperrors.NewInvalid("invalid metric type")
 	ErrInvalidMetricName     = apperrors.NewInvalid("invalid metric name")
 	ErrInvalidMetricValue    = apperrors.NewInvalid("invalid metric value")
+	ErrMetricNameNotAllowed  = apperrors.NewInvalid("metric name not allowed")
 )
 
 func MapToEntities(models []Metric) (values []entities.Metric, err error) {
@@ -34,11 +35,32 @@ func MapToEntity(model Metric) (entity entities.Metric, err error) {
 	}
 
 	entity.MetricsKey = key
+	if model.Timestamp != nil {
+		entity.Timestamp = *model.Timestamp
+	}
 	switch {
+	case key.Type != entities.MetricCounter && model.Total != nil:
+		err = fmt.Errorf("%w: total is allowed only for counters", ErrInvalidMetricValue)
 	case key.Type == entities.MetricGauge && model.Value != nil:
 		entity.Value = model.Value
-	case key.Type == entities.MetricCounter && model.Delta != nil:
+	case key.Type == entities.MetricCounter && (model.Delta == nil) != (model.Total == nil):
 		entity.Delta = model.Delta
+		entity.Total = model.Total
+	case key.Type == entities.MetricHistogram && model.Histogram != nil:
+		entity.Histogram = MapToEntityHistogram(*model.Histogram)
+		if herr := entity.Histogram.Validate(); herr != nil {
+			err = fmt.Errorf("%w: %w", ErrInvalidMetricValue, herr)
+		}
+	case key.Type == entities.MetricSummary && model.Summary != nil:
+		entity.Summary = MapToEntitySummary(*model.Summary)
+		if serr := entity.Summary.Validate(); serr != nil {
+			err = fmt.Errorf("%w: %w", ErrInvalidMetricValue, serr)
+		}
+	case key.Type == entities.MetricSet && model.Set != nil:
+		entity.Set = &entities.Set{Precision: model.Set.Precision, Registers: model.Set.Registers}
+		if serr := entity.Set.Validate(); serr != nil {
+			err = fmt.Errorf("%w: %w", ErrInvalidMetricValue, serr)
+		}
 	default:
 		err = fmt.Errorf("%w: %s", ErrInvalidMetricValue, key.Type)
 	}
@@ -56,6 +78,9 @@ func MapToEntityKey(key MetricKey) (entityKey entities.MetricsKey, err error) {
 	if key.Name == "" {
 		return entityKey, ErrInvalidMetricName
 	}
+	if err = entities.ValidateMetricName(key.Name); err != nil {
+		return entityKey, fmt.Errorf("%w: %w", ErrMetricNameNotAllowed, err)
+	}
 
 	return entities.MetricsKey{
 		Name: key.Name,
@@ -63,11 +88,54 @@ func MapToEntityKey(key MetricKey) (entityKey entities.MetricsKey, err error) {
 	}, nil
 }
 
+func MapToEntityHistogram(model Histogram) *entities.Histogram {
+	return &entities.Histogram{
+		Bounds: model.Bounds,
+		Counts: model.Counts,
+		Sum:    model.Sum,
+		Count:  model.Count,
+	}
+}
+
 func MapToModel(entity entities.Metric) Metric {
-	return Metric{
+	model := Metric{
 		MetricKey: MapToModelKey(entity.MetricsKey),
 		Delta:     entity.Delta,
 		Value:     entity.Value,
+		Total:     entity.Total,
+	}
+	if entity.Histogram != nil {
+		h := MapToModelHistogram(*entity.Histogram)
+		model.Histogram = &h
+	}
+	if entity.Summary != nil {
+		s := MapToModelSummary(*entity.Summary)
+		model.Summary = &s
+	}
+	if entity.Set != nil {
+		model.Set = &Set{Precision: entity.Set.Precision, Registers: entity.Set.Registers}
+	}
+	if !entity.Timestamp.IsZero() {
+		ts := entity.Timestamp
+		model.Timestamp = &ts
+	}
+	return model
+}
+
+// MapToStoredModel maps a stored metric, its sample timestamp is returned as UpdatedAt.
+func MapToStoredModel(entity entities.Metric) Metric {
+	model := MapToModel(entity)
+	model.UpdatedAt, model.Timestamp = model.Timestamp, nil
+	model.Stale = entity.Stale
+	return model
+}
+
+func MapToModelHistogram(entity entities.Histogram) Histogram {
+	return Histogram{
+		Bounds: entity.Bounds,
+		Counts: entity.Counts,
+		Sum:    entity.Sum,
+		Count:  entity.Count,
 	}
 }
 
@@ -77,3 +145,29 @@ func MapToModelKey(entity entities.MetricsKey) MetricKey {
 		Type: string(entity.Type),
 	}
 }
+
+func MapToEntitySummary(model Summary) *entities.Summary {
+	return &entities.Summary{
+		Alpha:    model.Alpha,
+		Positive: model.Positive,
+		Negative: model.Negative,
+		Zero:     model.Zero,
+		Count:    model.Count,
+		Sum:      model.Sum,
+		Min:      model.Min,
+		Max:      model.Max,
+	}
+}
+
+func MapToModelSummary(entity entities.Summary) Summary {
+	return Summary{
+		Alpha:    entity.Alpha,
+		Positive: entity.Positive,
+		Negative: entity.Negative,
+		Zero:     entity.Zero,
+		Count:    entity.Count,
+		Sum:      entity.Sum,
+		Min:      entity.Min,
+		Max:      entity.Max,
+	}
+}
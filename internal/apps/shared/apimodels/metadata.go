@@ -0,0 +1,36 @@
+package apimodels
+
+import "github.com/dlomanov/mon/internal/entities"
+
+// Metadata describes a metric name.
+type Metadata struct {
+	Name        string `json:"id"`                    // Name is the metric name the metadata belongs to.
+	Type        string `json:"type,omitempty"`        // Type is the declared metric type, empty allows any type.
+	Unit        string `json:"unit,omitempty"`        // Unit is the unit of metric values (e.g., "bytes", "seconds").
+	Description string `json:"description,omitempty"` // Description explains what the metric measures.
+	Owner       string `json:"owner,omitempty"`       // Owner is the team owning the metric.
+}
+
+func MapToEntityMetadata(model Metadata) entities.Metadata {
+	mtype, ok := entities.ParseMetricType(model.Type)
+	if !ok {
+		mtype = entities.MetricType(model.Type) // rejected by validation unless empty
+	}
+	return entities.Metadata{
+		Name:        model.Name,
+		Type:        mtype,
+		Unit:        model.Unit,
+		Description: model.Description,
+		Owner:       model.Owner,
+	}
+}
+
+func MapToModelMetadata(entity entities.Metadata) Metadata {
+	return Metadata{
+		Name:        entity.Name,
+		Type:        string(entity.Type),
+		Unit:        entity.Unit,
+		Description: entity.Description,
+		Owner:       entity.Owner,
+	}
+}
@@ -1,16 +1,61 @@
 // Package apimodels provides API models for the application.
 package apimodels
 
+import "time"
+
 // Metric represents a metric with a key and optional delta or value.
 // It is used to store and retrieve metrics in the application.
 type Metric struct {
 	MetricKey
 	Delta *int64   `json:"delta,omitempty"` // Delta is the change in value for a counter metric.
 	Value *float64 `json:"value,omitempty"` // Value is the current value for a gauge metric.
+	// Total is the cumulative value of a counter metric, sent instead of Delta.
+	// The server derives the delta from the previous total, a lower total is taken as a counter reset.
+	Total *int64 `json:"total,omitempty"`
+	// Histogram holds observations for a histogram metric.
+	Histogram *Histogram `json:"histogram,omitempty"`
+	// Summary holds a quantile sketch for a summary metric.
+	Summary *Summary `json:"summary,omitempty"`
+	// Set holds a distinct-count sketch for a set metric.
+	Set *Set `json:"set,omitempty"`
+	// Timestamp is the time the sample was taken, older gauge samples don't overwrite newer ones.
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+	// UpdatedAt is the timestamp of the latest stored sample, returned on reads.
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	// Stale is returned on reads if the metric wasn't updated within its TTL.
+	Stale bool `json:"stale,omitempty"`
+}
+
+// Histogram is a distribution of observed values over buckets.
+// Counts has one more element than Bounds: the last bucket holds observations above the last bound.
+type Histogram struct {
+	Bounds []float64 `json:"bounds"` // Bounds are strictly increasing bucket upper bounds.
+	Counts []uint64  `json:"counts"` // Counts are non-cumulative bucket counts.
+	Sum    float64   `json:"sum"`    // Sum is the sum of observed values.
+	Count  uint64    `json:"count"`  // Count is the number of observations.
 }
 
 // MetricKey is a unique identifier for a metric, consisting of a name and type.
 type MetricKey struct {
 	Name string `json:"id"`   // Name is the unique name of the metric.
-	Type string `json:"type"` // Type is the type of the metric (e.g., "counter", "gauge").
+	Type string `json:"type"` // Type is the type of the metric (e.g., "counter", "gauge", "histogram", "summary", "set").
+}
+
+// Summary is a DDSketch quantile sketch.
+// Bins map a logarithmic bin index to the number of observations in the bin.
+type Summary struct {
+	Alpha    float64          `json:"alpha"`              // Alpha is the relative accuracy of quantiles.
+	Positive map[int32]uint64 `json:"positive,omitempty"` // Positive are bins of positive values.
+	Negative map[int32]uint64 `json:"negative,omitempty"` // Negative are bins of negative values.
+	Zero     uint64           `json:"zero,omitempty"`     // Zero is the number of values close to zero.
+	Count    uint64           `json:"count"`              // Count is the number of observations.
+	Sum      float64          `json:"sum"`                // Sum is the sum of observed values.
+	Min      float64          `json:"min"`                // Min is the minimal observed value.
+	Max      float64          `json:"max"`                // Max is the maximal observed value.
+}
+
+// Set is a HyperLogLog sketch.
+type Set struct {
+	Precision uint8  `json:"precision"` // Precision is the log2 of the number of registers.
+	Registers []byte `json:"registers"` // Registers are base64 encoded register values.
 }
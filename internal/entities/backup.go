@@ -0,0 +1,73 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// BackupVersion is the version of backups made by this version, older versions are restored as well.
+const BackupVersion = 1
+
+var ErrInvalidBackup = errors.New("invalid backup")
+
+// Backup is a snapshot of metrics and metadata portable between storages.
+type Backup struct {
+	Version   int
+	CreatedAt time.Time
+	Metrics   []Metric
+	Metadata  []Metadata
+}
+
+// Validate checks that the version is supported, metric keys and metadata are valid and unique,
+// and metrics hold a valid value of their type.
+func (b Backup) Validate() error {
+	if b.Version < 1 || b.Version > BackupVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidBackup, b.Version)
+	}
+	keys := make(map[MetricsKey]struct{}, len(b.Metrics))
+	for _, m := range b.Metrics {
+		if !m.Type.IsValid() {
+			return fmt.Errorf("%w: metric %q has unknown type %q", ErrInvalidBackup, m.Name, m.Type)
+		}
+		if err := ValidateMetricName(m.Name); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidBackup, err)
+		}
+		if err := validateBackupValue(m); err != nil {
+			return fmt.Errorf("%w: metric %q: %w", ErrInvalidBackup, m.MetricsKey.String(), err)
+		}
+		if _, ok := keys[m.MetricsKey]; ok {
+			return fmt.Errorf("%w: duplicate metric %q", ErrInvalidBackup, m.MetricsKey.String())
+		}
+		keys[m.MetricsKey] = struct{}{}
+	}
+	names := make(map[string]struct{}, len(b.Metadata))
+	for _, meta := range b.Metadata {
+		if err := meta.Validate(); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidBackup, err)
+		}
+		if _, ok := names[meta.Name]; ok {
+			return fmt.Errorf("%w: duplicate metadata %q", ErrInvalidBackup, meta.Name)
+		}
+		names[meta.Name] = struct{}{}
+	}
+	return nil
+}
+
+// validateBackupValue checks that the metric holds the value of its type,
+// so restored metrics can be rendered and merged with later updates.
+func validateBackupValue(m Metric) error {
+	switch m.Type {
+	case MetricGauge:
+		if m.Value == nil {
+			return errors.New("gauge value is empty")
+		}
+	case MetricCounter:
+		if m.Delta == nil {
+			return errors.New("counter value is empty")
+		}
+	default:
+		return ValidateMergeable(m)
+	}
+	return nil
+}
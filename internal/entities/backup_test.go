@@ -0,0 +1,62 @@
+package entities_test
+
+import (
+	"testing"
+
+	"github.com/dlomanov/mon/internal/entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackup_Validate(t *testing.T) {
+	value := 1.5
+	delta := int64(5)
+	gauge := entities.Metric{MetricsKey: entities.MetricsKey{Type: entities.MetricGauge, Name: "cpu"}, Value: &value}
+	counter := entities.Metric{MetricsKey: entities.MetricsKey{Type: entities.MetricCounter, Name: "requests"}, Delta: &delta}
+	h, err := entities.NewHistogram([]float64{1, 10})
+	require.NoError(t, err)
+	h.Observe(5)
+	histogram := entities.Metric{MetricsKey: entities.MetricsKey{Type: entities.MetricHistogram, Name: "latency"}, Histogram: h}
+
+	tests := []struct {
+		name    string
+		metrics []entities.Metric
+		wantErr bool
+	}{
+		{name: "valid", metrics: []entities.Metric{gauge, counter, histogram}},
+		{
+			name:    "gauge without value",
+			metrics: []entities.Metric{{MetricsKey: gauge.MetricsKey}},
+			wantErr: true,
+		},
+		{
+			name:    "counter without value",
+			metrics: []entities.Metric{{MetricsKey: counter.MetricsKey, Value: &value}},
+			wantErr: true,
+		},
+		{
+			name:    "empty histogram",
+			metrics: []entities.Metric{{MetricsKey: histogram.MetricsKey}},
+			wantErr: true,
+		},
+		{
+			name: "histogram counts not matching bounds",
+			metrics: []entities.Metric{{
+				MetricsKey: histogram.MetricsKey,
+				Histogram:  &entities.Histogram{Bounds: []float64{1, 10}, Counts: []uint64{1}, Count: 1},
+			}},
+			wantErr: true,
+		},
+		{name: "duplicate", metrics: []entities.Metric{gauge, gauge}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := entities.Backup{Version: entities.BackupVersion, Metrics: tt.metrics}.Validate()
+			if !tt.wantErr {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, entities.ErrInvalidBackup)
+		})
+	}
+}
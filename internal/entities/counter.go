@@ -0,0 +1,103 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// OverflowPolicy defines what happens when a counter exceeds the int64 range.
+type OverflowPolicy string
+
+const (
+	// OverflowClamp saturates the counter at the range bound.
+	OverflowClamp OverflowPolicy = "clamp"
+	// OverflowError rejects the update.
+	OverflowError OverflowPolicy = "error"
+)
+
+var ErrCounterOverflow = errors.New("counter overflow")
+
+// ParseOverflowPolicy parses the policy name, an empty name is OverflowClamp.
+func ParseOverflowPolicy(value string) (OverflowPolicy, error) {
+	switch p := OverflowPolicy(value); p {
+	case "":
+		return OverflowClamp, nil
+	case OverflowClamp, OverflowError:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown counter overflow policy: %s", value)
+	}
+}
+
+// AddDelta returns a+b saturated at the int64 range bounds, overflow reports whether saturation happened.
+func AddDelta(a, b int64) (sum int64, overflow bool) {
+	sum = a + b
+	switch {
+	case b > 0 && sum < a:
+		return math.MaxInt64, true
+	case b < 0 && sum > a:
+		return math.MinInt64, true
+	default:
+		return sum, false
+	}
+}
+
+// Add adds delta to the counter value according to the policy.
+// Returns ErrCounterOverflow if the value overflows and the policy is OverflowError.
+func (p OverflowPolicy) Add(value, delta int64) (int64, error) {
+	sum, overflow := AddDelta(value, delta)
+	if overflow && p == OverflowError {
+		return value, fmt.Errorf("%w: %d + %d", ErrCounterOverflow, value, delta)
+	}
+	return sum, nil
+}
+
+// CumulativeDelta derives the increase of a cumulative counter from its previous and current totals.
+// A total lower than the previous one means the counter was reset, and the whole current total is the increase.
+func CumulativeDelta(prev, cur int64) (delta int64, reset bool) {
+	if cur < prev {
+		return cur, true
+	}
+	return cur - prev, false
+}
+
+// Increment returns the counter with the update applied, ok is false if there is no stored counter yet.
+// The update holds either the increase in Delta or the cumulative total in Total.
+// The increase of a cumulative counter is derived from the previous total, a lower total means the counter was reset.
+// The first total of a new counter is its value, the first total of a delta counter only becomes the baseline.
+// A total older than the stored counter is ignored and the stored counter is returned.
+func (p OverflowPolicy) Increment(stored Metric, ok bool, update Metric) (Metric, error) {
+	if ok && update.Total != nil && update.Timestamp.Before(stored.Timestamp) {
+		return stored, nil // stale total, a lower value would be taken for a reset
+	}
+
+	var delta int64
+	switch {
+	case update.Total == nil:
+		delta = *update.Delta
+	case !ok:
+		delta = *update.Total
+	case stored.Total == nil:
+		delta = 0
+	default:
+		delta, _ = CumulativeDelta(*stored.Total, *update.Total)
+	}
+
+	var value int64
+	if ok {
+		value = *stored.Delta
+		if stored.Timestamp.After(update.Timestamp) {
+			update.Timestamp = stored.Timestamp
+		}
+		if update.Total == nil {
+			update.Total = stored.Total
+		}
+	}
+	sum, err := p.Add(value, delta)
+	if err != nil {
+		return update, err
+	}
+	update.Delta = &sum
+	return update, nil
+}
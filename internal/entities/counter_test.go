@@ -0,0 +1,134 @@
+package entities_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/dlomanov/mon/internal/entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddDelta(t *testing.T) {
+	tests := []struct {
+		name         string
+		a, b         int64
+		want         int64
+		wantOverflow bool
+	}{
+		{name: "positive", a: 1, b: 2, want: 3},
+		{name: "negative", a: 1, b: -2, want: -1},
+		{name: "max", a: math.MaxInt64 - 1, b: 1, want: math.MaxInt64},
+		{name: "overflow", a: math.MaxInt64, b: 1, want: math.MaxInt64, wantOverflow: true},
+		{name: "underflow", a: math.MinInt64, b: -1, want: math.MinInt64, wantOverflow: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sum, overflow := entities.AddDelta(tt.a, tt.b)
+			assert.Equal(t, tt.want, sum)
+			assert.Equal(t, tt.wantOverflow, overflow)
+		})
+	}
+}
+
+func TestOverflowPolicy_Add(t *testing.T) {
+	sum, err := entities.OverflowClamp.Add(math.MaxInt64, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(math.MaxInt64), sum)
+
+	_, err = entities.OverflowError.Add(math.MaxInt64, 10)
+	assert.ErrorIs(t, err, entities.ErrCounterOverflow)
+
+	_, err = entities.ParseOverflowPolicy("wrap")
+	assert.Error(t, err)
+}
+
+func TestCumulativeDelta(t *testing.T) {
+	delta, reset := entities.CumulativeDelta(10, 15)
+	assert.Equal(t, int64(5), delta)
+	assert.False(t, reset)
+
+	delta, reset = entities.CumulativeDelta(10, 3)
+	assert.Equal(t, int64(3), delta)
+	assert.True(t, reset)
+}
+
+func TestOverflowPolicy_Increment(t *testing.T) {
+	key := entities.MetricsKey{Name: "requests", Type: entities.MetricCounter}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	counter := func(delta, total *int64, sec int) entities.Metric {
+		m := entities.Metric{MetricsKey: key, Delta: delta, Total: total}
+		if sec != 0 {
+			m.Timestamp = start.Add(time.Duration(sec) * time.Second)
+		}
+		return m
+	}
+	v := func(v int64) *int64 { return &v }
+
+	tests := []struct {
+		name    string
+		stored  *entities.Metric
+		update  entities.Metric
+		want    entities.Metric
+		wantErr error
+	}{
+		{name: "new delta", update: counter(v(5), nil, 0), want: counter(v(5), nil, 0)},
+		{name: "new total", update: counter(nil, v(7), 1), want: counter(v(7), v(7), 1)},
+		{
+			name:   "delta keeps total and later timestamp",
+			stored: ptr(counter(v(10), v(7), 2)),
+			update: counter(v(5), nil, 1),
+			want:   counter(v(15), v(7), 2),
+		},
+		{
+			name:   "total increase",
+			stored: ptr(counter(v(10), v(7), 1)),
+			update: counter(nil, v(9), 2),
+			want:   counter(v(12), v(9), 2),
+		},
+		{
+			name:   "total reset",
+			stored: ptr(counter(v(10), v(7), 1)),
+			update: counter(nil, v(3), 2),
+			want:   counter(v(13), v(3), 2),
+		},
+		{
+			name:   "first total of delta counter is baseline",
+			stored: ptr(counter(v(10), nil, 0)),
+			update: counter(nil, v(3), 2),
+			want:   counter(v(10), v(3), 2),
+		},
+		{
+			name:   "stale total",
+			stored: ptr(counter(v(10), v(7), 2)),
+			update: counter(nil, v(9), 1),
+			want:   counter(v(10), v(7), 2),
+		},
+		{
+			name:    "overflow",
+			stored:  ptr(counter(v(math.MaxInt64), nil, 0)),
+			update:  counter(v(1), nil, 0),
+			wantErr: entities.ErrCounterOverflow,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stored entities.Metric
+			if tt.stored != nil {
+				stored = *tt.stored
+			}
+			got, err := entities.OverflowError.Increment(stored, tt.stored != nil, tt.update)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,94 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrInvalidTTL = errors.New("invalid TTL")
+
+type (
+	// TTLRule sets the TTL of metrics of a type or with names matching a pattern.
+	// Exactly one of Type and Pattern is set.
+	TTLRule struct {
+		Type    MetricType
+		Pattern NamePattern
+		TTL     time.Duration
+	}
+
+	// Expiry decides when metrics become stale and when they are evicted.
+	// A metric not updated within its TTL is stale, a stale metric is evicted once Grace passes.
+	// Pattern rules take precedence over type rules, the first matching rule wins.
+	// Metrics without a matching rule never expire.
+	Expiry struct {
+		Rules []TTLRule
+		Grace time.Duration
+	}
+)
+
+// ParseTTLRules parses comma-separated rules of the form "<type or pattern>=<duration>",
+// e.g. "gauge=24h,host-*=1h".
+func ParseTTLRules(value string) ([]TTLRule, error) {
+	var rules []TTLRule
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		key, ttlStr, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: rule %q should be <type or pattern>=<duration>", ErrInvalidTTL, item)
+		}
+		ttl, err := time.ParseDuration(strings.TrimSpace(ttlStr))
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("%w: rule %q has invalid duration", ErrInvalidTTL, item)
+		}
+
+		key = strings.TrimSpace(key)
+		rule := TTLRule{TTL: ttl}
+		if mtype, isType := ParseMetricType(key); isType {
+			rule.Type = mtype
+		} else {
+			rule.Pattern = NamePattern(key)
+			if err = rule.Pattern.Validate(); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrInvalidTTL, err)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Enabled reports whether any metric can expire.
+func (e Expiry) Enabled() bool {
+	return len(e.Rules) != 0
+}
+
+// TTL returns the TTL of the metric, ok is false if the metric never expires.
+func (e Expiry) TTL(key MetricsKey) (ttl time.Duration, ok bool) {
+	for _, r := range e.Rules {
+		if r.Type == MetricUnknown && r.Pattern.Match(key.Name) {
+			return r.TTL, true
+		}
+	}
+	for _, r := range e.Rules {
+		if r.Type == key.Type {
+			return r.TTL, true
+		}
+	}
+	return 0, false
+}
+
+// IsStale reports whether the metric wasn't updated within its TTL.
+// Metrics with unknown update time are never stale.
+func (e Expiry) IsStale(m Metric, now time.Time) bool {
+	ttl, ok := e.TTL(m.MetricsKey)
+	return ok && !m.ReceivedAt.IsZero() && now.Sub(m.ReceivedAt) > ttl
+}
+
+// IsExpired reports whether the metric is stale for longer than the grace period and should be evicted.
+func (e Expiry) IsExpired(m Metric, now time.Time) bool {
+	ttl, ok := e.TTL(m.MetricsKey)
+	return ok && !m.ReceivedAt.IsZero() && now.Sub(m.ReceivedAt) > ttl+e.Grace
+}
@@ -0,0 +1,66 @@
+package entities_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dlomanov/mon/internal/entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTTLRules(t *testing.T) {
+	rules, err := entities.ParseTTLRules("gauge=24h, host-*=1h")
+	require.NoError(t, err)
+	assert.Equal(t, []entities.TTLRule{
+		{Type: entities.MetricGauge, TTL: 24 * time.Hour},
+		{Pattern: "host-*", TTL: time.Hour},
+	}, rules)
+
+	rules, err = entities.ParseTTLRules("")
+	require.NoError(t, err)
+	assert.Empty(t, rules)
+
+	for _, value := range []string{"gauge", "gauge=abc", "gauge=-1h", "=1h"} {
+		_, err = entities.ParseTTLRules(value)
+		assert.ErrorIs(t, err, entities.ErrInvalidTTL, value)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	expiry := entities.Expiry{
+		Rules: []entities.TTLRule{
+			{Type: entities.MetricGauge, TTL: 24 * time.Hour},
+			{Pattern: "host-*", TTL: time.Hour},
+		},
+		Grace: time.Hour,
+	}
+	metric := func(name string, mtype entities.MetricType, age time.Duration) entities.Metric {
+		return entities.Metric{
+			MetricsKey: entities.MetricsKey{Name: name, Type: mtype},
+			ReceivedAt: now.Add(-age),
+		}
+	}
+
+	tests := []struct {
+		name        string
+		metric      entities.Metric
+		wantStale   bool
+		wantExpired bool
+	}{
+		{name: "fresh gauge", metric: metric("Alloc", entities.MetricGauge, time.Hour)},
+		{name: "stale gauge", metric: metric("Alloc", entities.MetricGauge, 24*time.Hour+time.Minute), wantStale: true},
+		{name: "expired gauge", metric: metric("Alloc", entities.MetricGauge, 26*time.Hour), wantStale: true, wantExpired: true},
+		{name: "pattern before type", metric: metric("host-1", entities.MetricGauge, 90*time.Minute), wantStale: true},
+		{name: "pattern for any type", metric: metric("host-1", entities.MetricCounter, 3*time.Hour), wantStale: true, wantExpired: true},
+		{name: "no rule", metric: metric("PollCount", entities.MetricCounter, 100*time.Hour)},
+		{name: "unknown update time", metric: entities.Metric{MetricsKey: entities.MetricsKey{Name: "Alloc", Type: entities.MetricGauge}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantStale, expiry.IsStale(tt.metric, now))
+			assert.Equal(t, tt.wantExpired, expiry.IsExpired(tt.metric, now))
+		})
+	}
+}
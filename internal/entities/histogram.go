@@ -0,0 +1,114 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidHistogram        = errors.New("invalid histogram")
+	ErrHistogramBoundsMismatch = errors.New("histogram bounds mismatch")
+)
+
+// Histogram is a distribution of observed values over buckets with fixed upper bounds.
+// Counts[i] is the number of observations in (Bounds[i-1], Bounds[i]],
+// the last element of Counts holds observations above the last bound.
+type Histogram struct {
+	Bounds []float64
+	Counts []uint64
+	Sum    float64
+	Count  uint64
+}
+
+// NewHistogram creates an empty Histogram with the given bucket upper bounds.
+func NewHistogram(bounds []float64) (*Histogram, error) {
+	h := &Histogram{
+		Bounds: slices.Clone(bounds),
+		Counts: make([]uint64, len(bounds)+1),
+	}
+	return h, h.Validate()
+}
+
+// Validate checks that bounds are finite and strictly increasing
+// and that counts match the bounds and the total count.
+func (h *Histogram) Validate() error {
+	for i, b := range h.Bounds {
+		if math.IsNaN(b) || math.IsInf(b, 0) {
+			return fmt.Errorf("%w: bound %d is not finite", ErrInvalidHistogram, i)
+		}
+		if i > 0 && b <= h.Bounds[i-1] {
+			return fmt.Errorf("%w: bounds are not strictly increasing", ErrInvalidHistogram)
+		}
+	}
+	if len(h.Counts) != len(h.Bounds)+1 {
+		return fmt.Errorf("%w: %d counts for %d bounds", ErrInvalidHistogram, len(h.Counts), len(h.Bounds))
+	}
+	var total uint64
+	for _, c := range h.Counts {
+		total += c
+	}
+	if total != h.Count {
+		return fmt.Errorf("%w: count %d doesn't match bucket counts %d", ErrInvalidHistogram, h.Count, total)
+	}
+	return nil
+}
+
+// Observe adds a value to the histogram.
+func (h *Histogram) Observe(value float64) {
+	i, _ := slices.BinarySearch(h.Bounds, value)
+	h.Counts[i]++
+	h.Sum += value
+	h.Count++
+}
+
+// Merge adds observations of other to the histogram bucket-wise.
+// Returns ErrHistogramBoundsMismatch if the histograms have different bounds.
+func (h *Histogram) Merge(other *Histogram) error {
+	if !slices.Equal(h.Bounds, other.Bounds) {
+		return ErrHistogramBoundsMismatch
+	}
+	for i, c := range other.Counts {
+		h.Counts[i] += c
+	}
+	h.Sum += other.Sum
+	h.Count += other.Count
+	return nil
+}
+
+// Clone returns a deep copy of the histogram.
+func (h *Histogram) Clone() *Histogram {
+	return &Histogram{
+		Bounds: slices.Clone(h.Bounds),
+		Counts: slices.Clone(h.Counts),
+		Sum:    h.Sum,
+		Count:  h.Count,
+	}
+}
+
+// String returns the histogram in the form "count=3 sum=1.5 le(0.1)=1 le(1)=2 le(+Inf)=3",
+// bucket counts are cumulative.
+func (h *Histogram) String() string {
+	sb := strings.Builder{}
+	sb.WriteString("count=")
+	sb.WriteString(strconv.FormatUint(h.Count, 10))
+	sb.WriteString(" sum=")
+	sb.WriteString(strconv.FormatFloat(h.Sum, 'f', -1, 64))
+
+	var cumulative uint64
+	for i, c := range h.Counts {
+		cumulative += c
+		bound := "+Inf"
+		if i < len(h.Bounds) {
+			bound = strconv.FormatFloat(h.Bounds[i], 'f', -1, 64)
+		}
+		sb.WriteString(" le(")
+		sb.WriteString(bound)
+		sb.WriteString(")=")
+		sb.WriteString(strconv.FormatUint(cumulative, 10))
+	}
+	return sb.String()
+}
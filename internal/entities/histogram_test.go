@@ -0,0 +1,51 @@
+package entities_test
+
+import (
+	"testing"
+
+	"github.com/dlomanov/mon/internal/entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogram_Observe(t *testing.T) {
+	h, err := entities.NewHistogram([]float64{0.1, 1})
+	require.NoError(t, err)
+
+	for _, v := range []float64{0.05, 0.1, 0.5, 2} {
+		h.Observe(v)
+	}
+
+	assert.Equal(t, []uint64{2, 1, 1}, h.Counts)
+	assert.Equal(t, uint64(4), h.Count)
+	assert.InDelta(t, 2.65, h.Sum, 1e-9)
+	assert.Equal(t, "count=4 sum=2.65 le(0.1)=2 le(1)=3 le(+Inf)=4", h.String())
+	require.NoError(t, h.Validate())
+}
+
+func TestHistogram_Merge(t *testing.T) {
+	h := &entities.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 2}, Sum: 5, Count: 3}
+
+	require.NoError(t, h.Merge(&entities.Histogram{Bounds: []float64{1}, Counts: []uint64{3, 0}, Sum: 1, Count: 3}))
+	assert.Equal(t, &entities.Histogram{Bounds: []float64{1}, Counts: []uint64{4, 2}, Sum: 6, Count: 6}, h)
+
+	err := h.Merge(&entities.Histogram{Bounds: []float64{2}, Counts: []uint64{1, 0}, Sum: 1, Count: 1})
+	require.ErrorIs(t, err, entities.ErrHistogramBoundsMismatch)
+}
+
+func TestHistogram_Validate(t *testing.T) {
+	tests := []struct {
+		name string
+		h    entities.Histogram
+	}{
+		{name: "unsorted bounds", h: entities.Histogram{Bounds: []float64{2, 1}, Counts: []uint64{0, 0, 0}}},
+		{name: "counts length", h: entities.Histogram{Bounds: []float64{1}, Counts: []uint64{0}}},
+		{name: "total count", h: entities.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 1}, Count: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.ErrorIs(t, tt.h.Validate(), entities.ErrInvalidHistogram)
+		})
+	}
+}
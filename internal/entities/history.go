@@ -0,0 +1,116 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MaxRangePoints limits the number of steps of a range query.
+const MaxRangePoints = 11000
+
+var ErrInvalidRange = errors.New("invalid range")
+
+type (
+	// Point is a metric value at a moment of time.
+	Point struct {
+		Time  time.Time
+		Value float64
+	}
+
+	// Sample is a point of a metric time series.
+	Sample struct {
+		MetricsKey
+		Point
+	}
+
+	// Series is a metric time series ordered by time.
+	// Resolution is the rollup resolution the points are read from, zero for raw points.
+	Series struct {
+		MetricsKey
+		Resolution time.Duration
+		Points     []Point
+	}
+
+	// RangeQuery selects points of a metric between From and To inclusively.
+	// A non-zero Step downsamples the series to the latest point of every step.
+	// Aggregation selects the rollup value if the range is read from rollups.
+	RangeQuery struct {
+		MetricsKey
+		From        time.Time
+		To          time.Time
+		Step        time.Duration
+		Aggregation Aggregation
+	}
+)
+
+// HasHistory reports whether samples of the metric type are kept in history.
+// Only gauges and counters have a single value to put on a series.
+func HasHistory(t MetricType) bool {
+	return t == MetricGauge || t == MetricCounter
+}
+
+// NewSample returns the history sample of the metric, ok is false if the metric has no single value.
+// The sample is taken at the metric timestamp, or at the time it was received if the timestamp is unknown.
+func NewSample(m Metric) (sample Sample, ok bool) {
+	sample.MetricsKey = m.MetricsKey
+	sample.Time = m.Timestamp
+	if sample.Time.IsZero() {
+		sample.Time = m.ReceivedAt
+	}
+	switch {
+	case sample.Time.IsZero():
+		return sample, false
+	case m.Type == MetricGauge && m.Value != nil:
+		sample.Value = *m.Value
+	case m.Type == MetricCounter && m.Delta != nil:
+		sample.Value = float64(*m.Delta)
+	default:
+		return sample, false
+	}
+	return sample, true
+}
+
+// Validate checks that the range is not inverted and doesn't exceed MaxRangePoints steps.
+func (q RangeQuery) Validate() error {
+	switch {
+	case !HasHistory(q.Type):
+		return fmt.Errorf("%w: history isn't kept for %s metrics", ErrInvalidRange, q.Type)
+	case q.To.Before(q.From):
+		return fmt.Errorf("%w: end is before start", ErrInvalidRange)
+	case q.Step < 0:
+		return fmt.Errorf("%w: negative step", ErrInvalidRange)
+	case q.Step > 0 && q.To.Sub(q.From)/q.Step >= MaxRangePoints:
+		return fmt.Errorf("%w: more than %d steps", ErrInvalidRange, MaxRangePoints)
+	default:
+		return nil
+	}
+}
+
+// Contains reports whether the time is within the range.
+func (q RangeQuery) Contains(t time.Time) bool {
+	return !t.Before(q.From) && !t.After(q.To)
+}
+
+// Downsample returns the latest point of every step of the range, stamped with the step end.
+// Steps without points are skipped. Points must be ordered by time.
+func (q RangeQuery) Downsample(points []Point) []Point {
+	if q.Step <= 0 {
+		return points
+	}
+	result := make([]Point, 0)
+	i := 0
+	for end := q.From; !end.After(q.To); end = end.Add(q.Step) {
+		found := false
+		var last Point
+		for ; i < len(points) && !points[i].Time.After(end); i++ {
+			if points[i].Time.After(end.Add(-q.Step)) {
+				last, found = points[i], true
+			}
+		}
+		if found {
+			result = append(result, Point{Time: end, Value: last.Value})
+		}
+	}
+	return result
+}
@@ -0,0 +1,60 @@
+package entities_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dlomanov/mon/internal/entities"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRangeQuery_Validate(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	gauge := entities.MetricsKey{Type: entities.MetricGauge, Name: "key"}
+	tests := []struct {
+		name    string
+		query   entities.RangeQuery
+		wantErr bool
+	}{
+		{name: "raw", query: entities.RangeQuery{MetricsKey: gauge, From: start, To: start.Add(time.Hour)}},
+		{name: "step", query: entities.RangeQuery{MetricsKey: gauge, From: start, To: start.Add(time.Hour), Step: time.Second}},
+		{name: "histogram", query: entities.RangeQuery{MetricsKey: entities.MetricsKey{Type: entities.MetricHistogram, Name: "key"}, From: start, To: start}, wantErr: true},
+		{name: "inverted", query: entities.RangeQuery{MetricsKey: gauge, From: start.Add(time.Second), To: start}, wantErr: true},
+		{name: "negative step", query: entities.RangeQuery{MetricsKey: gauge, From: start, To: start, Step: -time.Second}, wantErr: true},
+		{name: "too many steps", query: entities.RangeQuery{MetricsKey: gauge, From: start, To: start.Add(24 * time.Hour), Step: time.Second}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.query.Validate()
+			if tt.wantErr {
+				assert.ErrorIs(t, err, entities.ErrInvalidRange)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestRangeQuery_Downsample(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration, v float64) entities.Point {
+		return entities.Point{Time: start.Add(d), Value: v}
+	}
+	points := []entities.Point{
+		at(-30*time.Second, 0),
+		at(10*time.Second, 1),
+		at(20*time.Second, 2),
+		at(150*time.Second, 3),
+	}
+	query := entities.RangeQuery{From: start, To: start.Add(3 * time.Minute), Step: time.Minute}
+
+	got := query.Downsample(points)
+	assert.Equal(t, []entities.Point{
+		at(0, 0),
+		at(time.Minute, 2),
+		at(3*time.Minute, 3),
+	}, got)
+
+	query.Step = 0
+	assert.Equal(t, points, query.Downsample(points))
+}
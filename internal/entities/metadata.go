@@ -0,0 +1,33 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidMetadata = errors.New("invalid metadata")
+
+// Metadata describes a metric name: its unit, purpose, owner and expected type.
+type Metadata struct {
+	Name        string
+	Type        MetricType // declared type, MetricUnknown allows any type
+	Unit        string
+	Description string
+	Owner       string
+}
+
+// Validate checks that the name is set and the declared type is known.
+func (m *Metadata) Validate() error {
+	if err := ValidateMetricName(m.Name); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidMetadata, err)
+	}
+	if m.Type != MetricUnknown && !m.Type.IsValid() {
+		return fmt.Errorf("%w: unknown type %s", ErrInvalidMetadata, m.Type)
+	}
+	return nil
+}
+
+// Allows reports whether a metric of type t conforms to the declared type.
+func (m *Metadata) Allows(t MetricType) bool {
+	return m.Type == MetricUnknown || m.Type == t
+}
@@ -6,17 +6,32 @@ import (
 	"github.com/dlomanov/mon/internal/entities/apperrors"
 	"strconv"
 	"strings"
+	"time"
 )
 
-// Metric represents a metric with a key and optional delta or value.
+// Metric represents a metric with a key and optional delta, value, histogram, summary or set.
 type Metric struct {
 	MetricsKey
 	Value *float64
 	Delta *int64
+	// Total is the latest absolute value of a cumulative counter reported by the client,
+	// the server derives deltas from consecutive totals.
+	Total     *int64
+	Histogram *Histogram
+	Summary   *Summary
+	Set       *Set
+	// Timestamp is the time the sample was taken, zero if unknown.
+	Timestamp time.Time
+	// ReceivedAt is the time the server received the latest update, zero if unknown.
+	ReceivedAt time.Time
+	// Stale is set on reads if the metric wasn't updated within its TTL.
+	Stale bool
 }
 
 // NewMetric creates a new Metric instance based on the provided key and value string.
 // It parses the value string into either a float64 for gauge metrics or an int64 for counter metrics.
+// For set metrics the value string is a member of a new set.
+// Histograms and summaries can't be parsed from a string.
 func NewMetric(key MetricsKey, value string) (Metric, error) {
 	if key.Type == MetricGauge {
 		v, err := strconv.ParseFloat(value, 64)
@@ -35,6 +50,18 @@ func NewMetric(key MetricsKey, value string) (Metric, error) {
 
 	}
 
+	if key.Type == MetricSet {
+		s, err := NewSet(DefaultSetPrecision)
+		if err != nil {
+			return Metric{}, err
+		}
+		s.Add(value)
+		return Metric{
+			MetricsKey: key,
+			Set:        s,
+		}, nil
+	}
+
 	return Metric{}, fmt.Errorf("%w: %s", apperrors.ErrUnsupportedMetricType, key.Type)
 }
 
@@ -44,22 +71,28 @@ type MetricsKey struct {
 	Type MetricType
 }
 
-// NewMetricsKey parses a string into a MetricsKey, which includes the metric type and name.
+// NewMetricsKey parses a string formatted as "type_name" into a MetricsKey.
+// Types never contain '_', so the string is split on the first separator
+// and the name is kept as is, whatever characters it contains.
 func NewMetricsKey(value string) (metricsKey MetricsKey, err error) {
-	values := strings.Split(value, "_")
-	if len(values) < 2 {
+	typeStr, name, ok := strings.Cut(value, "_")
+	if !ok {
 		return metricsKey, errors.New("string value should contains separator '_'")
 	}
 
-	mtype, ok := ParseMetricType(values[0])
+	mtype, ok := ParseMetricType(typeStr)
 	if !ok {
-		return metricsKey, fmt.Errorf("uknown metric type: %s", values[0])
+		return metricsKey, fmt.Errorf("uknown metric type: %s", typeStr)
+	}
+	if err = ValidateMetricName(name); err != nil {
+		return metricsKey, err
 	}
 
-	return MetricsKey{Type: mtype, Name: values[1]}, nil
+	return MetricsKey{Type: mtype, Name: name}, nil
 }
 
 // String returns a string representation of the MetricsKey, formatted as "type_name".
+// It's reversible with NewMetricsKey.
 func (m *MetricsKey) String() string {
 	return fmt.Sprintf("%s_%s", m.Type, m.Name)
 }
@@ -71,6 +104,12 @@ func (m *Metric) StringValue() string {
 		return strconv.FormatInt(*m.Delta, 10)
 	case MetricGauge:
 		return strconv.FormatFloat(*m.Value, 'f', -1, 64)
+	case MetricHistogram:
+		return m.Histogram.String()
+	case MetricSummary:
+		return m.Summary.String()
+	case MetricSet:
+		return m.Set.String()
 	default:
 		panic(fmt.Sprintf("unsupported metric type %s", m.Type))
 	}
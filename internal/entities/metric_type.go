@@ -10,13 +10,16 @@ import (
 type MetricType string
 
 const (
-	MetricUnknown MetricType = ""
-	MetricGauge   MetricType = "gauge"
-	MetricCounter MetricType = "counter"
+	MetricUnknown   MetricType = ""
+	MetricGauge     MetricType = "gauge"
+	MetricCounter   MetricType = "counter"
+	MetricHistogram MetricType = "histogram"
+	MetricSummary   MetricType = "summary"
+	MetricSet       MetricType = "set"
 )
 
 func (t MetricType) IsValid() bool {
-	return t == MetricGauge || t == MetricCounter
+	return t == MetricGauge || t == MetricCounter || t == MetricHistogram || t == MetricSummary || t == MetricSet
 }
 
 // MustParseMetricType attempts to parse a string into a MetricType.
@@ -37,6 +40,12 @@ func ParseMetricType(str string) (value MetricType, ok bool) {
 		return MetricGauge, true
 	case string(MetricCounter):
 		return MetricCounter, true
+	case string(MetricHistogram):
+		return MetricHistogram, true
+	case string(MetricSummary):
+		return MetricSummary, true
+	case string(MetricSet):
+		return MetricSet, true
 	default:
 		return "", false
 	}
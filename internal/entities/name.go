@@ -0,0 +1,33 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxMetricNameLength is the maximal length of a metric name in bytes of its UTF-8 encoding.
+const MaxMetricNameLength = 255
+
+var ErrInvalidMetricName = errors.New("invalid metric name")
+
+// ValidateMetricName checks that the name is non-empty valid UTF-8 of at most MaxMetricNameLength bytes
+// consisting of letters, marks, digits, punctuation and symbols of any script.
+// Whitespace and control characters aren't allowed.
+func ValidateMetricName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("%w: name is empty", ErrInvalidMetricName)
+	case len(name) > MaxMetricNameLength:
+		return fmt.Errorf("%w: name is longer than %d bytes", ErrInvalidMetricName, MaxMetricNameLength)
+	case !utf8.ValidString(name):
+		return fmt.Errorf("%w: name is not valid UTF-8", ErrInvalidMetricName)
+	}
+	for _, r := range name {
+		if !unicode.IsGraphic(r) || unicode.IsSpace(r) {
+			return fmt.Errorf("%w: name contains disallowed character %U", ErrInvalidMetricName, r)
+		}
+	}
+	return nil
+}
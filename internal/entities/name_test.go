@@ -0,0 +1,48 @@
+package entities_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dlomanov/mon/internal/entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateMetricName(t *testing.T) {
+	valid := []string{
+		"Alloc",
+		"heap_alloc",
+		"host-1.cpu.user",
+		"disk/sda1/used",
+		"память_занято",
+		"延迟.p99",
+		strings.Repeat("a", entities.MaxMetricNameLength),
+	}
+	for _, name := range valid {
+		assert.NoError(t, entities.ValidateMetricName(name), name)
+	}
+
+	invalid := []string{
+		"",
+		"heap alloc",
+		"heap\talloc",
+		"heap\x00alloc",
+		"\xff",
+		strings.Repeat("a", entities.MaxMetricNameLength+1),
+	}
+	for _, name := range invalid {
+		assert.ErrorIs(t, entities.ValidateMetricName(name), entities.ErrInvalidMetricName, name)
+	}
+}
+
+func TestNewMetricsKey_RoundTrip(t *testing.T) {
+	for _, name := range []string{"heap_alloc", "a__b_", "disk/sda1/used", "host-1.cpu", "память_занято"} {
+		for _, mtype := range []entities.MetricType{entities.MetricGauge, entities.MetricCounter, entities.MetricSet} {
+			key := entities.MetricsKey{Name: name, Type: mtype}
+			parsed, err := entities.NewMetricsKey(key.String())
+			require.NoError(t, err)
+			assert.Equal(t, key, parsed)
+		}
+	}
+}
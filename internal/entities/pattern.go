@@ -0,0 +1,52 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidNamePattern = errors.New("invalid name pattern")
+
+// NamePattern is a glob over metric names:
+// '*' matches any sequence of characters and '?' matches a single character.
+type NamePattern string
+
+// Validate checks that the pattern isn't empty.
+// A pattern consisting of wildcards only is allowed and matches every name.
+func (p NamePattern) Validate() error {
+	if strings.TrimSpace(string(p)) == "" {
+		return fmt.Errorf("%w: pattern is empty", ErrInvalidNamePattern)
+	}
+	return nil
+}
+
+// Match reports whether name matches the pattern.
+func (p NamePattern) Match(name string) bool {
+	pattern := []rune(string(p))
+	runes := []rune(name)
+
+	// greedy matching with backtracking to the last star
+	pi, ni := 0, 0
+	star, mark := -1, 0
+	for ni < len(runes) {
+		switch {
+		case pi < len(pattern) && (pattern[pi] == '?' || pattern[pi] == runes[ni]):
+			pi++
+			ni++
+		case pi < len(pattern) && pattern[pi] == '*':
+			star, mark = pi, ni
+			pi++
+		case star >= 0:
+			pi = star + 1
+			mark++
+			ni = mark
+		default:
+			return false
+		}
+	}
+	for pi < len(pattern) && pattern[pi] == '*' {
+		pi++
+	}
+	return pi == len(pattern)
+}
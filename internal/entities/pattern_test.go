@@ -0,0 +1,38 @@
+package entities_test
+
+import (
+	"testing"
+
+	"github.com/dlomanov/mon/internal/entities"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamePattern_Match(t *testing.T) {
+	tests := []struct {
+		pattern entities.NamePattern
+		name    string
+		want    bool
+	}{
+		{pattern: "Alloc", name: "Alloc", want: true},
+		{pattern: "Alloc", name: "Allocs", want: false},
+		{pattern: "host-1.*", name: "host-1.cpu", want: true},
+		{pattern: "host-1.*", name: "host-2.cpu", want: false},
+		{pattern: "*.cpu", name: "host-1.cpu", want: true},
+		{pattern: "host-?.cpu", name: "host-3.cpu", want: true},
+		{pattern: "host-?.cpu", name: "host-10.cpu", want: false},
+		{pattern: "*a*b*", name: "xaybz", want: true},
+		{pattern: "*a*b", name: "xaybz", want: false},
+		{pattern: "*", name: "", want: true},
+		{pattern: "?", name: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.pattern)+"/"+tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.pattern.Match(tt.name))
+		})
+	}
+}
+
+func TestNamePattern_Validate(t *testing.T) {
+	assert.NoError(t, entities.NamePattern("*").Validate())
+	assert.ErrorIs(t, entities.NamePattern(" ").Validate(), entities.ErrInvalidNamePattern)
+}
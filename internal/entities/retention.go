@@ -0,0 +1,204 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidRetention = errors.New("invalid retention")
+
+// Aggregation selects the value of a rollup.
+type Aggregation string
+
+const (
+	AggregationMin  Aggregation = "min"
+	AggregationMax  Aggregation = "max"
+	AggregationAvg  Aggregation = "avg"
+	AggregationLast Aggregation = "last"
+	AggregationSum  Aggregation = "sum"
+)
+
+// ParseAggregation parses the aggregation name, an empty name is returned as is to be defaulted.
+func ParseAggregation(value string) (Aggregation, bool) {
+	switch a := Aggregation(value); a {
+	case "", AggregationMin, AggregationMax, AggregationAvg, AggregationLast, AggregationSum:
+		return a, true
+	default:
+		return "", false
+	}
+}
+
+// DefaultAggregation returns the aggregation of the metric type: the last value of counters, the average of gauges.
+func DefaultAggregation(t MetricType) Aggregation {
+	if t == MetricCounter {
+		return AggregationLast
+	}
+	return AggregationAvg
+}
+
+type (
+	// Rollup aggregates points of a metric within a bucket starting at Time.
+	Rollup struct {
+		MetricsKey
+		Time  time.Time
+		Min   float64
+		Max   float64
+		Sum   float64
+		Last  float64
+		Count uint64
+	}
+
+	// Tier keeps points of a resolution for the retention period.
+	// Zero Resolution means raw points and zero Retention keeps points forever.
+	Tier struct {
+		Resolution time.Duration
+		Retention  time.Duration
+	}
+
+	// Retention is a list of tiers ordered by resolution, the first tier keeps raw points.
+	Retention []Tier
+)
+
+// NewRollup returns the rollup of a single point.
+func NewRollup(key MetricsKey, p Point) Rollup {
+	return Rollup{MetricsKey: key, Time: p.Time, Min: p.Value, Max: p.Value, Sum: p.Value, Last: p.Value, Count: 1}
+}
+
+// Merge adds the later rollup to the rollup.
+func (r *Rollup) Merge(other Rollup) {
+	if r.Count == 0 {
+		*r = other
+		return
+	}
+	r.Min = math.Min(r.Min, other.Min)
+	r.Max = math.Max(r.Max, other.Max)
+	r.Sum += other.Sum
+	r.Last = other.Last
+	r.Count += other.Count
+}
+
+// Value returns the aggregated value.
+func (r Rollup) Value(agg Aggregation) float64 {
+	switch agg {
+	case AggregationMin:
+		return r.Min
+	case AggregationMax:
+		return r.Max
+	case AggregationLast:
+		return r.Last
+	case AggregationSum:
+		return r.Sum
+	default:
+		if r.Count == 0 {
+			return 0
+		}
+		return r.Sum / float64(r.Count)
+	}
+}
+
+// Bucket returns the start of the resolution bucket containing t, buckets are aligned to the unix epoch.
+func Bucket(t time.Time, resolution time.Duration) time.Time {
+	ns := t.UnixNano()
+	rem := ns % int64(resolution)
+	if rem < 0 {
+		rem += int64(resolution)
+	}
+	return time.Unix(0, ns-rem).UTC()
+}
+
+// ParseRetention parses comma-separated tiers as <resolution or raw>=<retention>, e.g. raw=24h,1m=30d,1h=365d.
+// Durations accept a "d" suffix for days. Raw points are kept forever unless the raw tier is set.
+func ParseRetention(value string) (Retention, error) {
+	r := Retention{{}}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		resStr, retStr, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: tier %q should be <resolution or raw>=<retention>", ErrInvalidRetention, item)
+		}
+		retention, err := parseDays(strings.TrimSpace(retStr))
+		if err != nil || retention < 0 {
+			return nil, fmt.Errorf("%w: tier %q has invalid retention", ErrInvalidRetention, item)
+		}
+		if resStr = strings.TrimSpace(resStr); resStr == "raw" {
+			r[0].Retention = retention
+			continue
+		}
+		resolution, err := parseDays(resStr)
+		if err != nil || resolution <= 0 {
+			return nil, fmt.Errorf("%w: tier %q has invalid resolution", ErrInvalidRetention, item)
+		}
+		r = append(r, Tier{Resolution: resolution, Retention: retention})
+	}
+	sort.SliceStable(r, func(i, j int) bool { return r[i].Resolution < r[j].Resolution })
+	return r, r.Validate()
+}
+
+// Validate checks that resolutions are whole seconds and every resolution is a multiple of the previous one,
+// so rollups are built from the finer tier. A tier should be retained longer than the next resolution,
+// otherwise its points are deleted before they are rolled up.
+func (r Retention) Validate() error {
+	for i, t := range r {
+		switch {
+		case i == 0 && t.Resolution != 0:
+			return fmt.Errorf("%w: the first tier should keep raw points", ErrInvalidRetention)
+		case i == 0:
+			continue
+		case t.Resolution%time.Second != 0:
+			return fmt.Errorf("%w: resolution %s isn't whole seconds", ErrInvalidRetention, t.Resolution)
+		case t.Resolution == r[i-1].Resolution:
+			return fmt.Errorf("%w: duplicate resolution %s", ErrInvalidRetention, t.Resolution)
+		case r[i-1].Resolution != 0 && t.Resolution%r[i-1].Resolution != 0:
+			return fmt.Errorf("%w: resolution %s isn't a multiple of %s", ErrInvalidRetention, t.Resolution, r[i-1].Resolution)
+		case r[i-1].Retention != 0 && r[i-1].Retention <= t.Resolution:
+			return fmt.Errorf("%w: tier %s is retained shorter than resolution %s", ErrInvalidRetention, r[i-1].Resolution, t.Resolution)
+		}
+	}
+	return nil
+}
+
+// Enabled reports whether history is compacted: rollups are built or raw points expire.
+func (r Retention) Enabled() bool {
+	return len(r) > 1 || len(r) == 1 && r[0].Retention != 0
+}
+
+// Rollups returns the tiers of rollups, without the raw tier.
+func (r Retention) Rollups() []Tier {
+	if len(r) < 2 {
+		return nil
+	}
+	return r[1:]
+}
+
+// TierFor returns the finest tier that still retains points since from.
+// The coarsest tier is returned if none does.
+func (r Retention) TierFor(from, now time.Time) Tier {
+	if len(r) == 0 {
+		return Tier{}
+	}
+	for _, t := range r {
+		if t.Retention == 0 || !from.Before(now.Add(-t.Retention)) {
+			return t
+		}
+	}
+	return r[len(r)-1]
+}
+
+func parseDays(value string) (time.Duration, error) {
+	days, ok := strings.CutSuffix(value, "d")
+	if !ok {
+		return time.ParseDuration(value)
+	}
+	n, err := strconv.ParseUint(days, 10, 16)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(n) * 24 * time.Hour, nil
+}
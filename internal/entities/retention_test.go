@@ -0,0 +1,74 @@
+package entities_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dlomanov/mon/internal/entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRetention(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    entities.Retention
+		wantErr bool
+	}{
+		{name: "empty", value: "", want: entities.Retention{{}}},
+		{
+			name:  "tiers",
+			value: "1h=365d, raw=24h, 1m=30d",
+			want: entities.Retention{
+				{Retention: 24 * time.Hour},
+				{Resolution: time.Minute, Retention: 30 * 24 * time.Hour},
+				{Resolution: time.Hour, Retention: 365 * 24 * time.Hour},
+			},
+		},
+		{name: "raw kept forever", value: "1m=30d", want: entities.Retention{{}, {Resolution: time.Minute, Retention: 30 * 24 * time.Hour}}},
+		{name: "invalid tier", value: "raw", wantErr: true},
+		{name: "invalid duration", value: "raw=forever", wantErr: true},
+		{name: "fractional resolution", value: "1500ms=1h", wantErr: true},
+		{name: "not a multiple", value: "1m=1d,90s=1d", wantErr: true},
+		{name: "duplicate", value: "1m=1d,60s=2d", wantErr: true},
+		{name: "retained shorter than next resolution", value: "raw=1m,1h=1d", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := entities.ParseRetention(tt.value)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, entities.ErrInvalidRetention)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRetention_TierFor(t *testing.T) {
+	r, err := entities.ParseRetention("raw=24h,1m=30d,1h=365d")
+	require.NoError(t, err)
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, time.Duration(0), r.TierFor(now.Add(-time.Hour), now).Resolution)
+	assert.Equal(t, time.Minute, r.TierFor(now.Add(-48*time.Hour), now).Resolution)
+	assert.Equal(t, time.Hour, r.TierFor(now.Add(-90*24*time.Hour), now).Resolution)
+	assert.Equal(t, time.Hour, r.TierFor(now.Add(-5*365*24*time.Hour), now).Resolution)
+}
+
+func TestRollup(t *testing.T) {
+	key := entities.MetricsKey{Type: entities.MetricGauge, Name: "key"}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := entities.NewRollup(key, entities.Point{Time: start, Value: 4})
+	r.Merge(entities.NewRollup(key, entities.Point{Time: start.Add(time.Second), Value: 2}))
+
+	assert.Equal(t, 2.0, r.Value(entities.AggregationMin))
+	assert.Equal(t, 4.0, r.Value(entities.AggregationMax))
+	assert.Equal(t, 3.0, r.Value(entities.AggregationAvg))
+	assert.Equal(t, 2.0, r.Value(entities.AggregationLast))
+	assert.Equal(t, 6.0, r.Value(entities.AggregationSum))
+
+	assert.Equal(t, start.Add(time.Minute), entities.Bucket(start.Add(90*time.Second), time.Minute))
+}
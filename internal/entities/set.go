@@ -0,0 +1,166 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"strconv"
+)
+
+// Precision bounds of Set, the sketch has 2^precision registers
+// and a standard error of about 1.04/sqrt(2^precision).
+const (
+	MinSetPrecision     uint8 = 4
+	MaxSetPrecision     uint8 = 16
+	DefaultSetPrecision uint8 = 12
+)
+
+var ErrInvalidSet = errors.New("invalid set")
+
+// Set is a HyperLogLog sketch estimating the number of distinct members added to it.
+// Members themselves aren't stored.
+type Set struct {
+	Precision uint8
+	Registers []uint8
+}
+
+// NewSet creates an empty Set with the given precision.
+func NewSet(precision uint8) (*Set, error) {
+	if precision < MinSetPrecision || precision > MaxSetPrecision {
+		return nil, fmt.Errorf("%w: precision %d is not in [%d, %d]",
+			ErrInvalidSet, precision, MinSetPrecision, MaxSetPrecision)
+	}
+	return &Set{
+		Precision: precision,
+		Registers: make([]uint8, 1<<precision),
+	}, nil
+}
+
+// Validate checks the precision and that registers match it.
+func (s *Set) Validate() error {
+	if s.Precision < MinSetPrecision || s.Precision > MaxSetPrecision {
+		return fmt.Errorf("%w: precision %d is not in [%d, %d]",
+			ErrInvalidSet, s.Precision, MinSetPrecision, MaxSetPrecision)
+	}
+	if len(s.Registers) != 1<<s.Precision {
+		return fmt.Errorf("%w: %d registers for precision %d", ErrInvalidSet, len(s.Registers), s.Precision)
+	}
+	maxRank := 64 - s.Precision + 1
+	for _, r := range s.Registers {
+		if r > maxRank {
+			return fmt.Errorf("%w: register value %d exceeds %d", ErrInvalidSet, r, maxRank)
+		}
+	}
+	return nil
+}
+
+// Add adds a member to the set.
+func (s *Set) Add(member string) {
+	h := hash64(member)
+	i := h >> (64 - s.Precision)
+	rank := uint8(bits.LeadingZeros64(h<<s.Precision|1<<(s.Precision-1))) + 1
+	if rank > s.Registers[i] {
+		s.Registers[i] = rank
+	}
+}
+
+// Merge adds members of other to the set.
+// If the sets have different precision, the result has the lower one.
+func (s *Set) Merge(other *Set) {
+	if s.Precision > other.Precision {
+		s.reduce(other.Precision)
+	}
+	if other.Precision > s.Precision {
+		other = other.Clone()
+		other.reduce(s.Precision)
+	}
+	for i, r := range other.Registers {
+		if r > s.Registers[i] {
+			s.Registers[i] = r
+		}
+	}
+}
+
+// reduce lowers the precision of the set keeping its members.
+// Index bits dropped from a register index become the leading bits of its hash remainder.
+func (s *Set) reduce(precision uint8) {
+	shift := s.Precision - precision
+	registers := make([]uint8, 1<<precision)
+	for i, r := range s.Registers {
+		if r == 0 {
+			continue
+		}
+		dropped := uint64(i) & (1<<shift - 1)
+		rank := r + shift
+		if dropped != 0 {
+			rank = uint8(bits.LeadingZeros64(dropped<<(64-shift))) + 1
+		}
+		if j := i >> shift; rank > registers[j] {
+			registers[j] = rank
+		}
+	}
+	s.Precision = precision
+	s.Registers = registers
+}
+
+// Cardinality returns the estimated number of distinct members.
+func (s *Set) Cardinality() uint64 {
+	m := float64(len(s.Registers))
+	sum := 0.0
+	zeros := 0
+	for _, r := range s.Registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	estimate := alpha(len(s.Registers)) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 { // small range correction
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// Clone returns a deep copy of the set.
+func (s *Set) Clone() *Set {
+	registers := make([]uint8, len(s.Registers))
+	copy(registers, s.Registers)
+	return &Set{
+		Precision: s.Precision,
+		Registers: registers,
+	}
+}
+
+// String returns the estimated cardinality.
+func (s *Set) String() string {
+	return strconv.FormatUint(s.Cardinality(), 10)
+}
+
+func alpha(m int) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	default:
+		return 0.7213 / (1 + 1.079/float64(m))
+	}
+}
+
+// hash64 returns FNV-1a hash of the member with a murmur3 finalizer to spread bits.
+func hash64(member string) uint64 {
+	f := fnv.New64a()
+	_, _ = f.Write([]byte(member))
+	h := f.Sum64()
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
@@ -0,0 +1,51 @@
+package entities_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/dlomanov/mon/internal/entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSet_Cardinality(t *testing.T) {
+	for _, n := range []int{0, 10, 1000, 100000} {
+		t.Run(strconv.Itoa(n), func(t *testing.T) {
+			s, err := entities.NewSet(entities.DefaultSetPrecision)
+			require.NoError(t, err)
+
+			for i := 0; i < n; i++ {
+				s.Add("user-" + strconv.Itoa(i))
+				s.Add("user-" + strconv.Itoa(i)) // duplicates don't count
+			}
+
+			require.NoError(t, s.Validate())
+			assert.InDelta(t, n, s.Cardinality(), 0.05*float64(n)+1)
+		})
+	}
+}
+
+func TestSet_Merge(t *testing.T) {
+	a, err := entities.NewSet(entities.DefaultSetPrecision)
+	require.NoError(t, err)
+	b, err := entities.NewSet(entities.MaxSetPrecision)
+	require.NoError(t, err)
+	for i := 0; i < 10000; i++ {
+		a.Add("ip-" + strconv.Itoa(i))
+		b.Add("ip-" + strconv.Itoa(i+5000))
+	}
+
+	b.Merge(a)
+	require.NoError(t, b.Validate())
+	assert.Equal(t, entities.DefaultSetPrecision, b.Precision, "merged to the lower precision")
+	assert.InDelta(t, 15000, b.Cardinality(), 0.05*15000)
+}
+
+func TestSet_Validate(t *testing.T) {
+	_, err := entities.NewSet(entities.MaxSetPrecision + 1)
+	require.ErrorIs(t, err, entities.ErrInvalidSet)
+
+	s := entities.Set{Precision: 4, Registers: make([]uint8, 8)}
+	require.ErrorIs(t, s.Validate(), entities.ErrInvalidSet)
+}
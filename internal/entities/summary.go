@@ -0,0 +1,210 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultSummaryAccuracy is the default relative accuracy of summary quantiles.
+const DefaultSummaryAccuracy = 0.01
+
+// SummaryQuantiles are quantiles rendered by Summary.String.
+var SummaryQuantiles = []float64{0.5, 0.9, 0.99}
+
+var (
+	ErrInvalidSummary          = errors.New("invalid summary")
+	ErrSummaryAccuracyMismatch = errors.New("summary accuracy mismatch")
+)
+
+// Summary is a mergeable quantile sketch (DDSketch).
+// Observations are counted in logarithmic bins, so any quantile estimate
+// is within Alpha relative error of the exact value.
+// Bins of positive and negative values are keyed by the bin index,
+// values whose magnitude is too small to be indexed are counted in Zero.
+type Summary struct {
+	Alpha    float64
+	Positive map[int32]uint64
+	Negative map[int32]uint64
+	Zero     uint64
+	Count    uint64
+	Sum      float64
+	Min      float64 // valid if Count > 0
+	Max      float64 // valid if Count > 0
+}
+
+// minIndexable is the smallest magnitude counted in a log bin.
+const minIndexable = 1e-9
+
+// NewSummary creates an empty Summary with the given relative accuracy.
+func NewSummary(alpha float64) (*Summary, error) {
+	s := &Summary{
+		Alpha:    alpha,
+		Positive: make(map[int32]uint64),
+		Negative: make(map[int32]uint64),
+	}
+	return s, s.Validate()
+}
+
+// Validate checks that the accuracy is in (0, 1) and counts match the total count.
+func (s *Summary) Validate() error {
+	if !(s.Alpha > 0 && s.Alpha < 1) {
+		return fmt.Errorf("%w: accuracy %v is not in (0, 1)", ErrInvalidSummary, s.Alpha)
+	}
+	total := s.Zero
+	for _, c := range s.Positive {
+		total += c
+	}
+	for _, c := range s.Negative {
+		total += c
+	}
+	if total != s.Count {
+		return fmt.Errorf("%w: count %d doesn't match bin counts %d", ErrInvalidSummary, s.Count, total)
+	}
+	if s.Count > 0 && s.Min > s.Max {
+		return fmt.Errorf("%w: min is greater than max", ErrInvalidSummary)
+	}
+	return nil
+}
+
+// Observe adds a value to the summary. NaN values are ignored.
+func (s *Summary) Observe(value float64) {
+	if math.IsNaN(value) {
+		return
+	}
+	switch {
+	case value > minIndexable:
+		s.Positive[s.index(value)]++
+	case value < -minIndexable:
+		s.Negative[s.index(-value)]++
+	default:
+		s.Zero++
+	}
+	if s.Count == 0 || value < s.Min {
+		s.Min = value
+	}
+	if s.Count == 0 || value > s.Max {
+		s.Max = value
+	}
+	s.Count++
+	s.Sum += value
+}
+
+// Merge adds observations of other to the summary.
+// Returns ErrSummaryAccuracyMismatch if the summaries have different accuracy.
+func (s *Summary) Merge(other *Summary) error {
+	if s.Alpha != other.Alpha {
+		return ErrSummaryAccuracyMismatch
+	}
+	if other.Count == 0 {
+		return nil
+	}
+	if s.Positive == nil {
+		s.Positive = make(map[int32]uint64, len(other.Positive))
+	}
+	if s.Negative == nil {
+		s.Negative = make(map[int32]uint64, len(other.Negative))
+	}
+	for i, c := range other.Positive {
+		s.Positive[i] += c
+	}
+	for i, c := range other.Negative {
+		s.Negative[i] += c
+	}
+	if s.Count == 0 || other.Min < s.Min {
+		s.Min = other.Min
+	}
+	if s.Count == 0 || other.Max > s.Max {
+		s.Max = other.Max
+	}
+	s.Zero += other.Zero
+	s.Count += other.Count
+	s.Sum += other.Sum
+	return nil
+}
+
+// Quantile returns the estimated value at quantile q in [0, 1].
+// Returns NaN if the summary is empty or q is out of range.
+func (s *Summary) Quantile(q float64) float64 {
+	if s.Count == 0 || q < 0 || q > 1 {
+		return math.NaN()
+	}
+	rank := uint64(q * float64(s.Count-1))
+
+	var cumulative uint64
+	// negative values in ascending order are bins of descending index
+	negative := sortedBins(s.Negative)
+	for i := len(negative) - 1; i >= 0; i-- {
+		cumulative += s.Negative[negative[i]]
+		if cumulative > rank {
+			return s.clamp(-s.value(negative[i]))
+		}
+	}
+	cumulative += s.Zero
+	if cumulative > rank {
+		return s.clamp(0)
+	}
+	for _, i := range sortedBins(s.Positive) {
+		cumulative += s.Positive[i]
+		if cumulative > rank {
+			return s.clamp(s.value(i))
+		}
+	}
+	return s.Max
+}
+
+// Clone returns a deep copy of the summary.
+func (s *Summary) Clone() *Summary {
+	c := *s
+	c.Positive = maps.Clone(s.Positive)
+	c.Negative = maps.Clone(s.Negative)
+	return &c
+}
+
+// String returns the summary in the form "count=3 sum=1.5 p50=0.5 p90=0.9 p99=0.99".
+func (s *Summary) String() string {
+	sb := strings.Builder{}
+	sb.WriteString("count=")
+	sb.WriteString(strconv.FormatUint(s.Count, 10))
+	sb.WriteString(" sum=")
+	sb.WriteString(strconv.FormatFloat(s.Sum, 'f', -1, 64))
+	for _, q := range SummaryQuantiles {
+		sb.WriteString(" p")
+		sb.WriteString(strconv.FormatFloat(q*100, 'f', -1, 64))
+		sb.WriteString("=")
+		sb.WriteString(strconv.FormatFloat(s.Quantile(q), 'g', 6, 64))
+	}
+	return sb.String()
+}
+
+func (s *Summary) gamma() float64 {
+	return (1 + s.Alpha) / (1 - s.Alpha)
+}
+
+// index returns the bin of a positive value: gamma^(i-1) < value <= gamma^i.
+func (s *Summary) index(value float64) int32 {
+	return int32(math.Ceil(math.Log(value) / math.Log(s.gamma())))
+}
+
+// value returns the estimate of values in bin i, which is within Alpha of any of them.
+func (s *Summary) value(i int32) float64 {
+	g := s.gamma()
+	return 2 * math.Pow(g, float64(i)) / (g + 1)
+}
+
+func sortedBins(bins map[int32]uint64) []int32 {
+	result := make([]int32, 0, len(bins))
+	for i := range bins {
+		result = append(result, i)
+	}
+	slices.Sort(result)
+	return result
+}
+
+func (s *Summary) clamp(v float64) float64 {
+	return math.Max(s.Min, math.Min(s.Max, v))
+}
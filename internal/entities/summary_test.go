@@ -0,0 +1,81 @@
+package entities_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/dlomanov/mon/internal/entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummary_Quantile(t *testing.T) {
+	const alpha = 0.01
+	s, err := entities.NewSummary(alpha)
+	require.NoError(t, err)
+
+	for i := 1; i <= 1000; i++ {
+		s.Observe(float64(i))
+	}
+	require.NoError(t, s.Validate())
+
+	for _, tt := range []struct {
+		q    float64
+		want float64
+	}{
+		{q: 0, want: 1},
+		{q: 0.5, want: 500},
+		{q: 0.9, want: 900},
+		{q: 0.99, want: 990},
+		{q: 1, want: 1000},
+	} {
+		assert.InEpsilon(t, tt.want, s.Quantile(tt.q), alpha, "q=%v", tt.q)
+	}
+	assert.True(t, math.IsNaN(s.Quantile(1.5)))
+}
+
+func TestSummary_QuantileNegative(t *testing.T) {
+	s, err := entities.NewSummary(0.01)
+	require.NoError(t, err)
+
+	for _, v := range []float64{-10, -1, 0, 1, 10} {
+		s.Observe(v)
+	}
+
+	assert.Equal(t, -10.0, s.Quantile(0))
+	assert.InEpsilon(t, -1, s.Quantile(0.25), 0.01)
+	assert.Equal(t, 0.0, s.Quantile(0.5))
+	assert.InEpsilon(t, 1, s.Quantile(0.75), 0.01)
+	assert.Equal(t, 10.0, s.Quantile(1))
+}
+
+func TestSummary_Merge(t *testing.T) {
+	a, err := entities.NewSummary(0.01)
+	require.NoError(t, err)
+	b, err := entities.NewSummary(0.01)
+	require.NoError(t, err)
+	for i := 1; i <= 500; i++ {
+		a.Observe(float64(i))
+		b.Observe(float64(i + 500))
+	}
+
+	require.NoError(t, a.Merge(b))
+	require.NoError(t, a.Validate())
+	assert.Equal(t, uint64(1000), a.Count)
+	assert.Equal(t, 1.0, a.Min)
+	assert.Equal(t, 1000.0, a.Max)
+	assert.InEpsilon(t, 990, a.Quantile(0.99), 0.01)
+
+	c, err := entities.NewSummary(0.02)
+	require.NoError(t, err)
+	c.Observe(1)
+	require.ErrorIs(t, a.Merge(c), entities.ErrSummaryAccuracyMismatch)
+}
+
+func TestSummary_Validate(t *testing.T) {
+	_, err := entities.NewSummary(0)
+	require.ErrorIs(t, err, entities.ErrInvalidSummary)
+
+	s := entities.Summary{Alpha: 0.01, Positive: map[int32]uint64{1: 2}, Count: 1}
+	require.ErrorIs(t, s.Validate(), entities.ErrInvalidSummary)
+}
@@ -0,0 +1,76 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dlomanov/mon/internal/entities/apperrors"
+)
+
+// ErrMergeConflict is returned when an update can't be merged into the stored metric.
+var ErrMergeConflict = errors.New("metric update conflicts with the stored metric")
+
+// ApplyUpdate returns the metric resulting from the update of the stored one, ok is false if there is no stored metric.
+// Stored values aren't modified.
+//
+// Gauges are replaced unless the update is older than the stored value, counters are incremented
+// according to the overflow policy, and histograms, summaries and sets accumulate the update observations.
+// Returns ErrCounterOverflow or ErrMergeConflict if the update can't be applied.
+func ApplyUpdate(stored Metric, ok bool, update Metric, overflow OverflowPolicy) (Metric, error) {
+	switch update.Type {
+	case MetricGauge:
+		if ok && !update.Timestamp.IsZero() && update.Timestamp.Before(stored.Timestamp) {
+			return stored, nil // stale write, a newer value is already stored
+		}
+		return update, nil
+	case MetricCounter:
+		return overflow.Increment(stored, ok, update)
+	case MetricHistogram, MetricSummary, MetricSet:
+		if !ok {
+			return update, nil
+		}
+		return merge(stored, update)
+	default:
+		return update, fmt.Errorf("%w: %s", apperrors.ErrUnsupportedMetricType, update.Type)
+	}
+}
+
+// ValidateMergeable checks the observations of a histogram, summary or set update.
+func ValidateMergeable(update Metric) error {
+	switch {
+	case update.Type == MetricHistogram && update.Histogram != nil:
+		return update.Histogram.Validate()
+	case update.Type == MetricSummary && update.Summary != nil:
+		return update.Summary.Validate()
+	case update.Type == MetricSet && update.Set != nil:
+		return update.Set.Validate()
+	default:
+		return fmt.Errorf("%s is empty", update.Type)
+	}
+}
+
+// merge returns the update with observations of the stored metric added.
+func merge(stored, update Metric) (Metric, error) {
+	switch update.Type {
+	case MetricHistogram:
+		merged := stored.Histogram.Clone()
+		if err := merged.Merge(update.Histogram); err != nil {
+			return update, fmt.Errorf("%w: %w", ErrMergeConflict, err)
+		}
+		update.Histogram = merged
+	case MetricSummary:
+		merged := stored.Summary.Clone()
+		if err := merged.Merge(update.Summary); err != nil {
+			return update, fmt.Errorf("%w: %w", ErrMergeConflict, err)
+		}
+		update.Summary = merged
+	case MetricSet:
+		merged := stored.Set.Clone()
+		merged.Merge(update.Set)
+		update.Set = merged
+	}
+	if stored.Timestamp.After(update.Timestamp) {
+		update.Timestamp = stored.Timestamp
+	}
+	return update, nil
+}
@@ -0,0 +1,53 @@
+package entities_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dlomanov/mon/internal/entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyUpdate(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	gauge := func(v float64, sec int) entities.Metric {
+		m := entities.Metric{MetricsKey: entities.MetricsKey{Type: entities.MetricGauge, Name: "cpu"}, Value: &v}
+		if sec != 0 {
+			m.Timestamp = start.Add(time.Duration(sec) * time.Second)
+		}
+		return m
+	}
+
+	got, err := entities.ApplyUpdate(gauge(1, 2), true, gauge(2, 0), entities.OverflowClamp)
+	require.NoError(t, err)
+	assert.Equal(t, gauge(2, 0), got, "gauge without timestamp replaces the stored one")
+	got, err = entities.ApplyUpdate(gauge(1, 2), true, gauge(2, 3), entities.OverflowClamp)
+	require.NoError(t, err)
+	assert.Equal(t, gauge(2, 3), got, "newer gauge replaces the stored one")
+	got, err = entities.ApplyUpdate(gauge(1, 2), true, gauge(2, 1), entities.OverflowClamp)
+	require.NoError(t, err)
+	assert.Equal(t, gauge(1, 2), got, "stale gauge is ignored")
+
+	key := entities.MetricsKey{Type: entities.MetricHistogram, Name: "latency"}
+	stored, err := entities.NewHistogram([]float64{1, 10})
+	require.NoError(t, err)
+	stored.Observe(5)
+	update, err := entities.NewHistogram([]float64{1, 10})
+	require.NoError(t, err)
+	update.Observe(20)
+	got, err = entities.ApplyUpdate(
+		entities.Metric{MetricsKey: key, Histogram: stored, Timestamp: start.Add(time.Second)}, true,
+		entities.Metric{MetricsKey: key, Histogram: update}, entities.OverflowClamp)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), got.Histogram.Count)
+	assert.Equal(t, uint64(1), stored.Count, "stored histogram shouldn't be modified")
+	assert.Equal(t, start.Add(time.Second), got.Timestamp)
+
+	other, err := entities.NewHistogram([]float64{2})
+	require.NoError(t, err)
+	_, err = entities.ApplyUpdate(
+		entities.Metric{MetricsKey: key, Histogram: stored}, true,
+		entities.Metric{MetricsKey: key, Histogram: other}, entities.OverflowClamp)
+	assert.ErrorIs(t, err, entities.ErrMergeConflict)
+}
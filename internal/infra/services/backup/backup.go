@@ -0,0 +1,392 @@
+// Package backup provides the portable archive format of metric backups.
+//
+// An archive is a gzip-compressed tar of:
+//
+//	manifest.json  format version, creation time and numbers of metrics and metadata
+//	metrics.jsonl  metrics as JSON lines
+//	metadata.jsonl metadata as JSON lines
+//
+// The format doesn't depend on the storage, so an archive made from one storage is restored into any other.
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dlomanov/mon/internal/entities"
+)
+
+const (
+	manifestName = "manifest.json"
+	metricsName  = "metrics.jsonl"
+	metadataName = "metadata.jsonl"
+	// MaxArchiveEntrySize limits an uncompressed archive entry.
+	MaxArchiveEntrySize = 1 << 30
+	// MaxArchiveSize limits a compressed archive uploaded for restore.
+	MaxArchiveSize = 256 << 20
+)
+
+var ErrInvalidArchive = errors.New("invalid backup archive")
+
+// Write writes the backup as an archive.
+func Write(w io.Writer, b entities.Backup) error {
+	metrics := &bytes.Buffer{}
+	enc := json.NewEncoder(metrics)
+	for _, m := range b.Metrics {
+		if err := enc.Encode(toMetric(m)); err != nil {
+			return err
+		}
+	}
+	metadata := &bytes.Buffer{}
+	enc = json.NewEncoder(metadata)
+	for _, m := range b.Metadata {
+		if err := enc.Encode(toMetadata(m)); err != nil {
+			return err
+		}
+	}
+	manifestJSON, err := json.MarshalIndent(manifest{
+		Version:   b.Version,
+		CreatedAt: b.CreatedAt,
+		Metrics:   len(b.Metrics),
+		Metadata:  len(b.Metadata),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	entries := []struct {
+		name string
+		data []byte
+	}{
+		{name: manifestName, data: manifestJSON},
+		{name: metricsName, data: metrics.Bytes()},
+		{name: metadataName, data: metadata.Bytes()},
+	}
+	for _, e := range entries {
+		header := &tar.Header{
+			Name:    e.name,
+			Mode:    0o644,
+			Size:    int64(len(e.data)),
+			ModTime: b.CreatedAt,
+		}
+		if err = tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err = tw.Write(e.data); err != nil {
+			return err
+		}
+	}
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Read reads the backup from an archive. The backup isn't validated beyond the archive structure.
+func Read(r io.Reader) (entities.Backup, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return entities.Backup{}, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+	}
+	defer func() { _ = gz.Close() }()
+
+	var (
+		b           entities.Backup
+		m           *manifest
+		hasMetrics  bool
+		hasMetadata bool
+	)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return entities.Backup{}, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+		}
+		if header.Size > MaxArchiveEntrySize {
+			return entities.Backup{}, fmt.Errorf("%w: %s is too large", ErrInvalidArchive, header.Name)
+		}
+
+		switch header.Name {
+		case manifestName:
+			m = &manifest{}
+			err = json.NewDecoder(tr).Decode(m)
+		case metricsName:
+			hasMetrics = true
+			err = decodeLines(tr, func(dec *json.Decoder) error {
+				var v metric
+				if err := dec.Decode(&v); err != nil {
+					return err
+				}
+				entity, err := v.toEntity()
+				if err != nil {
+					return err
+				}
+				b.Metrics = append(b.Metrics, entity)
+				return nil
+			})
+		case metadataName:
+			hasMetadata = true
+			err = decodeLines(tr, func(dec *json.Decoder) error {
+				var v metadata
+				if err := dec.Decode(&v); err != nil {
+					return err
+				}
+				b.Metadata = append(b.Metadata, v.toEntity())
+				return nil
+			})
+		}
+		if err != nil {
+			return entities.Backup{}, fmt.Errorf("%w: %s: %w", ErrInvalidArchive, header.Name, err)
+		}
+	}
+
+	switch {
+	case m == nil:
+		return entities.Backup{}, fmt.Errorf("%w: %s is missing", ErrInvalidArchive, manifestName)
+	case !hasMetrics || !hasMetadata:
+		return entities.Backup{}, fmt.Errorf("%w: %s or %s is missing", ErrInvalidArchive, metricsName, metadataName)
+	case m.Metrics != len(b.Metrics) || m.Metadata != len(b.Metadata):
+		return entities.Backup{}, fmt.Errorf("%w: %d metrics and %d metadata are expected, got %d and %d",
+			ErrInvalidArchive, m.Metrics, m.Metadata, len(b.Metrics), len(b.Metadata))
+	}
+	b.Version = m.Version
+	b.CreatedAt = m.CreatedAt
+	return b, nil
+}
+
+func decodeLines(r io.Reader, decode func(dec *json.Decoder) error) error {
+	dec := json.NewDecoder(r)
+	for dec.More() {
+		if err := decode(dec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dir saves backups as archive files in a directory keeping the latest ones.
+type Dir struct {
+	path string
+	keep int
+}
+
+// NewDir creates the directory if it doesn't exist.
+// Up to keep latest archives are kept, zero keeps every archive.
+func NewDir(path string, keep int) (*Dir, error) {
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return nil, err
+	}
+	return &Dir{path: path, keep: keep}, nil
+}
+
+// Save writes the backup to the directory and deletes the archives beyond the kept ones.
+// The archive is named after the backup time and written to a temporary file first,
+// so an interrupted save never leaves a partial archive.
+func (d *Dir) Save(_ context.Context, b entities.Backup) error {
+	name := FileName(b.CreatedAt)
+	tmp, err := os.CreateTemp(d.path, name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if err = Write(tmp, b); err == nil {
+		err = tmp.Sync()
+	}
+	if err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), filepath.Join(d.path, name)); err != nil {
+		return err
+	}
+	return d.prune()
+}
+
+func (d *Dir) prune() error {
+	if d.keep <= 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(d.path)
+	if err != nil {
+		return err
+	}
+	var archives []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), filePrefix) && strings.HasSuffix(e.Name(), fileSuffix) {
+			archives = append(archives, e.Name())
+		}
+	}
+	if len(archives) <= d.keep {
+		return nil
+	}
+	// names start with the sortable backup time
+	sort.Strings(archives)
+	var errs []error
+	for _, name := range archives[:len(archives)-d.keep] {
+		errs = append(errs, os.Remove(filepath.Join(d.path, name)))
+	}
+	return errors.Join(errs...)
+}
+
+const (
+	filePrefix = "mon-backup-"
+	fileSuffix = ".tar.gz"
+)
+
+// FileName returns the archive file name of a backup made at the time.
+func FileName(t time.Time) string {
+	return filePrefix + t.UTC().Format("20060102T150405.000Z") + fileSuffix
+}
+
+type (
+	manifest struct {
+		Version   int       `json:"version"`
+		CreatedAt time.Time `json:"created_at"`
+		Metrics   int       `json:"metrics"`
+		Metadata  int       `json:"metadata"`
+	}
+	metric struct {
+		Name       string     `json:"name"`
+		Type       string     `json:"type"`
+		Delta      *int64     `json:"delta,omitempty"`
+		Value      *float64   `json:"value,omitempty"`
+		Total      *int64     `json:"total,omitempty"`
+		Histogram  *histogram `json:"histogram,omitempty"`
+		Summary    *summary   `json:"summary,omitempty"`
+		Set        *set       `json:"set,omitempty"`
+		Timestamp  *time.Time `json:"timestamp,omitempty"`
+		ReceivedAt *time.Time `json:"received_at,omitempty"`
+	}
+	histogram struct {
+		Bounds []float64 `json:"bounds"`
+		Counts []uint64  `json:"counts"`
+		Sum    float64   `json:"sum"`
+		Count  uint64    `json:"count"`
+	}
+	summary struct {
+		Alpha    float64          `json:"alpha"`
+		Positive map[int32]uint64 `json:"positive,omitempty"`
+		Negative map[int32]uint64 `json:"negative,omitempty"`
+		Zero     uint64           `json:"zero,omitempty"`
+		Count    uint64           `json:"count"`
+		Sum      float64          `json:"sum"`
+		Min      float64          `json:"min"`
+		Max      float64          `json:"max"`
+	}
+	set struct {
+		Precision uint8  `json:"precision"`
+		Registers []byte `json:"registers"`
+	}
+	metadata struct {
+		Name        string `json:"name"`
+		Type        string `json:"type,omitempty"`
+		Unit        string `json:"unit,omitempty"`
+		Description string `json:"description,omitempty"`
+		Owner       string `json:"owner,omitempty"`
+	}
+)
+
+func toMetric(v entities.Metric) metric {
+	m := metric{
+		Name:  v.Name,
+		Type:  string(v.Type),
+		Delta: v.Delta,
+		Value: v.Value,
+		Total: v.Total,
+	}
+	if v.Histogram != nil {
+		h := histogram(*v.Histogram)
+		m.Histogram = &h
+	}
+	if v.Summary != nil {
+		s := summary(*v.Summary)
+		m.Summary = &s
+	}
+	if v.Set != nil {
+		s := set(*v.Set)
+		m.Set = &s
+	}
+	if !v.Timestamp.IsZero() {
+		m.Timestamp = &v.Timestamp
+	}
+	if !v.ReceivedAt.IsZero() {
+		m.ReceivedAt = &v.ReceivedAt
+	}
+	return m
+}
+
+func (m metric) toEntity() (entities.Metric, error) {
+	t, ok := entities.ParseMetricType(m.Type)
+	if !ok {
+		return entities.Metric{}, fmt.Errorf("metric %q has unknown type %q", m.Name, m.Type)
+	}
+	v := entities.Metric{
+		MetricsKey: entities.MetricsKey{Name: m.Name, Type: t},
+		Delta:      m.Delta,
+		Value:      m.Value,
+		Total:      m.Total,
+	}
+	if m.Histogram != nil {
+		h := entities.Histogram(*m.Histogram)
+		v.Histogram = &h
+	}
+	if m.Summary != nil {
+		s := entities.Summary(*m.Summary)
+		v.Summary = &s
+	}
+	if m.Set != nil {
+		s := entities.Set(*m.Set)
+		v.Set = &s
+	}
+	if m.Timestamp != nil {
+		v.Timestamp = *m.Timestamp
+	}
+	if m.ReceivedAt != nil {
+		v.ReceivedAt = *m.ReceivedAt
+	}
+	return v, nil
+}
+
+func toMetadata(v entities.Metadata) metadata {
+	return metadata{
+		Name:        v.Name,
+		Type:        string(v.Type),
+		Unit:        v.Unit,
+		Description: v.Description,
+		Owner:       v.Owner,
+	}
+}
+
+func (m metadata) toEntity() entities.Metadata {
+	t, ok := entities.ParseMetricType(m.Type)
+	if !ok {
+		t = entities.MetricType(m.Type) // rejected by validation unless empty
+	}
+	return entities.Metadata{
+		Name:        m.Name,
+		Type:        t,
+		Unit:        m.Unit,
+		Description: m.Description,
+		Owner:       m.Owner,
+	}
+}
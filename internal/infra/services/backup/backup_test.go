@@ -0,0 +1,169 @@
+package backup_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dlomanov/mon/internal/entities"
+	"github.com/dlomanov/mon/internal/infra/services/backup"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	b := testBackup(t, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+
+	buf := bytes.Buffer{}
+	require.NoError(t, backup.Write(&buf, b))
+	result, err := backup.Read(&buf)
+	require.NoError(t, err)
+	require.NoError(t, result.Validate())
+	assert.Equal(t, b.Version, result.Version)
+	assert.True(t, b.CreatedAt.Equal(result.CreatedAt))
+	assert.Equal(t, b.Metadata, result.Metadata)
+	require.Len(t, result.Metrics, len(b.Metrics))
+	for i, m := range b.Metrics {
+		assert.True(t, m.Timestamp.Equal(result.Metrics[i].Timestamp))
+		assert.True(t, m.ReceivedAt.Equal(result.Metrics[i].ReceivedAt))
+		m.Timestamp, result.Metrics[i].Timestamp = time.Time{}, time.Time{}
+		m.ReceivedAt, result.Metrics[i].ReceivedAt = time.Time{}, time.Time{}
+		assert.Equal(t, m, result.Metrics[i])
+	}
+
+	empty := bytes.Buffer{}
+	require.NoError(t, backup.Write(&empty, entities.Backup{Version: entities.BackupVersion}))
+	result, err = backup.Read(&empty)
+	require.NoError(t, err)
+	assert.Empty(t, result.Metrics)
+	assert.Empty(t, result.Metadata)
+}
+
+func TestRead_Invalid(t *testing.T) {
+	archive := func(entries map[string]string) []byte {
+		buf := bytes.Buffer{}
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		for name, data := range entries {
+			require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(data))}))
+			_, err := tw.Write([]byte(data))
+			require.NoError(t, err)
+		}
+		require.NoError(t, tw.Close())
+		require.NoError(t, gz.Close())
+		return buf.Bytes()
+	}
+	const manifest = `{"version":1,"metrics":1,"metadata":0}`
+
+	valid := bytes.Buffer{}
+	require.NoError(t, backup.Write(&valid, testBackup(t, time.Now())))
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "not gzip", data: []byte("not an archive")},
+		{name: "truncated", data: valid.Bytes()[:valid.Len()/2]},
+		{name: "missing manifest", data: archive(map[string]string{"metrics.jsonl": "", "metadata.jsonl": ""})},
+		{name: "missing metrics", data: archive(map[string]string{"manifest.json": manifest, "metadata.jsonl": ""})},
+		{name: "count mismatch", data: archive(map[string]string{
+			"manifest.json":  manifest,
+			"metrics.jsonl":  "",
+			"metadata.jsonl": "",
+		})},
+		{name: "unknown metric type", data: archive(map[string]string{
+			"manifest.json":  manifest,
+			"metrics.jsonl":  `{"name":"cpu","type":"meter","value":1}`,
+			"metadata.jsonl": "",
+		})},
+		{name: "invalid line", data: archive(map[string]string{
+			"manifest.json":  manifest,
+			"metrics.jsonl":  `{"name":"cpu",`,
+			"metadata.jsonl": "",
+		})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := backup.Read(bytes.NewReader(tt.data))
+			require.ErrorIs(t, err, backup.ErrInvalidArchive)
+		})
+	}
+}
+
+func TestDir_Save(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backups")
+	dir, err := backup.NewDir(path, 2)
+	require.NoError(t, err)
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		require.NoError(t, dir.Save(context.Background(), testBackup(t, start.Add(time.Duration(i)*time.Hour))))
+	}
+
+	entries, err := os.ReadDir(path)
+	require.NoError(t, err)
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.Equal(t, []string{
+		backup.FileName(start.Add(2 * time.Hour)),
+		backup.FileName(start.Add(3 * time.Hour)),
+	}, names)
+
+	f, err := os.Open(filepath.Join(path, names[1]))
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	b, err := backup.Read(f)
+	require.NoError(t, err)
+	assert.True(t, start.Add(3*time.Hour).Equal(b.CreatedAt))
+}
+
+func testBackup(t *testing.T, createdAt time.Time) entities.Backup {
+	t.Helper()
+
+	h, err := entities.NewHistogram([]float64{1, 10})
+	require.NoError(t, err)
+	h.Observe(0.5)
+	h.Observe(5)
+	s, err := entities.NewSummary(0.01)
+	require.NoError(t, err)
+	s.Observe(-2)
+	s.Observe(3)
+	set, err := entities.NewSet(10)
+	require.NoError(t, err)
+	set.Add("user-1")
+
+	value := 1.5
+	delta := int64(7)
+	received := createdAt.Add(-time.Minute)
+	return entities.Backup{
+		Version:   entities.BackupVersion,
+		CreatedAt: createdAt,
+		Metrics: []entities.Metric{
+			{
+				MetricsKey: entities.MetricsKey{Name: "cpu", Type: entities.MetricGauge},
+				Value:      &value,
+				Timestamp:  received.Add(-time.Second),
+				ReceivedAt: received,
+			},
+			{
+				MetricsKey: entities.MetricsKey{Name: "requests", Type: entities.MetricCounter},
+				Delta:      &delta,
+				Total:      &delta,
+			},
+			{MetricsKey: entities.MetricsKey{Name: "latency", Type: entities.MetricHistogram}, Histogram: h},
+			{MetricsKey: entities.MetricsKey{Name: "size", Type: entities.MetricSummary}, Summary: s},
+			{MetricsKey: entities.MetricsKey{Name: "users", Type: entities.MetricSet}, Set: set},
+		},
+		Metadata: []entities.Metadata{
+			{Name: "cpu", Type: entities.MetricGauge, Unit: "percent", Owner: "infra"},
+			{Name: "requests", Description: "served requests"},
+		},
+	}
+}
@@ -0,0 +1,113 @@
+// Package compress provides the HTTP content codings supported by the agent and the server.
+package compress
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Content coding names as used in Content-Encoding and Accept-Encoding headers.
+const (
+	Gzip   = "gzip"
+	Zstd   = "zstd"
+	Snappy = "snappy" // snappy framing format
+)
+
+// DefaultLevel selects the default compression level of a coding.
+const DefaultLevel = 0
+
+// Algorithms lists supported codings in order of preference.
+var Algorithms = []string{Zstd, Snappy, Gzip}
+
+var ErrUnsupported = errors.New("unsupported content coding")
+
+// Supported reports whether the coding is supported.
+func Supported(algo string) bool {
+	for _, v := range Algorithms {
+		if v == algo {
+			return true
+		}
+	}
+	return false
+}
+
+// NewWriter returns a writer compressing to w with the coding algo.
+// Level follows the coding's native scale (1-9 for gzip, 1-22 for zstd)
+// and is ignored by snappy; DefaultLevel selects the coding default.
+func NewWriter(algo string, w io.Writer, level int) (io.WriteCloser, error) {
+	switch algo {
+	case Gzip:
+		if level == DefaultLevel {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(w, level)
+	case Zstd:
+		opts := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+		if level != DefaultLevel {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		return zstd.NewWriter(w, opts...)
+	case Snappy:
+		return snappy.NewBufferedWriter(w), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, algo)
+	}
+}
+
+// NewReader returns a reader decompressing r with the coding algo.
+func NewReader(algo string, r io.Reader) (io.ReadCloser, error) {
+	switch algo {
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zstd:
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	case Snappy:
+		return io.NopCloser(snappy.NewReader(r)), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, algo)
+	}
+}
+
+// Negotiate returns the most preferred supported coding listed in an Accept-Encoding header value.
+// Codings with q=0 are ignored. Returns an empty string if none is acceptable.
+func Negotiate(acceptEncoding string) string {
+	accepted := ParseList(acceptEncoding)
+	for _, algo := range Algorithms {
+		for _, v := range accepted {
+			if v == algo {
+				return algo
+			}
+		}
+	}
+	return ""
+}
+
+// ParseList returns codings listed in an Accept-Encoding header value, skipping those with q=0.
+func ParseList(header string) []string {
+	result := make([]string, 0)
+	for _, item := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(item, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		result = append(result, name)
+	}
+	return result
+}
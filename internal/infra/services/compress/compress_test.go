@@ -0,0 +1,62 @@
+package compress_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/dlomanov/mon/internal/infra/services/compress"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	msg := []byte(strings.Repeat(`{"id":"Alloc","type":"gauge","value":1}`, 100))
+	for _, algo := range compress.Algorithms {
+		for _, level := range []int{compress.DefaultLevel, 1} {
+			t.Run(algo, func(t *testing.T) {
+				buf := bytes.Buffer{}
+				w, err := compress.NewWriter(algo, &buf, level)
+				require.NoError(t, err)
+				_, err = w.Write(msg)
+				require.NoError(t, err)
+				require.NoError(t, w.Close())
+				require.Less(t, buf.Len(), len(msg))
+
+				r, err := compress.NewReader(algo, &buf)
+				require.NoError(t, err)
+				result, err := io.ReadAll(r)
+				require.NoError(t, err)
+				require.NoError(t, r.Close())
+				assert.Equal(t, msg, result)
+			})
+		}
+	}
+
+	_, err := compress.NewWriter("br", io.Discard, compress.DefaultLevel)
+	require.ErrorIs(t, err, compress.ErrUnsupported)
+	_, err = compress.NewReader("br", nil)
+	require.ErrorIs(t, err, compress.ErrUnsupported)
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{header: "", want: ""},
+		{header: "gzip", want: compress.Gzip},
+		{header: "gzip, deflate, br", want: compress.Gzip},
+		{header: "gzip, snappy", want: compress.Snappy},
+		{header: "gzip;q=1.0, zstd", want: compress.Zstd},
+		{header: "ZSTD;q=0, gzip", want: compress.Gzip},
+		{header: "zstd; q=0.0", want: ""},
+		{header: "identity", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			assert.Equal(t, tt.want, compress.Negotiate(tt.header))
+		})
+	}
+}
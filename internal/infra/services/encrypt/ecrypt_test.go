@@ -1,11 +1,13 @@
 package encrypt_test
 
 import (
+	"bytes"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
 	"github.com/dlomanov/mon/internal/infra/services/encrypt"
+	"os"
 	"strings"
 	"testing"
 
@@ -16,16 +18,102 @@ func TestEncrypt(t *testing.T) {
 	publicKey, privateKey := createKeys(t)
 	enc, err := encrypt.NewEncryptor(publicKey)
 	require.NoError(t, err, "failed to create encryptor")
-	dec, err := encrypt.NewDecryptor(privateKey)
+	dec, err := encrypt.NewDecryptor(privateKey, true)
 	require.NoError(t, err, "failed to create decryptor")
 
 	msg := []byte(strings.Repeat("test", 1000))
 	encMsg, err := enc.Encrypt(msg)
 	require.NoError(t, err, "failed to encrypt message")
 	require.NotEqual(t, msg, encMsg)
-	decMsg, err := dec.Decrypt(encMsg)
+	decMsg, legacy, err := dec.Decrypt(encMsg)
 	require.NoError(t, err, "failed to decrypt message")
 	require.Equal(t, msg, decMsg)
+	require.False(t, legacy)
+}
+
+func TestDecrypt_Legacy(t *testing.T) {
+	publicKey, privateKey := createKeys(t)
+	enc, err := encrypt.NewEncryptor(publicKey)
+	require.NoError(t, err, "failed to create encryptor")
+	dec, err := encrypt.NewDecryptor(privateKey, true)
+	require.NoError(t, err, "failed to create decryptor")
+
+	msg := []byte(strings.Repeat("test", 1000))
+	encMsg, err := enc.EncryptLegacy(msg)
+	require.NoError(t, err, "failed to encrypt message")
+	decMsg, legacy, err := dec.Decrypt(encMsg)
+	require.NoError(t, err, "failed to decrypt legacy message")
+	require.Equal(t, msg, decMsg)
+	require.True(t, legacy)
+
+	dec, err = encrypt.NewDecryptor(privateKey, false)
+	require.NoError(t, err, "failed to create decryptor")
+	_, _, err = dec.Decrypt(encMsg)
+	require.ErrorIs(t, err, encrypt.ErrLegacyDisabled)
+}
+
+func TestDecrypt_LegacyWithMagic(t *testing.T) {
+	// the RSA block of a legacy message happens to start with the envelope magic
+	privateKey, err := os.ReadFile("testdata/legacy_magic_key.pem")
+	require.NoError(t, err)
+	encMsg, err := os.ReadFile("testdata/legacy_magic.bin")
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(encMsg, []byte("mon")))
+	dec, err := encrypt.NewDecryptor(privateKey, true)
+	require.NoError(t, err, "failed to create decryptor")
+
+	decMsg, legacy, err := dec.Decrypt(encMsg)
+	require.NoError(t, err, "failed to decrypt legacy message")
+	require.Equal(t, `[{"id":"cpu","type":"gauge","value":1.5}]`, string(decMsg))
+	require.True(t, legacy)
+
+	dec, err = encrypt.NewDecryptor(privateKey, false)
+	require.NoError(t, err, "failed to create decryptor")
+	_, _, err = dec.Decrypt(encMsg)
+	require.Error(t, err)
+}
+
+func TestDecrypt_Invalid(t *testing.T) {
+	publicKey, privateKey := createKeys(t)
+	enc, err := encrypt.NewEncryptor(publicKey)
+	require.NoError(t, err, "failed to create encryptor")
+	dec, err := encrypt.NewDecryptor(privateKey, true)
+	require.NoError(t, err, "failed to create decryptor")
+	encMsg, err := enc.Encrypt([]byte("test"))
+	require.NoError(t, err, "failed to encrypt message")
+
+	tampered := append([]byte(nil), encMsg...)
+	tampered[len(tampered)-1] ^= 0xff
+	unknownVersion := append([]byte(nil), encMsg...)
+	unknownVersion[3] = 3
+
+	tests := []struct {
+		name    string
+		input   []byte
+		wantErr error
+	}{
+		{name: "empty", input: nil, wantErr: encrypt.ErrMalformed},
+		{name: "short legacy", input: []byte("short"), wantErr: encrypt.ErrMalformed},
+		{name: "short header", input: []byte("mon\x02"), wantErr: encrypt.ErrMalformed},
+		{name: "short key", input: encMsg[:100], wantErr: encrypt.ErrMalformed},
+		{name: "short payload", input: encMsg[:len(encMsg)-20], wantErr: encrypt.ErrMalformed},
+		{name: "tampered", input: tampered, wantErr: encrypt.ErrDecrypt},
+		{name: "unknown version", input: unknownVersion, wantErr: encrypt.ErrUnsupportedVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			require.NotPanics(t, func() { _, _, err = dec.Decrypt(tt.input) })
+			require.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestNewEncryptor_Invalid(t *testing.T) {
+	_, err := encrypt.NewEncryptor([]byte("not a key"))
+	require.ErrorIs(t, err, encrypt.ErrInvalidKey)
+	_, err = encrypt.NewDecryptor([]byte("not a key"), true)
+	require.ErrorIs(t, err, encrypt.ErrInvalidKey)
 }
 
 func createKeys(t *testing.T) (public []byte, private []byte) {
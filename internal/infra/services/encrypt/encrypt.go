@@ -1,12 +1,51 @@
+// Package encrypt provides hybrid RSA/AES encryption of request payloads.
+//
+// Encryptor produces the versioned envelope (version 2):
+//
+//	magic   [3]byte "mon"
+//	version byte    2
+//	keyLen  uint16  big-endian length of the wrapped key
+//	key     []byte  AES-256 key wrapped with RSA-OAEP (SHA-256)
+//	nonce   [12]byte
+//	payload []byte  AES-GCM ciphertext with tag, the header above is associated data
+//
+// Decryptor also accepts the legacy unversioned format
+// (RSA PKCS #1 v1.5 wrapped key followed by AES-CTR payload) during migration if allowed,
+// including legacy messages that happen to start with the magic.
+// The legacy format isn't authenticated, so it should be disallowed once all senders are migrated.
 package encrypt
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/binary"
 	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+const (
+	magic           = "mon"
+	versionV2  byte = 2
+	aesKeySize      = 32 // AES 256
+	headerSize      = len(magic) + 1 + 2
+)
+
+var (
+	oaepHash = sha256.New
+	// oaepLabel binds wrapped keys to this envelope format.
+	oaepLabel = []byte("mon/v2")
+
+	ErrInvalidKey         = errors.New("encrypt: invalid key")
+	ErrMalformed          = errors.New("encrypt: malformed message")
+	ErrUnsupportedVersion = errors.New("encrypt: unsupported version")
+	ErrDecrypt            = errors.New("encrypt: decryption failed")
+	ErrLegacyDisabled     = errors.New("encrypt: legacy format is disabled")
 )
 
 type (
@@ -14,66 +53,145 @@ type (
 		publicKey *rsa.PublicKey
 	}
 	Decryptor struct {
-		privateKey *rsa.PrivateKey
+		privateKey  *rsa.PrivateKey
+		allowLegacy bool
 	}
 )
 
 func NewEncryptor(publicKeyPEM []byte) (*Encryptor, error) {
 	publicKeyBlock, _ := pem.Decode(publicKeyPEM)
+	if publicKeyBlock == nil {
+		return nil, fmt.Errorf("%w: PEM block not found", ErrInvalidKey)
+	}
 	publicKey, err := x509.ParsePKIXPublicKey(publicKeyBlock.Bytes)
 	if err != nil {
 		return nil, err
 	}
+	rsaKey, ok := publicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: RSA public key expected, got %T", ErrInvalidKey, publicKey)
+	}
 	return &Encryptor{
-		publicKey: publicKey.(*rsa.PublicKey),
+		publicKey: rsaKey,
 	}, nil
 }
 
+// Encrypt seals input into a version 2 envelope.
 func (enc *Encryptor) Encrypt(input []byte) ([]byte, error) {
-	aesKey := make([]byte, 32) // AES 256
+	aesKey := make([]byte, aesKeySize)
 	if _, err := rand.Read(aesKey); err != nil {
 		return nil, err
 	}
-	encAesKey, err := rsa.EncryptPKCS1v15(rand.Reader, enc.publicKey, aesKey)
+	encAesKey, err := rsa.EncryptOAEP(oaepHash(), rand.Reader, enc.publicKey, aesKey, oaepLabel)
 	if err != nil {
 		return nil, err
 	}
-	output, err := encryptAES(input, aesKey)
+
+	gcm, err := newGCM(aesKey)
 	if err != nil {
 		return nil, err
 	}
-	return append(encAesKey, output...), nil
-}
-
-func encryptAES(input []byte, key []byte) ([]byte, error) {
-	block, err := aes.NewCipher(key)
-	if err != nil {
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
 		return nil, err
 	}
-	output := make([]byte, len(input))
-	stream := cipher.NewCTR(block, key[:block.BlockSize()])
-	stream.XORKeyStream(output, input)
-	return output, nil
+
+	header := make([]byte, 0, headerSize+len(encAesKey))
+	header = append(header, magic...)
+	header = append(header, versionV2)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(encAesKey)))
+	header = append(header, encAesKey...)
+
+	output := make([]byte, 0, len(header)+len(nonce)+len(input)+gcm.Overhead())
+	output = append(output, header...)
+	output = append(output, nonce...)
+	return gcm.Seal(output, nonce, input, header), nil
 }
 
-func NewDecryptor(privateKeyPEM []byte) (*Decryptor, error) {
+// NewDecryptor creates a Decryptor, allowLegacy enables decryption of the legacy format.
+func NewDecryptor(privateKeyPEM []byte, allowLegacy bool) (*Decryptor, error) {
 	privateKeyBlock, _ := pem.Decode(privateKeyPEM)
+	if privateKeyBlock == nil {
+		return nil, fmt.Errorf("%w: PEM block not found", ErrInvalidKey)
+	}
 	privateKey, err := x509.ParsePKCS1PrivateKey(privateKeyBlock.Bytes)
 	if err != nil {
 		return nil, err
 	}
 	return &Decryptor{
-		privateKey: privateKey,
+		privateKey:  privateKey,
+		allowLegacy: allowLegacy,
 	}, nil
 }
 
-func (dec *Decryptor) Decrypt(input []byte) ([]byte, error) {
+// Decrypt opens a version 2 envelope or, if allowed, a legacy message; legacy reports the latter.
+// A legacy message may start with the magic by chance, so input that fails to open as an envelope
+// is decrypted as a legacy message before giving up.
+// Returns ErrMalformed, ErrUnsupportedVersion or ErrDecrypt of the envelope on invalid input,
+// ErrLegacyDisabled if input isn't an envelope and the legacy format is disallowed.
+func (dec *Decryptor) Decrypt(input []byte) (output []byte, legacy bool, err error) {
+	if len(input) <= len(magic) || !bytes.HasPrefix(input, []byte(magic)) {
+		if !dec.allowLegacy {
+			return nil, false, ErrLegacyDisabled
+		}
+		output, err = dec.decryptLegacy(input)
+		return output, err == nil, err
+	}
+	output, err = dec.decryptVersioned(input)
+	if err == nil || !dec.allowLegacy {
+		return output, false, err
+	}
+	if output, legacyErr := dec.decryptLegacy(input); legacyErr == nil {
+		return output, true, nil
+	}
+	return nil, false, err
+}
+
+func (dec *Decryptor) decryptVersioned(input []byte) ([]byte, error) {
+	if version := input[len(magic)]; version != versionV2 {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+	if len(input) < headerSize {
+		return nil, fmt.Errorf("%w: short header", ErrMalformed)
+	}
+	keyEnd := headerSize + int(binary.BigEndian.Uint16(input[len(magic)+1:headerSize]))
+	if len(input) < keyEnd {
+		return nil, fmt.Errorf("%w: short key", ErrMalformed)
+	}
+	aesKey, err := rsa.DecryptOAEP(oaepHash(), nil, dec.privateKey, input[headerSize:keyEnd], oaepLabel)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecrypt, err)
+	}
+
+	gcm, err := newGCM(aesKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecrypt, err)
+	}
+	nonceEnd := keyEnd + gcm.NonceSize()
+	if len(input) < nonceEnd+gcm.Overhead() {
+		return nil, fmt.Errorf("%w: short payload", ErrMalformed)
+	}
+	output, err := gcm.Open(nil, input[keyEnd:nonceEnd], input[nonceEnd:], input[:keyEnd])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecrypt, err)
+	}
+
+	return output, nil
+}
+
+func (dec *Decryptor) decryptLegacy(input []byte) ([]byte, error) {
 	size := dec.privateKey.Size()
+	if len(input) < size {
+		return nil, fmt.Errorf("%w: short key", ErrMalformed)
+	}
 	encAesKey := input[:size]
 	encPayload := input[size:]
-	aesKey, err := rsa.DecryptPKCS1v15(rand.Reader, dec.privateKey, encAesKey)
+	aesKey, err := rsa.DecryptPKCS1v15(nil, dec.privateKey, encAesKey)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", ErrDecrypt, err)
+	}
+	if len(aesKey) != aesKeySize {
+		return nil, fmt.Errorf("%w: invalid key size", ErrDecrypt)
 	}
 
 	return decryptAES(encPayload, aesKey)
@@ -89,3 +207,11 @@ func decryptAES(input []byte, key []byte) ([]byte, error) {
 	stream.XORKeyStream(output, input)
 	return output, nil
 }
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,27 @@
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+)
+
+// EncryptLegacy produces a message in the legacy unversioned format.
+func (enc *Encryptor) EncryptLegacy(input []byte) ([]byte, error) {
+	aesKey := make([]byte, aesKeySize)
+	if _, err := rand.Read(aesKey); err != nil {
+		return nil, err
+	}
+	encAesKey, err := rsa.EncryptPKCS1v15(rand.Reader, enc.publicKey, aesKey)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		return nil, err
+	}
+	output := make([]byte, len(input))
+	cipher.NewCTR(block, aesKey[:block.BlockSize()]).XORKeyStream(output, input)
+	return append(encAesKey, output...), nil
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/dlomanov/mon/internal/apps/server/usecases"
+	"github.com/dlomanov/mon/internal/entities"
+)
+
+var _ usecases.BackupStorage = (*SplitBackup)(nil)
+
+type (
+	// MetricsReplacer is a metric storage reading and replacing all metrics under a single lock.
+	MetricsReplacer interface {
+		All(ctx context.Context) ([]entities.Metric, error)
+		Replace(ctx context.Context, metrics ...entities.Metric) error
+	}
+
+	// SplitBackup backs up metrics and metadata kept by separate storages.
+	// Metrics and metadata are each read and replaced consistently, but not as a whole.
+	SplitBackup struct {
+		metrics MetricsReplacer
+		meta    *MetaStorage
+	}
+)
+
+// NewSplitBackup creates a SplitBackup of the metric and metadata storages.
+func NewSplitBackup(metrics MetricsReplacer, meta *MetaStorage) *SplitBackup {
+	return &SplitBackup{
+		metrics: metrics,
+		meta:    meta,
+	}
+}
+
+// Backup returns all metrics and metadata.
+func (b *SplitBackup) Backup(ctx context.Context) (entities.Backup, error) {
+	metrics, err := b.metrics.All(ctx)
+	if err != nil {
+		return entities.Backup{}, err
+	}
+	metas, err := b.meta.AllMeta(ctx)
+	if err != nil {
+		return entities.Backup{}, err
+	}
+	return entities.Backup{Metrics: metrics, Metadata: metas}, nil
+}
+
+// Restore replaces metrics, then metadata with the backup ones.
+func (b *SplitBackup) Restore(ctx context.Context, backup entities.Backup) error {
+	if err := b.metrics.Replace(ctx, backup.Metrics...); err != nil {
+		return err
+	}
+	return b.meta.ReplaceMeta(ctx, backup.Metadata...)
+}
@@ -0,0 +1,378 @@
+// Package block implements a compressed file format of time series.
+//
+// A block starts with a header of the magic and the format version followed by records of series.
+// A record is a chunk of compressed points and an optional opaque payload.
+// Records are followed by the index of series ordered by key and the footer:
+//
+//	header: magic [4]byte | version byte
+//	record: chunk []byte | payload []byte
+//	index:  entries count uvarint | entry...
+//	entry:  key length uvarint | key | columns uvarint | points uvarint | min time varint | max time varint |
+//	        offset uvarint | chunk length uvarint | payload length uvarint | record crc32 uint32
+//	footer: index offset uint64 | index crc32 uint32 | magic [4]byte
+//
+// Integers are little-endian. The footer allows reading the index without scanning records,
+// so a series is looked up by key with a binary search and a single read.
+package block
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+)
+
+const (
+	// Version is the current format version.
+	Version = 1
+	// HeaderSize is the size of the block header, enough to detect a block with IsBlock.
+	HeaderSize = len(magic) + 1
+	footerSize = 8 + 4 + len(magic)
+)
+
+const magic = "MONB"
+
+type (
+	// Series is a time series of points with a fixed number of columns and an optional payload.
+	Series struct {
+		Key     string
+		Columns int
+		Points  []Point
+		Payload []byte
+	}
+
+	// Entry is an index entry of a series.
+	Entry struct {
+		Key        string
+		Columns    int
+		Points     int
+		MinT       int64
+		MaxT       int64
+		Offset     int64
+		ChunkLen   int64
+		PayloadLen int64
+		CRC        uint32
+	}
+)
+
+// IsBlock reports whether data starts with the block header.
+func IsBlock(data []byte) bool {
+	return len(data) >= HeaderSize && string(data[:len(magic)]) == magic
+}
+
+// Write writes series as a block ordered by key. Keys should be unique.
+func Write(w io.Writer, series []Series) error {
+	ordered := make([]*Series, 0, len(series))
+	for i := range series {
+		ordered = append(ordered, &series[i])
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].Key < ordered[j].Key })
+
+	cw := &countingWriter{w: w}
+	if _, err := cw.Write(append([]byte(magic), Version)); err != nil {
+		return err
+	}
+
+	entries := make([]Entry, 0, len(ordered))
+	for i, s := range ordered {
+		if i > 0 && ordered[i-1].Key == s.Key {
+			return fmt.Errorf("duplicate series key %q", s.Key)
+		}
+		for _, p := range s.Points {
+			if len(p.V) != s.Columns {
+				return fmt.Errorf("series %q: point has %d values, want %d", s.Key, len(p.V), s.Columns)
+			}
+		}
+
+		chunk := encodeChunk(s.Columns, s.Points)
+		e := Entry{
+			Key:        s.Key,
+			Columns:    s.Columns,
+			Points:     len(s.Points),
+			Offset:     cw.n,
+			ChunkLen:   int64(len(chunk)),
+			PayloadLen: int64(len(s.Payload)),
+			CRC:        crc32.Update(crc32.ChecksumIEEE(chunk), crc32.IEEETable, s.Payload),
+		}
+		if len(s.Points) > 0 {
+			e.MinT, e.MaxT = s.Points[0].T, s.Points[0].T
+			for _, p := range s.Points[1:] {
+				e.MinT, e.MaxT = min(e.MinT, p.T), max(e.MaxT, p.T)
+			}
+		}
+		if _, err := cw.Write(chunk); err != nil {
+			return err
+		}
+		if _, err := cw.Write(s.Payload); err != nil {
+			return err
+		}
+		entries = append(entries, e)
+	}
+
+	index := encodeIndex(entries)
+	footer := make([]byte, 0, footerSize)
+	footer = binary.LittleEndian.AppendUint64(footer, uint64(cw.n))
+	footer = binary.LittleEndian.AppendUint32(footer, crc32.ChecksumIEEE(index))
+	footer = append(footer, magic...)
+	if _, err := cw.Write(index); err != nil {
+		return err
+	}
+	_, err := cw.Write(footer)
+	return err
+}
+
+// Reader reads series of a block.
+type Reader struct {
+	r       io.ReaderAt
+	closer  io.Closer
+	size    int64
+	version byte
+	index   []Entry
+}
+
+// Open opens the block file and reads its index.
+func Open(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	r, err := NewReader(file, info.Size())
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	r.closer = file
+	return r, nil
+}
+
+// NewReader reads the index of the block of the size.
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	if size < int64(HeaderSize+footerSize) {
+		return nil, fmt.Errorf("%w: block is too short", ErrCorrupted)
+	}
+	header := make([]byte, HeaderSize)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, err
+	}
+	if !IsBlock(header) {
+		return nil, fmt.Errorf("%w: invalid magic", ErrCorrupted)
+	}
+	if header[len(magic)] != Version {
+		return nil, fmt.Errorf("unsupported block version %d", header[len(magic)])
+	}
+
+	footer := make([]byte, footerSize)
+	if _, err := r.ReadAt(footer, size-int64(footerSize)); err != nil {
+		return nil, err
+	}
+	if string(footer[12:]) != magic {
+		return nil, fmt.Errorf("%w: invalid footer magic", ErrCorrupted)
+	}
+	indexOffset := int64(binary.LittleEndian.Uint64(footer))
+	if indexOffset < int64(HeaderSize) || indexOffset > size-int64(footerSize) {
+		return nil, fmt.Errorf("%w: invalid index offset %d", ErrCorrupted, indexOffset)
+	}
+	index := make([]byte, size-int64(footerSize)-indexOffset)
+	if _, err := r.ReadAt(index, indexOffset); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(index) != binary.LittleEndian.Uint32(footer[8:]) {
+		return nil, fmt.Errorf("%w: index checksum mismatch", ErrCorrupted)
+	}
+	entries, err := decodeIndex(index, indexOffset)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{r: r, size: size, version: header[len(magic)], index: entries}, nil
+}
+
+// Version returns the format version of the block.
+func (r *Reader) Version() int {
+	return int(r.version)
+}
+
+// Size returns the size of the block in bytes.
+func (r *Reader) Size() int64 {
+	return r.size
+}
+
+// Index returns index entries ordered by key.
+func (r *Reader) Index() []Entry {
+	return r.index
+}
+
+// Lookup returns the index entry of the key.
+func (r *Reader) Lookup(key string) (Entry, bool) {
+	i := sort.Search(len(r.index), func(i int) bool { return r.index[i].Key >= key })
+	if i == len(r.index) || r.index[i].Key != key {
+		return Entry{}, false
+	}
+	return r.index[i], true
+}
+
+// Series reads the series of the index entry and verifies its checksum.
+func (r *Reader) Series(e Entry) (Series, error) {
+	record := make([]byte, e.ChunkLen+e.PayloadLen)
+	if _, err := r.r.ReadAt(record, e.Offset); err != nil {
+		return Series{}, err
+	}
+	if crc32.ChecksumIEEE(record) != e.CRC {
+		return Series{}, fmt.Errorf("%w: series %q checksum mismatch", ErrCorrupted, e.Key)
+	}
+	points, err := decodeChunk(record[:e.ChunkLen], e.Columns, e.Points)
+	if err != nil {
+		return Series{}, fmt.Errorf("series %q: %w", e.Key, err)
+	}
+	s := Series{Key: e.Key, Columns: e.Columns, Points: points}
+	if e.PayloadLen > 0 {
+		s.Payload = record[e.ChunkLen:]
+	}
+	return s, nil
+}
+
+// All reads every series of the block ordered by key.
+func (r *Reader) All() ([]Series, error) {
+	series := make([]Series, 0, len(r.index))
+	for _, e := range r.index {
+		s, err := r.Series(e)
+		if err != nil {
+			return nil, err
+		}
+		series = append(series, s)
+	}
+	return series, nil
+}
+
+// Close closes the underlying file if the reader was opened by Open.
+func (r *Reader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+func encodeIndex(entries []Entry) []byte {
+	buf := binary.AppendUvarint(nil, uint64(len(entries)))
+	for _, e := range entries {
+		buf = binary.AppendUvarint(buf, uint64(len(e.Key)))
+		buf = append(buf, e.Key...)
+		buf = binary.AppendUvarint(buf, uint64(e.Columns))
+		buf = binary.AppendUvarint(buf, uint64(e.Points))
+		buf = binary.AppendVarint(buf, e.MinT)
+		buf = binary.AppendVarint(buf, e.MaxT)
+		buf = binary.AppendUvarint(buf, uint64(e.Offset))
+		buf = binary.AppendUvarint(buf, uint64(e.ChunkLen))
+		buf = binary.AppendUvarint(buf, uint64(e.PayloadLen))
+		buf = binary.LittleEndian.AppendUint32(buf, e.CRC)
+	}
+	return buf
+}
+
+func decodeIndex(data []byte, indexOffset int64) ([]Entry, error) {
+	d := &decoder{buf: data}
+	count := d.uvarint()
+	if d.err == nil && count > uint64(len(data)) {
+		d.err = errors.New("invalid entries count")
+	}
+	entries := make([]Entry, 0, count)
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		e := Entry{Key: string(d.bytes(d.uvarint()))}
+		e.Columns = int(d.uvarint())
+		e.Points = int(d.uvarint())
+		e.MinT = d.varint()
+		e.MaxT = d.varint()
+		e.Offset = int64(d.uvarint())
+		e.ChunkLen = int64(d.uvarint())
+		e.PayloadLen = int64(d.uvarint())
+		e.CRC = d.uint32()
+		if d.err != nil {
+			break
+		}
+		if e.Offset < int64(HeaderSize) || e.ChunkLen < 0 || e.PayloadLen < 0 ||
+			e.Offset+e.ChunkLen+e.PayloadLen > indexOffset || e.Columns > 64 {
+			d.err = fmt.Errorf("series %q has invalid bounds", e.Key)
+			break
+		}
+		if len(entries) > 0 && entries[len(entries)-1].Key >= e.Key {
+			d.err = fmt.Errorf("series %q is out of order", e.Key)
+			break
+		}
+		entries = append(entries, e)
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("%w: invalid index: %w", ErrCorrupted, d.err)
+	}
+	return entries, nil
+}
+
+// decoder reads index fields keeping the first error.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) uint32() uint32 {
+	b := d.bytes(4)
+	if d.err != nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (d *decoder) bytes(n uint64) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > uint64(len(d.buf)) {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
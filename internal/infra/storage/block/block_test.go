@@ -0,0 +1,175 @@
+package block
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunk(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns int
+		points  []Point
+	}{
+		{name: "empty", columns: 1},
+		{name: "single point", columns: 2, points: []Point{{T: 42, V: []uint64{1, 2}}}},
+		{
+			name:    "regular interval",
+			columns: 1,
+			points:  series(100, func(i int) (int64, float64) { return int64(i) * 1e9, float64(i % 7) }),
+		},
+		{
+			name:    "delta-of-delta buckets",
+			columns: 1,
+			points: points(
+				0, 1, 2, 3+1<<12, 3+1<<13, 5+1<<22, 7+1<<30, 11+1<<38, 1<<40, 1<<62, -1<<62, math.MinInt64, math.MaxInt64,
+			),
+		},
+		{
+			name:    "special floats",
+			columns: 1,
+			points: floats(0, math.Copysign(0, -1), math.NaN(), math.Inf(1), math.Inf(-1),
+				math.MaxFloat64, math.SmallestNonzeroFloat64, -1.5, 1e-300, 1),
+		},
+		{
+			name:    "random",
+			columns: 3,
+			points: func() []Point {
+				rnd := rand.New(rand.NewSource(1))
+				ps := make([]Point, 1000)
+				var ts int64
+				for i := range ps {
+					ts += rnd.Int63n(1e10)
+					ps[i] = Point{T: ts, V: []uint64{rnd.Uint64(), uint64(rnd.Intn(10)), math.Float64bits(rnd.NormFloat64())}}
+				}
+				return ps
+			}(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := encodeChunk(tt.columns, tt.points)
+			got, err := decodeChunk(data, tt.columns, len(tt.points))
+			require.NoError(t, err)
+			require.Equal(t, len(tt.points), len(got))
+			for i := range tt.points {
+				require.Equal(t, tt.points[i], got[i], "point %d", i)
+			}
+		})
+	}
+}
+
+func TestChunk_Compression(t *testing.T) {
+	ps := series(1000, func(i int) (int64, float64) { return 1_700_000_000e9 + int64(i)*10e9, 42 })
+	data := encodeChunk(1, ps)
+	// a regular series of a constant is stored in about two bits per point after the first delta
+	require.LessOrEqual(t, len(data), 16+8+1000/4)
+}
+
+func TestBlock(t *testing.T) {
+	input := []Series{
+		{Key: "gauge_b", Columns: 1, Points: floats(1, 2, 3)},
+		{Key: "counter_a", Columns: 2, Points: []Point{{T: 5, V: []uint64{1, 2}}, {T: 9, V: []uint64{3, 4}}}},
+		{Key: "set_c", Columns: 0, Points: []Point{{T: 1, V: []uint64{}}}, Payload: []byte(`{"set":1}`)},
+		{Key: "empty", Columns: 1},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, input))
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Equal(t, Version, r.Version())
+	require.Len(t, r.Index(), len(input))
+	require.Equal(t, "counter_a", r.Index()[0].Key)
+
+	for _, want := range input {
+		e, ok := r.Lookup(want.Key)
+		require.True(t, ok, want.Key)
+		got, err := r.Series(e)
+		require.NoError(t, err)
+		require.Equal(t, want.Key, got.Key)
+		require.Equal(t, want.Payload, got.Payload)
+		require.Equal(t, len(want.Points), len(got.Points))
+		for i := range want.Points {
+			require.Equal(t, want.Points[i], got.Points[i])
+		}
+	}
+	e, _ := r.Lookup("counter_a")
+	require.Equal(t, int64(5), e.MinT)
+	require.Equal(t, int64(9), e.MaxT)
+
+	_, ok := r.Lookup("missing")
+	require.False(t, ok)
+
+	require.Error(t, Write(&bytes.Buffer{}, []Series{{Key: "a"}, {Key: "a"}}))
+	require.Error(t, Write(&bytes.Buffer{}, []Series{{Key: "a", Columns: 2, Points: floats(1)}}))
+}
+
+func TestBlock_Corruption(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, []Series{
+		{Key: "a", Columns: 1, Points: floats(1, 2, 3)},
+		{Key: "b", Columns: 1, Points: floats(4, 5, 6)},
+	}))
+	valid := buf.Bytes()
+	corrupt := func(offset int) []byte {
+		data := append([]byte{}, valid...)
+		data[offset] ^= 0xff
+		return data
+	}
+
+	t.Run("record", func(t *testing.T) {
+		data := corrupt(HeaderSize + 1)
+		r, err := NewReader(bytes.NewReader(data), int64(len(data)))
+		require.NoError(t, err)
+		_, err = r.Series(r.Index()[0])
+		require.ErrorIs(t, err, ErrCorrupted)
+		_, err = r.Series(r.Index()[1])
+		require.NoError(t, err)
+	})
+	t.Run("index", func(t *testing.T) {
+		data := corrupt(len(valid) - footerSize - 1)
+		_, err := NewReader(bytes.NewReader(data), int64(len(data)))
+		require.ErrorIs(t, err, ErrCorrupted)
+	})
+	t.Run("magic", func(t *testing.T) {
+		data := corrupt(0)
+		require.False(t, IsBlock(data))
+		_, err := NewReader(bytes.NewReader(data), int64(len(data)))
+		require.ErrorIs(t, err, ErrCorrupted)
+	})
+	t.Run("truncated", func(t *testing.T) {
+		data := valid[:len(valid)-3]
+		_, err := NewReader(bytes.NewReader(data), int64(len(data)))
+		require.ErrorIs(t, err, ErrCorrupted)
+	})
+}
+
+func points(ts ...int64) []Point {
+	ps := make([]Point, 0, len(ts))
+	for i, t := range ts {
+		ps = append(ps, Point{T: t, V: []uint64{uint64(i)}})
+	}
+	return ps
+}
+
+func floats(vs ...float64) []Point {
+	ps := make([]Point, 0, len(vs))
+	for i, v := range vs {
+		ps = append(ps, Point{T: int64(i) * 1e9, V: []uint64{math.Float64bits(v)}})
+	}
+	return ps
+}
+
+func series(n int, f func(i int) (int64, float64)) []Point {
+	ps := make([]Point, 0, n)
+	for i := 0; i < n; i++ {
+		t, v := f(i)
+		ps = append(ps, Point{T: t, V: []uint64{math.Float64bits(v)}})
+	}
+	return ps
+}
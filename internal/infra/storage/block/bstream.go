@@ -0,0 +1,77 @@
+package block
+
+import "io"
+
+// bitWriter appends bits to a byte slice, most significant bit first.
+type bitWriter struct {
+	buf  []byte
+	free uint8 // free bits in the last byte
+}
+
+func (w *bitWriter) writeBit(bit bool) {
+	if w.free == 0 {
+		w.buf = append(w.buf, 0)
+		w.free = 8
+	}
+	w.free--
+	if bit {
+		w.buf[len(w.buf)-1] |= 1 << w.free
+	}
+}
+
+// writeBits writes the n least significant bits of u.
+func (w *bitWriter) writeBits(u uint64, n int) {
+	for n > 0 {
+		if w.free == 0 {
+			w.buf = append(w.buf, 0)
+			w.free = 8
+		}
+		take := n
+		if take > int(w.free) {
+			take = int(w.free)
+		}
+		n -= take
+		chunk := byte((u >> uint(n)) & (1<<uint(take) - 1))
+		w.free -= uint8(take)
+		w.buf[len(w.buf)-1] |= chunk << w.free
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	return w.buf
+}
+
+// bitReader reads bits written by bitWriter.
+type bitReader struct {
+	buf []byte
+	pos int // position in bits
+}
+
+func (r *bitReader) readBit() (bool, error) {
+	if r.pos >= len(r.buf)*8 {
+		return false, io.ErrUnexpectedEOF
+	}
+	bit := r.buf[r.pos/8]&(1<<(7-uint(r.pos%8))) != 0
+	r.pos++
+	return bit, nil
+}
+
+// readBits reads n bits into the least significant bits of the result.
+func (r *bitReader) readBits(n int) (uint64, error) {
+	if r.pos+n > len(r.buf)*8 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	var u uint64
+	for n > 0 {
+		offset := r.pos % 8
+		take := 8 - offset
+		if take > n {
+			take = n
+		}
+		b := r.buf[r.pos/8] >> uint(8-offset-take) & (1<<uint(take) - 1)
+		u = u<<uint(take) | uint64(b)
+		r.pos += take
+		n -= take
+	}
+	return u, nil
+}
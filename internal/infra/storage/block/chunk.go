@@ -0,0 +1,214 @@
+package block
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// ErrCorrupted is returned if a block doesn't match its checksums or can't be decoded.
+var ErrCorrupted = errors.New("corrupted block")
+
+// Point is a timestamp in unix nanoseconds with values of every series column.
+// Values are raw 64-bit patterns, e.g. math.Float64bits of a float or an int64 conversion.
+type Point struct {
+	T int64
+	V []uint64
+}
+
+// dodBuckets are bit widths of delta-of-delta timestamps, selected by a prefix of ones ended by zero.
+// Timestamps are in nanoseconds, so the buckets are wider than in the Gorilla paper.
+// The last bucket has no trailing zero.
+var dodBuckets = []int{14, 24, 40, 64}
+
+// encodeChunk compresses points with columns values each.
+// The first point is stored as is, then timestamps are stored as delta-of-delta
+// and values as XOR with the previous value of the column, like in Gorilla.
+func encodeChunk(columns int, points []Point) []byte {
+	w := &bitWriter{}
+	if len(points) == 0 {
+		return w.bytes()
+	}
+
+	xors := make([]xorState, columns)
+	first := points[0]
+	w.writeBits(uint64(first.T), 64)
+	for c := 0; c < columns; c++ {
+		w.writeBits(first.V[c], 64)
+		xors[c].prev = first.V[c]
+	}
+
+	prevT, prevDelta := first.T, int64(0)
+	for _, p := range points[1:] {
+		delta := p.T - prevT
+		writeDoD(w, delta-prevDelta)
+		prevT, prevDelta = p.T, delta
+		for c := 0; c < columns; c++ {
+			xors[c].write(w, p.V[c])
+		}
+	}
+	return w.bytes()
+}
+
+// decodeChunk decompresses count points with columns values each.
+func decodeChunk(data []byte, columns, count int) ([]Point, error) {
+	// every point after the first one takes at least a bit per timestamp and column
+	if count < 0 || count > 1 && count-1 > len(data)*8/(columns+1) {
+		return nil, fmt.Errorf("%w: %d points don't fit %d bytes", ErrCorrupted, count, len(data))
+	}
+	points := make([]Point, 0, count)
+	if count == 0 {
+		return points, nil
+	}
+
+	r := &bitReader{buf: data}
+	xors := make([]xorState, columns)
+	t, err := r.readBits(64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorrupted, err)
+	}
+	first := Point{T: int64(t), V: make([]uint64, columns)}
+	for c := 0; c < columns; c++ {
+		if first.V[c], err = r.readBits(64); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrCorrupted, err)
+		}
+		xors[c].prev = first.V[c]
+	}
+	points = append(points, first)
+
+	prevT, prevDelta := first.T, int64(0)
+	for i := 1; i < count; i++ {
+		dod, err := readDoD(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrCorrupted, err)
+		}
+		delta := prevDelta + dod
+		p := Point{T: prevT + delta, V: make([]uint64, columns)}
+		prevT, prevDelta = p.T, delta
+		for c := 0; c < columns; c++ {
+			if p.V[c], err = xors[c].read(r); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrCorrupted, err)
+			}
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+func writeDoD(w *bitWriter, dod int64) {
+	if dod == 0 {
+		w.writeBit(false)
+		return
+	}
+	for i, n := range dodBuckets {
+		last := i == len(dodBuckets)-1
+		if !last && (dod < -(1<<(n-1)) || dod >= 1<<(n-1)) {
+			w.writeBit(true)
+			continue
+		}
+		w.writeBit(true)
+		if !last {
+			w.writeBit(false)
+		}
+		w.writeBits(uint64(dod), n)
+		return
+	}
+}
+
+func readDoD(r *bitReader) (int64, error) {
+	bit, err := r.readBit()
+	if err != nil || !bit {
+		return 0, err
+	}
+	for i, n := range dodBuckets {
+		if i < len(dodBuckets)-1 {
+			if bit, err = r.readBit(); err != nil {
+				return 0, err
+			}
+			if bit {
+				continue
+			}
+		}
+		u, err := r.readBits(n)
+		if err != nil {
+			return 0, err
+		}
+		// sign extension of the n-bit value
+		return int64(u<<(64-uint(n))) >> (64 - uint(n)), nil
+	}
+	return 0, nil
+}
+
+// xorState holds the previous value and the meaningful bits window of a column.
+type xorState struct {
+	prev     uint64
+	leading  int
+	trailing int
+	window   bool
+}
+
+// write stores the XOR with the previous value:
+// '0' if it's the same value, '10' and the meaningful bits if they fit the previous window,
+// otherwise '11', 5 bits of leading zeros, 6 bits of the meaningful bits length and the meaningful bits.
+func (s *xorState) write(w *bitWriter, v uint64) {
+	xor := v ^ s.prev
+	s.prev = v
+	if xor == 0 {
+		w.writeBit(false)
+		return
+	}
+	w.writeBit(true)
+
+	leading, trailing := bits.LeadingZeros64(xor), bits.TrailingZeros64(xor)
+	if leading > 31 {
+		leading = 31
+	}
+	if s.window && leading >= s.leading && trailing >= s.trailing {
+		w.writeBit(false)
+		w.writeBits(xor>>uint(s.trailing), 64-s.leading-s.trailing)
+		return
+	}
+
+	s.leading, s.trailing, s.window = leading, trailing, true
+	sig := 64 - leading - trailing
+	w.writeBit(true)
+	w.writeBits(uint64(leading), 5)
+	w.writeBits(uint64(sig), 6) // 64 meaningful bits are stored as 0
+	w.writeBits(xor>>uint(trailing), sig)
+}
+
+func (s *xorState) read(r *bitReader) (uint64, error) {
+	bit, err := r.readBit()
+	if err != nil || !bit {
+		return s.prev, err
+	}
+	if bit, err = r.readBit(); err != nil {
+		return 0, err
+	}
+	if bit {
+		leading, err := r.readBits(5)
+		if err != nil {
+			return 0, err
+		}
+		sig, err := r.readBits(6)
+		if err != nil {
+			return 0, err
+		}
+		if sig == 0 {
+			sig = 64
+		}
+		if leading+sig > 64 {
+			return 0, errors.New("invalid xor window")
+		}
+		s.leading, s.trailing, s.window = int(leading), 64-int(leading)-int(sig), true
+	} else if !s.window {
+		return 0, errors.New("xor window is not set")
+	}
+
+	xor, err := r.readBits(64 - s.leading - s.trailing)
+	if err != nil {
+		return 0, err
+	}
+	s.prev ^= xor << uint(s.trailing)
+	return s.prev, nil
+}
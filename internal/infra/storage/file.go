@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"github.com/dlomanov/mon/internal/apps/server/usecases"
 	"github.com/dlomanov/mon/internal/infra/storage/internal/dumper"
 	"github.com/dlomanov/mon/internal/infra/storage/internal/mem"
@@ -32,29 +33,45 @@ type (
 		mu       sync.RWMutex
 		internal *mem.Storage
 		logger   *zap.Logger
-		dumper   *dumper.FileDumper
+		dumper   metricsDumper
 		config   FileStorageConfig
 		syncDump bool
 		closed   bool
 	}
+
+	// metricsDumper persists the in-memory storage, see dumper.FileDumper.
+	metricsDumper interface {
+		Load(dest *mem.Storage) error
+		Dump(source mem.Storage) error
+		Close() error
+		LogSet(metrics ...entities.Metric) error
+		LogDelete(keys ...entities.MetricsKey) error
+		LogDeleteByPattern(pattern entities.NamePattern) error
+		LogEvict(metrics ...entities.Metric) error
+	}
 )
 
 // NewFileStorage creates a new FileStorage instance with the given configuration.
 // It initializes the storage with data from the file if Restore is true.
 // Returns an error if the storage cannot be initialized.
 func NewFileStorage(logger *zap.Logger, config FileStorageConfig) (*FileStorage, error) {
+	syncDump := config.StoreInterval == 0
+	d, err := dumper.NewFileDumper(logger, config.FileStoragePath, !syncDump)
+	if err != nil {
+		return nil, err
+	}
 	fs := &FileStorage{
 		mu:       sync.RWMutex{},
 		internal: mem.NewStorage(),
 		logger:   logger,
 		config:   config,
-		syncDump: config.StoreInterval == 0,
-		dumper:   dumper.NewFileDumper(logger, config.FileStoragePath),
+		syncDump: syncDump,
+		dumper:   d,
 		closed:   false,
 	}
 
-	err := fs.load()
-	if err != nil {
+	if err = fs.load(); err != nil {
+		_ = d.Close()
 		return nil, err
 	}
 
@@ -65,9 +82,13 @@ func NewFileStorage(logger *zap.Logger, config FileStorageConfig) (*FileStorage,
 // It attempts to dump the current state of the in-memory storage to the file system.
 // Returns an error if the dump operation fails.
 func (fs *FileStorage) Close() error {
-	fs.mu.RLock()
-	defer fs.mu.RUnlock()
-	return fs.dumper.Dump(*fs.internal)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.closed {
+		return nil
+	}
+	fs.closed = true
+	return errors.Join(fs.dumper.Dump(*fs.internal), fs.dumper.Close())
 }
 
 // Get retrieves a metric by its key from the FileStorage.
@@ -97,8 +118,14 @@ func (fs *FileStorage) All(_ context.Context) ([]entities.Metric, error) {
 // Returns an error if the operation fails.
 func (fs *FileStorage) Set(_ context.Context, metrics ...entities.Metric) error {
 	fs.mu.Lock()
-	fs.internal.Set(metrics...)
+	err := fs.dumper.LogSet(metrics...)
+	if err == nil {
+		fs.internal.Set(metrics...)
+	}
 	fs.mu.Unlock()
+	if err != nil {
+		return err
+	}
 
 	if fs.syncDump {
 		_ = fs.dump()
@@ -107,6 +134,144 @@ func (fs *FileStorage) Set(_ context.Context, metrics ...entities.Metric) error
 	return nil
 }
 
+// Update applies the updates under the lock and returns the resulting metrics.
+// The resulting metrics are logged as a single record, so nothing is stored if any update fails.
+func (fs *FileStorage) Update(
+	_ context.Context,
+	overflow entities.OverflowPolicy,
+	updates ...entities.Metric,
+) ([]entities.Metric, error) {
+	fs.mu.Lock()
+	result, err := fs.internal.Updated(overflow, updates...)
+	if err == nil {
+		err = fs.dumper.LogSet(result...)
+	}
+	if err == nil {
+		fs.internal.Set(result...)
+	}
+	fs.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if fs.syncDump {
+		_ = fs.dump()
+	}
+
+	return result, nil
+}
+
+// Delete removes metrics by keys from the FileStorage.
+// Returns the number of removed metrics.
+func (fs *FileStorage) Delete(_ context.Context, keys ...entities.MetricsKey) (int, error) {
+	fs.mu.Lock()
+	err := fs.dumper.LogDelete(fs.existing(keys)...)
+	deleted := 0
+	if err == nil {
+		deleted = fs.internal.Delete(keys...)
+	}
+	fs.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	if fs.syncDump && deleted > 0 {
+		_ = fs.dump()
+	}
+
+	return deleted, nil
+}
+
+// DeleteByPattern removes metrics with names matching the pattern from the FileStorage.
+// Returns the number of removed metrics.
+func (fs *FileStorage) DeleteByPattern(_ context.Context, pattern entities.NamePattern) (int, error) {
+	fs.mu.Lock()
+	keys := fs.internal.Matching(pattern)
+	var err error
+	if len(keys) > 0 {
+		err = fs.dumper.LogDeleteByPattern(pattern)
+	}
+	deleted := 0
+	if err == nil {
+		deleted = fs.internal.Delete(keys...)
+	}
+	fs.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	if fs.syncDump && deleted > 0 {
+		_ = fs.dump()
+	}
+
+	return deleted, nil
+}
+
+// Evict removes the metrics from the FileStorage unless they were received again.
+// Returns the number of removed metrics.
+func (fs *FileStorage) Evict(_ context.Context, metrics ...entities.Metric) (int, error) {
+	fs.mu.Lock()
+	keys := fs.internal.Evictable(metrics...)
+	var err error
+	if len(keys) > 0 {
+		err = fs.dumper.LogEvict(metrics...)
+	}
+	evicted := 0
+	if err == nil {
+		evicted = fs.internal.Delete(keys...)
+	}
+	fs.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	if fs.syncDump && evicted > 0 {
+		_ = fs.dump()
+	}
+
+	return evicted, nil
+}
+
+// ResetCounter sets the counter value to zero.
+// Returns false if the counter doesn't exist.
+func (fs *FileStorage) ResetCounter(_ context.Context, name string) (bool, error) {
+	fs.mu.Lock()
+	counter, ok := fs.internal.CounterReset(name)
+	var err error
+	if ok {
+		err = fs.dumper.LogSet(counter)
+	}
+	if err == nil && ok {
+		fs.internal.Set(counter)
+	}
+	fs.mu.Unlock()
+	if err != nil {
+		return false, err
+	}
+
+	if fs.syncDump && ok {
+		_ = fs.dump()
+	}
+
+	return ok, nil
+}
+
+// Replace replaces all metrics of the FileStorage with the given ones.
+// The snapshot is dumped before Replace returns, the previous metrics are kept if the dump fails.
+func (fs *FileStorage) Replace(_ context.Context, metrics ...entities.Metric) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	s := make(mem.Storage, len(metrics))
+	s.Set(metrics...)
+	if err := fs.dumper.Dump(s); err != nil {
+		fs.logger.Error("dump failed", zap.Error(err))
+		return err
+	}
+	fs.internal = &s
+	return nil
+}
+
 // DumpLoop starts a loop that periodically dumps the in-memory storage to the file system.
 // The loop runs until the provided context is canceled.
 // Returns an error if the dump operation fails or if the context is canceled.
@@ -131,6 +296,15 @@ func (fs *FileStorage) DumpLoop(ctx context.Context) error {
 	}
 }
 
+// existing returns the keys of stored metrics. Must be called with the lock held.
+func (fs *FileStorage) existing(keys []entities.MetricsKey) []entities.MetricsKey {
+	result := make([]entities.MetricsKey, 0, len(keys))
+	for _, m := range fs.internal.Get(keys...) {
+		result = append(result, m.MetricsKey)
+	}
+	return result
+}
+
 func (fs *FileStorage) load() error {
 	if !fs.config.Restore {
 		fs.logger.Debug("load disabled")
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dlomanov/mon/internal/entities"
+	"github.com/dlomanov/mon/internal/infra/storage/internal/mem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+var errLogFailed = errors.New("log failed")
+
+// failingDumper fails to append to the write-ahead log.
+type failingDumper struct{}
+
+func (failingDumper) Load(*mem.Storage) error                       { return nil }
+func (failingDumper) Dump(mem.Storage) error                        { return nil }
+func (failingDumper) Close() error                                  { return nil }
+func (failingDumper) LogSet(...entities.Metric) error               { return errLogFailed }
+func (failingDumper) LogDelete(...entities.MetricsKey) error        { return errLogFailed }
+func (failingDumper) LogDeleteByPattern(entities.NamePattern) error { return errLogFailed }
+func (failingDumper) LogEvict(...entities.Metric) error             { return errLogFailed }
+
+func TestFileStorage_LogFailure(t *testing.T) {
+	ctx := context.Background()
+	delta := int64(5)
+	value := 1.5
+	receivedAt := time.Now()
+	counter := entities.Metric{
+		MetricsKey: entities.MetricsKey{Type: entities.MetricCounter, Name: "requests"},
+		Delta:      &delta,
+		ReceivedAt: receivedAt,
+	}
+	gauge := entities.Metric{
+		MetricsKey: entities.MetricsKey{Type: entities.MetricGauge, Name: "cpu"},
+		Value:      &value,
+		ReceivedAt: receivedAt,
+	}
+
+	internal := mem.NewStorage()
+	internal.Set(counter, gauge)
+	fs := &FileStorage{
+		internal: internal,
+		logger:   zaptest.NewLogger(t),
+		dumper:   failingDumper{},
+	}
+	unchanged := func(t *testing.T) {
+		t.Helper()
+		all, err := fs.All(ctx)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []entities.Metric{counter, gauge}, all)
+	}
+
+	t.Run("set", func(t *testing.T) {
+		v := 2.5
+		err := fs.Set(ctx, entities.Metric{MetricsKey: gauge.MetricsKey, Value: &v})
+		require.ErrorIs(t, err, errLogFailed)
+		unchanged(t)
+	})
+	t.Run("update", func(t *testing.T) {
+		d := int64(1)
+		_, err := fs.Update(ctx, entities.OverflowClamp, entities.Metric{MetricsKey: counter.MetricsKey, Delta: &d})
+		require.ErrorIs(t, err, errLogFailed)
+		unchanged(t)
+	})
+	t.Run("delete", func(t *testing.T) {
+		_, err := fs.Delete(ctx, gauge.MetricsKey)
+		require.ErrorIs(t, err, errLogFailed)
+		unchanged(t)
+	})
+	t.Run("delete by pattern", func(t *testing.T) {
+		deleted, err := fs.DeleteByPattern(ctx, "*")
+		require.ErrorIs(t, err, errLogFailed)
+		assert.Zero(t, deleted)
+		unchanged(t)
+	})
+	t.Run("evict", func(t *testing.T) {
+		evicted, err := fs.Evict(ctx, counter, gauge)
+		require.ErrorIs(t, err, errLogFailed)
+		assert.Zero(t, evicted)
+		unchanged(t)
+	})
+	t.Run("reset counter", func(t *testing.T) {
+		ok, err := fs.ResetCounter(ctx, counter.Name)
+		require.ErrorIs(t, err, errLogFailed)
+		assert.False(t, ok)
+		unchanged(t)
+	})
+}
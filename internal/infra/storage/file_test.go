@@ -2,9 +2,13 @@ package storage_test
 
 import (
 	"context"
+	"fmt"
 	"github.com/dlomanov/mon/internal/infra/storage"
+	"github.com/dlomanov/mon/internal/infra/storage/block"
+	"math"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/dlomanov/mon/internal/entities"
 	"github.com/stretchr/testify/require"
@@ -69,3 +73,333 @@ func TestFileStorage(t *testing.T) {
 	require.Len(t, allMetrics, 1)
 	require.Equal(t, metric, allMetrics[0])
 }
+
+func TestFileStorage_Delete(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	ctx := context.Background()
+	cfg := storage.FileStorageConfig{
+		StoreInterval:   0,
+		FileStoragePath: t.TempDir() + "/metrics.json",
+		Restore:         true,
+	}
+
+	fs, err := storage.NewFileStorage(logger, cfg)
+	require.NoError(t, err)
+	value := 0.5
+	metric := entities.Metric{
+		MetricsKey: entities.MetricsKey{Type: entities.MetricGauge, Name: "cpu_usage"},
+		Value:      &value,
+	}
+	require.NoError(t, fs.Set(ctx, metric))
+	deleted, err := fs.Delete(ctx, metric.MetricsKey)
+	require.NoError(t, err)
+	require.Equal(t, 1, deleted)
+	require.NoError(t, fs.Close())
+
+	// the last metric deletion is persisted
+	fs, err = storage.NewFileStorage(logger, cfg)
+	require.NoError(t, err)
+	defer func(fs *storage.FileStorage) {
+		require.NoError(t, fs.Close())
+	}(fs)
+	allMetrics, err := fs.All(ctx)
+	require.NoError(t, err)
+	require.Empty(t, allMetrics)
+}
+
+func TestFileStorage_Names(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	ctx := context.Background()
+	cfg := storage.FileStorageConfig{
+		StoreInterval:   0,
+		FileStoragePath: t.TempDir() + "/metrics.json",
+		Restore:         true,
+	}
+
+	fs, err := storage.NewFileStorage(logger, cfg)
+	require.NoError(t, err)
+	names := []string{"heap_alloc", "heap", "host-1.cpu", "disk/sda1/used", "память_занято"}
+	for i, name := range names {
+		value := float64(i)
+		metric := entities.Metric{
+			MetricsKey: entities.MetricsKey{Type: entities.MetricGauge, Name: name},
+			Value:      &value,
+		}
+		require.NoError(t, fs.Set(ctx, metric))
+	}
+	require.NoError(t, fs.Close())
+
+	fs, err = storage.NewFileStorage(logger, cfg)
+	require.NoError(t, err)
+	defer func(fs *storage.FileStorage) {
+		require.NoError(t, fs.Close())
+	}(fs)
+	for i, name := range names {
+		metric, ok, err := fs.Get(ctx, entities.MetricsKey{Type: entities.MetricGauge, Name: name})
+		require.NoError(t, err)
+		require.True(t, ok, name)
+		require.Equal(t, float64(i), *metric.Value, name)
+	}
+}
+
+func TestFileStorage_LegacyFormat(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	ctx := context.Background()
+	cfg := storage.FileStorageConfig{
+		StoreInterval:   0,
+		FileStoragePath: t.TempDir() + "/metrics.json",
+		Restore:         true,
+	}
+	legacy := `{"name":"requests","type":"counter","delta":5,"total":12,"timestamp":"2024-01-02T03:04:05.123456789Z"}
+{"name":"cpu","type":"gauge","value":0.25,"received_at":"2024-01-02T03:04:06Z"}
+`
+	require.NoError(t, os.WriteFile(cfg.FileStoragePath, []byte(legacy), 0o666))
+
+	check := func(fs *storage.FileStorage) {
+		counter, ok, err := fs.Get(ctx, entities.MetricsKey{Type: entities.MetricCounter, Name: "requests"})
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, int64(5), *counter.Delta)
+		require.Equal(t, int64(12), *counter.Total)
+		require.Nil(t, counter.Value)
+		require.True(t, counter.Timestamp.Equal(time.Date(2024, 1, 2, 3, 4, 5, 123456789, time.UTC)))
+		require.True(t, counter.ReceivedAt.IsZero())
+
+		gauge, ok, err := fs.Get(ctx, entities.MetricsKey{Type: entities.MetricGauge, Name: "cpu"})
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, 0.25, *gauge.Value)
+		require.Nil(t, gauge.Delta)
+		require.True(t, gauge.Timestamp.IsZero())
+		require.True(t, gauge.ReceivedAt.Equal(time.Date(2024, 1, 2, 3, 4, 6, 0, time.UTC)))
+	}
+
+	fs, err := storage.NewFileStorage(logger, cfg)
+	require.NoError(t, err)
+	check(fs)
+	require.NoError(t, fs.Close())
+
+	// the file is rewritten as a block
+	r, err := block.Open(cfg.FileStoragePath)
+	require.NoError(t, err)
+	require.Len(t, r.Index(), 2)
+	require.NoError(t, r.Close())
+
+	fs, err = storage.NewFileStorage(logger, cfg)
+	require.NoError(t, err)
+	defer func(fs *storage.FileStorage) {
+		require.NoError(t, fs.Close())
+	}(fs)
+	check(fs)
+}
+
+func TestFileStorage_SnapshotLayout(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	ctx := context.Background()
+	cfg := storage.FileStorageConfig{
+		StoreInterval:   time.Hour,
+		FileStoragePath: t.TempDir() + "/metrics",
+		Restore:         true,
+	}
+	receivedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	metrics := make([]entities.Metric, 0)
+	for i := 0; i < 100; i++ {
+		v := float64(i) / 4
+		metrics = append(metrics, entities.Metric{
+			MetricsKey: entities.MetricsKey{Type: entities.MetricGauge, Name: fmt.Sprintf("gauge-%03d", i)},
+			Value:      &v,
+			ReceivedAt: receivedAt.Add(time.Duration(i) * time.Millisecond),
+		})
+	}
+	for i := 0; i < 10; i++ {
+		d := int64(i)
+		metrics = append(metrics, entities.Metric{
+			MetricsKey: entities.MetricsKey{Type: entities.MetricCounter, Name: fmt.Sprintf("counter-%d", i)},
+			Delta:      &d,
+			Timestamp:  receivedAt.Add(time.Duration(i) * time.Second),
+		})
+	}
+	hist, err := entities.NewHistogram([]float64{1, 10})
+	require.NoError(t, err)
+	hist.Observe(5)
+	metrics = append(metrics,
+		entities.Metric{MetricsKey: entities.MetricsKey{Type: entities.MetricHistogram, Name: "latency"}, Histogram: hist},
+		entities.Metric{MetricsKey: entities.MetricsKey{Type: entities.MetricHistogram, Name: "size"}, Histogram: hist})
+
+	fs, err := storage.NewFileStorage(logger, cfg)
+	require.NoError(t, err)
+	require.NoError(t, fs.Set(ctx, metrics...))
+	require.NoError(t, fs.Close())
+
+	// metrics of a type are compressed as a single series
+	r, err := block.Open(cfg.FileStoragePath)
+	require.NoError(t, err)
+	points := make(map[string]int)
+	for _, e := range r.Index() {
+		points[e.Key] = e.Points
+	}
+	require.Equal(t, map[string]int{"gauge": 100, "counter": 10, "histogram": 2}, points)
+	require.NoError(t, r.Close())
+
+	fs, err = storage.NewFileStorage(logger, cfg)
+	require.NoError(t, err)
+	defer func(fs *storage.FileStorage) {
+		require.NoError(t, fs.Close())
+	}(fs)
+	for _, want := range metrics {
+		got, ok, err := fs.Get(ctx, want.MetricsKey)
+		require.NoError(t, err)
+		require.True(t, ok, want.MetricsKey.String())
+		require.Equal(t, want.StringValue(), got.StringValue())
+		require.True(t, want.Timestamp.Equal(got.Timestamp))
+		require.True(t, want.ReceivedAt.Equal(got.ReceivedAt))
+	}
+}
+
+func TestFileStorage_Recovery(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	ctx := context.Background()
+	cfg := storage.FileStorageConfig{
+		StoreInterval:   time.Hour,
+		FileStoragePath: t.TempDir() + "/metrics",
+		Restore:         true,
+	}
+	gauge := func(name string, v float64) entities.Metric {
+		return entities.Metric{MetricsKey: entities.MetricsKey{Type: entities.MetricGauge, Name: name}, Value: &v}
+	}
+	hist, err := entities.NewHistogram([]float64{1, 10})
+	require.NoError(t, err)
+	hist.Observe(5)
+	histogram := entities.Metric{MetricsKey: entities.MetricsKey{Type: entities.MetricHistogram, Name: "latency"}, Histogram: hist}
+
+	// the snapshot holds the first metrics
+	fs, err := storage.NewFileStorage(logger, cfg)
+	require.NoError(t, err)
+	require.NoError(t, fs.Set(ctx, gauge("a", 1), gauge("b", 2), histogram))
+	require.NoError(t, fs.Close())
+
+	// updates after the snapshot are only in the write-ahead log, the storage isn't closed as on a crash
+	fs, err = storage.NewFileStorage(logger, cfg)
+	require.NoError(t, err)
+	require.NoError(t, fs.Set(ctx, gauge("a", 10), gauge("c", 3)))
+	deleted, err := fs.Delete(ctx, gauge("b", 0).MetricsKey)
+	require.NoError(t, err)
+	require.Equal(t, 1, deleted)
+	_, err = fs.DeleteByPattern(ctx, "c*")
+	require.NoError(t, err)
+	require.NoError(t, fs.Set(ctx, gauge("d", 4)))
+
+	// a torn record at the end of the log is discarded
+	wal, err := os.OpenFile(cfg.FileStoragePath+".wal", os.O_APPEND|os.O_WRONLY, 0o666)
+	require.NoError(t, err)
+	_, err = wal.Write([]byte{42, 0, 0, 0, 1, 2})
+	require.NoError(t, err)
+	require.NoError(t, wal.Close())
+
+	fs, err = storage.NewFileStorage(logger, cfg)
+	require.NoError(t, err)
+	defer func(fs *storage.FileStorage) {
+		require.NoError(t, fs.Close())
+	}(fs)
+	all, err := fs.All(ctx)
+	require.NoError(t, err)
+	values := make(map[string]float64)
+	for _, m := range all {
+		if m.Value != nil {
+			values[m.Name] = *m.Value
+		}
+	}
+	require.Equal(t, map[string]float64{"a": 10, "d": 4}, values)
+	got, ok, err := fs.Get(ctx, histogram.MetricsKey)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, histogram.Histogram, got.Histogram)
+
+	// updates after the torn record are recovered
+	require.NoError(t, fs.Set(ctx, gauge("e", 5)))
+	fs2, err := storage.NewFileStorage(logger, cfg)
+	require.NoError(t, err)
+	_, ok, err = fs2.Get(ctx, gauge("e", 0).MetricsKey)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NoError(t, fs2.Close())
+}
+
+func TestFileStorage_Restore(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	ctx := context.Background()
+	cfg := storage.FileStorageConfig{
+		StoreInterval:   time.Hour,
+		FileStoragePath: t.TempDir() + "/metrics",
+		Restore:         true,
+	}
+	gauge := func(name string, v float64) entities.Metric {
+		return entities.Metric{MetricsKey: entities.MetricsKey{Type: entities.MetricGauge, Name: name}, Value: &v}
+	}
+
+	fs, err := storage.NewFileStorage(logger, cfg)
+	require.NoError(t, err)
+	meta, err := storage.NewMetaStorage(logger, cfg.FileStoragePath+".meta")
+	require.NoError(t, err)
+	require.NoError(t, fs.Set(ctx, gauge("a", 1), gauge("b", 2)))
+	require.NoError(t, meta.SetMeta(ctx, entities.Metadata{Name: "a", Unit: "bytes"}))
+
+	b := storage.NewSplitBackup(fs, meta)
+	backup, err := b.Backup(ctx)
+	require.NoError(t, err)
+	require.Len(t, backup.Metrics, 2)
+	require.Len(t, backup.Metadata, 1)
+
+	require.NoError(t, fs.Set(ctx, gauge("a", 10), gauge("c", 3)))
+	require.NoError(t, meta.SetMeta(ctx, entities.Metadata{Name: "c", Unit: "seconds"}))
+	require.NoError(t, b.Restore(ctx, backup))
+
+	// restored metrics are persisted without waiting for the store interval and the log doesn't revive replaced ones
+	fs2, err := storage.NewFileStorage(logger, cfg)
+	require.NoError(t, err)
+	defer func(fs *storage.FileStorage) {
+		require.NoError(t, fs.Close())
+	}(fs2)
+	all, err := fs2.All(ctx)
+	require.NoError(t, err)
+	values := make(map[string]float64)
+	for _, m := range all {
+		values[m.Name] = *m.Value
+	}
+	require.Equal(t, map[string]float64{"a": 1, "b": 2}, values)
+
+	meta2, err := storage.NewMetaStorage(logger, cfg.FileStoragePath+".meta")
+	require.NoError(t, err)
+	metas, err := meta2.AllMeta(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []entities.Metadata{{Name: "a", Unit: "bytes"}}, metas)
+
+	// restoring an empty backup clears the storage
+	require.NoError(t, b.Restore(ctx, entities.Backup{}))
+	all, err = fs.All(ctx)
+	require.NoError(t, err)
+	require.Empty(t, all)
+	require.NoError(t, fs.Close())
+}
+
+func TestFileStorage_Update(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	cfg := storage.FileStorageConfig{
+		StoreInterval:   time.Hour,
+		FileStoragePath: t.TempDir() + "/metrics",
+		Restore:         true,
+	}
+	fs, err := storage.NewFileStorage(logger, cfg)
+	require.NoError(t, err)
+	testUpdate(t, fs)
+
+	// updates are logged before the snapshot
+	fs2, err := storage.NewFileStorage(logger, cfg)
+	require.NoError(t, err)
+	got, ok, err := fs2.Get(context.Background(), entities.MetricsKey{Type: entities.MetricCounter, Name: "requests"})
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, int64(math.MaxInt64), *got.Delta)
+	require.NoError(t, fs2.Close())
+	require.NoError(t, fs.Close())
+}
@@ -0,0 +1,431 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dlomanov/mon/internal/apps/server/usecases"
+	"github.com/dlomanov/mon/internal/entities"
+	"github.com/dlomanov/mon/internal/infra/storage/block"
+	"github.com/dlomanov/mon/internal/infra/storage/internal/atomicfile"
+	"github.com/dlomanov/mon/internal/infra/storage/internal/ring"
+	"go.uber.org/zap"
+)
+
+var _ usecases.HistoryStorage = (*MemHistory)(nil)
+
+// MemHistory is an in-memory storage of metric time series.
+// Raw points of every series are kept in a ring buffer, so memory usage is bounded by the number of metrics,
+// rollups are kept until they are truncated.
+// If a file path is set, history is loaded from the file on creation and dumped by DumpLoop and on Close.
+type MemHistory struct {
+	mu       sync.RWMutex
+	logger   *zap.Logger
+	size     int
+	filePath string
+	raw      map[entities.MetricsKey]*ring.Buffer
+	rollups  map[time.Duration]map[entities.MetricsKey][]entities.Rollup
+}
+
+// NewMemHistory creates a new MemHistory keeping up to size raw points per metric,
+// persisted to filePath, or kept in memory only if filePath is empty.
+// Raw points aren't kept if size is zero. Returns an error if the existing file can't be loaded.
+func NewMemHistory(logger *zap.Logger, size int, filePath string) (*MemHistory, error) {
+	h := &MemHistory{
+		logger:   logger,
+		size:     size,
+		filePath: filePath,
+		raw:      make(map[entities.MetricsKey]*ring.Buffer),
+		rollups:  make(map[time.Duration]map[entities.MetricsKey][]entities.Rollup),
+	}
+	if err := h.load(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Append adds samples to the metric series.
+func (h *MemHistory) Append(_ context.Context, samples ...entities.Sample) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, s := range samples {
+		h.append(s)
+	}
+	return nil
+}
+
+// Range returns points of the metric between from and to inclusively ordered by time.
+func (h *MemHistory) Range(_ context.Context, key entities.MetricsKey, from, to time.Time) ([]entities.Point, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	b, ok := h.raw[key]
+	if !ok {
+		return []entities.Point{}, nil
+	}
+	return b.Between(from, to), nil
+}
+
+// Rollup aggregates points of the source resolution within [from, to) into rollups of the resolution.
+// Returns the number of built rollups.
+func (h *MemHistory) Rollup(_ context.Context, source, resolution time.Duration, from, to time.Time) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	built := 0
+	if source == 0 {
+		for key, b := range h.raw {
+			points := b.Between(from, to)
+			rollups := make([]entities.Rollup, 0, len(points))
+			for _, p := range points {
+				if p.Time.Before(to) {
+					rollups = append(rollups, entities.NewRollup(key, p))
+				}
+			}
+			built += h.build(resolution, rollups)
+		}
+		return built, nil
+	}
+	for _, series := range h.rollups[source] {
+		rollups := between(series, from, to)
+		if n := len(rollups); n != 0 && !rollups[n-1].Time.Before(to) {
+			rollups = rollups[:n-1]
+		}
+		built += h.build(resolution, rollups)
+	}
+	return built, nil
+}
+
+// RangeRollups returns rollups of the metric starting between from and to inclusively ordered by time.
+func (h *MemHistory) RangeRollups(
+	_ context.Context,
+	key entities.MetricsKey,
+	resolution time.Duration,
+	from time.Time,
+	to time.Time,
+) ([]entities.Rollup, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return append([]entities.Rollup{}, between(h.rollups[resolution][key], from, to)...), nil
+}
+
+// Truncate deletes points of the resolution before the time and returns the number of deleted points.
+func (h *MemHistory) Truncate(_ context.Context, resolution time.Duration, before time.Time) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	deleted := 0
+	if resolution == 0 {
+		for key, b := range h.raw {
+			deleted += b.DropBefore(before)
+			if b.Len() == 0 {
+				delete(h.raw, key)
+			}
+		}
+		return deleted, nil
+	}
+	series := h.rollups[resolution]
+	for key, rollups := range series {
+		i := sort.Search(len(rollups), func(i int) bool { return !rollups[i].Time.Before(before) })
+		deleted += i
+		if i == len(rollups) {
+			delete(series, key)
+			continue
+		}
+		series[key] = append(rollups[:0:0], rollups[i:]...)
+	}
+	return deleted, nil
+}
+
+// DumpLoop dumps history to the file every interval until the context is canceled.
+func (h *MemHistory) DumpLoop(ctx context.Context, interval time.Duration) error {
+	if h.filePath == "" {
+		return nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			h.logger.Debug("history dump loop cancelled", zap.Error(ctx.Err()))
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+
+		if err := h.dump(); err != nil {
+			h.logger.Error("failed history dump", zap.Error(err))
+		}
+	}
+}
+
+// Close dumps history to the file.
+func (h *MemHistory) Close() error {
+	return h.dump()
+}
+
+func (h *MemHistory) append(s entities.Sample) {
+	if h.size <= 0 {
+		return
+	}
+	b, ok := h.raw[s.MetricsKey]
+	if !ok {
+		b = ring.NewBuffer(h.size)
+		h.raw[s.MetricsKey] = b
+	}
+	b.Add(s.Point)
+}
+
+// build merges ordered source rollups of a metric into buckets of the resolution.
+// Must be called with the lock held.
+func (h *MemHistory) build(resolution time.Duration, source []entities.Rollup) int {
+	built := 0
+	var current entities.Rollup
+	for _, r := range source {
+		bucket := entities.Bucket(r.Time, resolution)
+		if current.Count != 0 && !current.Time.Equal(bucket) {
+			h.setRollup(resolution, current)
+			current = entities.Rollup{}
+			built++
+		}
+		current.Merge(r)
+		current.Time = bucket
+	}
+	if current.Count != 0 {
+		h.setRollup(resolution, current)
+		built++
+	}
+	return built
+}
+
+// setRollup inserts the rollup keeping the order by time, a rollup of the same bucket is replaced.
+// Must be called with the lock held.
+func (h *MemHistory) setRollup(resolution time.Duration, r entities.Rollup) {
+	series, ok := h.rollups[resolution]
+	if !ok {
+		series = make(map[entities.MetricsKey][]entities.Rollup)
+		h.rollups[resolution] = series
+	}
+	rollups := series[r.MetricsKey]
+	i := sort.Search(len(rollups), func(i int) bool { return !rollups[i].Time.Before(r.Time) })
+	switch {
+	case i < len(rollups) && rollups[i].Time.Equal(r.Time):
+		rollups[i] = r
+	case i == len(rollups):
+		rollups = append(rollups, r)
+	default:
+		rollups = append(rollups, entities.Rollup{})
+		copy(rollups[i+1:], rollups[i:])
+		rollups[i] = r
+	}
+	series[r.MetricsKey] = rollups
+}
+
+// between returns ordered rollups starting between from and to inclusively.
+func between(rollups []entities.Rollup, from, to time.Time) []entities.Rollup {
+	lo := sort.Search(len(rollups), func(i int) bool { return !rollups[i].Time.Before(from) })
+	hi := sort.Search(len(rollups), func(i int) bool { return rollups[i].Time.After(to) })
+	if lo >= hi {
+		return nil
+	}
+	return rollups[lo:hi]
+}
+
+func (h *MemHistory) load() error {
+	if h.filePath == "" {
+		return nil
+	}
+	file, err := os.Open(h.filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		h.logger.Debug("history file doesn't exist", zap.String("path", h.filePath))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	header := make([]byte, block.HeaderSize)
+	n, err := file.ReadAt(header, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	var count int
+	if block.IsBlock(header[:n]) {
+		count, err = h.loadBlock(file, info.Size())
+	} else {
+		count, err = h.loadJSON(file)
+	}
+	if err != nil {
+		return err
+	}
+	h.logger.Debug("history loaded", zap.Int("count", count))
+	return nil
+}
+
+func (h *MemHistory) loadBlock(r io.ReaderAt, size int64) (int, error) {
+	reader, err := block.NewReader(r, size)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, e := range reader.Index() {
+		s, err := reader.Series(e)
+		if err != nil {
+			return count, err
+		}
+		resolution, key, err := parseHistoryKey(s.Key)
+		if err != nil {
+			return count, err
+		}
+		for _, p := range s.Points {
+			if resolution == 0 {
+				h.append(entities.Sample{MetricsKey: key, Point: entities.Point{
+					Time:  time.Unix(0, p.T).UTC(),
+					Value: math.Float64frombits(p.V[0]),
+				}})
+			} else {
+				h.setRollup(resolution, entities.Rollup{
+					MetricsKey: key,
+					Time:       time.Unix(0, p.T).UTC(),
+					Min:        math.Float64frombits(p.V[0]),
+					Max:        math.Float64frombits(p.V[1]),
+					Sum:        math.Float64frombits(p.V[2]),
+					Last:       math.Float64frombits(p.V[3]),
+					Count:      p.V[4],
+				})
+			}
+		}
+		count += len(s.Points)
+	}
+	return count, nil
+}
+
+// loadJSON loads history written as JSON lines by previous versions, it's rewritten as a block on the next dump.
+func (h *MemHistory) loadJSON(r io.Reader) (int, error) {
+	count := 0
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var record historyRecord
+		err := dec.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return count, err
+		}
+		typ, ok := entities.ParseMetricType(record.Type)
+		if !ok {
+			return count, fmt.Errorf("invalid history record of %q: unknown type %q", record.Name, record.Type)
+		}
+		key := entities.MetricsKey{Name: record.Name, Type: typ}
+		if record.Resolution == 0 {
+			h.append(entities.Sample{MetricsKey: key, Point: entities.Point{Time: record.Time, Value: record.Value}})
+		} else {
+			h.setRollup(time.Duration(record.Resolution)*time.Second, record.toRollup(key))
+		}
+		count++
+	}
+	return count, nil
+}
+
+// dump writes history to the file as a block, every raw and rollup series of a metric is a separate series.
+// Raw series have a single value column, rollup series have min, max, sum, last and count columns.
+func (h *MemHistory) dump() error {
+	if h.filePath == "" {
+		return nil
+	}
+
+	h.mu.RLock()
+	series := make([]block.Series, 0, len(h.raw))
+	for key, b := range h.raw {
+		points := b.Points()
+		s := block.Series{Key: historyKey(0, key), Columns: 1, Points: make([]block.Point, 0, len(points))}
+		for _, p := range points {
+			s.Points = append(s.Points, block.Point{T: p.Time.UnixNano(), V: []uint64{math.Float64bits(p.Value)}})
+		}
+		series = append(series, s)
+	}
+	for resolution, rollups := range h.rollups {
+		for key, rs := range rollups {
+			s := block.Series{Key: historyKey(resolution, key), Columns: 5, Points: make([]block.Point, 0, len(rs))}
+			for _, r := range rs {
+				s.Points = append(s.Points, block.Point{T: r.Time.UnixNano(), V: []uint64{
+					math.Float64bits(r.Min),
+					math.Float64bits(r.Max),
+					math.Float64bits(r.Sum),
+					math.Float64bits(r.Last),
+					r.Count,
+				}})
+			}
+			series = append(series, s)
+		}
+	}
+	h.mu.RUnlock()
+
+	return atomicfile.Write(h.filePath, func(w io.Writer) error {
+		return block.Write(w, series)
+	})
+}
+
+// historyKey returns the block series key of the metric resolution as "<resolution seconds>/<metric key>".
+func historyKey(resolution time.Duration, key entities.MetricsKey) string {
+	return strconv.FormatInt(int64(resolution/time.Second), 10) + "/" + key.String()
+}
+
+func parseHistoryKey(value string) (time.Duration, entities.MetricsKey, error) {
+	resStr, keyStr, ok := strings.Cut(value, "/")
+	if !ok {
+		return 0, entities.MetricsKey{}, fmt.Errorf("invalid history series key %q", value)
+	}
+	seconds, err := strconv.ParseInt(resStr, 10, 64)
+	if err != nil {
+		return 0, entities.MetricsKey{}, fmt.Errorf("invalid history series key %q: %w", value, err)
+	}
+	key, err := entities.NewMetricsKey(keyStr)
+	if err != nil {
+		return 0, entities.MetricsKey{}, fmt.Errorf("invalid history series key %q: %w", value, err)
+	}
+	return time.Duration(seconds) * time.Second, key, nil
+}
+
+// historyRecord is a raw point or a rollup in the history file written as JSON lines by previous versions.
+type historyRecord struct {
+	Name       string    `json:"name"`
+	Type       string    `json:"type"`
+	Resolution int64     `json:"resolution,omitempty"` // Resolution of a rollup in seconds, zero for raw points.
+	Time       time.Time `json:"time"`
+	Value      float64   `json:"value,omitempty"` // Value is the raw value or the last value of a rollup.
+	Min        float64   `json:"min,omitempty"`
+	Max        float64   `json:"max,omitempty"`
+	Sum        float64   `json:"sum,omitempty"`
+	Count      uint64    `json:"count,omitempty"`
+}
+
+func (r historyRecord) toRollup(key entities.MetricsKey) entities.Rollup {
+	return entities.Rollup{
+		MetricsKey: key,
+		Time:       r.Time,
+		Min:        r.Min,
+		Max:        r.Max,
+		Sum:        r.Sum,
+		Last:       r.Value,
+		Count:      r.Count,
+	}
+}
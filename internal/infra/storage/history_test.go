@@ -0,0 +1,129 @@
+package storage_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dlomanov/mon/internal/entities"
+	"github.com/dlomanov/mon/internal/infra/storage"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestMemHistory(t *testing.T) {
+	ctx := context.Background()
+	history, err := storage.NewMemHistory(zap.NewNop(), 3, "")
+	require.NoError(t, err)
+
+	key := entities.MetricsKey{Type: entities.MetricGauge, Name: "HeapInuse"}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sample := func(sec int, value float64) entities.Sample {
+		return entities.Sample{MetricsKey: key, Point: entities.Point{Time: start.Add(time.Duration(sec) * time.Second), Value: value}}
+	}
+	point := func(sec int, value float64) entities.Point {
+		return sample(sec, value).Point
+	}
+
+	// out of order samples are kept ordered, the same time is replaced
+	require.NoError(t, history.Append(ctx, sample(2, 2), sample(1, 1), sample(2, 20)))
+	points, err := history.Range(ctx, key, start, start.Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, []entities.Point{point(1, 1), point(2, 20)}, points)
+
+	// the oldest points are dropped when the buffer is full
+	require.NoError(t, history.Append(ctx, sample(3, 3), sample(4, 4), sample(0, 0)))
+	points, err = history.Range(ctx, key, start, start.Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, []entities.Point{point(2, 20), point(3, 3), point(4, 4)}, points)
+
+	// the range is inclusive
+	points, err = history.Range(ctx, key, start.Add(3*time.Second), start.Add(4*time.Second))
+	require.NoError(t, err)
+	require.Equal(t, []entities.Point{point(3, 3), point(4, 4)}, points)
+
+	points, err = history.Range(ctx, entities.MetricsKey{Type: entities.MetricGauge, Name: "unknown"}, start, start.Add(time.Minute))
+	require.NoError(t, err)
+	require.Empty(t, points)
+
+	// raw points aren't kept with zero size
+	disabled, err := storage.NewMemHistory(zap.NewNop(), 0, "")
+	require.NoError(t, err)
+	require.NoError(t, disabled.Append(ctx, sample(1, 1)))
+	points, err = disabled.Range(ctx, key, start, start.Add(time.Minute))
+	require.NoError(t, err)
+	require.Empty(t, points)
+}
+
+func TestMemHistory_LoadInvalidJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	record := `{"name":"HeapInuse","type":"meter","time":"2024-01-01T00:00:00Z","value":1}` + "\n"
+	require.NoError(t, os.WriteFile(path, []byte(record), 0o644))
+
+	_, err := storage.NewMemHistory(zap.NewNop(), 3, path)
+	require.Error(t, err)
+}
+
+func TestMemHistory_Compaction(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.history")
+	history, err := storage.NewMemHistory(zap.NewNop(), 100, path)
+	require.NoError(t, err)
+
+	key := entities.MetricsKey{Type: entities.MetricGauge, Name: "HeapInuse"}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration, value float64) entities.Sample {
+		return entities.Sample{MetricsKey: key, Point: entities.Point{Time: start.Add(d), Value: value}}
+	}
+	require.NoError(t, history.Append(ctx,
+		at(10*time.Second, 1), at(20*time.Second, 3),
+		at(70*time.Second, 5), at(130*time.Second, 7)))
+
+	// Test Rollup of complete minutes from raw points
+	built, err := history.Rollup(ctx, 0, time.Minute, start, start.Add(2*time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, 2, built)
+	minutes, err := history.RangeRollups(ctx, key, time.Minute, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, []entities.Rollup{
+		{MetricsKey: key, Time: start, Min: 1, Max: 3, Sum: 4, Last: 3, Count: 2},
+		{MetricsKey: key, Time: start.Add(time.Minute), Min: 5, Max: 5, Sum: 5, Last: 5, Count: 1},
+	}, minutes)
+
+	// Test Rollup of hours from minutes
+	built, err = history.Rollup(ctx, time.Minute, time.Hour, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 1, built)
+	hours, err := history.RangeRollups(ctx, key, time.Hour, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, []entities.Rollup{
+		{MetricsKey: key, Time: start, Min: 1, Max: 5, Sum: 9, Last: 5, Count: 3},
+	}, hours)
+
+	// Test Truncate
+	deleted, err := history.Truncate(ctx, 0, start.Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, 2, deleted)
+	deleted, err = history.Truncate(ctx, time.Minute, start.Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, 1, deleted)
+
+	// Test persistence
+	require.NoError(t, history.Close())
+	restored, err := storage.NewMemHistory(zap.NewNop(), 100, path)
+	require.NoError(t, err)
+	points, err := restored.Range(ctx, key, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, points, 2)
+	require.True(t, points[0].Time.Equal(start.Add(70*time.Second)))
+	minutes, err = restored.RangeRollups(ctx, key, time.Minute, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, minutes, 1)
+	require.Equal(t, 5.0, minutes[0].Last)
+	hours, err = restored.RangeRollups(ctx, key, time.Hour, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, hours, 1)
+	require.Equal(t, uint64(3), hours[0].Count)
+}
@@ -2,115 +2,433 @@ package dumper
 
 import (
 	"encoding/json"
+	"fmt"
+	"github.com/dlomanov/mon/internal/infra/storage/block"
+	"github.com/dlomanov/mon/internal/infra/storage/internal/atomicfile"
 	"github.com/dlomanov/mon/internal/infra/storage/internal/mem"
+	"github.com/dlomanov/mon/internal/infra/storage/internal/wal"
 	"io"
+	"math"
 	"os"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/dlomanov/mon/internal/entities"
 	"go.uber.org/zap"
 )
 
-func NewFileDumper(logger *zap.Logger, filePath string) *FileDumper {
+// NewFileDumper creates a dumper of snapshots to filePath with the write-ahead log next to it.
+// Updates are appended to the log only if logging is set, otherwise every update is expected to be dumped.
+// Returns an error if the log can't be opened.
+func NewFileDumper(logger *zap.Logger, filePath string, logging bool) (*FileDumper, error) {
+	log, err := wal.Open(filePath + ".wal")
+	if err != nil {
+		return nil, err
+	}
 	return &FileDumper{
 		logger:   logger,
 		filePath: filePath,
 		mu:       sync.Mutex{},
-	}
+		wal:      log,
+		logging:  logging,
+	}, nil
 }
 
+// FileDumper persists metrics as snapshots of the whole storage and a write-ahead log of updates since the snapshot.
 type FileDumper struct {
 	logger   *zap.Logger
 	filePath string
 	mu       sync.Mutex
+	wal      *wal.Log
+	logging  bool
+	// written is set once the file holds metrics,
+	// from then on an empty storage is dumped to reflect deleted metrics.
+	written bool
 }
 
+// Load reads metrics from the latest snapshot into dest and replays the write-ahead log on top of it.
+// Files written as JSON lines by previous versions are loaded as well and rewritten as a block on the next dump.
 func (f *FileDumper) Load(dest *mem.Storage) error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
+	m, err := f.loadSnapshot()
+	if err != nil {
+		return err
+	}
+	f.written = len(m) > 0
+
+	count, err := f.wal.Replay(func(record []byte) error { return replay(m, record) })
+	if err != nil {
+		f.logger.Error("failed to replay write-ahead log", zap.Error(err))
+		return err
+	}
+
+	*dest = m
+	f.logger.Debug("metrics loaded", zap.Int("count", len(m)), zap.Int("replayed", count))
+	return nil
+}
+
+func (f *FileDumper) loadSnapshot() (mem.Storage, error) {
 	file, err := os.OpenFile(f.filePath, os.O_RDONLY, 0o666)
 	if os.IsNotExist(err) {
 		f.logger.Debug("file doesn't exist", zap.Error(err))
-		return nil
+		return make(mem.Storage), nil
 	}
 	if err != nil {
 		f.logger.Error("failed to open file", zap.Error(err))
-		return err
+		return nil, err
 	}
 	defer func(file *os.File) { _ = file.Close() }(file)
 
-	m := make(mem.Storage)
-	dec := json.NewDecoder(file)
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, block.HeaderSize)
+	n, err := file.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if block.IsBlock(header[:n]) {
+		return loadBlock(file, info.Size())
+	}
+	return loadJSON(file)
+}
 
-	for {
-		data := metric{}
-		if err = dec.Decode(&data); err == io.EOF {
-			break
-		}
+// Dump writes a snapshot of metrics to the file as a block and discards the write-ahead log.
+// The snapshot is written to a temporary file, synced and renamed over the file,
+// so a crash during the dump leaves the previous snapshot and the log intact.
+// Updates of the source must be blocked until Dump returns.
+func (f *FileDumper) Dump(source mem.Storage) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(source) == 0 && !f.written && f.wal.Size() == 0 {
+		f.logger.Debug("nothing to dump")
+		return nil
+	}
+
+	byType := make(map[entities.MetricType][]entities.Metric)
+	for _, v := range source {
+		byType[v.Type] = append(byType[v.Type], v)
+	}
+	series := make([]block.Series, 0, len(byType))
+	for typ, metrics := range byType {
+		s, err := toSeries(typ, metrics)
 		if err != nil {
+			f.logger.Error("failed to encode metrics", zap.String("type", string(typ)), zap.Error(err))
 			return err
 		}
+		series = append(series, s)
+	}
+
+	err := atomicfile.Write(f.filePath, func(w io.Writer) error {
+		return block.Write(w, series)
+	})
+	if err != nil {
+		f.logger.Error("failed to write metrics", zap.Error(err))
+		return err
+	}
+	// updates before the dump are in the snapshot, the storage is locked for updates while dumping
+	if err = f.wal.Reset(); err != nil {
+		f.logger.Error("failed to reset write-ahead log", zap.Error(err))
+		return err
+	}
+
+	f.written = len(source) > 0
+	f.logger.Debug("metrics dumped")
+	return nil
+}
 
-		entity := entities.Metric{
-			MetricsKey: entities.MetricsKey{
-				Name: data.Name,
-				Type: entities.MustParseMetricType(data.Type),
-			},
-			Value: data.Value,
-			Delta: data.Delta,
+// Close closes the write-ahead log.
+func (f *FileDumper) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.wal.Close()
+}
+
+// Columns of a metrics series.
+// Metrics of a type are stored as a single series with a point per metric at its timestamp,
+// so the values of similar metrics are compressed against each other.
+const (
+	columnFlags = iota
+	columnReceivedAt
+	columnValue
+	columnDelta
+	columnTotal
+	columnsCount
+)
+
+// Flags of the set optional fields of a metric.
+const (
+	flagTimestamp uint64 = 1 << iota
+	flagReceivedAt
+	flagValue
+	flagDelta
+	flagTotal
+)
+
+// toSeries converts metrics of the type to a series keyed by the type.
+// Metric names, histograms, summaries and sets are stored in the payload as JSON.
+func toSeries(typ entities.MetricType, metrics []entities.Metric) (block.Series, error) {
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].Name < metrics[j].Name })
+
+	s := block.Series{Key: string(typ), Columns: columnsCount, Points: make([]block.Point, 0, len(metrics))}
+	data := seriesPayload{Names: make([]string, 0, len(metrics))}
+	for _, v := range metrics {
+		s.Points = append(s.Points, toPoint(v))
+		data.Names = append(data.Names, v.Name)
+		if v.Histogram == nil && v.Summary == nil && v.Set == nil {
+			continue
 		}
+		if data.Values == nil {
+			data.Values = make([]payload, len(metrics))
+		}
+		m := toModel(v)
+		data.Values[len(data.Names)-1] = payload{Histogram: m.Histogram, Summary: m.Summary, Set: m.Set}
+	}
+
+	var err error
+	s.Payload, err = json.Marshal(data)
+	return s, err
+}
 
-		m[entity.String()] = entity
+// fromSeries converts the series of metrics of a type back to metrics.
+func fromSeries(s block.Series) ([]entities.Metric, error) {
+	typ, ok := entities.ParseMetricType(s.Key)
+	if !ok {
+		return nil, fmt.Errorf("%w: series %q has unknown type", block.ErrCorrupted, s.Key)
+	}
+	if s.Columns != columnsCount {
+		return nil, fmt.Errorf("%w: series %q has unexpected shape", block.ErrCorrupted, s.Key)
+	}
+	var data seriesPayload
+	if err := json.Unmarshal(s.Payload, &data); err != nil {
+		return nil, fmt.Errorf("%w: series %q: %w", block.ErrCorrupted, s.Key, err)
+	}
+	if len(data.Names) != len(s.Points) || data.Values != nil && len(data.Values) != len(s.Points) {
+		return nil, fmt.Errorf("%w: series %q has unexpected shape", block.ErrCorrupted, s.Key)
 	}
 
-	*dest = m
-	f.logger.Debug("metrics loaded")
-	return nil
+	result := make([]entities.Metric, 0, len(s.Points))
+	for i, p := range s.Points {
+		m := fromPoint(p)
+		m.Name, m.Type = data.Names[i], string(typ)
+		if data.Values != nil {
+			m.Histogram, m.Summary, m.Set = data.Values[i].Histogram, data.Values[i].Summary, data.Values[i].Set
+		}
+		if err := entities.ValidateMetricName(m.Name); err != nil {
+			return nil, fmt.Errorf("%w: series %q: %w", block.ErrCorrupted, s.Key, err)
+		}
+		result = append(result, m.toEntity())
+	}
+	return result, nil
 }
 
-func (f *FileDumper) Dump(source mem.Storage) error {
-	if len(source) == 0 {
-		f.logger.Debug("nothing to dump")
-		return nil
+// toPoint stores the scalar fields of the metric in the point columns.
+func toPoint(v entities.Metric) block.Point {
+	p := block.Point{V: make([]uint64, columnsCount)}
+	if !v.Timestamp.IsZero() {
+		p.T = v.Timestamp.UnixNano()
+		p.V[columnFlags] |= flagTimestamp
 	}
+	if !v.ReceivedAt.IsZero() {
+		p.V[columnReceivedAt] = uint64(v.ReceivedAt.UnixNano())
+		p.V[columnFlags] |= flagReceivedAt
+	}
+	if v.Value != nil {
+		p.V[columnValue] = math.Float64bits(*v.Value)
+		p.V[columnFlags] |= flagValue
+	}
+	if v.Delta != nil {
+		p.V[columnDelta] = uint64(*v.Delta)
+		p.V[columnFlags] |= flagDelta
+	}
+	if v.Total != nil {
+		p.V[columnTotal] = uint64(*v.Total)
+		p.V[columnFlags] |= flagTotal
+	}
+	return p
+}
 
-	f.mu.Lock()
-	defer f.mu.Unlock()
+// fromPoint reads the scalar fields of a metric from the point columns.
+func fromPoint(p block.Point) metric {
+	m := metric{}
+	flags := p.V[columnFlags]
+	if flags&flagTimestamp != 0 {
+		t := time.Unix(0, p.T)
+		m.Timestamp = &t
+	}
+	if flags&flagReceivedAt != 0 {
+		t := time.Unix(0, int64(p.V[columnReceivedAt]))
+		m.ReceivedAt = &t
+	}
+	if flags&flagValue != 0 {
+		v := math.Float64frombits(p.V[columnValue])
+		m.Value = &v
+	}
+	if flags&flagDelta != 0 {
+		d := int64(p.V[columnDelta])
+		m.Delta = &d
+	}
+	if flags&flagTotal != 0 {
+		t := int64(p.V[columnTotal])
+		m.Total = &t
+	}
+	return m
+}
 
-	file, err := os.OpenFile(f.filePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o666)
+func loadBlock(r io.ReaderAt, size int64) (mem.Storage, error) {
+	reader, err := block.NewReader(r, size)
 	if err != nil {
-		f.logger.Error("failed to open file", zap.Error(err))
-		return err
+		return nil, err
 	}
-	defer func(file *os.File) { _ = file.Close() }(file)
-
-	enc := json.NewEncoder(file)
-	for k, v := range source {
-		data := metric{
-			Name:  v.Name,
-			Type:  string(v.Type),
-			Delta: v.Delta,
-			Value: v.Value,
+	series, err := reader.All()
+	if err != nil {
+		return nil, err
+	}
+	m := make(mem.Storage)
+	for _, s := range series {
+		metrics, err := fromSeries(s)
+		if err != nil {
+			return nil, err
 		}
-		valueStr := v.StringValue()
+		m.Set(metrics...)
+	}
+	return m, nil
+}
 
-		err = enc.Encode(data)
+func loadJSON(r io.Reader) (mem.Storage, error) {
+	m := make(mem.Storage)
+	dec := json.NewDecoder(r)
+	for {
+		data := metric{}
+		err := dec.Decode(&data)
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			f.logger.Error("failed to encode metric",
-				zap.String("key", k),
-				zap.String("value", valueStr))
-			return err
+			return nil, err
 		}
+		entity := data.toEntity()
+		m[entity.MetricsKey] = entity
 	}
+	return m, nil
+}
 
-	f.logger.Debug("metrics dumped")
-	return nil
+func toModel(v entities.Metric) metric {
+	data := metric{
+		Name:  v.Name,
+		Type:  string(v.Type),
+		Delta: v.Delta,
+		Value: v.Value,
+		Total: v.Total,
+	}
+	if !v.Timestamp.IsZero() {
+		data.Timestamp = &v.Timestamp
+	}
+	if !v.ReceivedAt.IsZero() {
+		data.ReceivedAt = &v.ReceivedAt
+	}
+	if v.Histogram != nil {
+		data.Histogram = &histogram{
+			Bounds: v.Histogram.Bounds,
+			Counts: v.Histogram.Counts,
+			Sum:    v.Histogram.Sum,
+			Count:  v.Histogram.Count,
+		}
+	}
+	if v.Summary != nil {
+		s := summary(*v.Summary)
+		data.Summary = &s
+	}
+	if v.Set != nil {
+		s := set(*v.Set)
+		data.Set = &s
+	}
+	return data
 }
 
-type metric struct {
-	Name  string   `json:"name"`
-	Type  string   `json:"type"`
-	Delta *int64   `json:"delta,omitempty"`
-	Value *float64 `json:"value,omitempty"`
+func (data metric) toEntity() entities.Metric {
+	entity := entities.Metric{
+		MetricsKey: entities.MetricsKey{
+			Name: data.Name,
+			Type: entities.MustParseMetricType(data.Type),
+		},
+		Value: data.Value,
+		Delta: data.Delta,
+		Total: data.Total,
+	}
+	if data.Timestamp != nil {
+		entity.Timestamp = *data.Timestamp
+	}
+	if data.ReceivedAt != nil {
+		entity.ReceivedAt = *data.ReceivedAt
+	}
+	if data.Histogram != nil {
+		entity.Histogram = &entities.Histogram{
+			Bounds: data.Histogram.Bounds,
+			Counts: data.Histogram.Counts,
+			Sum:    data.Histogram.Sum,
+			Count:  data.Histogram.Count,
+		}
+	}
+	if data.Summary != nil {
+		s := entities.Summary(*data.Summary)
+		entity.Summary = &s
+	}
+	if data.Set != nil {
+		s := entities.Set(*data.Set)
+		entity.Set = &s
+	}
+	return entity
 }
+
+type (
+	metric struct {
+		Name       string     `json:"name"`
+		Type       string     `json:"type"`
+		Delta      *int64     `json:"delta,omitempty"`
+		Value      *float64   `json:"value,omitempty"`
+		Histogram  *histogram `json:"histogram,omitempty"`
+		Summary    *summary   `json:"summary,omitempty"`
+		Set        *set       `json:"set,omitempty"`
+		Timestamp  *time.Time `json:"timestamp,omitempty"`
+		ReceivedAt *time.Time `json:"received_at,omitempty"`
+		Total      *int64     `json:"total,omitempty"`
+	}
+	// seriesPayload holds the names of metrics of a series and their fields that aren't stored in block columns,
+	// values are omitted if no metric of the series has such fields.
+	seriesPayload struct {
+		Names  []string  `json:"names"`
+		Values []payload `json:"values,omitempty"`
+	}
+	// payload holds fields of a metric that aren't stored in block columns.
+	payload struct {
+		Histogram *histogram `json:"histogram,omitempty"`
+		Summary   *summary   `json:"summary,omitempty"`
+		Set       *set       `json:"set,omitempty"`
+	}
+	histogram struct {
+		Bounds []float64 `json:"bounds"`
+		Counts []uint64  `json:"counts"`
+		Sum    float64   `json:"sum"`
+		Count  uint64    `json:"count"`
+	}
+	summary struct {
+		Alpha    float64          `json:"alpha"`
+		Positive map[int32]uint64 `json:"positive,omitempty"`
+		Negative map[int32]uint64 `json:"negative,omitempty"`
+		Zero     uint64           `json:"zero,omitempty"`
+		Count    uint64           `json:"count"`
+		Sum      float64          `json:"sum"`
+		Min      float64          `json:"min"`
+		Max      float64          `json:"max"`
+	}
+	set struct {
+		Precision uint8   `json:"precision"`
+		Registers []uint8 `json:"registers"`
+	}
+)
@@ -0,0 +1,118 @@
+package dumper
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/dlomanov/mon/internal/entities"
+	"github.com/dlomanov/mon/internal/infra/storage/internal/mem"
+)
+
+// Operations of write-ahead log records.
+// Records hold resulting metrics rather than requested changes, so replaying a record twice is harmless:
+// a crash between a dump and the log reset replays records already in the snapshot.
+const (
+	opSet           = "set"
+	opDelete        = "delete"
+	opDeletePattern = "delete_pattern"
+	opEvict         = "evict"
+)
+
+// recordVersion is the version of the record format.
+const recordVersion = 1
+
+type record struct {
+	Version int      `json:"v"`
+	Op      string   `json:"op"`
+	Metrics []metric `json:"metrics,omitempty"`
+	Keys    []string `json:"keys,omitempty"`
+	Pattern string   `json:"pattern,omitempty"`
+}
+
+// LogSet appends the metrics set by an update to the write-ahead log.
+func (f *FileDumper) LogSet(metrics ...entities.Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	r := record{Op: opSet, Metrics: make([]metric, 0, len(metrics))}
+	for _, m := range metrics {
+		r.Metrics = append(r.Metrics, toModel(m))
+	}
+	return f.log(r)
+}
+
+// LogDelete appends the deletion of the keys to the write-ahead log.
+func (f *FileDumper) LogDelete(keys ...entities.MetricsKey) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	r := record{Op: opDelete, Keys: make([]string, 0, len(keys))}
+	for _, k := range keys {
+		r.Keys = append(r.Keys, k.String())
+	}
+	return f.log(r)
+}
+
+// LogDeleteByPattern appends the deletion of metrics matching the pattern to the write-ahead log.
+func (f *FileDumper) LogDeleteByPattern(pattern entities.NamePattern) error {
+	return f.log(record{Op: opDeletePattern, Pattern: string(pattern)})
+}
+
+// LogEvict appends the eviction of the metrics to the write-ahead log.
+func (f *FileDumper) LogEvict(metrics ...entities.Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	r := record{Op: opEvict, Metrics: make([]metric, 0, len(metrics))}
+	for _, m := range metrics {
+		r.Metrics = append(r.Metrics, toModel(entities.Metric{MetricsKey: m.MetricsKey, ReceivedAt: m.ReceivedAt}))
+	}
+	return f.log(r)
+}
+
+func (f *FileDumper) log(r record) error {
+	if !f.logging {
+		return nil
+	}
+	r.Version = recordVersion
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return f.wal.Append(data)
+}
+
+// replay applies the write-ahead log record to the storage.
+func replay(s mem.Storage, data []byte) error {
+	var r record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return err
+	}
+	if r.Version != recordVersion {
+		return fmt.Errorf("unsupported write-ahead log record version %d", r.Version)
+	}
+
+	switch r.Op {
+	case opSet:
+		for _, m := range r.Metrics {
+			s.Set(m.toEntity())
+		}
+	case opDelete:
+		for _, k := range r.Keys {
+			key, err := entities.NewMetricsKey(k)
+			if err != nil {
+				return err
+			}
+			s.Delete(key)
+		}
+	case opDeletePattern:
+		s.DeleteByPattern(entities.NamePattern(r.Pattern))
+	case opEvict:
+		for _, m := range r.Metrics {
+			s.Evict(m.toEntity())
+		}
+	default:
+		return fmt.Errorf("unknown write-ahead log operation %q", r.Op)
+	}
+	return nil
+}
@@ -7,18 +7,39 @@ func NewStorage() *Storage {
 	return &s
 }
 
-type Storage map[string]entities.Metric
+// Storage keeps metrics by their keys, names are used as is without any encoding.
+type Storage map[entities.MetricsKey]entities.Metric
 
 func (s *Storage) Set(metrics ...entities.Metric) {
 	for _, v := range metrics {
-		(*s)[v.String()] = v
+		(*s)[v.MetricsKey] = v
 	}
 }
 
+// Updated returns the metrics resulting from the updates without storing them, see entities.ApplyUpdate.
+// Updates of the same metric are applied one after another, so the last result of a metric is its final value.
+func (s *Storage) Updated(overflow entities.OverflowPolicy, updates ...entities.Metric) ([]entities.Metric, error) {
+	result := make([]entities.Metric, 0, len(updates))
+	updated := make(map[entities.MetricsKey]entities.Metric, len(updates))
+	for _, u := range updates {
+		stored, ok := updated[u.MetricsKey]
+		if !ok {
+			stored, ok = (*s)[u.MetricsKey]
+		}
+		m, err := entities.ApplyUpdate(stored, ok, u, overflow)
+		if err != nil {
+			return nil, err
+		}
+		updated[u.MetricsKey] = m
+		result = append(result, m)
+	}
+	return result, nil
+}
+
 func (s *Storage) Get(keys ...entities.MetricsKey) []entities.Metric {
 	result := make([]entities.Metric, 0, len(keys))
 	for _, k := range keys {
-		v, ok := (*s)[k.String()]
+		v, ok := (*s)[k]
 		if !ok {
 			continue
 		}
@@ -36,3 +57,70 @@ func (s *Storage) All() []entities.Metric {
 
 	return result
 }
+
+func (s *Storage) Delete(keys ...entities.MetricsKey) int {
+	deleted := 0
+	for _, k := range keys {
+		if _, ok := (*s)[k]; ok {
+			delete(*s, k)
+			deleted++
+		}
+	}
+
+	return deleted
+}
+
+func (s *Storage) DeleteByPattern(pattern entities.NamePattern) int {
+	return s.Delete(s.Matching(pattern)...)
+}
+
+// Matching returns the keys of metrics with names matching the pattern.
+func (s *Storage) Matching(pattern entities.NamePattern) []entities.MetricsKey {
+	result := make([]entities.MetricsKey, 0)
+	for k := range *s {
+		if pattern.Match(k.Name) {
+			result = append(result, k)
+		}
+	}
+
+	return result
+}
+
+func (s *Storage) Evict(metrics ...entities.Metric) int {
+	return s.Delete(s.Evictable(metrics...)...)
+}
+
+// Evictable returns the keys of the metrics removed by Evict,
+// that is the stored metrics not received again after the given ones.
+func (s *Storage) Evictable(metrics ...entities.Metric) []entities.MetricsKey {
+	result := make([]entities.MetricsKey, 0, len(metrics))
+	for _, m := range metrics {
+		if v, ok := (*s)[m.MetricsKey]; ok && !v.ReceivedAt.After(m.ReceivedAt) {
+			result = append(result, m.MetricsKey)
+		}
+	}
+
+	return result
+}
+
+func (s *Storage) ResetCounter(name string) bool {
+	v, ok := s.CounterReset(name)
+	if ok {
+		s.Set(v)
+	}
+
+	return ok
+}
+
+// CounterReset returns the counter with the zero value without storing it,
+// ok is false if the counter doesn't exist.
+func (s *Storage) CounterReset(name string) (counter entities.Metric, ok bool) {
+	counter, ok = (*s)[entities.MetricsKey{Name: name, Type: entities.MetricCounter}]
+	if !ok {
+		return counter, false
+	}
+	zero := int64(0)
+	counter.Delta = &zero
+
+	return counter, true
+}
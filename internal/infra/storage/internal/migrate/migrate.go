@@ -0,0 +1,310 @@
+// Package migrate applies versioned SQL migrations to PostgreSQL.
+//
+// Migrations are files named <version>_<name>.up.sql with optional <version>_<name>.down.sql reverting them.
+// Applied versions are recorded in the schema_migrations table. Every migration runs in its own transaction,
+// and the whole run holds an advisory lock, so concurrent instances apply each migration once.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+// lockKey is the advisory lock key of migration runs.
+const lockKey int64 = 0x6d6f6e5f6d6967 // "mon_mig"
+
+var (
+	ErrInvalidMigration = errors.New("invalid migration")
+	ErrIrreversible     = errors.New("migration has no down script")
+	ErrUnknownVersion   = errors.New("unknown migration version")
+)
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a schema change.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string // Down is empty if the migration can't be reverted.
+}
+
+// Load reads migrations from the root of fsys ordered by version.
+// Files not named as migrations are ignored.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		match := fileName.FindStringSubmatch(e.Name())
+		if e.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("%w: %s has invalid version", ErrInvalidMigration, e.Name())
+		}
+		content, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("%w: version %d is used by %s and %s", ErrInvalidMigration, version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("%w: %d_%s has no up script", ErrInvalidMigration, m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator applies migrations to a database.
+type Migrator struct {
+	logger     *zap.Logger
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New creates a Migrator of the migrations ordered by version.
+func New(logger *zap.Logger, db *sql.DB, migrations []Migration) *Migrator {
+	return &Migrator{
+		logger:     logger,
+		db:         db,
+		migrations: migrations,
+	}
+}
+
+// Latest returns the version of the last migration, zero if there are no migrations.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version returns the latest applied version, zero if no migrations are applied.
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	applied, err := m.applied(ctx, m.db)
+	if err != nil || len(applied) == 0 {
+		return 0, err
+	}
+	return applied[len(applied)-1], nil
+}
+
+// Pending returns the migrations not applied yet.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	applied, err := m.applied(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+	return m.pending(applied, m.Latest()), nil
+}
+
+// Up applies all pending migrations.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.Latest())
+}
+
+// Down reverts the given number of latest applied migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.run(ctx, func(conn *sql.Conn, applied []int64) error {
+		for i := len(applied) - 1; i >= 0 && steps > 0; i, steps = i-1, steps-1 {
+			if err := m.revert(ctx, conn, applied[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// To applies pending migrations up to the version and reverts applied migrations beyond it.
+func (m *Migrator) To(ctx context.Context, version int64) error {
+	if version != 0 && m.find(version) == nil {
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+	return m.run(ctx, func(conn *sql.Conn, applied []int64) error {
+		for i := len(applied) - 1; i >= 0 && applied[i] > version; i-- {
+			if err := m.revert(ctx, conn, applied[i]); err != nil {
+				return err
+			}
+		}
+		for _, migration := range m.pending(applied, version) {
+			if err := m.apply(ctx, conn, migration); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// run calls fn with a connection holding the migration lock and the versions applied before the lock was taken.
+func (m *Migrator) run(ctx context.Context, fn func(conn *sql.Conn, applied []int64) error) (err error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	// the lock belongs to the session, so it's taken and released on the same connection
+	if _, err = conn.ExecContext(ctx, `select pg_advisory_lock($1)`, lockKey); err != nil {
+		return fmt.Errorf("failed to lock migrations: %w", err)
+	}
+	defer func() {
+		_, uerr := conn.ExecContext(context.WithoutCancel(ctx), `select pg_advisory_unlock($1)`, lockKey)
+		if uerr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to unlock migrations: %w", uerr))
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, `
+create table if not exists schema_migrations (
+    "version" bigint primary key,
+    "name" text not null,
+    "applied_at" timestamptz not null default now()
+);`)
+	if err != nil {
+		return err
+	}
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return fn(conn, applied)
+}
+
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// applied returns applied versions in ascending order.
+func (m *Migrator) applied(ctx context.Context, q querier) ([]int64, error) {
+	var exists bool
+	if err := q.QueryRowContext(ctx, `select to_regclass('schema_migrations') is not null`).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	rows, err := q.QueryContext(ctx, `select "version" from schema_migrations order by "version"`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var versions []int64
+	for rows.Next() {
+		var v int64
+		if err = rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// pending returns migrations up to the version that aren't applied.
+func (m *Migrator) pending(applied []int64, version int64) []Migration {
+	done := make(map[int64]struct{}, len(applied))
+	for _, v := range applied {
+		done[v] = struct{}{}
+	}
+	var result []Migration
+	for _, migration := range m.migrations {
+		if migration.Version > version {
+			break
+		}
+		if _, ok := done[migration.Version]; !ok {
+			result = append(result, migration)
+		}
+	}
+	return result
+}
+
+func (m *Migrator) find(version int64) *Migration {
+	i := sort.Search(len(m.migrations), func(i int) bool { return m.migrations[i].Version >= version })
+	if i < len(m.migrations) && m.migrations[i].Version == version {
+		return &m.migrations[i]
+	}
+	return nil
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration) error {
+	err := inTx(ctx, conn, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx,
+			`insert into schema_migrations ("version", "name") values ($1, $2)`,
+			migration.Version, migration.Name)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+	m.logger.Info("migration applied", zap.Int64("version", migration.Version), zap.String("name", migration.Name))
+	return nil
+}
+
+func (m *Migrator) revert(ctx context.Context, conn *sql.Conn, version int64) error {
+	migration := m.find(version)
+	switch {
+	case migration == nil:
+		return fmt.Errorf("%w: applied version %d can't be reverted", ErrUnknownVersion, version)
+	case migration.Down == "":
+		return fmt.Errorf("%w: %d_%s", ErrIrreversible, migration.Version, migration.Name)
+	}
+
+	err := inTx(ctx, conn, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `delete from schema_migrations where "version" = $1`, migration.Version)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to revert migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+	m.logger.Info("migration reverted", zap.Int64("version", migration.Version), zap.String("name", migration.Name))
+	return nil
+}
+
+func inTx(ctx context.Context, conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err = fn(tx); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	return tx.Commit()
+}
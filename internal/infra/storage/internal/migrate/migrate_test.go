@@ -0,0 +1,52 @@
+package migrate_test
+
+import (
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/dlomanov/mon/internal/infra/storage/internal/migrate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestLoad(t *testing.T) {
+	file := func(data string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(data)} }
+
+	migrations, err := migrate.Load(fstest.MapFS{
+		"0010_rollups.up.sql":   file("create table rollups ();"),
+		"0002_history.up.sql":   file("create table history ();"),
+		"0002_history.down.sql": file("drop table history;"),
+		"0001_init.up.sql":      file("create table metrics ();"),
+		"0001_init.down.sql":    file("drop table metrics;"),
+		"README.md":             file("ignored"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []migrate.Migration{
+		{Version: 1, Name: "init", Up: "create table metrics ();", Down: "drop table metrics;"},
+		{Version: 2, Name: "history", Up: "create table history ();", Down: "drop table history;"},
+		{Version: 10, Name: "rollups", Up: "create table rollups ();"},
+	}, migrations)
+	assert.Equal(t, int64(10), migrate.New(zap.NewNop(), nil, migrations).Latest())
+
+	invalid := []fstest.MapFS{
+		{"0001_init.down.sql": file("drop table metrics;")},
+		{"0001_init.up.sql": file("select 1;"), "0001_other.up.sql": file("select 1;")},
+		{"0000_init.up.sql": file("select 1;")},
+	}
+	for _, fsys := range invalid {
+		_, err = migrate.Load(fsys)
+		assert.ErrorIs(t, err, migrate.ErrInvalidMigration)
+	}
+}
+
+func TestLoad_Embedded(t *testing.T) {
+	migrations, err := migrate.Load(os.DirFS("../../migrations"))
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	for i, m := range migrations {
+		assert.Equal(t, int64(i+1), m.Version, "versions should have no gaps")
+		assert.NotEmpty(t, m.Down, "%d_%s should be reversible", m.Version, m.Name)
+	}
+}
@@ -0,0 +1,89 @@
+// Package ring provides a fixed-size buffer of points ordered by time.
+package ring
+
+import (
+	"sort"
+	"time"
+
+	"github.com/dlomanov/mon/internal/entities"
+)
+
+// Buffer keeps the latest points ordered by time, the oldest point is dropped when the buffer is full.
+type Buffer struct {
+	points []entities.Point
+	start  int
+	size   int
+}
+
+func NewBuffer(capacity int) *Buffer {
+	return &Buffer{points: make([]entities.Point, capacity)}
+}
+
+// Add inserts the point keeping the order by time, a point with the same time is replaced.
+// A point older than every point of a full buffer is dropped.
+func (b *Buffer) Add(p entities.Point) {
+	if len(b.points) == 0 {
+		return
+	}
+	i := b.search(p.Time)
+	if i < b.size && b.at(i).Time.Equal(p.Time) {
+		b.at(i).Value = p.Value
+		return
+	}
+	if b.size == len(b.points) {
+		if i == 0 {
+			return
+		}
+		b.start = (b.start + 1) % len(b.points)
+		b.size--
+		i--
+	}
+	b.size++
+	for j := b.size - 1; j > i; j-- {
+		*b.at(j) = *b.at(j - 1)
+	}
+	*b.at(i) = p
+}
+
+// Between returns points between from and to inclusively.
+func (b *Buffer) Between(from, to time.Time) []entities.Point {
+	result := make([]entities.Point, 0)
+	for i := b.search(from); i < b.size && !b.at(i).Time.After(to); i++ {
+		result = append(result, *b.at(i))
+	}
+	return result
+}
+
+// Points returns all points of the buffer.
+func (b *Buffer) Points() []entities.Point {
+	result := make([]entities.Point, 0, b.size)
+	for i := 0; i < b.size; i++ {
+		result = append(result, *b.at(i))
+	}
+	return result
+}
+
+// DropBefore removes points before t and returns the number of removed points.
+func (b *Buffer) DropBefore(t time.Time) int {
+	n := b.search(t)
+	if n == 0 {
+		return 0
+	}
+	b.start = (b.start + n) % len(b.points)
+	b.size -= n
+	return n
+}
+
+// Len returns the number of points in the buffer.
+func (b *Buffer) Len() int {
+	return b.size
+}
+
+// search returns the index of the first point not before t.
+func (b *Buffer) search(t time.Time) int {
+	return sort.Search(b.size, func(i int) bool { return !b.at(i).Time.Before(t) })
+}
+
+func (b *Buffer) at(i int) *entities.Point {
+	return &b.points[(b.start+i)%len(b.points)]
+}
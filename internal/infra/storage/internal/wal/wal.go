@@ -0,0 +1,157 @@
+// Package wal implements an append-only write-ahead log of checksummed records.
+//
+// A record is framed as:
+//
+//	length uint32 | crc32c uint32 | payload [length]byte
+//
+// Integers are little-endian and the checksum covers the payload.
+// A record is synced to disk before Append returns, so an acknowledged record survives a crash.
+// A crash during an append leaves a torn record at the end of the log, it's discarded on Replay.
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/dlomanov/mon/internal/infra/storage/internal/atomicfile"
+)
+
+const (
+	headerSize = 8
+	// MaxRecordSize limits the record payload, a larger length in the log is treated as corruption.
+	MaxRecordSize = 64 << 20
+)
+
+var (
+	ErrRecordTooLarge = errors.New("wal record is too large")
+	castagnoli        = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// Log is a write-ahead log file.
+type Log struct {
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Open opens the log at the path, creating it if it doesn't exist.
+func Open(path string) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o666)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err == nil {
+		// the log may be just created
+		err = atomicfile.SyncDir(filepath.Dir(path))
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return &Log{file: file, size: info.Size()}, nil
+}
+
+// Append writes the records to the end of the log and syncs the file.
+func (l *Log) Append(records ...[]byte) error {
+	size := 0
+	for _, r := range records {
+		if len(r) > MaxRecordSize {
+			return fmt.Errorf("%w: %d bytes", ErrRecordTooLarge, len(r))
+		}
+		size += headerSize + len(r)
+	}
+	buf := make([]byte, 0, size)
+	for _, r := range records {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(r)))
+		buf = binary.LittleEndian.AppendUint32(buf, crc32.Checksum(r, castagnoli))
+		buf = append(buf, r...)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := l.file.WriteAt(buf, l.size); err != nil {
+		// the partial write is overwritten by the next append
+		return err
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	l.size += int64(len(buf))
+	return nil
+}
+
+// Replay calls fn for every record of the log in order.
+// Reading stops at the first torn or corrupted record, the log is truncated there,
+// so the following appends aren't hidden behind it. Returns the number of replayed records.
+func (l *Log) Replay(fn func(record []byte) error) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	r := bufio.NewReader(io.NewSectionReader(l.file, 0, l.size))
+	var offset int64
+	count := 0
+	header := make([]byte, headerSize)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return count, nil
+			}
+			return count, l.truncate(offset)
+		}
+		length := binary.LittleEndian.Uint32(header)
+		if length > MaxRecordSize {
+			return count, l.truncate(offset)
+		}
+		record := make([]byte, length)
+		if _, err := io.ReadFull(r, record); err != nil {
+			return count, l.truncate(offset)
+		}
+		if crc32.Checksum(record, castagnoli) != binary.LittleEndian.Uint32(header[4:]) {
+			return count, l.truncate(offset)
+		}
+		if err := fn(record); err != nil {
+			return count, err
+		}
+		offset += headerSize + int64(length)
+		count++
+	}
+}
+
+// Size returns the size of the log in bytes.
+func (l *Log) Size() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.size
+}
+
+// Reset discards every record, it's called once the records are persisted elsewhere.
+func (l *Log) Reset() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.truncate(0)
+}
+
+// Close closes the log file.
+func (l *Log) Close() error {
+	return l.file.Close()
+}
+
+func (l *Log) truncate(size int64) error {
+	if err := l.file.Truncate(size); err != nil {
+		return err
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	l.size = size
+	return nil
+}
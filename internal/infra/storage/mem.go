@@ -67,3 +67,68 @@ func (m *MemStorage) Set(_ context.Context, metrics ...entities.Metric) error {
 	m.internal.Set(metrics...)
 	return nil
 }
+
+// Update applies the updates under the lock and returns the resulting metrics.
+// Nothing is stored if any update fails.
+func (m *MemStorage) Update(
+	_ context.Context,
+	overflow entities.OverflowPolicy,
+	updates ...entities.Metric,
+) ([]entities.Metric, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result, err := m.internal.Updated(overflow, updates...)
+	if err != nil {
+		return nil, err
+	}
+	m.internal.Set(result...)
+	return result, nil
+}
+
+// Delete removes metrics by keys from the MemStorage.
+// Returns the number of removed metrics.
+func (m *MemStorage) Delete(_ context.Context, keys ...entities.MetricsKey) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.internal.Delete(keys...), nil
+}
+
+// DeleteByPattern removes metrics with names matching the pattern from the MemStorage.
+// Returns the number of removed metrics.
+func (m *MemStorage) DeleteByPattern(_ context.Context, pattern entities.NamePattern) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.internal.DeleteByPattern(pattern), nil
+}
+
+// Evict removes the metrics from the MemStorage unless they were received again.
+// Returns the number of removed metrics.
+func (m *MemStorage) Evict(_ context.Context, metrics ...entities.Metric) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.internal.Evict(metrics...), nil
+}
+
+// ResetCounter sets the counter value to zero.
+// Returns false if the counter doesn't exist.
+func (m *MemStorage) ResetCounter(_ context.Context, name string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.internal.ResetCounter(name), nil
+}
+
+// Replace replaces all metrics of the MemStorage with the given ones.
+func (m *MemStorage) Replace(_ context.Context, metrics ...entities.Metric) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := make(mem.Storage, len(metrics))
+	s.Set(metrics...)
+	m.internal = &s
+	return nil
+}
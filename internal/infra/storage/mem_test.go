@@ -3,9 +3,13 @@ package storage_test
 import (
 	"context"
 	"github.com/dlomanov/mon/internal/infra/storage"
+	"math"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/dlomanov/mon/internal/entities"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -38,4 +42,141 @@ func TestMemStorage(t *testing.T) {
 	require.NoError(t, err)
 	require.Len(t, allMetrics, 1)
 	require.Equal(t, metric, allMetrics[0])
+
+	// Test ResetCounter
+	delta := int64(5)
+	counter := entities.Metric{
+		MetricsKey: entities.MetricsKey{Type: entities.MetricCounter, Name: "host-1.requests"},
+		Delta:      &delta,
+	}
+	require.NoError(t, stg.Set(ctx, counter))
+	ok, err = stg.ResetCounter(ctx, "host-1.requests")
+	require.NoError(t, err)
+	require.True(t, ok)
+	retrievedMetric, _, err = stg.Get(ctx, counter.MetricsKey)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), *retrievedMetric.Delta)
+	ok, err = stg.ResetCounter(ctx, "unknown")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// Test DeleteByPattern
+	deleted, err := stg.DeleteByPattern(ctx, "host-1.*")
+	require.NoError(t, err)
+	require.Equal(t, 1, deleted)
+
+	// Test Delete
+	deleted, err = stg.Delete(ctx, key, counter.MetricsKey)
+	require.NoError(t, err)
+	require.Equal(t, 1, deleted)
+	allMetrics, err = stg.All(ctx)
+	require.NoError(t, err)
+	require.Empty(t, allMetrics)
+}
+
+func TestMemStorage_Evict(t *testing.T) {
+	ctx := context.Background()
+	stg := storage.NewMemStorage()
+
+	receivedAt := time.Now()
+	value := 0.5
+	metric := entities.Metric{
+		MetricsKey: entities.MetricsKey{Type: entities.MetricGauge, Name: "FreeMemory"},
+		Value:      &value,
+		ReceivedAt: receivedAt,
+	}
+	require.NoError(t, stg.Set(ctx, metric))
+
+	// the metric received again after it was read isn't evicted
+	updated := metric
+	updated.ReceivedAt = receivedAt.Add(time.Second)
+	require.NoError(t, stg.Set(ctx, updated))
+	evicted, err := stg.Evict(ctx, metric)
+	require.NoError(t, err)
+	require.Equal(t, 0, evicted)
+
+	evicted, err = stg.Evict(ctx, updated)
+	require.NoError(t, err)
+	require.Equal(t, 1, evicted)
+	_, ok, err := stg.Get(ctx, metric.MetricsKey)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestMemStorage_Update(t *testing.T) {
+	testUpdate(t, storage.NewMemStorage())
+}
+
+type updater interface {
+	Update(ctx context.Context, overflow entities.OverflowPolicy, updates ...entities.Metric) ([]entities.Metric, error)
+	Get(ctx context.Context, key entities.MetricsKey) (entities.Metric, bool, error)
+}
+
+// testUpdate checks that concurrent counter increments aren't lost and a failed batch changes nothing.
+func testUpdate(t *testing.T, s updater) {
+	t.Helper()
+	ctx := context.Background()
+	key := entities.MetricsKey{Type: entities.MetricCounter, Name: "requests"}
+	counter := func(delta int64) entities.Metric {
+		return entities.Metric{MetricsKey: key, Delta: &delta}
+	}
+	gauge := func(name string, v float64, sec int) entities.Metric {
+		return entities.Metric{
+			MetricsKey: entities.MetricsKey{Type: entities.MetricGauge, Name: name},
+			Value:      &v,
+			Timestamp:  time.Unix(int64(sec), 0),
+		}
+	}
+
+	const workers, increments = 8, 50
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < increments; j++ {
+				_, err := s.Update(ctx, entities.OverflowError, counter(1))
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	got, ok, err := s.Get(ctx, key)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, int64(workers*increments), *got.Delta)
+
+	// updates of the same metric in a batch are applied one after another
+	result, err := s.Update(ctx, entities.OverflowError, counter(1), gauge("cpu", 2, 2), counter(2), gauge("cpu", 1, 1))
+	require.NoError(t, err)
+	require.Len(t, result, 4)
+	require.Equal(t, int64(workers*increments+3), *result[2].Delta)
+	require.Equal(t, 2.0, *result[3].Value, "stale gauge shouldn't replace the newer one")
+
+	_, err = s.Update(ctx, entities.OverflowError, gauge("mem", 1, 1), counter(math.MaxInt64))
+	require.ErrorIs(t, err, entities.ErrCounterOverflow)
+	_, ok, err = s.Get(ctx, gauge("mem", 0, 0).MetricsKey)
+	require.NoError(t, err)
+	require.False(t, ok, "failed batch shouldn't be stored")
+	got, _, err = s.Get(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, int64(workers*increments+3), *got.Delta, "failed batch shouldn't be stored")
+
+	h1, err := entities.NewHistogram([]float64{1})
+	require.NoError(t, err)
+	h2, err := entities.NewHistogram([]float64{2})
+	require.NoError(t, err)
+	hkey := entities.MetricsKey{Type: entities.MetricHistogram, Name: "latency"}
+	_, err = s.Update(ctx, entities.OverflowError, entities.Metric{MetricsKey: hkey, Histogram: h1})
+	require.NoError(t, err)
+	_, err = s.Update(ctx, entities.OverflowError, counter(1), entities.Metric{MetricsKey: hkey, Histogram: h2})
+	require.ErrorIs(t, err, entities.ErrMergeConflict)
+	got, _, err = s.Get(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, int64(workers*increments+3), *got.Delta, "failed batch shouldn't be stored")
+
+	result, err = s.Update(ctx, entities.OverflowClamp, counter(math.MaxInt64))
+	require.NoError(t, err)
+	require.Equal(t, int64(math.MaxInt64), *result[0].Delta)
 }
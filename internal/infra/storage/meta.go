@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/dlomanov/mon/internal/apps/server/usecases"
+	"github.com/dlomanov/mon/internal/entities"
+	"github.com/dlomanov/mon/internal/infra/storage/internal/atomicfile"
+	"go.uber.org/zap"
+)
+
+var _ usecases.MetaStorage = (*MetaStorage)(nil)
+
+// MetaStorage is an in-memory storage of metric metadata.
+// If a file path is set, metadata is loaded from the file on creation
+// and the file is rewritten on every change, as metadata changes rarely.
+type MetaStorage struct {
+	mu       sync.RWMutex
+	logger   *zap.Logger
+	filePath string
+	internal map[string]entities.Metadata
+}
+
+// NewMetaStorage creates a new MetaStorage persisted to filePath, or kept in memory only if filePath is empty.
+// Returns an error if the existing file can't be loaded.
+func NewMetaStorage(logger *zap.Logger, filePath string) (*MetaStorage, error) {
+	ms := &MetaStorage{
+		logger:   logger,
+		filePath: filePath,
+		internal: make(map[string]entities.Metadata),
+	}
+	if err := ms.load(); err != nil {
+		return nil, err
+	}
+	return ms, nil
+}
+
+// SetMeta creates or replaces metadata of a metric name.
+func (ms *MetaStorage) SetMeta(_ context.Context, meta entities.Metadata) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.internal[meta.Name] = meta
+	return ms.dump()
+}
+
+// GetMeta returns metadata of the registered names.
+func (ms *MetaStorage) GetMeta(_ context.Context, names ...string) ([]entities.Metadata, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	result := make([]entities.Metadata, 0, len(names))
+	for _, name := range names {
+		if meta, ok := ms.internal[name]; ok {
+			result = append(result, meta)
+		}
+	}
+	return result, nil
+}
+
+// AllMeta returns all registered metadata ordered by name.
+func (ms *MetaStorage) AllMeta(_ context.Context) ([]entities.Metadata, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return ms.all(), nil
+}
+
+// ReplaceMeta replaces all metadata with the given ones, the previous metadata is kept if the dump fails.
+func (ms *MetaStorage) ReplaceMeta(_ context.Context, metas ...entities.Metadata) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	previous := ms.internal
+	ms.internal = make(map[string]entities.Metadata, len(metas))
+	for _, meta := range metas {
+		ms.internal[meta.Name] = meta
+	}
+	if err := ms.dump(); err != nil {
+		ms.internal = previous
+		return err
+	}
+	return nil
+}
+
+func (ms *MetaStorage) all() []entities.Metadata {
+	result := make([]entities.Metadata, 0, len(ms.internal))
+	for _, meta := range ms.internal {
+		result = append(result, meta)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+func (ms *MetaStorage) load() error {
+	if ms.filePath == "" {
+		return nil
+	}
+	content, err := os.ReadFile(ms.filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		ms.logger.Debug("metadata file doesn't exist", zap.String("path", ms.filePath))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var metas []metadata
+	if err = json.Unmarshal(content, &metas); err != nil {
+		return err
+	}
+	for _, v := range metas {
+		ms.internal[v.Name] = v.toEntity()
+	}
+	ms.logger.Debug("metadata loaded", zap.Int("count", len(metas)))
+	return nil
+}
+
+// dump rewrites the file atomically. Must be called with the lock held.
+func (ms *MetaStorage) dump() error {
+	if ms.filePath == "" {
+		return nil
+	}
+
+	metas := make([]metadata, 0, len(ms.internal))
+	for _, v := range ms.all() {
+		metas = append(metas, toMetadata(v))
+	}
+	content, err := json.MarshalIndent(metas, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.Write(ms.filePath, func(w io.Writer) error {
+		_, err := w.Write(content)
+		return err
+	})
+}
+
+type metadata struct {
+	Name        string `json:"name" db:"name"`
+	Type        string `json:"type,omitempty" db:"type"`
+	Unit        string `json:"unit,omitempty" db:"unit"`
+	Description string `json:"description,omitempty" db:"description"`
+	Owner       string `json:"owner,omitempty" db:"owner"`
+}
+
+func toMetadata(meta entities.Metadata) metadata {
+	return metadata{
+		Name:        meta.Name,
+		Type:        string(meta.Type),
+		Unit:        meta.Unit,
+		Description: meta.Description,
+		Owner:       meta.Owner,
+	}
+}
+
+func (m metadata) toEntity() entities.Metadata {
+	mtype, _ := entities.ParseMetricType(m.Type)
+	return entities.Metadata{
+		Name:        m.Name,
+		Type:        mtype,
+		Unit:        m.Unit,
+		Description: m.Description,
+		Owner:       m.Owner,
+	}
+}
@@ -0,0 +1,37 @@
+package storage_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/dlomanov/mon/internal/entities"
+	"github.com/dlomanov/mon/internal/infra/storage"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestMetaStorage(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	path := filepath.Join(t.TempDir(), "metrics.json.meta")
+	ctx := context.Background()
+
+	ms, err := storage.NewMetaStorage(logger, path)
+	require.NoError(t, err)
+
+	alloc := entities.Metadata{Name: "Alloc", Type: entities.MetricGauge, Unit: "bytes", Owner: "runtime"}
+	pollCount := entities.Metadata{Name: "PollCount", Type: entities.MetricCounter}
+	require.NoError(t, ms.SetMeta(ctx, pollCount))
+	require.NoError(t, ms.SetMeta(ctx, alloc))
+
+	metas, err := ms.GetMeta(ctx, "Alloc", "Unknown")
+	require.NoError(t, err)
+	require.Equal(t, []entities.Metadata{alloc}, metas)
+
+	// metadata is restored from the file
+	restored, err := storage.NewMetaStorage(logger, path)
+	require.NoError(t, err)
+	metas, err = restored.AllMeta(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []entities.Metadata{alloc, pollCount}, metas)
+}
@@ -0,0 +1,7 @@
+create table if not exists metrics (
+    "name" text not null,
+    "type" text not null,
+    "delta" bigint,
+    "value" double precision,
+    primary key ("name", "type")
+);
@@ -0,0 +1,6 @@
+alter table metrics drop column if exists "total";
+alter table metrics drop column if exists "received_at";
+alter table metrics drop column if exists "updated_at";
+alter table metrics drop column if exists "set";
+alter table metrics drop column if exists "summary";
+alter table metrics drop column if exists "histogram";
@@ -0,0 +1,6 @@
+alter table metrics add column if not exists "histogram" jsonb;
+alter table metrics add column if not exists "summary" jsonb;
+alter table metrics add column if not exists "set" bytea;
+alter table metrics add column if not exists "updated_at" timestamptz;
+alter table metrics add column if not exists "received_at" timestamptz default now();
+alter table metrics add column if not exists "total" bigint;
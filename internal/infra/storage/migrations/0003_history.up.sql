@@ -0,0 +1,8 @@
+create table if not exists history (
+    "name" text not null,
+    "type" text not null,
+    "time" timestamptz not null,
+    "value" double precision not null,
+    primary key ("name", "type", "time")
+);
+create index if not exists history_time_idx on history ("time");
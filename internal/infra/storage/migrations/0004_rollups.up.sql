@@ -0,0 +1,12 @@
+create table if not exists rollups (
+    "name" text not null,
+    "type" text not null,
+    "resolution" bigint not null,
+    "time" timestamptz not null,
+    "min" double precision not null,
+    "max" double precision not null,
+    "sum" double precision not null,
+    "last" double precision not null,
+    "count" bigint not null,
+    primary key ("name", "type", "resolution", "time")
+);
@@ -0,0 +1,7 @@
+create table if not exists metadata (
+    "name" text primary key,
+    "type" text not null default '',
+    "unit" text not null default '',
+    "description" text not null default '',
+    "owner" text not null default ''
+);
@@ -3,41 +3,75 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/dlomanov/mon/internal/apps/server/usecases"
 	"github.com/dlomanov/mon/internal/entities/apperrors"
+	"math/bits"
+	"strings"
+	"time"
 
 	"github.com/dlomanov/mon/internal/entities"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jmoiron/sqlx"
 	"go.uber.org/zap"
 )
 
-var _ usecases.Storage = (*PGStorage)(nil)
+var (
+	_ usecases.Storage        = (*PGStorage)(nil)
+	_ usecases.MetaStorage    = (*PGStorage)(nil)
+	_ usecases.HistoryStorage = (*PGStorage)(nil)
+	_ usecases.BackupStorage  = (*PGStorage)(nil)
+)
+
+// codeNumericValueOutOfRange is the SQLSTATE of an integer overflow.
+const codeNumericValueOutOfRange = "22003"
 
 // PGStorage is a storage system that uses a PostgreSQL database for persistence.
 // It provides methods for storing, retrieving, and managing metrics.
 type PGStorage struct {
 	logger      *zap.Logger
 	db          *sqlx.DB
-	migrationUp bool
+	retryPolicy pgRetry
+}
+
+// PGOption configures the PGStorage.
+type PGOption func(*pgOptions)
+
+type pgOptions struct {
+	skipMigration bool
+}
+
+// SkipMigration makes the PGStorage check that the schema is up-to-date instead of migrating it,
+// so migrations are run separately, e.g. by the "migrate" command.
+func SkipMigration() PGOption {
+	return func(o *pgOptions) {
+		o.skipMigration = true
+	}
 }
 
 // NewPGStorage creates a new PGStorage instance with the given logger and database connection.
-// It initializes the storage with data from the database if the migration is up.
+// It applies pending schema migrations unless SkipMigration is given.
+// Operations failed with transient errors, e.g. connection failures or deadlocks, are retried with backoff.
 // Returns an error if the storage cannot be initialized.
 func NewPGStorage(
 	ctx context.Context,
 	logger *zap.Logger,
 	db *sqlx.DB,
+	opts ...PGOption,
 ) (*PGStorage, error) {
+	o := pgOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
 	ps := &PGStorage{
 		logger:      logger,
 		db:          db,
-		migrationUp: false,
+		retryPolicy: defaultPGRetry(),
 	}
 
-	err := ps.migrate(ctx)
+	err := ps.migrate(ctx, o.skipMigration)
 	return ps, err
 }
 
@@ -46,16 +80,27 @@ func NewPGStorage(
 func (ps *PGStorage) Get(
 	ctx context.Context,
 	key entities.MetricsKey,
+) (result entities.Metric, ok bool, err error) {
+	err = ps.retry(ctx, func() (err error) {
+		result, ok, err = ps.getOnce(ctx, key)
+		return err
+	})
+	return result, ok, err
+}
+
+func (ps *PGStorage) getOnce(
+	ctx context.Context,
+	key entities.MetricsKey,
 ) (result entities.Metric, ok bool, err error) {
 	m := metric{}
 
-	const query = `select "name", "type", "delta", "value" from metrics where "name"= $1 and "type" = $2`
+	const query = `select "name", "type", "delta", "value", "histogram", "summary", "set", "updated_at", "received_at", "total" from metrics where "name"= $1 and "type" = $2`
 	row := ps.db.DB.QueryRowContext(ctx, query, key.Name, string(key.Type))
 	if rerr := row.Err(); rerr != nil {
 		return result, false, rerr
 	}
 
-	err = row.Scan(&m.Name, &m.Type, &m.Delta, &m.Value)
+	err = row.Scan(&m.Name, &m.Type, &m.Delta, &m.Value, &m.Histogram, &m.Summary, &m.Set, &m.UpdatedAt, &m.ReceivedAt, &m.Total)
 	switch {
 	case errors.Is(err, sql.ErrNoRows):
 		return result, false, nil
@@ -73,10 +118,14 @@ func (ps *PGStorage) Get(
 
 // All retrieves all metrics stored in the PGStorage.
 // Returns a slice of metrics or an error if the operation fails.
-func (ps *PGStorage) All(ctx context.Context) (result []entities.Metric, err error) {
+func (ps *PGStorage) All(ctx context.Context) ([]entities.Metric, error) {
+	return retryValue(ctx, ps, func() ([]entities.Metric, error) { return ps.allOnce(ctx) })
+}
+
+func (ps *PGStorage) allOnce(ctx context.Context) (result []entities.Metric, err error) {
 	var metrics []metric
 
-	err = ps.db.SelectContext(ctx, &metrics, `select "name", "type", "delta", "value" from metrics`)
+	err = ps.db.SelectContext(ctx, &metrics, `select "name", "type", "delta", "value", "histogram", "summary", "set", "updated_at", "received_at", "total" from metrics`)
 	if errors.Is(err, sql.ErrNoRows) {
 		return result, nil
 	}
@@ -101,6 +150,10 @@ func (ps *PGStorage) All(ctx context.Context) (result []entities.Metric, err err
 // Set sets one or more metrics in the PGStorage.
 // Returns an error if the operation fails.
 func (ps *PGStorage) Set(ctx context.Context, metrics ...entities.Metric) error {
+	return ps.retry(ctx, func() error { return ps.setOnce(ctx, metrics...) })
+}
+
+func (ps *PGStorage) setOnce(ctx context.Context, metrics ...entities.Metric) error {
 	if len(metrics) == 0 {
 		return nil
 	}
@@ -109,52 +162,616 @@ func (ps *PGStorage) Set(ctx context.Context, metrics ...entities.Metric) error
 	if err != nil {
 		return err
 	}
+	if err = ps.set(ctx, tx, metrics); err != nil {
+		return errors.Join(tx.Rollback(), err)
+	}
+	if err = tx.Commit(); err != nil {
+		ps.logger.Error("metric upsert commit failed", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
 
+// set upserts the metrics within the transaction.
+func (ps *PGStorage) set(ctx context.Context, tx *sql.Tx, metrics []entities.Metric) error {
 	stmt, err := tx.PrepareContext(ctx, `
-		insert into metrics ("name", "type", "delta", "value") values ($1, $2, $3, $4)
+		insert into metrics ("name", "type", "delta", "value", "histogram", "summary", "set", "updated_at", "received_at", "total") values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 		on conflict ("name", "type")
 		    do update
 		    	set "delta" = excluded."delta",
-		    	    "value" = excluded."value";`)
+		    	    "value" = excluded."value",
+		    	    "histogram" = excluded."histogram",
+		    	    "summary" = excluded."summary",
+		    	    "set" = excluded."set",
+		    	    "updated_at" = excluded."updated_at",
+		    	    "received_at" = excluded."received_at",
+		    	    "total" = excluded."total";`)
 	if err != nil {
 		ps.logger.Error("metric upsert query preparing failed", zap.Error(err))
-		return errors.Join(tx.Rollback(), err)
+		return err
 	}
 	defer func(stmt *sql.Stmt) { _ = stmt.Close() }(stmt)
 
 	for _, v := range metrics {
-		_, err = stmt.ExecContext(ctx, v.Name, string(v.Type), v.Delta, v.Value)
+		var h, s, set []byte
+		if h, err = marshalHistogram(v.Histogram); err != nil {
+			return err
+		}
+		if s, err = marshalSummary(v.Summary); err != nil {
+			return err
+		}
+		if v.Set != nil {
+			set = v.Set.Registers
+		}
+		updatedAt := sql.NullTime{Time: v.Timestamp, Valid: !v.Timestamp.IsZero()}
+		receivedAt := sql.NullTime{Time: v.ReceivedAt, Valid: !v.ReceivedAt.IsZero()}
+		_, err = stmt.ExecContext(ctx, v.Name, string(v.Type), v.Delta, v.Value, h, s, set, updatedAt, receivedAt, v.Total)
 		if err != nil {
 			ps.logger.Error("metric upsert failed", zap.Error(err))
-			return errors.Join(tx.Rollback(), err)
+			return err
 		}
 	}
+	return nil
+}
+
+// Update applies the updates in a single transaction and returns the resulting metrics,
+// so either all updates are stored or none.
+// Counter increases are added by the database itself, so concurrent updates aren't lost.
+// Other updates depending on the stored metric lock it for the transaction.
+func (ps *PGStorage) Update(
+	ctx context.Context,
+	overflow entities.OverflowPolicy,
+	updates ...entities.Metric,
+) ([]entities.Metric, error) {
+	return retryValue(ctx, ps, func() ([]entities.Metric, error) { return ps.updateOnce(ctx, overflow, updates...) })
+}
+
+func (ps *PGStorage) updateOnce(
+	ctx context.Context,
+	overflow entities.OverflowPolicy,
+	updates ...entities.Metric,
+) ([]entities.Metric, error) {
+	if len(updates) == 0 {
+		return nil, nil
+	}
 
+	tx, err := ps.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]entities.Metric, 0, len(updates))
+	for _, u := range updates {
+		var m entities.Metric
+		switch {
+		case u.Type == entities.MetricGauge && u.Timestamp.IsZero():
+			m, err = u, ps.set(ctx, tx, []entities.Metric{u})
+		case u.Type == entities.MetricCounter && u.Total == nil:
+			m, err = ps.addDelta(ctx, tx, overflow, u)
+		default:
+			m, err = ps.updateLocked(ctx, tx, overflow, u)
+		}
+		if err != nil {
+			return nil, errors.Join(tx.Rollback(), err)
+		}
+		result = append(result, m)
+	}
+	// counters would be incremented twice if a committed update were retried
 	if err = tx.Commit(); err != nil {
-		ps.logger.Error("metric upsert commit failed", zap.Error(err))
-		return err
+		ps.logger.Error("metric update commit failed", zap.Error(err))
+		return nil, &commitError{err: err}
 	}
+	return result, nil
+}
 
-	return nil
+// addDelta adds the increase to the stored counter by an upsert.
+func (ps *PGStorage) addDelta(
+	ctx context.Context,
+	tx *sql.Tx,
+	policy entities.OverflowPolicy,
+	counter entities.Metric,
+) (entities.Metric, error) {
+	sum := `coalesce(metrics."delta", 0) + excluded."delta"`
+	if policy != entities.OverflowError {
+		// numeric doesn't overflow, so the sum is clamped to the bigint range before the cast
+		sum = `least(greatest(coalesce(metrics."delta", 0)::numeric + excluded."delta", -9223372036854775808), 9223372036854775807)::bigint`
+	}
+	query := `
+		insert into metrics ("name", "type", "delta", "updated_at", "received_at") values ($1, $2, $3, $4, $5)
+		on conflict ("name", "type")
+		    do update
+		    	set "delta" = ` + sum + `,
+		    	    "updated_at" = greatest(metrics."updated_at", excluded."updated_at"),
+		    	    "received_at" = excluded."received_at"
+		returning "name", "type", "delta", "value", "histogram", "summary", "set", "updated_at", "received_at", "total";`
+
+	updatedAt := sql.NullTime{Time: counter.Timestamp, Valid: !counter.Timestamp.IsZero()}
+	receivedAt := sql.NullTime{Time: counter.ReceivedAt, Valid: !counter.ReceivedAt.IsZero()}
+	row := tx.QueryRowContext(ctx, query, counter.Name, string(counter.Type), counter.Delta, updatedAt, receivedAt)
+	m := metric{}
+	err := row.Scan(&m.Name, &m.Type, &m.Delta, &m.Value, &m.Histogram, &m.Summary, &m.Set, &m.UpdatedAt, &m.ReceivedAt, &m.Total)
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.As(err, &pgErr) && pgErr.Code == codeNumericValueOutOfRange:
+		return counter, fmt.Errorf("%w: %s + %d", entities.ErrCounterOverflow, counter.Name, *counter.Delta)
+	case err != nil:
+		ps.logger.Error("counter increment failed", zap.Error(err))
+		return counter, err
+	}
+	return m.toEntity()
 }
 
-func (ps *PGStorage) migrate(ctx context.Context) error {
-	if ps.migrationUp {
-		ps.logger.Debug("already migrated")
+// updateLocked applies the update to the stored metric locked for the transaction.
+func (ps *PGStorage) updateLocked(
+	ctx context.Context,
+	tx *sql.Tx,
+	overflow entities.OverflowPolicy,
+	update entities.Metric,
+) (entities.Metric, error) {
+	// an empty row is inserted first, so a new metric is locked as well as a stored one
+	_, err := tx.ExecContext(ctx,
+		`insert into metrics ("name", "type") values ($1, $2) on conflict ("name", "type") do nothing`,
+		update.Name, string(update.Type))
+	if err != nil {
+		return update, err
+	}
+
+	const query = `select "name", "type", "delta", "value", "histogram", "summary", "set", "updated_at", "received_at", "total" from metrics where "name"= $1 and "type" = $2 for update`
+	m := metric{}
+	err = tx.QueryRowContext(ctx, query, update.Name, string(update.Type)).
+		Scan(&m.Name, &m.Type, &m.Delta, &m.Value, &m.Histogram, &m.Summary, &m.Set, &m.UpdatedAt, &m.ReceivedAt, &m.Total)
+	if err != nil {
+		return update, err
+	}
+	stored, err := m.toEntity()
+	if err != nil {
+		return update, err
+	}
+
+	result, err := entities.ApplyUpdate(stored, !m.empty(), update, overflow)
+	if err != nil {
+		return update, err
+	}
+	return result, ps.set(ctx, tx, []entities.Metric{result})
+}
+
+// Delete removes metrics by keys from the PGStorage.
+// Returns the number of removed metrics or an error if the operation fails.
+func (ps *PGStorage) Delete(ctx context.Context, keys ...entities.MetricsKey) (int, error) {
+	return retryValue(ctx, ps, func() (int, error) { return ps.deleteOnce(ctx, keys...) })
+}
+
+func (ps *PGStorage) deleteOnce(ctx context.Context, keys ...entities.MetricsKey) (int, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	names := make([]string, 0, len(keys))
+	types := make([]string, 0, len(keys))
+	for _, k := range keys {
+		names = append(names, k.Name)
+		types = append(types, string(k.Type))
+	}
+	res, err := ps.db.ExecContext(ctx, `
+		delete from metrics
+		where ("name", "type") in (select * from unnest($1::text[], $2::text[]))`, names, types)
+	if err != nil {
+		ps.logger.Error("metric delete failed", zap.Error(err))
+		return 0, err
+	}
+	deleted, err := res.RowsAffected()
+	return int(deleted), err
+}
+
+// DeleteByPattern removes metrics with names matching the pattern from the PGStorage.
+// Returns the number of removed metrics or an error if the operation fails.
+func (ps *PGStorage) DeleteByPattern(ctx context.Context, pattern entities.NamePattern) (int, error) {
+	return retryValue(ctx, ps, func() (int, error) { return ps.deleteByPatternOnce(ctx, pattern) })
+}
+
+func (ps *PGStorage) deleteByPatternOnce(ctx context.Context, pattern entities.NamePattern) (int, error) {
+	res, err := ps.db.ExecContext(ctx, `delete from metrics where "name" like $1 escape '\'`, likePattern(pattern))
+	if err != nil {
+		ps.logger.Error("metric delete by pattern failed", zap.Error(err))
+		return 0, err
+	}
+	deleted, err := res.RowsAffected()
+	return int(deleted), err
+}
+
+// Evict removes the metrics from the PGStorage unless they were received again.
+// Returns the number of removed metrics or an error if the operation fails.
+func (ps *PGStorage) Evict(ctx context.Context, metrics ...entities.Metric) (int, error) {
+	return retryValue(ctx, ps, func() (int, error) { return ps.evictOnce(ctx, metrics...) })
+}
+
+func (ps *PGStorage) evictOnce(ctx context.Context, metrics ...entities.Metric) (int, error) {
+	if len(metrics) == 0 {
+		return 0, nil
+	}
+
+	names := make([]string, 0, len(metrics))
+	types := make([]string, 0, len(metrics))
+	receivedAt := make([]time.Time, 0, len(metrics))
+	for _, m := range metrics {
+		names = append(names, m.Name)
+		types = append(types, string(m.Type))
+		receivedAt = append(receivedAt, m.ReceivedAt)
+	}
+	res, err := ps.db.ExecContext(ctx, `
+		delete from metrics m
+		using unnest($1::text[], $2::text[], $3::timestamptz[]) as e("name", "type", "received_at")
+		where m."name" = e."name" and m."type" = e."type" and m."received_at" <= e."received_at"`,
+		names, types, receivedAt)
+	if err != nil {
+		ps.logger.Error("metric eviction failed", zap.Error(err))
+		return 0, err
+	}
+	evicted, err := res.RowsAffected()
+	return int(evicted), err
+}
+
+// ResetCounter sets the counter value to zero.
+// Returns false if the counter doesn't exist, or an error if the operation fails.
+func (ps *PGStorage) ResetCounter(ctx context.Context, name string) (bool, error) {
+	return retryValue(ctx, ps, func() (bool, error) { return ps.resetCounterOnce(ctx, name) })
+}
+
+func (ps *PGStorage) resetCounterOnce(ctx context.Context, name string) (bool, error) {
+	res, err := ps.db.ExecContext(ctx,
+		`update metrics set "delta" = 0 where "name" = $1 and "type" = $2`, name, string(entities.MetricCounter))
+	if err != nil {
+		ps.logger.Error("counter reset failed", zap.Error(err))
+		return false, err
+	}
+	updated, err := res.RowsAffected()
+	return updated > 0, err
+}
+
+// Append adds samples to the metric series, a sample replaces the one with the same key and time.
+// Returns an error if the operation fails.
+func (ps *PGStorage) Append(ctx context.Context, samples ...entities.Sample) error {
+	return ps.retry(ctx, func() error { return ps.appendOnce(ctx, samples...) })
+}
+
+func (ps *PGStorage) appendOnce(ctx context.Context, samples ...entities.Sample) error {
+	if len(samples) == 0 {
 		return nil
 	}
-	ps.migrationUp = true
 
+	// a row can't be upserted twice by one statement, the latest sample wins
+	type sampleKey struct {
+		key entities.MetricsKey
+		ts  int64
+	}
+	index := make(map[sampleKey]int, len(samples))
+	names := make([]string, 0, len(samples))
+	types := make([]string, 0, len(samples))
+	times := make([]time.Time, 0, len(samples))
+	values := make([]float64, 0, len(samples))
+	for _, s := range samples {
+		k := sampleKey{key: s.MetricsKey, ts: s.Time.UnixNano()}
+		if i, ok := index[k]; ok {
+			values[i] = s.Value
+			continue
+		}
+		index[k] = len(names)
+		names = append(names, s.Name)
+		types = append(types, string(s.Type))
+		times = append(times, s.Time)
+		values = append(values, s.Value)
+	}
 	_, err := ps.db.ExecContext(ctx, `
-create table if not exists metrics (
-    "name" text not null,
-    "type" text not null,
-    "delta" bigint,
-    "value" double precision,
-    primary key ("name", "type")
-);
-	`)
+		insert into history ("name", "type", "time", "value")
+		select * from unnest($1::text[], $2::text[], $3::timestamptz[], $4::double precision[])
+		on conflict ("name", "type", "time") do update set "value" = excluded."value"`,
+		names, types, times, values)
 	if err != nil {
+		ps.logger.Error("history append failed", zap.Error(err))
+	}
+	return err
+}
+
+// Range returns points of the metric between from and to inclusively ordered by time.
+// Returns an error if the operation fails.
+func (ps *PGStorage) Range(
+	ctx context.Context,
+	key entities.MetricsKey,
+	from time.Time,
+	to time.Time,
+) ([]entities.Point, error) {
+	return retryValue(ctx, ps, func() ([]entities.Point, error) { return ps.rangeOnce(ctx, key, from, to) })
+}
+
+func (ps *PGStorage) rangeOnce(
+	ctx context.Context,
+	key entities.MetricsKey,
+	from time.Time,
+	to time.Time,
+) ([]entities.Point, error) {
+	var points []point
+	err := ps.db.SelectContext(ctx, &points, `
+		select "time", "value" from history
+		where "name" = $1 and "type" = $2 and "time" >= $3 and "time" <= $4
+		order by "time"`,
+		key.Name, string(key.Type), from, to)
+	if err != nil {
+		ps.logger.Error("history range query failed", zap.Error(err))
+		return nil, err
+	}
+
+	result := make([]entities.Point, 0, len(points))
+	for _, p := range points {
+		result = append(result, entities.Point{Time: p.Time, Value: p.Value})
+	}
+	return result, nil
+}
+
+// Rollup aggregates points of the source resolution within [from, to) into rollups of the resolution,
+// replacing existing rollups of the same buckets. Returns the number of built rollups or an error if the operation fails.
+func (ps *PGStorage) Rollup(
+	ctx context.Context,
+	source time.Duration,
+	resolution time.Duration,
+	from time.Time,
+	to time.Time,
+) (int, error) {
+	return retryValue(ctx, ps, func() (int, error) { return ps.rollupOnce(ctx, source, resolution, from, to) })
+}
+
+func (ps *PGStorage) rollupOnce(
+	ctx context.Context,
+	source time.Duration,
+	resolution time.Duration,
+	from time.Time,
+	to time.Time,
+) (int, error) {
+	const upsert = `
+		on conflict ("name", "type", "resolution", "time")
+		    do update
+		    	set "min" = excluded."min",
+		    	    "max" = excluded."max",
+		    	    "sum" = excluded."sum",
+		    	    "last" = excluded."last",
+		    	    "count" = excluded."count"`
+	seconds := int64(resolution / time.Second)
+	var res sql.Result
+	var err error
+	if source == 0 {
+		res, err = ps.db.ExecContext(ctx, `
+		insert into rollups ("name", "type", "resolution", "time", "min", "max", "sum", "last", "count")
+		select "name", "type", $1::bigint, to_timestamp(floor(extract(epoch from "time") / $1) * $1) as "bucket",
+		       min("value"), max("value"), sum("value"), (array_agg("value" order by "time" desc))[1], count(*)
+		from history
+		where "time" >= $2 and "time" < $3
+		group by "name", "type", "bucket"`+upsert,
+			seconds, from, to)
+	} else {
+		res, err = ps.db.ExecContext(ctx, `
+		insert into rollups ("name", "type", "resolution", "time", "min", "max", "sum", "last", "count")
+		select "name", "type", $1::bigint, to_timestamp(floor(extract(epoch from "time") / $1) * $1) as "bucket",
+		       min("min"), max("max"), sum("sum"), (array_agg("last" order by "time" desc))[1], sum("count")
+		from rollups
+		where "resolution" = $4 and "time" >= $2 and "time" < $3
+		group by "name", "type", "bucket"`+upsert,
+			seconds, from, to, int64(source/time.Second))
+	}
+	if err != nil {
+		ps.logger.Error("history rollup failed", zap.Error(err))
+		return 0, err
+	}
+	built, err := res.RowsAffected()
+	return int(built), err
+}
+
+// RangeRollups returns rollups of the metric starting between from and to inclusively ordered by time.
+// Returns an error if the operation fails.
+func (ps *PGStorage) RangeRollups(
+	ctx context.Context,
+	key entities.MetricsKey,
+	resolution time.Duration,
+	from time.Time,
+	to time.Time,
+) ([]entities.Rollup, error) {
+	return retryValue(ctx, ps, func() ([]entities.Rollup, error) {
+		return ps.rangeRollupsOnce(ctx, key, resolution, from, to)
+	})
+}
+
+func (ps *PGStorage) rangeRollupsOnce(
+	ctx context.Context,
+	key entities.MetricsKey,
+	resolution time.Duration,
+	from time.Time,
+	to time.Time,
+) ([]entities.Rollup, error) {
+	var rows []rollup
+	err := ps.db.SelectContext(ctx, &rows, `
+		select "time", "min", "max", "sum", "last", "count" from rollups
+		where "name" = $1 and "type" = $2 and "resolution" = $3 and "time" >= $4 and "time" <= $5
+		order by "time"`,
+		key.Name, string(key.Type), int64(resolution/time.Second), from, to)
+	if err != nil {
+		ps.logger.Error("history rollups query failed", zap.Error(err))
+		return nil, err
+	}
+
+	result := make([]entities.Rollup, 0, len(rows))
+	for _, r := range rows {
+		result = append(result, entities.Rollup{
+			MetricsKey: key,
+			Time:       r.Time,
+			Min:        r.Min,
+			Max:        r.Max,
+			Sum:        r.Sum,
+			Last:       r.Last,
+			Count:      uint64(r.Count),
+		})
+	}
+	return result, nil
+}
+
+// Truncate deletes points of the resolution before the time, zero resolution means raw points.
+// Returns the number of deleted points or an error if the operation fails.
+func (ps *PGStorage) Truncate(ctx context.Context, resolution time.Duration, before time.Time) (int, error) {
+	return retryValue(ctx, ps, func() (int, error) { return ps.truncateOnce(ctx, resolution, before) })
+}
+
+func (ps *PGStorage) truncateOnce(ctx context.Context, resolution time.Duration, before time.Time) (int, error) {
+	var res sql.Result
+	var err error
+	if resolution == 0 {
+		res, err = ps.db.ExecContext(ctx, `delete from history where "time" < $1`, before)
+	} else {
+		res, err = ps.db.ExecContext(ctx, `delete from rollups where "resolution" = $1 and "time" < $2`,
+			int64(resolution/time.Second), before)
+	}
+	if err != nil {
+		ps.logger.Error("history truncation failed", zap.Error(err))
+		return 0, err
+	}
+	deleted, err := res.RowsAffected()
+	return int(deleted), err
+}
+
+// SetMeta creates or replaces metadata of a metric name.
+func (ps *PGStorage) SetMeta(ctx context.Context, meta entities.Metadata) error {
+	return ps.retry(ctx, func() error { return ps.setMetaOnce(ctx, meta) })
+}
+
+func (ps *PGStorage) setMetaOnce(ctx context.Context, meta entities.Metadata) error {
+	m := toMetadata(meta)
+	_, err := ps.db.NamedExecContext(ctx, `
+		insert into metadata ("name", "type", "unit", "description", "owner")
+		values (:name, :type, :unit, :description, :owner)
+		on conflict ("name")
+		    do update
+		    	set "type" = excluded."type",
+		    	    "unit" = excluded."unit",
+		    	    "description" = excluded."description",
+		    	    "owner" = excluded."owner";`, m)
+	return err
+}
+
+// GetMeta returns metadata of the registered names.
+func (ps *PGStorage) GetMeta(ctx context.Context, names ...string) ([]entities.Metadata, error) {
+	return retryValue(ctx, ps, func() ([]entities.Metadata, error) { return ps.getMetaOnce(ctx, names...) })
+}
+
+func (ps *PGStorage) getMetaOnce(ctx context.Context, names ...string) ([]entities.Metadata, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	var metas []metadata
+	err := ps.db.SelectContext(ctx, &metas,
+		`select "name", "type", "unit", "description", "owner" from metadata where "name" = any($1)`, names)
+	if err != nil {
+		return nil, err
+	}
+	return toMetadataEntities(metas), nil
+}
+
+// AllMeta returns all registered metadata ordered by name.
+func (ps *PGStorage) AllMeta(ctx context.Context) ([]entities.Metadata, error) {
+	return retryValue(ctx, ps, func() ([]entities.Metadata, error) { return ps.allMetaOnce(ctx) })
+}
+
+func (ps *PGStorage) allMetaOnce(ctx context.Context) ([]entities.Metadata, error) {
+	var metas []metadata
+	err := ps.db.SelectContext(ctx, &metas,
+		`select "name", "type", "unit", "description", "owner" from metadata order by "name"`)
+	if err != nil {
+		return nil, err
+	}
+	return toMetadataEntities(metas), nil
+}
+
+// Backup returns all metrics and metadata read within a single repeatable read transaction,
+// so the backup is consistent under concurrent writes.
+func (ps *PGStorage) Backup(ctx context.Context) (entities.Backup, error) {
+	return retryValue(ctx, ps, func() (entities.Backup, error) { return ps.backupOnce(ctx) })
+}
+
+func (ps *PGStorage) backupOnce(ctx context.Context) (backup entities.Backup, err error) {
+	tx, err := ps.db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return backup, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var metrics []metric
+	err = tx.SelectContext(ctx, &metrics, `select "name", "type", "delta", "value", "histogram", "summary", "set", "updated_at", "received_at", "total" from metrics order by "name", "type"`)
+	if err != nil {
+		return backup, err
+	}
+	var metas []metadata
+	err = tx.SelectContext(ctx, &metas, `select "name", "type", "unit", "description", "owner" from metadata order by "name"`)
+	if err != nil {
+		return backup, err
+	}
+	if err = tx.Commit(); err != nil {
+		return backup, err
+	}
+
+	backup.Metrics = make([]entities.Metric, 0, len(metrics))
+	for _, v := range metrics {
+		entity, err := v.toEntity()
+		if err != nil {
+			return backup, err
+		}
+		backup.Metrics = append(backup.Metrics, entity)
+	}
+	backup.Metadata = toMetadataEntities(metas)
+	return backup, nil
+}
+
+// Restore replaces all metrics and metadata with the backup ones within a single transaction.
+func (ps *PGStorage) Restore(ctx context.Context, backup entities.Backup) error {
+	return ps.retry(ctx, func() error { return ps.restoreOnce(ctx, backup) })
+}
+
+func (ps *PGStorage) restoreOnce(ctx context.Context, backup entities.Backup) error {
+	tx, err := ps.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err = ps.restore(ctx, tx, backup); err != nil {
+		ps.logger.Error("restore failed", zap.Error(err))
+		return errors.Join(tx.Rollback(), err)
+	}
+	return tx.Commit()
+}
+
+func (ps *PGStorage) restore(ctx context.Context, tx *sql.Tx, backup entities.Backup) error {
+	if _, err := tx.ExecContext(ctx, `delete from metrics; delete from metadata;`); err != nil {
+		return err
+	}
+	if len(backup.Metrics) != 0 {
+		if err := ps.set(ctx, tx, backup.Metrics); err != nil {
+			return err
+		}
+	}
+	for _, meta := range backup.Metadata {
+		m := toMetadata(meta)
+		_, err := tx.ExecContext(ctx,
+			`insert into metadata ("name", "type", "unit", "description", "owner") values ($1, $2, $3, $4, $5)`,
+			m.Name, m.Type, m.Unit, m.Description, m.Owner)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ps *PGStorage) migrate(ctx context.Context, skip bool) error {
+	migrator, err := NewPGMigrator(ps.logger, ps.db)
+	if err != nil {
+		return err
+	}
+	if skip {
+		return migrator.Check(ctx)
+	}
+	if err = migrator.Up(ctx); err != nil {
 		ps.logger.Error("migration failed", zap.Error(err))
 		return err
 	}
@@ -163,11 +780,52 @@ create table if not exists metrics (
 	return nil
 }
 
-type metric struct {
-	Name  string          `db:"name"`
-	Type  string          `db:"type"`
-	Delta sql.NullInt64   `db:"delta"`
-	Value sql.NullFloat64 `db:"value"`
+type (
+	metric struct {
+		Name       string          `db:"name"`
+		Type       string          `db:"type"`
+		Delta      sql.NullInt64   `db:"delta"`
+		Value      sql.NullFloat64 `db:"value"`
+		Histogram  []byte          `db:"histogram"`
+		Summary    []byte          `db:"summary"`
+		Set        []byte          `db:"set"`
+		UpdatedAt  sql.NullTime    `db:"updated_at"`
+		ReceivedAt sql.NullTime    `db:"received_at"`
+		Total      sql.NullInt64   `db:"total"`
+	}
+	point struct {
+		Time  time.Time `db:"time"`
+		Value float64   `db:"value"`
+	}
+	rollup struct {
+		Time  time.Time `db:"time"`
+		Min   float64   `db:"min"`
+		Max   float64   `db:"max"`
+		Sum   float64   `db:"sum"`
+		Last  float64   `db:"last"`
+		Count int64     `db:"count"`
+	}
+	histogram struct {
+		Bounds []float64 `json:"bounds"`
+		Counts []uint64  `json:"counts"`
+		Sum    float64   `json:"sum"`
+		Count  uint64    `json:"count"`
+	}
+	summary struct {
+		Alpha    float64          `json:"alpha"`
+		Positive map[int32]uint64 `json:"positive,omitempty"`
+		Negative map[int32]uint64 `json:"negative,omitempty"`
+		Zero     uint64           `json:"zero,omitempty"`
+		Count    uint64           `json:"count"`
+		Sum      float64          `json:"sum"`
+		Min      float64          `json:"min"`
+		Max      float64          `json:"max"`
+	}
+)
+
+// empty reports whether the metric has no value, i.e. it's a row just inserted to be locked.
+func (m *metric) empty() bool {
+	return !m.Delta.Valid && !m.Value.Valid && m.Histogram == nil && m.Summary == nil && m.Set == nil
 }
 
 func (m *metric) toEntity() (result entities.Metric, err error) {
@@ -184,6 +842,91 @@ func (m *metric) toEntity() (result entities.Metric, err error) {
 	if m.Value.Valid {
 		result.Value = &m.Value.Float64
 	}
+	if m.Total.Valid {
+		result.Total = &m.Total.Int64
+	}
+	if m.UpdatedAt.Valid {
+		result.Timestamp = m.UpdatedAt.Time
+	}
+	if m.ReceivedAt.Valid {
+		result.ReceivedAt = m.ReceivedAt.Time
+	}
+	if m.Histogram != nil {
+		h := histogram{}
+		if err = json.Unmarshal(m.Histogram, &h); err != nil {
+			return result, err
+		}
+		result.Histogram = &entities.Histogram{
+			Bounds: h.Bounds,
+			Counts: h.Counts,
+			Sum:    h.Sum,
+			Count:  h.Count,
+		}
+	}
+	if m.Summary != nil {
+		s := summary{}
+		if err = json.Unmarshal(m.Summary, &s); err != nil {
+			return result, err
+		}
+		es := entities.Summary(s)
+		result.Summary = &es
+	}
+	if m.Set != nil {
+		// precision is implied by the number of registers
+		s := &entities.Set{Precision: uint8(bits.TrailingZeros(uint(len(m.Set)))), Registers: m.Set}
+		if err = s.Validate(); err != nil {
+			return result, err
+		}
+		result.Set = s
+	}
 
 	return result, nil
 }
+
+// marshalHistogram returns the JSON representation of h, or nil if h is nil.
+func marshalHistogram(h *entities.Histogram) ([]byte, error) {
+	if h == nil {
+		return nil, nil
+	}
+	return json.Marshal(histogram{
+		Bounds: h.Bounds,
+		Counts: h.Counts,
+		Sum:    h.Sum,
+		Count:  h.Count,
+	})
+}
+
+// marshalSummary returns the JSON representation of s, or nil if s is nil.
+func marshalSummary(s *entities.Summary) ([]byte, error) {
+	if s == nil {
+		return nil, nil
+	}
+	return json.Marshal(summary(*s))
+}
+
+func toMetadataEntities(metas []metadata) []entities.Metadata {
+	result := make([]entities.Metadata, 0, len(metas))
+	for _, v := range metas {
+		result = append(result, v.toEntity())
+	}
+	return result
+}
+
+// likePattern converts the name pattern to an SQL LIKE pattern with '\' as the escape character.
+func likePattern(pattern entities.NamePattern) string {
+	var sb strings.Builder
+	for _, r := range string(pattern) {
+		switch r {
+		case '*':
+			sb.WriteRune('%')
+		case '?':
+			sb.WriteRune('_')
+		case '%', '_', '\\':
+			sb.WriteRune('\\')
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/dlomanov/mon/internal/infra/storage/internal/migrate"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// ErrSchemaOutdated is returned when the database schema lacks migrations the PGStorage relies on.
+var ErrSchemaOutdated = errors.New("database schema is outdated")
+
+// PGMigrator applies PGStorage schema migrations embedded into the binary.
+type PGMigrator struct {
+	internal *migrate.Migrator
+}
+
+// NewPGMigrator creates a PGMigrator of the database.
+func NewPGMigrator(logger *zap.Logger, db *sqlx.DB) (*PGMigrator, error) {
+	dir, err := fs.Sub(migrationsFS, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := migrate.Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &PGMigrator{internal: migrate.New(logger, db.DB, migrations)}, nil
+}
+
+// Up applies all pending migrations.
+func (m *PGMigrator) Up(ctx context.Context) error {
+	return m.internal.Up(ctx)
+}
+
+// Down reverts the given number of latest applied migrations.
+func (m *PGMigrator) Down(ctx context.Context, steps int) error {
+	return m.internal.Down(ctx, steps)
+}
+
+// To migrates the schema up or down to the version, zero reverts all migrations.
+func (m *PGMigrator) To(ctx context.Context, version int64) error {
+	return m.internal.To(ctx, version)
+}
+
+// Version returns the applied schema version and the latest known one.
+func (m *PGMigrator) Version(ctx context.Context) (current, latest int64, err error) {
+	current, err = m.internal.Version(ctx)
+	return current, m.internal.Latest(), err
+}
+
+// Check returns ErrSchemaOutdated if there are pending migrations.
+func (m *PGMigrator) Check(ctx context.Context) error {
+	pending, err := m.internal.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pending) != 0 {
+		return fmt.Errorf("%w: %d migrations are pending, the first is %d_%s",
+			ErrSchemaOutdated, len(pending), pending[0].Version, pending[0].Name)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dlomanov/mon/internal/entities/apperrors"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+// SQLSTATEs of errors that are likely to succeed if the operation is retried.
+const (
+	classConnectionException = "08"
+	codeSerializationFailure = "40001"
+	codeDeadlockDetected     = "40P01"
+	codeTooManyConnections   = "53300"
+	codeCannotConnectNow     = "57P03"
+	codeAdminShutdown        = "57P01"
+)
+
+const (
+	defaultPGRetries           = 3
+	defaultPGRetryDelay        = 100 * time.Millisecond
+	defaultPGRetryMaxDelay     = time.Second
+	transientPGErrorRetryAfter = time.Second
+)
+
+// pgRetry defines how many times and how often operations failed with transient errors are retried.
+type pgRetry struct {
+	retries  int           // retries is the number of retries after the first attempt.
+	delay    time.Duration // delay before the first retry, doubled on every next one.
+	maxDelay time.Duration // maxDelay caps the delay between retries.
+}
+
+func defaultPGRetry() pgRetry {
+	return pgRetry{
+		retries:  defaultPGRetries,
+		delay:    defaultPGRetryDelay,
+		maxDelay: defaultPGRetryMaxDelay,
+	}
+}
+
+// isTransient reports whether the error is caused by a connection failure, a serialization failure,
+// a deadlock or a server overload, so the operation may succeed if retried.
+func isTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case codeSerializationFailure,
+			codeDeadlockDetected,
+			codeTooManyConnections,
+			codeCannotConnectNow,
+			codeAdminShutdown:
+			return true
+		}
+		return strings.HasPrefix(pgErr.Code, classConnectionException)
+	}
+
+	var connectErr *pgconn.ConnectError
+	return errors.As(err, &connectErr) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		safeToRetry(err)
+}
+
+// safeToRetry is pgconn.SafeToRetry of wrapped errors.
+func safeToRetry(err error) bool {
+	var e interface{ SafeToRetry() bool }
+	return errors.As(err, &e) && e.SafeToRetry()
+}
+
+// commitError is returned by non-idempotent operations if the commit of their transaction fails.
+// The transaction may have been committed anyway, e.g. if the connection is lost before the reply,
+// so such operations are retried only if nothing was sent to the server.
+type commitError struct {
+	err error
+}
+
+func (e *commitError) Error() string {
+	return fmt.Sprintf("commit failed: %s", e.err)
+}
+
+func (e *commitError) Unwrap() error {
+	return e.err
+}
+
+// isRetryable reports whether the transient error is safe to retry.
+func isRetryable(err error) bool {
+	var commitErr *commitError
+	return !errors.As(err, &commitErr) || safeToRetry(err)
+}
+
+// retry runs the operation until it succeeds, fails with a non-transient error or retries are exhausted.
+// The operation is run as a whole, so a transaction is retried from its beginning.
+// A failed commit is retried only if it's known to be not applied, see commitError,
+// otherwise it's returned as apperrors.AppErrorInternal, so clients don't retry it either.
+// Transient errors left after retries are returned as apperrors.AppErrorTransient.
+func (ps *PGStorage) retry(ctx context.Context, op func() error) error {
+	delay := ps.retryPolicy.delay
+	for attempt := 0; ; attempt++ {
+		err := op()
+		if !isTransient(err) {
+			return err
+		}
+		if !isRetryable(err) {
+			return fmt.Errorf("%w: %w", apperrors.NewInternal("database commit may have been applied"), err)
+		}
+		if attempt >= ps.retryPolicy.retries {
+			return fmt.Errorf("%w: %w",
+				apperrors.NewTransient("database is temporarily unavailable", transientPGErrorRetryAfter), err)
+		}
+
+		ps.logger.Warn("transient database error, retrying",
+			zap.Int("attempt", attempt+1),
+			zap.Duration("delay", delay),
+			zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w",
+				apperrors.NewTransient("database is temporarily unavailable", transientPGErrorRetryAfter), err)
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, ps.retryPolicy.maxDelay)
+	}
+}
+
+// retryValue is retry for operations returning a value.
+func retryValue[T any](ctx context.Context, ps *PGStorage, op func() (T, error)) (result T, err error) {
+	err = ps.retry(ctx, func() (err error) {
+		result, err = op()
+		return err
+	})
+	return result, err
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dlomanov/mon/internal/entities/apperrors"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "connection failure", err: &pgconn.PgError{Code: "08006"}, want: true},
+		{name: "serialization failure", err: &pgconn.PgError{Code: "40001"}, want: true},
+		{name: "deadlock", err: &pgconn.PgError{Code: "40P01"}, want: true},
+		{name: "too many connections", err: &pgconn.PgError{Code: "53300"}, want: true},
+		{name: "wrapped", err: fmt.Errorf("query failed: %w", &pgconn.PgError{Code: "40P01"}), want: true},
+		{name: "unique violation", err: &pgconn.PgError{Code: "23505"}, want: false},
+		{name: "numeric out of range", err: &pgconn.PgError{Code: "22003"}, want: false},
+		{name: "canceled", err: context.Canceled, want: false},
+		{name: "deadline exceeded", err: fmt.Errorf("query failed: %w", context.DeadlineExceeded), want: false},
+		{name: "other", err: errors.New("boom"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isTransient(tt.err))
+		})
+	}
+}
+
+func TestPGStorage_retry(t *testing.T) {
+	ps := &PGStorage{
+		logger:      zaptest.NewLogger(t),
+		retryPolicy: pgRetry{retries: 2, delay: time.Millisecond, maxDelay: time.Millisecond},
+	}
+	ctx := context.Background()
+	deadlock := &pgconn.PgError{Code: "40P01"}
+
+	t.Run("succeeds after transient errors", func(t *testing.T) {
+		calls := 0
+		err := ps.retry(ctx, func() error {
+			calls++
+			if calls < 3 {
+				return deadlock
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("gives up after retries", func(t *testing.T) {
+		calls := 0
+		err := ps.retry(ctx, func() error {
+			calls++
+			return deadlock
+		})
+		assert.Equal(t, 3, calls)
+		var errTransient *apperrors.AppErrorTransient
+		require.ErrorAs(t, err, &errTransient)
+		assert.Positive(t, errTransient.RetryAfter)
+		assert.ErrorIs(t, err, deadlock)
+	})
+
+	t.Run("doesn't retry other errors", func(t *testing.T) {
+		calls := 0
+		want := &pgconn.PgError{Code: "23505"}
+		err := ps.retry(ctx, func() error {
+			calls++
+			return want
+		})
+		assert.Equal(t, 1, calls)
+		assert.ErrorIs(t, err, want)
+		var errTransient *apperrors.AppErrorTransient
+		assert.False(t, errors.As(err, &errTransient))
+	})
+
+	t.Run("doesn't retry failed commits", func(t *testing.T) {
+		calls := 0
+		err := ps.retry(ctx, func() error {
+			calls++
+			return &commitError{err: &pgconn.PgError{Code: "08006"}}
+		})
+		assert.Equal(t, 1, calls)
+		var errTransient *apperrors.AppErrorTransient
+		assert.False(t, errors.As(err, &errTransient))
+		var errInternal *apperrors.AppErrorInternal
+		assert.ErrorAs(t, err, &errInternal)
+	})
+
+	t.Run("retries commits not sent", func(t *testing.T) {
+		calls := 0
+		err := ps.retry(ctx, func() error {
+			calls++
+			if calls < 2 {
+				return &commitError{err: notSentError{}}
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("stops when context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		calls := 0
+		err := ps.retry(ctx, func() error {
+			calls++
+			return deadlock
+		})
+		assert.Equal(t, 1, calls)
+		var errTransient *apperrors.AppErrorTransient
+		assert.ErrorAs(t, err, &errTransient)
+	})
+}
+
+// notSentError is an error occurred before anything was sent to the server.
+type notSentError struct{}
+
+func (notSentError) Error() string     { return "connection refused" }
+func (notSentError) SafeToRetry() bool { return true }
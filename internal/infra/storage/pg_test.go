@@ -95,6 +95,146 @@ func (s *TestSuit) TestPGStorage() {
 	require.Len(s.T(), metrics, 1, "invalid metrics length")
 }
 
+func (s *TestSuit) TestPGBackup() {
+	db, err := storage.NewPGStorage(s.ctx, s.logger, s.db)
+	require.NoError(s.T(), err)
+
+	gauge := func(name string, v float64) entities.Metric {
+		return entities.Metric{MetricsKey: entities.MetricsKey{Type: entities.MetricGauge, Name: name}, Value: &v}
+	}
+	require.NoError(s.T(), db.Set(s.ctx, gauge("backup_a", 1), gauge("backup_b", 2)))
+	require.NoError(s.T(), db.SetMeta(s.ctx, entities.Metadata{Name: "backup_a", Unit: "bytes"}))
+
+	// Test Backup
+	backup, err := db.Backup(s.ctx)
+	require.NoError(s.T(), err, "failed to backup")
+	require.Len(s.T(), backup.Metrics, 2, "invalid metrics length")
+	require.Len(s.T(), backup.Metadata, 1, "invalid metadata length")
+
+	// Test Restore replaces everything
+	require.NoError(s.T(), db.Set(s.ctx, gauge("backup_a", 10), gauge("backup_c", 3)))
+	require.NoError(s.T(), db.Restore(s.ctx, backup), "failed to restore")
+	metrics, err := db.All(s.ctx)
+	require.NoError(s.T(), err)
+	values := make(map[string]float64)
+	for _, m := range metrics {
+		values[m.Name] = *m.Value
+	}
+	require.Equal(s.T(), map[string]float64{"backup_a": 1, "backup_b": 2}, values)
+
+	require.NoError(s.T(), db.Restore(s.ctx, entities.Backup{}), "failed to restore empty backup")
+	metas, err := db.AllMeta(s.ctx)
+	require.NoError(s.T(), err)
+	require.Empty(s.T(), metas)
+}
+
+func (s *TestSuit) TestPGMigrations() {
+	_, err := storage.NewPGStorage(s.ctx, s.logger, s.db)
+	require.NoError(s.T(), err)
+	migrator, err := storage.NewPGMigrator(s.logger, s.db)
+	require.NoError(s.T(), err)
+
+	current, latest, err := migrator.Version(s.ctx)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), latest, current, "schema should be migrated on start")
+
+	// Test Down
+	require.NoError(s.T(), migrator.Down(s.ctx, 1), "failed to revert migration")
+	current, _, err = migrator.Version(s.ctx)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), latest-1, current, "invalid version after down")
+	_, err = storage.NewPGStorage(s.ctx, s.logger, s.db, storage.SkipMigration())
+	require.ErrorIs(s.T(), err, storage.ErrSchemaOutdated, "outdated schema should be rejected")
+
+	// Test To and concurrent Up
+	require.NoError(s.T(), migrator.To(s.ctx, 0), "failed to revert all migrations")
+	errs := make(chan error, 3)
+	for i := 0; i < cap(errs); i++ {
+		go func() { errs <- migrator.Up(s.ctx) }()
+	}
+	for i := 0; i < cap(errs); i++ {
+		require.NoError(s.T(), <-errs, "failed to apply migrations")
+	}
+	_, err = storage.NewPGStorage(s.ctx, s.logger, s.db, storage.SkipMigration())
+	require.NoError(s.T(), err)
+}
+
+func (s *TestSuit) TestPGUpdate() {
+	db, err := storage.NewPGStorage(s.ctx, s.logger, s.db)
+	require.NoError(s.T(), err)
+	testUpdate(s.T(), db)
+
+	// cumulative totals are derived from the locked previous total
+	key := entities.MetricsKey{Type: entities.MetricCounter, Name: "cumulative"}
+	total := func(v int64, sec int) entities.Metric {
+		return entities.Metric{MetricsKey: key, Total: &v, Timestamp: time.Unix(int64(sec), 0)}
+	}
+	result, err := db.Update(s.ctx, entities.OverflowError, total(5, 1), total(8, 2), total(2, 3))
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), int64(10), *result[2].Delta, "invalid cumulative counter value")
+	require.Equal(s.T(), int64(2), *result[2].Total, "invalid cumulative counter total")
+	got, ok, err := db.Get(s.ctx, key)
+	require.NoError(s.T(), err)
+	require.True(s.T(), ok)
+	require.Equal(s.T(), int64(10), *got.Delta)
+}
+
+func (s *TestSuit) TestPGHistory() {
+	db, err := storage.NewPGStorage(s.ctx, s.logger, s.db)
+	require.NoError(s.T(), err)
+
+	key := entities.MetricsKey{Type: entities.MetricGauge, Name: "HeapInuse"}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sample := func(sec int, value float64) entities.Sample {
+		return entities.Sample{MetricsKey: key, Point: entities.Point{Time: start.Add(time.Duration(sec) * time.Second), Value: value}}
+	}
+
+	// Test Append, the same time is replaced
+	err = db.Append(s.ctx, sample(2, 2), sample(1, 1), sample(2, 20))
+	require.NoError(s.T(), err, "failed to append history")
+
+	// Test Range
+	points, err := db.Range(s.ctx, key, start, start.Add(time.Minute))
+	require.NoError(s.T(), err, "failed to get history")
+	require.Len(s.T(), points, 2, "invalid points length")
+	require.True(s.T(), points[0].Time.Equal(start.Add(time.Second)), "invalid point order")
+	require.Equal(s.T(), 20.0, points[1].Value, "invalid point value")
+}
+
+func (s *TestSuit) TestPGRollups() {
+	db, err := storage.NewPGStorage(s.ctx, s.logger, s.db)
+	require.NoError(s.T(), err)
+
+	key := entities.MetricsKey{Type: entities.MetricGauge, Name: "Rolled"}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration, value float64) entities.Sample {
+		return entities.Sample{MetricsKey: key, Point: entities.Point{Time: start.Add(d), Value: value}}
+	}
+	err = db.Append(s.ctx, at(10*time.Second, 1), at(20*time.Second, 3), at(70*time.Second, 5))
+	require.NoError(s.T(), err, "failed to append history")
+
+	// Test Rollup
+	built, err := db.Rollup(s.ctx, 0, time.Minute, start, start.Add(2*time.Minute))
+	require.NoError(s.T(), err, "failed to roll up history")
+	require.Equal(s.T(), 2, built, "invalid rollups count")
+	built, err = db.Rollup(s.ctx, time.Minute, time.Hour, start, start.Add(time.Hour))
+	require.NoError(s.T(), err, "failed to roll up history")
+	require.Equal(s.T(), 1, built, "invalid rollups count")
+
+	// Test RangeRollups
+	rollups, err := db.RangeRollups(s.ctx, key, time.Hour, start, start.Add(time.Hour))
+	require.NoError(s.T(), err, "failed to get rollups")
+	require.Len(s.T(), rollups, 1, "invalid rollups length")
+	require.Equal(s.T(), 9.0, rollups[0].Sum, "invalid rollup sum")
+	require.Equal(s.T(), 5.0, rollups[0].Last, "invalid rollup last")
+	require.Equal(s.T(), uint64(3), rollups[0].Count, "invalid rollup count")
+
+	// Test Truncate
+	deleted, err := db.Truncate(s.ctx, time.Minute, start.Add(time.Minute))
+	require.NoError(s.T(), err, "failed to truncate rollups")
+	require.Equal(s.T(), 1, deleted, "invalid deleted count")
+}
+
 func createPosgres(t *testing.T, dsn string) (*postgres.PostgresContainer, string) {
 	values := strings.Split(dsn, " ")
 	require.NotEmpty(t, values, "failed to parse database uri")